@@ -0,0 +1,168 @@
+package all_minilm_l6_v2
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"sync"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// Adapter is a linear projection applied on top of the embeddings of a
+// model, typically trained with TrainAdapter to improve retrieval in a
+// domain. Its outputs are normalized to unit length, so that cosine
+// similarity and dot product agree on them.
+//
+// An Adapter is immutable and safe for concurrent use.
+type Adapter struct {
+	in, out int
+	// weights holds out rows of in coefficients.
+	weights []float32
+
+	fingerprintOnce sync.Once
+	fingerprintSum  [32]byte
+}
+
+// NewAdapter returns an adapter projecting vectors with weights, a matrix of
+// one row per output dimension. The weights are copied.
+func NewAdapter(weights [][]float32) (*Adapter, error) {
+	if len(weights) == 0 || len(weights[0]) == 0 {
+		return nil, errors.New("adapter weights must not be empty")
+	}
+	a := &Adapter{in: len(weights[0]), out: len(weights)}
+	for _, row := range weights {
+		if err := checkDimensions(a.in, len(row)); err != nil {
+			return nil, err
+		}
+		a.weights = append(a.weights, row...)
+	}
+	return a, nil
+}
+
+// identityAdapter returns an adapter keeping the first out dimensions of its
+// input.
+func identityAdapter(in, out int) *Adapter {
+	a := &Adapter{in: in, out: out, weights: make([]float32, in*out)}
+	for i := range min(in, out) {
+		a.weights[i*in+i] = 1
+	}
+	return a
+}
+
+// fingerprint returns the SHA-256 of the serialized adapter, computed once.
+func (a *Adapter) fingerprint() [32]byte {
+	a.fingerprintOnce.Do(func() {
+		data, _ := a.MarshalBinary()
+		a.fingerprintSum = sha256.Sum256(data)
+	})
+	return a.fingerprintSum
+}
+
+// InputDim returns the dimension of the vectors the adapter projects.
+func (a *Adapter) InputDim() int { return a.in }
+
+// OutputDim returns the dimension of the projected vectors.
+func (a *Adapter) OutputDim() int { return a.out }
+
+// Weights returns a copy of the projection matrix, one row per output
+// dimension.
+func (a *Adapter) Weights() [][]float32 {
+	rows := make([][]float32, a.out)
+	for i := range rows {
+		rows[i] = append([]float32(nil), a.weights[i*a.in:(i+1)*a.in]...)
+	}
+	return rows
+}
+
+// Transform projects v and normalizes the result.
+func (a *Adapter) Transform(v []float32) ([]float32, error) {
+	if err := checkDimensions(a.in, len(v)); err != nil {
+		return nil, err
+	}
+	out := make([]float32, a.out)
+	for i := range out {
+		out[i] = vecmath.Dot(a.weights[i*a.in:(i+1)*a.in], v)
+	}
+	if norm := vecmath.Norm(out); norm > 0 {
+		for i := range out {
+			out[i] /= norm
+		}
+	}
+	return out, nil
+}
+
+// TransformBatch projects every vector of vs.
+func (a *Adapter) TransformBatch(vs [][]float32) ([][]float32, error) {
+	out := make([][]float32, len(vs))
+	for i, v := range vs {
+		var err error
+		if out[i], err = a.Transform(v); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// A serialized adapter is the magic "MINILMAD", the format version, the input
+// and output dimensions as little-endian uint32, the weights as float32 row
+// by row, and the CRC-32C of all the preceding bytes.
+const (
+	adapterMagic   = "MINILMAD"
+	adapterVersion = 1
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// MarshalBinary encodes the adapter in a versioned binary format.
+func (a *Adapter) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 20+len(a.weights)*4+4)
+	buf = append(buf, adapterMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, adapterVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(a.in))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(a.out))
+	for _, w := range a.weights {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(w))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+	return buf, nil
+}
+
+// UnmarshalBinary decodes an adapter encoded with MarshalBinary.
+func (a *Adapter) UnmarshalBinary(data []byte) error {
+	if len(data) < 24 || string(data[:8]) != adapterMagic {
+		return errors.New("not an adapter")
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, castagnoli) != sum {
+		return errors.New("adapter checksum mismatch")
+	}
+	if v := binary.LittleEndian.Uint32(body[8:]); v != adapterVersion {
+		return fmt.Errorf("unsupported adapter version %d", v)
+	}
+	in := uint64(binary.LittleEndian.Uint32(body[12:]))
+	out := uint64(binary.LittleEndian.Uint32(body[16:]))
+	if in == 0 || out == 0 || uint64(len(body)-20) != in*out*4 {
+		return errors.New("invalid adapter dimensions")
+	}
+
+	*a = Adapter{in: int(in), out: int(out), weights: make([]float32, in*out)}
+	for i := range a.weights {
+		a.weights[i] = math.Float32frombits(binary.LittleEndian.Uint32(body[20+i*4:]))
+	}
+	return nil
+}
+
+// WithAdapter transforms every sentence embedding computed by the model with
+// adapter, whose input dimension must be the dimension of the model output.
+// Adapters are created with NewAdapter, TrainAdapter or UnmarshalBinary, and
+// NewModel rejects an empty one. Outputs other than DefaultOutputName, such
+// as the logits of cross-encoders, are left untransformed.
+func WithAdapter(adapter *Adapter) ModelOption {
+	return func(m *Model) {
+		m.adapter = adapter
+	}
+}
@@ -0,0 +1,174 @@
+package all_minilm_l6_v2_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// topicPairs returns pairs of vectors sharing a random topic in their first
+// half, their second half being noise stronger than the topic, so that raw
+// cosine similarity retrieves the partner of a vector poorly.
+func topicPairs(seed int64, n, dim int) (anchors, positives [][]float32) {
+	rng := rand.New(rand.NewSource(seed))
+	noisy := func(topic []float64) []float32 {
+		v := make([]float32, dim)
+		for d := range v {
+			if d < dim/2 {
+				v[d] = float32(topic[d] + 0.1*rng.NormFloat64())
+			} else {
+				v[d] = float32(2 * rng.NormFloat64())
+			}
+		}
+		return v
+	}
+	for range n {
+		topic := make([]float64, dim/2)
+		for d := range topic {
+			topic[d] = rng.NormFloat64()
+		}
+		anchors = append(anchors, noisy(topic))
+		positives = append(positives, noisy(topic))
+	}
+	return anchors, positives
+}
+
+// recallAt1 returns the share of anchors whose most similar positive is their
+// own.
+func recallAt1(t *testing.T, anchors, positives [][]float32) float64 {
+	t.Helper()
+	neighbors, err := all_minilm_l6_v2.TopK(anchors, positives, 1)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	found := 0
+	for i, n := range neighbors {
+		if n[0].Index == i {
+			found++
+		}
+	}
+	return float64(found) / float64(len(anchors))
+}
+
+func adaptedRecall(t *testing.T, adapter *all_minilm_l6_v2.Adapter, anchors, positives [][]float32) float64 {
+	t.Helper()
+	a, err := adapter.TransformBatch(anchors)
+	if err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+	p, _ := adapter.TransformBatch(positives)
+	return recallAt1(t, a, p)
+}
+
+func TestTrainAdapterMNRL(t *testing.T) {
+	anchors, positives := topicPairs(1, 400, 16)
+	var triplets []all_minilm_l6_v2.Triplet
+	for i := range anchors {
+		triplets = append(triplets, all_minilm_l6_v2.Triplet{Anchor: anchors[i], Positive: positives[i]})
+	}
+	testAnchors, testPositives := topicPairs(2, 100, 16)
+
+	before := recallAt1(t, testAnchors, testPositives)
+	adapter, err := all_minilm_l6_v2.TrainAdapter(triplets,
+		all_minilm_l6_v2.WithAdapterEpochs(20), all_minilm_l6_v2.WithAdapterLearningRate(0.01))
+	if err != nil {
+		t.Fatalf("Failed to train adapter: %v", err)
+	}
+	after := adaptedRecall(t, adapter, testAnchors, testPositives)
+	if before > 0.6 || after < 0.95 {
+		t.Errorf("Expected the adapter to improve recall on unseen topics, got %f before and %f after", before, after)
+	}
+}
+
+func TestTrainAdapterContrastive(t *testing.T) {
+	anchors, positives := topicPairs(3, 300, 16)
+	var pairs []all_minilm_l6_v2.TrainingPair
+	for i := range anchors {
+		pairs = append(pairs,
+			all_minilm_l6_v2.TrainingPair{A: anchors[i], B: positives[i], Similar: true},
+			all_minilm_l6_v2.TrainingPair{A: anchors[i], B: positives[(i+1)%len(positives)]})
+	}
+	testAnchors, testPositives := topicPairs(4, 100, 16)
+
+	adapter, err := all_minilm_l6_v2.TrainContrastiveAdapter(pairs,
+		all_minilm_l6_v2.WithAdapterEpochs(20), all_minilm_l6_v2.WithAdapterLearningRate(0.01),
+		all_minilm_l6_v2.WithAdapterOutputDim(8))
+	if err != nil {
+		t.Fatalf("Failed to train adapter: %v", err)
+	}
+	if adapter.InputDim() != 16 || adapter.OutputDim() != 8 {
+		t.Errorf("Expected a 16 to 8 adapter, got %d to %d", adapter.InputDim(), adapter.OutputDim())
+	}
+	if recall := adaptedRecall(t, adapter, testAnchors, testPositives); recall < 0.9 {
+		t.Errorf("Expected the adapter to improve recall on unseen topics, got %f", recall)
+	}
+}
+
+func TestAdapterTransform(t *testing.T) {
+	adapter, err := all_minilm_l6_v2.NewAdapter([][]float32{{1, 0, 0}, {0, 2, 0}})
+	if err != nil {
+		t.Fatalf("Failed to create adapter: %v", err)
+	}
+	out, err := adapter.Transform([]float32{3, 2, 5})
+	if err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+	if math.Abs(float64(out[0])-0.6) > 1e-6 || math.Abs(float64(out[1])-0.8) > 1e-6 {
+		t.Errorf("Expected [0.6 0.8], got %v", out)
+	}
+	if norm := vecmath.Norm(out); math.Abs(float64(norm)-1) > 1e-6 {
+		t.Errorf("Expected a unit vector, got norm %f", norm)
+	}
+	if _, err := adapter.Transform([]float32{1, 2}); err == nil {
+		t.Errorf("Expected a dimension mismatch error")
+	}
+
+	if _, err := all_minilm_l6_v2.NewAdapter([][]float32{{1, 0}, {1}}); err == nil {
+		t.Errorf("Expected an error for ragged weights")
+	}
+	if _, err := all_minilm_l6_v2.TrainAdapter(nil); err == nil {
+		t.Errorf("Expected an error without examples")
+	}
+}
+
+func TestAdapterMarshalBinary(t *testing.T) {
+	adapter, _ := all_minilm_l6_v2.NewAdapter([][]float32{{1, 0.5, 0}, {0, 2, -1}})
+	data, err := adapter.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	var loaded all_minilm_l6_v2.Adapter
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	weights := loaded.Weights()
+	expected := adapter.Weights()
+	for i := range expected {
+		for j := range expected[i] {
+			if weights[i][j] != expected[i][j] {
+				t.Fatalf("Expected weights %v, got %v", expected, weights)
+			}
+		}
+	}
+
+	for i := range data {
+		corrupted := append([]byte(nil), data...)
+		corrupted[i] ^= 1
+		if err := loaded.UnmarshalBinary(corrupted); err == nil {
+			t.Fatalf("Expected an error with byte %d flipped", i)
+		}
+	}
+	if err := loaded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Errorf("Expected an error for truncated data")
+	}
+}
+
+func TestModelRejectsEmptyAdapter(t *testing.T) {
+	if _, err := all_minilm_l6_v2.NewModel(all_minilm_l6_v2.WithAdapter(new(all_minilm_l6_v2.Adapter))); err == nil {
+		t.Error("Expected an error for an adapter without weights")
+	}
+}
@@ -0,0 +1,361 @@
+package all_minilm_l6_v2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const (
+	DefaultAdapterEpochs       = 10
+	DefaultAdapterLearningRate = 1e-3
+	DefaultAdapterBatchSize    = 32
+	// DefaultMNRLScale is the default factor applied to the similarities by
+	// the multiple negatives ranking loss, as in sentence-transformers.
+	DefaultMNRLScale = 20
+	// DefaultContrastiveMargin is the default cosine distance beyond which
+	// dissimilar pairs no longer contribute to the contrastive loss.
+	DefaultContrastiveMargin = 0.5
+)
+
+// Triplet is an anchor embedding with the embedding of a text relevant to it
+// and optionally the embedding of a hard negative, a text similar to the
+// anchor but not relevant to it.
+type Triplet struct {
+	Anchor, Positive []float32
+	// Negative may be nil.
+	Negative []float32
+}
+
+// TrainingPair is a pair of embeddings labeled as similar or not.
+type TrainingPair struct {
+	A, B    []float32
+	Similar bool
+}
+
+type adapterOptions struct {
+	outputDim       int
+	epochs          int
+	learningRate    float64
+	batchSize       int
+	seed            int64
+	scale           float64
+	margin          float64
+	identityPenalty float64
+}
+
+type AdapterOption = func(*adapterOptions)
+
+// WithAdapterOutputDim sets the output dimension of the adapter, which can be
+// lower than the input dimension to reduce the size of the embeddings. It
+// defaults to the input dimension.
+func WithAdapterOutputDim(dim int) AdapterOption {
+	return func(o *adapterOptions) {
+		o.outputDim = dim
+	}
+}
+
+// WithAdapterEpochs sets the number of passes over the training examples. It
+// defaults to DefaultAdapterEpochs.
+func WithAdapterEpochs(n int) AdapterOption {
+	return func(o *adapterOptions) {
+		o.epochs = n
+	}
+}
+
+// WithAdapterLearningRate sets the learning rate of the Adam optimizer. It
+// defaults to DefaultAdapterLearningRate.
+func WithAdapterLearningRate(rate float64) AdapterOption {
+	return func(o *adapterOptions) {
+		o.learningRate = rate
+	}
+}
+
+// WithAdapterBatchSize sets the number of examples per optimization step.
+// With the multiple negatives ranking loss, the other examples of a batch are
+// the negatives of an anchor, so larger batches make a harder task. It
+// defaults to DefaultAdapterBatchSize.
+func WithAdapterBatchSize(n int) AdapterOption {
+	return func(o *adapterOptions) {
+		o.batchSize = n
+	}
+}
+
+// WithAdapterSeed sets the seed of the random number generator shuffling the
+// examples.
+func WithAdapterSeed(seed int64) AdapterOption {
+	return func(o *adapterOptions) {
+		o.seed = seed
+	}
+}
+
+// WithMNRLScale sets the factor applied to the similarities by the multiple
+// negatives ranking loss. It defaults to DefaultMNRLScale.
+func WithMNRLScale(scale float64) AdapterOption {
+	return func(o *adapterOptions) {
+		o.scale = scale
+	}
+}
+
+// WithContrastiveMargin sets the cosine distance beyond which dissimilar
+// pairs no longer contribute to the contrastive loss. It defaults to
+// DefaultContrastiveMargin.
+func WithContrastiveMargin(margin float64) AdapterOption {
+	return func(o *adapterOptions) {
+		o.margin = margin
+	}
+}
+
+// WithIdentityRegularization penalizes the squared distance between the
+// weights and the initial projection, which keeps the adapter close to the
+// original embedding space when training examples are few.
+func WithIdentityRegularization(lambda float64) AdapterOption {
+	return func(o *adapterOptions) {
+		o.identityPenalty = lambda
+	}
+}
+
+// TrainAdapter trains an adapter with the multiple negatives ranking loss:
+// within a batch, each anchor must rank its positive first among the
+// positives and hard negatives of every triplet of the batch. The adapter
+// starts from the identity, truncated to the output dimension.
+func TrainAdapter(triplets []Triplet, opts ...AdapterOption) (*Adapter, error) {
+	var vectors [][]float32
+	for _, t := range triplets {
+		vectors = append(vectors, t.Anchor, t.Positive)
+		if t.Negative != nil {
+			vectors = append(vectors, t.Negative)
+		}
+	}
+	trainer, err := newAdapterTrainer(vectors, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	trainer.run(len(triplets), func(batch []int) {
+		anchors := make([]*adapterForward, len(batch))
+		var candidates []*adapterForward
+		for i, b := range batch {
+			anchors[i] = trainer.forward(triplets[b].Anchor)
+			candidates = append(candidates, trainer.forward(triplets[b].Positive))
+		}
+		for _, b := range batch {
+			if triplets[b].Negative != nil {
+				candidates = append(candidates, trainer.forward(triplets[b].Negative))
+			}
+		}
+
+		// Cross-entropy of the scaled similarities, the positive of the
+		// i-th anchor being the i-th candidate.
+		scores := make([]float64, len(candidates))
+		for i, anchor := range anchors {
+			maxScore := math.Inf(-1)
+			for j, c := range candidates {
+				scores[j] = trainer.o.scale * dotFloat64(anchor.unit, c.unit)
+				maxScore = max(maxScore, scores[j])
+			}
+			var sum float64
+			for j := range scores {
+				scores[j] = math.Exp(scores[j] - maxScore)
+				sum += scores[j]
+			}
+			for j, c := range candidates {
+				gradient := scores[j] / sum
+				if j == i {
+					gradient--
+				}
+				// Gradient with respect to the cosine similarity.
+				gradient *= trainer.o.scale / float64(len(anchors))
+				axpy64(gradient, c.unit, anchor.grad)
+				axpy64(gradient, anchor.unit, c.grad)
+			}
+		}
+		for _, f := range anchors {
+			trainer.backward(f)
+		}
+		for _, f := range candidates {
+			trainer.backward(f)
+		}
+	})
+	return trainer.adapter(), nil
+}
+
+// TrainContrastiveAdapter trains an adapter with the contrastive loss on the
+// cosine distance d of each pair: d² for similar pairs and max(0, margin -
+// d)² for dissimilar ones. The adapter starts from the identity, truncated to
+// the output dimension.
+func TrainContrastiveAdapter(pairs []TrainingPair, opts ...AdapterOption) (*Adapter, error) {
+	var vectors [][]float32
+	for _, p := range pairs {
+		vectors = append(vectors, p.A, p.B)
+	}
+	trainer, err := newAdapterTrainer(vectors, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	trainer.run(len(pairs), func(batch []int) {
+		for _, b := range batch {
+			a, c := trainer.forward(pairs[b].A), trainer.forward(pairs[b].B)
+			distance := 1 - dotFloat64(a.unit, c.unit)
+			// Derivative of half the loss with respect to the distance.
+			var gradient float64
+			if pairs[b].Similar {
+				gradient = distance
+			} else {
+				gradient = -max(trainer.o.margin-distance, 0)
+			}
+			// The distance decreases with the cosine similarity.
+			gradient = -gradient / float64(len(batch))
+			axpy64(gradient, c.unit, a.grad)
+			axpy64(gradient, a.unit, c.grad)
+			trainer.backward(a)
+			trainer.backward(c)
+		}
+	})
+	return trainer.adapter(), nil
+}
+
+// adapterTrainer optimizes the weights of an adapter with Adam.
+type adapterTrainer struct {
+	o       adapterOptions
+	in, out int
+	weights []float64
+	initial []float64
+	grad    []float64
+	// First and second moment estimates of Adam.
+	m, v  []float64
+	steps int
+}
+
+// adapterForward holds the projection of a vector and the gradient of the
+// loss with respect to its normalized projection.
+type adapterForward struct {
+	x    []float32
+	unit []float64
+	norm float64
+	grad []float64
+}
+
+func newAdapterTrainer(vectors [][]float32, opts []AdapterOption) (*adapterTrainer, error) {
+	if len(vectors) == 0 {
+		return nil, errors.New("no training examples")
+	}
+	if err := checkBatchDimensions(vectors, nil); err != nil {
+		return nil, err
+	}
+	in := len(vectors[0])
+	o := adapterOptions{
+		outputDim:    in,
+		epochs:       DefaultAdapterEpochs,
+		learningRate: DefaultAdapterLearningRate,
+		batchSize:    DefaultAdapterBatchSize,
+		seed:         1,
+		scale:        DefaultMNRLScale,
+		margin:       DefaultContrastiveMargin,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.outputDim <= 0 {
+		return nil, fmt.Errorf("output dimension must be positive, got %d", o.outputDim)
+	}
+	o.batchSize = max(o.batchSize, 1)
+
+	t := &adapterTrainer{o: o, in: in, out: o.outputDim}
+	for _, w := range identityAdapter(in, o.outputDim).weights {
+		t.weights = append(t.weights, float64(w))
+	}
+	t.initial = append([]float64(nil), t.weights...)
+	t.grad = make([]float64, len(t.weights))
+	t.m = make([]float64, len(t.weights))
+	t.v = make([]float64, len(t.weights))
+	return t, nil
+}
+
+// run calls step on shuffled batches of example indices for every epoch, and
+// updates the weights after each batch.
+func (t *adapterTrainer) run(examples int, step func(batch []int)) {
+	rng := rand.New(rand.NewSource(t.o.seed))
+	order := rng.Perm(examples)
+	for range t.o.epochs {
+		rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		for start := 0; start < len(order); start += t.o.batchSize {
+			clear(t.grad)
+			step(order[start:min(start+t.o.batchSize, len(order))])
+			t.update()
+		}
+	}
+}
+
+func (t *adapterTrainer) forward(x []float32) *adapterForward {
+	f := &adapterForward{x: x, unit: make([]float64, t.out), grad: make([]float64, t.out)}
+	for i := range f.unit {
+		row := t.weights[i*t.in : (i+1)*t.in]
+		for d, v := range x {
+			f.unit[i] += row[d] * float64(v)
+		}
+	}
+	f.norm = math.Sqrt(dotFloat64(f.unit, f.unit))
+	if f.norm > 0 {
+		for i := range f.unit {
+			f.unit[i] /= f.norm
+		}
+	}
+	return f
+}
+
+// backward accumulates the gradient of the weights from the gradient of the
+// normalized projection of f.
+func (t *adapterTrainer) backward(f *adapterForward) {
+	if f.norm == 0 {
+		return
+	}
+	// The normalization only lets through the component of the gradient
+	// orthogonal to the unit vector.
+	radial := dotFloat64(f.grad, f.unit)
+	for i, g := range f.grad {
+		g = (g - radial*f.unit[i]) / f.norm
+		row := t.grad[i*t.in : (i+1)*t.in]
+		for d, v := range f.x {
+			row[d] += g * float64(v)
+		}
+	}
+}
+
+func (t *adapterTrainer) update() {
+	const beta1, beta2, epsilon = 0.9, 0.999, 1e-8
+	t.steps++
+	correction1 := 1 - math.Pow(beta1, float64(t.steps))
+	correction2 := 1 - math.Pow(beta2, float64(t.steps))
+	for i, g := range t.grad {
+		g += t.o.identityPenalty * (t.weights[i] - t.initial[i])
+		t.m[i] = beta1*t.m[i] + (1-beta1)*g
+		t.v[i] = beta2*t.v[i] + (1-beta2)*g*g
+		t.weights[i] -= t.o.learningRate * (t.m[i] / correction1) / (math.Sqrt(t.v[i]/correction2) + epsilon)
+	}
+}
+
+func (t *adapterTrainer) adapter() *Adapter {
+	a := &Adapter{in: t.in, out: t.out, weights: make([]float32, len(t.weights))}
+	for i, w := range t.weights {
+		a.weights[i] = float32(w)
+	}
+	return a
+}
+
+func dotFloat64(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// axpy64 adds a × x to y.
+func axpy64(a float64, x, y []float64) {
+	for i := range x {
+		y[i] += a * x[i]
+	}
+}
@@ -225,3 +225,47 @@ func BenchmarkVariableLengthBatch(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkMMR benchmarks diversifying 10 results among 2000 candidates
+func BenchmarkMMR(b *testing.B) {
+	query := randomVectors(1, 1, 384)[0]
+	candidates := randomVectors(2, 2000, 384)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if _, err := all_minilm_l6_v2.MMR(query, candidates, 10, 0.5); err != nil {
+			b.Fatalf("Failed to compute MMR: %v", err)
+		}
+	}
+}
+
+// BenchmarkTokenizeLong benchmarks tokenizing the long sentence with the
+// sugarme tokenizer
+func BenchmarkTokenizeLong(b *testing.B) {
+	tk, err := all_minilm_l6_v2.NewTokenizer()
+	if err != nil {
+		b.Fatalf("Failed to create tokenizer: %v", err)
+	}
+	benchmarkTokenize(b, tk)
+}
+
+// BenchmarkWordPieceTokenizeLong benchmarks tokenizing the long sentence
+// with the pure Go WordPiece tokenizer
+func BenchmarkWordPieceTokenizeLong(b *testing.B) {
+	tk, err := all_minilm_l6_v2.NewWordPieceTokenizer()
+	if err != nil {
+		b.Fatalf("Failed to create tokenizer: %v", err)
+	}
+	benchmarkTokenize(b, tk)
+}
+
+func benchmarkTokenize(b *testing.B, tk *all_minilm_l6_v2.Tokenizer) {
+	sentence := "This is a very long test sentence for benchmarking purposes that contains many words and should test the performance of the model with longer input sequences that might be more common in real-world applications where users provide detailed text descriptions or longer documents that need to be processed efficiently."
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if _, err := tk.Encode(sentence, false); err != nil {
+			b.Fatalf("Failed to encode: %v", err)
+		}
+	}
+}
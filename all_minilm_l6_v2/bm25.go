@@ -0,0 +1,250 @@
+package all_minilm_l6_v2
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"unicode"
+
+	"github.com/sugarme/tokenizer"
+	"github.com/sugarme/tokenizer/normalizer"
+	"github.com/sugarme/tokenizer/pretokenizer"
+)
+
+const (
+	// DefaultBM25K1 is the default term frequency saturation of BM25.
+	DefaultBM25K1 = 1.2
+	// DefaultBM25B is the default document length normalization of BM25.
+	DefaultBM25B = 0.75
+)
+
+// Analyzer splits a text into the terms indexed by a BM25Index.
+type Analyzer = func(text string) []string
+
+var (
+	bertNormalizer   = normalizer.NewBertNormalizer(true, true, true, true)
+	bertPreTokenizer = pretokenizer.NewBertPreTokenizer()
+)
+
+// BertAnalyzer splits text into terms with the normalization and
+// pre-tokenization rules of the model tokenizer: text is lowercased and split
+// on whitespace and punctuation, and CJK characters are terms of their own.
+// Punctuation is dropped, so "ERR-4042" yields "err" and "4042".
+func BertAnalyzer(text string) []string {
+	n, err := bertNormalizer.Normalize(normalizer.NewNormalizedFrom(text))
+	if err != nil {
+		return nil
+	}
+	pt, err := bertPreTokenizer.PreTokenize(tokenizer.NewPreTokenizedStringFromNS(n))
+	if err != nil {
+		return nil
+	}
+
+	var terms []string
+	for _, split := range pt.GetSplits(normalizer.OriginalTarget, tokenizer.Byte) {
+		if isPunctuationTerm(split.Value) {
+			continue
+		}
+		terms = append(terms, split.Value)
+	}
+	return terms
+}
+
+func isPunctuationTerm(term string) bool {
+	for _, r := range term {
+		if !normalizer.IsBertPunctuation(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// BM25Result is a document found by BM25Index.Search along with its BM25
+// score and the contribution of every query term it contains.
+type BM25Result struct {
+	ID    string
+	Score float64
+	Terms map[string]float64
+}
+
+type bm25Doc struct {
+	id     string
+	length int
+	terms  map[string]int
+}
+
+// BM25Index is an inverted index ranking documents with Okapi BM25.
+//
+// A BM25Index is safe for concurrent use.
+type BM25Index struct {
+	analyzer Analyzer
+	k1, b    float64
+
+	mu          sync.RWMutex
+	docs        map[string]*bm25Doc
+	postings    map[string]map[string]int
+	totalLength int
+}
+
+type BM25Option = func(*BM25Index)
+
+// WithBM25Params sets the k1 and b parameters of BM25. They default to
+// DefaultBM25K1 and DefaultBM25B.
+func WithBM25Params(k1, b float64) BM25Option {
+	return func(idx *BM25Index) {
+		idx.k1 = k1
+		idx.b = b
+	}
+}
+
+// WithAnalyzer sets the analyzer applied to documents and queries. It
+// defaults to BertAnalyzer.
+func WithAnalyzer(analyzer Analyzer) BM25Option {
+	return func(idx *BM25Index) {
+		idx.analyzer = analyzer
+	}
+}
+
+func NewBM25Index(opts ...BM25Option) *BM25Index {
+	idx := &BM25Index{
+		analyzer: BertAnalyzer,
+		k1:       DefaultBM25K1,
+		b:        DefaultBM25B,
+		docs:     make(map[string]*bm25Doc),
+		postings: make(map[string]map[string]int),
+	}
+	for _, opt := range opts {
+		opt(idx)
+	}
+	return idx
+}
+
+// Add indexes text under id, replacing the document having the same id.
+func (idx *BM25Index) Add(id, text string) {
+	doc := &bm25Doc{id: id, terms: make(map[string]int)}
+	for _, term := range idx.analyzer(text) {
+		doc.terms[term]++
+		doc.length++
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(id)
+	idx.docs[id] = doc
+	idx.totalLength += doc.length
+	for term, tf := range doc.terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]int)
+		}
+		idx.postings[term][id] = tf
+	}
+}
+
+// Remove removes the document with the given id and reports whether it was
+// present.
+func (idx *BM25Index) Remove(id string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.removeLocked(id)
+}
+
+func (idx *BM25Index) removeLocked(id string) bool {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return false
+	}
+	for term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLength -= doc.length
+	delete(idx.docs, id)
+	return true
+}
+
+// Len returns the number of documents in the index.
+func (idx *BM25Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Search returns the k documents with the highest BM25 score for query,
+// sorted by decreasing score, ties being broken by id. Documents containing
+// none of the query terms are not returned.
+func (idx *BM25Index) Search(query string, k int) []BM25Result {
+	return idx.search(query, k, nil)
+}
+
+// search is Search restricted to the documents accepted by accept, if not
+// nil.
+func (idx *BM25Index) search(query string, k int, accept func(id string) bool) []BM25Result {
+	if k <= 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var terms []string
+	for _, term := range idx.analyzer(query) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.docs) == 0 {
+		return nil
+	}
+	n := float64(len(idx.docs))
+	avgLength := float64(idx.totalLength) / n
+
+	scores := make(map[string]*BM25Result)
+	for _, term := range terms {
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			if accept != nil && !accept(id) {
+				continue
+			}
+			length := float64(idx.docs[id].length)
+			norm := 1 - idx.b
+			if avgLength > 0 {
+				norm += idx.b * length / avgLength
+			}
+			contribution := idf * float64(tf) * (idx.k1 + 1) / (float64(tf) + idx.k1*norm)
+
+			r, ok := scores[id]
+			if !ok {
+				r = &BM25Result{ID: id, Terms: make(map[string]float64)}
+				scores[id] = r
+			}
+			r.Score += contribution
+			r.Terms[term] = contribution
+		}
+	}
+
+	results := make([]BM25Result, 0, len(scores))
+	for _, r := range scores {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
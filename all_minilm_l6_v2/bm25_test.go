@@ -0,0 +1,82 @@
+package all_minilm_l6_v2_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+func TestBertAnalyzer(t *testing.T) {
+	terms := all_minilm_l6_v2.BertAnalyzer("Hello, World! ERR-4042 東京")
+	expected := "[hello world err 4042 東 京]"
+	if fmt.Sprint(terms) != expected {
+		t.Errorf("Expected %s, got %v", expected, terms)
+	}
+}
+
+func TestBM25Scores(t *testing.T) {
+	idx := all_minilm_l6_v2.NewBM25Index()
+	idx.Add("a", "the cat sat on the mat")
+	idx.Add("b", "the dog sat")
+	idx.Add("c", "a cat and a cat")
+
+	results := idx.Search("cat", 10)
+	if len(results) != 2 {
+		t.Fatalf("Expected the 2 documents containing cat, got %v", results)
+	}
+
+	// Reference computation of BM25 for the document c
+	n, df := 3.0, 2.0
+	avgLength := (6.0 + 3.0 + 5.0) / 3
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	tf, length := 2.0, 5.0
+	expected := idf * tf * 2.2 / (tf + 1.2*(0.25+0.75*length/avgLength))
+
+	if results[0].ID != "c" {
+		t.Fatalf("Expected c first, got %v", results)
+	}
+	if math.Abs(results[0].Score-expected) > 1e-9 {
+		t.Errorf("Expected score %f, got %f", expected, results[0].Score)
+	}
+	if math.Abs(results[0].Terms["cat"]-expected) > 1e-9 {
+		t.Errorf("Expected the cat contribution to be the whole score, got %v", results[0].Terms)
+	}
+}
+
+func TestBM25RareTermsWeighMore(t *testing.T) {
+	idx := all_minilm_l6_v2.NewBM25Index()
+	for i := range 10 {
+		idx.Add(fmt.Sprint(i), "server error on startup")
+	}
+	idx.Add("rare", "server error ERR-4042")
+
+	results := idx.Search("4042 error", 3)
+	if results[0].ID != "rare" {
+		t.Errorf("Expected the document with the identifier first, got %v", results)
+	}
+	if results[0].Terms["4042"] <= results[0].Terms["error"] {
+		t.Errorf("Expected the rare term to contribute more, got %v", results[0].Terms)
+	}
+}
+
+func TestBM25AddReplacesAndRemove(t *testing.T) {
+	idx := all_minilm_l6_v2.NewBM25Index()
+	idx.Add("a", "apples")
+	idx.Add("a", "bananas")
+	idx.Add("b", "bananas")
+
+	if idx.Len() != 2 {
+		t.Errorf("Expected 2 documents, got %d", idx.Len())
+	}
+	if results := idx.Search("apples", 10); len(results) != 0 {
+		t.Errorf("Expected the replaced text to be forgotten, got %v", results)
+	}
+	if !idx.Remove("b") || idx.Remove("b") {
+		t.Errorf("Expected b to be removed once")
+	}
+	if results := idx.Search("bananas", 10); len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("Expected only a, got %v", results)
+	}
+}
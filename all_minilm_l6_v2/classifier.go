@@ -0,0 +1,257 @@
+package all_minilm_l6_v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+const (
+	// UnknownLabel is the label of the texts too far from every label, see
+	// WithMinSimilarity.
+	UnknownLabel = "unknown"
+	// DefaultTemperature is the default temperature of the softmax turning
+	// similarities into probabilities. It matches the scale of 20 used to
+	// train the model.
+	DefaultTemperature = 0.05
+)
+
+// Label is a class of a Classifier described by one or more descriptions or
+// example utterances.
+type Label struct {
+	Name     string
+	Examples []string
+	// Threshold is the similarity from which a text has the label in
+	// multi-label classification. Nil means the classifier's threshold set
+	// with WithMultiLabelThreshold.
+	Threshold *float64
+}
+
+// LabelScore is the cosine similarity between a text and the centroid of a
+// label along with the probability of the label.
+type LabelScore struct {
+	Label       string
+	Similarity  float64
+	Probability float64
+}
+
+// Classification is the outcome of classifying a text.
+type Classification struct {
+	// Label is the most similar label, or UnknownLabel when its similarity
+	// is below the minimum similarity.
+	Label string
+	// Labels are the labels whose similarity reaches their multi-label
+	// threshold, by decreasing similarity.
+	Labels []string
+	// Scores holds every label by decreasing similarity.
+	Scores []LabelScore
+}
+
+// Classifier tags texts with labels without training, by comparing their
+// embedding with the centroid of the embeddings of the examples of each
+// label.
+//
+// A Classifier is safe for concurrent use.
+type Classifier struct {
+	embedder            Embedder
+	temperature         float64
+	minSimilarity       float64
+	multiLabelThreshold float64
+	batchSize           int
+
+	names      []string
+	thresholds []float64
+	centroids  [][]float32
+}
+
+type ClassifierOption = func(*Classifier)
+
+// WithTemperature sets the temperature of the softmax over the similarities:
+// the lower, the more confident the probabilities. It defaults to
+// DefaultTemperature.
+func WithTemperature(temperature float64) ClassifierOption {
+	return func(c *Classifier) {
+		c.temperature = temperature
+	}
+}
+
+// WithMinSimilarity makes texts whose similarity to every label is below
+// score classified as UnknownLabel.
+func WithMinSimilarity(score float64) ClassifierOption {
+	return func(c *Classifier) {
+		c.minSimilarity = score
+	}
+}
+
+// WithMultiLabelThreshold sets the similarity from which a text has a label
+// in Classification.Labels, for the labels having no threshold of their own.
+// Without it, only those labels can be in Classification.Labels.
+func WithMultiLabelThreshold(score float64) ClassifierOption {
+	return func(c *Classifier) {
+		c.multiLabelThreshold = score
+	}
+}
+
+// WithClassifierBatchSize sets the number of texts embedded per call to the
+// embedder. It defaults to DefaultCorpusBatchSize.
+func WithClassifierBatchSize(n int) ClassifierOption {
+	return func(c *Classifier) {
+		c.batchSize = n
+	}
+}
+
+// NewClassifier embeds the examples of labels and creates a classifier
+// scoring texts against the centroid of each label.
+func NewClassifier(ctx context.Context, embedder Embedder, labels []Label, opts ...ClassifierOption) (*Classifier, error) {
+	c := &Classifier{
+		embedder:            embedder,
+		temperature:         DefaultTemperature,
+		minSimilarity:       math.Inf(-1),
+		multiLabelThreshold: math.Inf(1),
+		batchSize:           DefaultCorpusBatchSize,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.temperature <= 0 {
+		return nil, fmt.Errorf("temperature must be positive, got %f", c.temperature)
+	}
+	if len(labels) == 0 {
+		return nil, errors.New("at least one label is required")
+	}
+
+	var examples []string
+	seen := make(map[string]bool)
+	for _, label := range labels {
+		if label.Name == "" {
+			return nil, errors.New("label name must not be empty")
+		}
+		if label.Name == UnknownLabel {
+			return nil, fmt.Errorf("label name %q is reserved for texts matching no label", UnknownLabel)
+		}
+		if seen[label.Name] {
+			return nil, fmt.Errorf("duplicate label %q", label.Name)
+		}
+		seen[label.Name] = true
+		if len(label.Examples) == 0 {
+			return nil, fmt.Errorf("label %q has no examples", label.Name)
+		}
+		examples = append(examples, label.Examples...)
+	}
+
+	embeddings, err := embedAll(ctx, embedder, examples, c.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed examples: %w", err)
+	}
+	if err := checkBatchDimensions(embeddings, nil); err != nil {
+		return nil, err
+	}
+
+	for _, label := range labels {
+		vectors := embeddings[:len(label.Examples)]
+		embeddings = embeddings[len(label.Examples):]
+
+		threshold := c.multiLabelThreshold
+		if label.Threshold != nil {
+			threshold = *label.Threshold
+		}
+		c.names = append(c.names, label.Name)
+		c.thresholds = append(c.thresholds, threshold)
+		c.centroids = append(c.centroids, centroid(vectors))
+	}
+	return c, nil
+}
+
+// Labels returns the names of the labels in the order they were given.
+func (c *Classifier) Labels() []string {
+	return append([]string(nil), c.names...)
+}
+
+// Classify embeds text and classifies it.
+func (c *Classifier) Classify(ctx context.Context, text string) (Classification, error) {
+	classifications, err := c.ClassifyBatch(ctx, []string{text})
+	if err != nil {
+		return Classification{}, err
+	}
+	return classifications[0], nil
+}
+
+// ClassifyBatch embeds texts in batches and classifies each of them.
+func (c *Classifier) ClassifyBatch(ctx context.Context, texts []string) ([]Classification, error) {
+	embeddings, err := embedAll(ctx, c.embedder, texts, c.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed texts: %w", err)
+	}
+	classifications := make([]Classification, len(embeddings))
+	for i, embedding := range embeddings {
+		if classifications[i], err = c.ClassifyEmbedding(embedding); err != nil {
+			return nil, err
+		}
+	}
+	return classifications, nil
+}
+
+// ClassifyEmbedding classifies a text from its embedding.
+func (c *Classifier) ClassifyEmbedding(embedding []float32) (Classification, error) {
+	if err := checkDimensions(len(c.centroids[0]), len(embedding)); err != nil {
+		return Classification{}, err
+	}
+
+	scores := make([]LabelScore, len(c.centroids))
+	thresholds := make(map[string]float64, len(c.centroids))
+	maxSimilarity := math.Inf(-1)
+	for i, centroid := range c.centroids {
+		similarity := CosineSimilarity(embedding, centroid)
+		scores[i] = LabelScore{Label: c.names[i], Similarity: similarity}
+		thresholds[c.names[i]] = c.thresholds[i]
+		maxSimilarity = max(maxSimilarity, similarity)
+	}
+
+	// Subtracting the maximum keeps the exponentials from overflowing at low
+	// temperatures.
+	var sum float64
+	for i := range scores {
+		scores[i].Probability = math.Exp((scores[i].Similarity - maxSimilarity) / c.temperature)
+		sum += scores[i].Probability
+	}
+	for i := range scores {
+		scores[i].Probability /= sum
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Similarity > scores[j].Similarity
+	})
+
+	classification := Classification{Label: scores[0].Label, Scores: scores}
+	if scores[0].Similarity < c.minSimilarity {
+		classification.Label = UnknownLabel
+	}
+	for _, s := range scores {
+		if s.Similarity >= thresholds[s.Label] {
+			classification.Labels = append(classification.Labels, s.Label)
+		}
+	}
+	return classification, nil
+}
+
+// centroid returns the mean of the normalized vectors, so that every example
+// weighs the same whatever its norm.
+func centroid(vectors [][]float32) []float32 {
+	mean := make([]float32, len(vectors[0]))
+	for _, v := range vectors {
+		norm := vecmath.Norm(v)
+		if norm == 0 {
+			continue
+		}
+		for d, x := range v {
+			mean[d] += x / norm
+		}
+	}
+	for d := range mean {
+		mean[d] /= float32(len(vectors))
+	}
+	return mean
+}
@@ -0,0 +1,155 @@
+package all_minilm_l6_v2_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+var classifierEmbedder = fixedEmbedder{
+	"I was charged twice":           {1, 0, 0},
+	"Question about my invoice":     {0.9, 0.1, 0},
+	"The app crashes on startup":    {0, 1, 0},
+	"Please add a dark mode":        {0, 0, 1},
+	"Refund the double charge":      {0.95, 0.05, 0},
+	"Crash when paying the invoice": {0.7, 0.7, 0},
+	"What is the weather like?":     {-1, -1, -1},
+}
+
+var classifierLabels = []all_minilm_l6_v2.Label{
+	{Name: "billing", Examples: []string{"I was charged twice", "Question about my invoice"}},
+	{Name: "bug report", Examples: []string{"The app crashes on startup"}},
+	{Name: "feature request", Examples: []string{"Please add a dark mode"}},
+}
+
+func TestClassifierPicksClosestLabel(t *testing.T) {
+	classifier, err := all_minilm_l6_v2.NewClassifier(context.Background(), classifierEmbedder, classifierLabels)
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	classification, err := classifier.Classify(context.Background(), "Refund the double charge")
+	if err != nil {
+		t.Fatalf("Failed to classify: %v", err)
+	}
+	if classification.Label != "billing" {
+		t.Errorf("Expected billing, got %s", classification.Label)
+	}
+	if len(classification.Scores) != 3 {
+		t.Fatalf("Expected 3 scores, got %d", len(classification.Scores))
+	}
+	var sum float64
+	for i, s := range classification.Scores {
+		sum += s.Probability
+		if i > 0 && s.Similarity > classification.Scores[i-1].Similarity {
+			t.Errorf("Scores are not sorted by decreasing similarity: %v", classification.Scores)
+		}
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("Expected probabilities to sum to 1, got %f", sum)
+	}
+	if classification.Scores[0].Probability < 0.9 {
+		t.Errorf("Expected a confident probability, got %f", classification.Scores[0].Probability)
+	}
+	if len(classification.Labels) != 0 {
+		t.Errorf("Expected no multi-label output without thresholds, got %v", classification.Labels)
+	}
+}
+
+func TestClassifierTemperature(t *testing.T) {
+	sharp, _ := all_minilm_l6_v2.NewClassifier(context.Background(), classifierEmbedder, classifierLabels,
+		all_minilm_l6_v2.WithTemperature(0.01))
+	flat, _ := all_minilm_l6_v2.NewClassifier(context.Background(), classifierEmbedder, classifierLabels,
+		all_minilm_l6_v2.WithTemperature(10))
+
+	s, _ := sharp.Classify(context.Background(), "Crash when paying the invoice")
+	f, _ := flat.Classify(context.Background(), "Crash when paying the invoice")
+	if s.Scores[0].Probability <= f.Scores[0].Probability {
+		t.Errorf("Expected a lower temperature to be more confident, got %f and %f",
+			s.Scores[0].Probability, f.Scores[0].Probability)
+	}
+	if f.Scores[0].Probability > 0.4 {
+		t.Errorf("Expected a high temperature to be close to uniform, got %f", f.Scores[0].Probability)
+	}
+
+	if _, err := all_minilm_l6_v2.NewClassifier(context.Background(), classifierEmbedder, classifierLabels,
+		all_minilm_l6_v2.WithTemperature(0)); err == nil {
+		t.Errorf("Expected an error for a zero temperature")
+	}
+}
+
+func TestClassifierMultiLabel(t *testing.T) {
+	labels := append([]all_minilm_l6_v2.Label(nil), classifierLabels...)
+	labels[2].Threshold = float64Ptr(0.99)
+
+	classifier, err := all_minilm_l6_v2.NewClassifier(context.Background(), classifierEmbedder, labels,
+		all_minilm_l6_v2.WithMultiLabelThreshold(0.6))
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	classification, _ := classifier.Classify(context.Background(), "Crash when paying the invoice")
+	if len(classification.Labels) != 2 {
+		t.Fatalf("Expected billing and bug report, got %v", classification.Labels)
+	}
+	if classification.Labels[0] != classification.Label {
+		t.Errorf("Expected the first label to be the best one, got %v and %s", classification.Labels, classification.Label)
+	}
+
+	classification, _ = classifier.Classify(context.Background(), "Please add a dark mode")
+	if len(classification.Labels) != 1 || classification.Labels[0] != "feature request" {
+		t.Errorf("Expected the label's own threshold to apply, got %v", classification.Labels)
+	}
+	// A zero threshold is a threshold, not the classifier's default
+	labels[2].Threshold = float64Ptr(0)
+	classifier, _ = all_minilm_l6_v2.NewClassifier(context.Background(), classifierEmbedder, labels)
+	classification, _ = classifier.Classify(context.Background(), "Crash when paying the invoice")
+	if len(classification.Labels) != 1 || classification.Labels[0] != "feature request" {
+		t.Errorf("Expected feature request with a zero threshold, got %v", classification.Labels)
+	}
+}
+
+func TestClassifierUnknown(t *testing.T) {
+	classifier, _ := all_minilm_l6_v2.NewClassifier(context.Background(), classifierEmbedder, classifierLabels,
+		all_minilm_l6_v2.WithMinSimilarity(0.5))
+
+	classifications, err := classifier.ClassifyBatch(context.Background(),
+		[]string{"What is the weather like?", "The app crashes on startup"})
+	if err != nil {
+		t.Fatalf("Failed to classify: %v", err)
+	}
+	if classifications[0].Label != all_minilm_l6_v2.UnknownLabel {
+		t.Errorf("Expected %s, got %s", all_minilm_l6_v2.UnknownLabel, classifications[0].Label)
+	}
+	if len(classifications[0].Scores) != 3 {
+		t.Errorf("Expected scores for unknown texts too, got %v", classifications[0].Scores)
+	}
+	if classifications[1].Label != "bug report" {
+		t.Errorf("Expected bug report, got %s", classifications[1].Label)
+	}
+}
+
+func TestClassifierValidatesLabels(t *testing.T) {
+	invalid := map[string][]all_minilm_l6_v2.Label{
+		"no labels":   nil,
+		"empty name":  {{Examples: []string{"I was charged twice"}}},
+		"no examples": {{Name: "billing"}},
+		"unknown":     {{Name: all_minilm_l6_v2.UnknownLabel, Examples: []string{"I was charged twice"}}},
+		"duplicate": {
+			{Name: "billing", Examples: []string{"I was charged twice"}},
+			{Name: "billing", Examples: []string{"Question about my invoice"}},
+		},
+	}
+	for name, labels := range invalid {
+		if _, err := all_minilm_l6_v2.NewClassifier(context.Background(), classifierEmbedder, labels); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+
+	classifier, _ := all_minilm_l6_v2.NewClassifier(context.Background(), classifierEmbedder, classifierLabels)
+	if _, err := classifier.ClassifyEmbedding([]float32{1, 0}); err == nil {
+		t.Errorf("Expected a dimension mismatch error")
+	}
+}
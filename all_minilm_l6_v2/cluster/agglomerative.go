@@ -0,0 +1,145 @@
+package cluster
+
+// Linkage is the distance between two clusters used by Agglomerative.
+type Linkage int
+
+const (
+	// AverageLinkage uses the mean distance between the vectors of the two
+	// clusters.
+	AverageLinkage Linkage = iota
+	// CompleteLinkage uses the largest distance between the vectors of the
+	// two clusters.
+	CompleteLinkage
+	// SingleLinkage uses the smallest distance between the vectors of the two
+	// clusters.
+	SingleLinkage
+)
+
+type agglomerativeOptions struct {
+	linkage Linkage
+}
+
+type AgglomerativeOption = func(*agglomerativeOptions)
+
+// WithLinkage sets the linkage. It defaults to AverageLinkage.
+func WithLinkage(linkage Linkage) AgglomerativeOption {
+	return func(o *agglomerativeOptions) {
+		o.linkage = linkage
+	}
+}
+
+// Agglomerative clusters vectors bottom-up: starting from one cluster per
+// vector, it repeatedly merges the two closest clusters by cosine distance
+// until no two clusters are closer than threshold. The number of clusters
+// follows from the threshold.
+//
+// The pairwise distances are kept in memory, which takes 4n² bytes for n
+// vectors. Labels are numbered in order of the first vector of each cluster.
+func Agglomerative(vectors [][]float32, threshold float64, opts ...AgglomerativeOption) ([]int, error) {
+	o := agglomerativeOptions{linkage: AverageLinkage}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	n := len(vectors)
+	if n == 0 {
+		return nil, nil
+	}
+	units, err := normalized(vectors)
+	if err != nil {
+		return nil, err
+	}
+
+	distances := make([]float32, n*n)
+	for i := range n {
+		for j := i + 1; j < n; j++ {
+			d := float32(cosineDistance(units[i], units[j]))
+			distances[i*n+j], distances[j*n+i] = d, d
+		}
+	}
+
+	// parent[i] is the cluster vector i was merged into, the clusters still
+	// active being their own parents.
+	parent := make([]int, n)
+	sizes := make([]int, n)
+	for i := range parent {
+		parent[i], sizes[i] = i, 1
+	}
+
+	// closest[i] is the closest active cluster to the active cluster i, so
+	// that finding the next merge is linear in the number of clusters.
+	closest := make([]int, n)
+	nearestOf := func(i int) int {
+		best := -1
+		for j := range n {
+			if j != i && parent[j] == j && (best == -1 || distances[i*n+j] < distances[i*n+best]) {
+				best = j
+			}
+		}
+		return best
+	}
+	for i := range n {
+		closest[i] = nearestOf(i)
+	}
+
+	for clusters := n; clusters > 1; clusters-- {
+		a := -1
+		for i := range n {
+			if parent[i] == i && (a == -1 || distances[i*n+closest[i]] < distances[a*n+closest[a]]) {
+				a = i
+			}
+		}
+		b := closest[a]
+		if float64(distances[a*n+b]) > threshold {
+			break
+		}
+
+		// Merge b into a, updating the distances with the Lance-Williams
+		// formula of the linkage.
+		for k := range n {
+			if parent[k] != k || k == a || k == b {
+				continue
+			}
+			da, db := distances[a*n+k], distances[b*n+k]
+			var d float32
+			switch o.linkage {
+			case CompleteLinkage:
+				d = max(da, db)
+			case SingleLinkage:
+				d = min(da, db)
+			default:
+				d = (float32(sizes[a])*da + float32(sizes[b])*db) / float32(sizes[a]+sizes[b])
+			}
+			distances[a*n+k], distances[k*n+a] = d, d
+		}
+		parent[b] = a
+		sizes[a] += sizes[b]
+
+		for k := range n {
+			if parent[k] != k {
+				continue
+			}
+			if k == a || closest[k] == a || closest[k] == b {
+				closest[k] = nearestOf(k)
+			} else if distances[k*n+a] < distances[k*n+closest[k]] {
+				closest[k] = a
+			}
+		}
+	}
+
+	labels := make([]int, n)
+	clusterLabels := make(map[int]int)
+	for i := range n {
+		root := i
+		for parent[root] != root {
+			root = parent[root]
+		}
+		label, ok := clusterLabels[root]
+		if !ok {
+			label = len(clusterLabels)
+			clusterLabels[root] = label
+		}
+		labels[i] = label
+	}
+	return labels, nil
+}
@@ -0,0 +1,72 @@
+// Package cluster groups embeddings by cosine similarity. It provides
+// spherical k-means, agglomerative clustering, the fast community detection of
+// sentence-transformers, and the silhouette and Davies-Bouldin scores to
+// assess the resulting clusterings.
+//
+// Clusterings are returned as labels, labels[i] being the cluster of the i-th
+// vector. A label of Noise marks a vector assigned to no cluster.
+package cluster
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// Noise is the label of vectors assigned to no cluster.
+const Noise = -1
+
+// ErrDimensionMismatch is returned when the vectors do not all have the same
+// dimension.
+var ErrDimensionMismatch = errors.New("dimension mismatch")
+
+// normalized returns unit-length copies of vectors, checking that they all
+// have the same dimension. Zero vectors are left zero.
+func normalized(vectors [][]float32) ([][]float32, error) {
+	out := make([][]float32, len(vectors))
+	for i, v := range vectors {
+		if len(v) != len(vectors[0]) {
+			return nil, fmt.Errorf("%w: vector %d has dimension %d, expected %d", ErrDimensionMismatch, i, len(v), len(vectors[0]))
+		}
+		out[i] = vecmath.Normalized(v)
+	}
+	return out, nil
+}
+
+// cosineDistance returns 1 - cos(a, b) for unit-length a and b.
+func cosineDistance(a, b []float32) float64 {
+	return max(1-float64(vecmath.Dot(a, b)), 0)
+}
+
+// Labels converts clusters given as lists of vector indices, such as the
+// communities returned by CommunityDetection, into labels for n vectors.
+// Vectors in no cluster are labeled Noise.
+func Labels(clusters [][]int, n int) []int {
+	labels := make([]int, n)
+	for i := range labels {
+		labels[i] = Noise
+	}
+	for c, members := range clusters {
+		for _, i := range members {
+			labels[i] = c
+		}
+	}
+	return labels
+}
+
+// Clusters converts labels into lists of vector indices, the c-th list
+// holding the vectors labeled c. Noise is left out.
+func Clusters(labels []int) [][]int {
+	var clusters [][]int
+	for i, label := range labels {
+		if label == Noise {
+			continue
+		}
+		for len(clusters) <= label {
+			clusters = append(clusters, nil)
+		}
+		clusters[label] = append(clusters[label], i)
+	}
+	return clusters
+}
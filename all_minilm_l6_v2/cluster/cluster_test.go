@@ -0,0 +1,246 @@
+package cluster_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/cluster"
+)
+
+// blobs returns vectors drawn around random directions, sizes[c] of them
+// around the c-th one, along with the index of their direction.
+func blobs(seed int64, sizes []int, dim int, noise float64) ([][]float32, []int) {
+	rng := rand.New(rand.NewSource(seed))
+	var vectors [][]float32
+	var truth []int
+	for c, size := range sizes {
+		center := make([]float64, dim)
+		for d := range center {
+			center[d] = rng.NormFloat64()
+		}
+		for range size {
+			v := make([]float32, dim)
+			for d := range v {
+				v[d] = float32(center[d] + noise*rng.NormFloat64())
+			}
+			vectors = append(vectors, v)
+			truth = append(truth, c)
+		}
+	}
+	return vectors, truth
+}
+
+// checkSamePartition checks that labels group the vectors as truth does,
+// whatever the numbering of the clusters.
+func checkSamePartition(t *testing.T, labels, truth []int) {
+	t.Helper()
+
+	if len(labels) != len(truth) {
+		t.Fatalf("Expected %d labels, got %d", len(truth), len(labels))
+	}
+	mapping := make(map[int]int)
+	reverse := make(map[int]int)
+	for i := range labels {
+		if l, ok := mapping[truth[i]]; ok && l != labels[i] {
+			t.Fatalf("Cluster %d is split: %v", truth[i], labels)
+		}
+		if c, ok := reverse[labels[i]]; ok && c != truth[i] {
+			t.Fatalf("Clusters %d and %d are merged: %v", c, truth[i], labels)
+		}
+		mapping[truth[i]], reverse[labels[i]] = labels[i], truth[i]
+	}
+}
+
+func TestKMeans(t *testing.T) {
+	vectors, truth := blobs(1, []int{30, 20, 25, 15}, 32, 0.2)
+
+	result, err := cluster.KMeans(vectors, 4, cluster.WithRestarts(3))
+	if err != nil {
+		t.Fatalf("Failed to cluster: %v", err)
+	}
+	checkSamePartition(t, result.Labels, truth)
+
+	if len(result.Centroids) != 4 {
+		t.Fatalf("Expected 4 centroids, got %d", len(result.Centroids))
+	}
+	for c, centroid := range result.Centroids {
+		var norm float64
+		for _, x := range centroid {
+			norm += float64(x) * float64(x)
+		}
+		if math.Abs(norm-1) > 1e-4 {
+			t.Errorf("Centroid %d is not normalized: %f", c, norm)
+		}
+	}
+
+	again, _ := cluster.KMeans(vectors, 4, cluster.WithRestarts(3))
+	if fmt.Sprint(again.Labels) != fmt.Sprint(result.Labels) {
+		t.Errorf("Expected the same seed to give the same clustering")
+	}
+
+	if _, err := cluster.KMeans(vectors, 0); err == nil {
+		t.Errorf("Expected an error for k = 0")
+	}
+	if _, err := cluster.KMeans(append(vectors, []float32{1}), 2); !errors.Is(err, cluster.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}
+
+func TestAgglomerative(t *testing.T) {
+	vectors, truth := blobs(2, []int{12, 8, 10}, 32, 0.2)
+
+	for _, linkage := range []cluster.Linkage{cluster.AverageLinkage, cluster.CompleteLinkage, cluster.SingleLinkage} {
+		labels, err := cluster.Agglomerative(vectors, 0.3, cluster.WithLinkage(linkage))
+		if err != nil {
+			t.Fatalf("Failed to cluster: %v", err)
+		}
+		checkSamePartition(t, labels, truth)
+		if labels[0] != 0 {
+			t.Errorf("Expected labels numbered in order of appearance, got %v", labels)
+		}
+	}
+
+	labels, _ := cluster.Agglomerative(vectors, 0)
+	if len(cluster.Clusters(labels)) != len(vectors) {
+		t.Errorf("Expected one cluster per vector with a zero threshold, got %v", labels)
+	}
+	labels, _ = cluster.Agglomerative(vectors, 2)
+	if len(cluster.Clusters(labels)) != 1 {
+		t.Errorf("Expected a single cluster with the maximum threshold, got %v", labels)
+	}
+}
+
+// TestAgglomerativeLinkages checks the merge order on points of a circle,
+// where cosine distances are known.
+func TestAgglomerativeLinkages(t *testing.T) {
+	angles := []float64{0, 0.1, 0.25, 0.35}
+	vectors := make([][]float32, len(angles))
+	for i, a := range angles {
+		vectors[i] = []float32{float32(math.Cos(a)), float32(math.Sin(a))}
+	}
+	distance := func(a, b float64) float64 { return 1 - math.Cos(b-a) }
+
+	// Single linkage chains the points as every gap is below the threshold
+	threshold := distance(0, 0.2)
+	labels, _ := cluster.Agglomerative(vectors, threshold, cluster.WithLinkage(cluster.SingleLinkage))
+	if fmt.Sprint(labels) != "[0 0 0 0]" {
+		t.Errorf("Single linkage: expected one cluster, got %v", labels)
+	}
+
+	// Complete linkage compares the furthest points: {0, 0.1} and {0.25,
+	// 0.35} are merged, but the two groups are 0.35 apart
+	labels, _ = cluster.Agglomerative(vectors, threshold, cluster.WithLinkage(cluster.CompleteLinkage))
+	if fmt.Sprint(labels) != "[0 0 1 1]" {
+		t.Errorf("Complete linkage: expected [0 0 1 1], got %v", labels)
+	}
+}
+
+func TestCommunityDetection(t *testing.T) {
+	vectors, truth := blobs(3, []int{6, 10, 3}, 32, 0.2)
+
+	communities, err := cluster.CommunityDetection(vectors, 0.8, 5)
+	if err != nil {
+		t.Fatalf("Failed to detect communities: %v", err)
+	}
+	if len(communities) != 2 {
+		t.Fatalf("Expected 2 communities, got %v", communities)
+	}
+	if len(communities[0]) != 10 || len(communities[1]) != 6 {
+		t.Errorf("Expected communities of 10 and 6 vectors, got %v", communities)
+	}
+
+	labels := cluster.Labels(communities, len(vectors))
+	for i, label := range labels {
+		if truth[i] == 2 && label != cluster.Noise {
+			t.Errorf("Vector %d of the small cluster should be noise", i)
+		}
+	}
+	for _, community := range communities {
+		for _, i := range community {
+			if truth[i] != truth[community[0]] {
+				t.Errorf("Community %v mixes clusters", community)
+			}
+		}
+	}
+
+	communities, _ = cluster.CommunityDetection(vectors, 0.8, 1)
+	if len(communities) != 3 {
+		t.Errorf("Expected every cluster with a minimum size of 1, got %v", communities)
+	}
+}
+
+func TestSilhouette(t *testing.T) {
+	vectors, truth := blobs(4, []int{20, 20, 20}, 32, 0.2)
+
+	good, err := cluster.Silhouette(vectors, truth)
+	if err != nil {
+		t.Fatalf("Failed to compute silhouette: %v", err)
+	}
+	if good < 0.8 {
+		t.Errorf("Expected a high silhouette for well separated clusters, got %f", good)
+	}
+
+	shuffled := make([]int, len(truth))
+	for i := range shuffled {
+		shuffled[i] = i % 3
+	}
+	bad, _ := cluster.Silhouette(vectors, shuffled)
+	if bad >= good || bad > 0.1 {
+		t.Errorf("Expected a low silhouette for random labels, got %f", bad)
+	}
+
+	// Points on a circle: the first two share a cluster and the last one is
+	// alone, so its coefficient is 0
+	vectors = [][]float32{{1, 0}, {float32(math.Cos(0.1)), float32(math.Sin(0.1))}, {float32(math.Cos(1.1)), float32(math.Sin(1.1))}}
+	score, _ := cluster.Silhouette(vectors, []int{0, 0, 1})
+	a := 1 - math.Cos(0.1)
+	expected := ((1 - a/(1-math.Cos(1.1))) + (1 - a/(1-math.Cos(1))) + 0) / 3
+	if math.Abs(score-expected) > 1e-5 {
+		t.Errorf("Expected %f, got %f", expected, score)
+	}
+
+	if _, err := cluster.Silhouette(vectors, []int{0, 0, 0}); !errors.Is(err, cluster.ErrTooFewClusters) {
+		t.Errorf("Expected ErrTooFewClusters, got %v", err)
+	}
+}
+
+func TestDaviesBouldin(t *testing.T) {
+	vectors, truth := blobs(5, []int{20, 20, 20}, 32, 0.2)
+
+	good, err := cluster.DaviesBouldin(vectors, truth)
+	if err != nil {
+		t.Fatalf("Failed to compute Davies-Bouldin index: %v", err)
+	}
+	shuffled := make([]int, len(truth))
+	for i := range shuffled {
+		shuffled[i] = i % 3
+	}
+	bad, _ := cluster.DaviesBouldin(vectors, shuffled)
+	if good >= bad || good > 0.2 {
+		t.Errorf("Expected a low index for the true clusters, got %f against %f", good, bad)
+	}
+
+	// Noise is ignored
+	withNoise := append([]int(nil), truth...)
+	withNoise[0] = cluster.Noise
+	if _, err := cluster.DaviesBouldin(vectors, withNoise); err != nil {
+		t.Errorf("Unexpected error with noise: %v", err)
+	}
+	if _, err := cluster.DaviesBouldin(vectors, truth[:3]); err == nil {
+		t.Errorf("Expected an error for mismatched labels")
+	}
+}
+
+func TestLabelsAndClusters(t *testing.T) {
+	clusters := [][]int{{0, 3}, {1}}
+	labels := cluster.Labels(clusters, 5)
+	if fmt.Sprint(labels) != "[0 1 -1 0 -1]" {
+		t.Errorf("Expected [0 1 -1 0 -1], got %v", labels)
+	}
+	if fmt.Sprint(cluster.Clusters(labels)) != fmt.Sprint(clusters) {
+		t.Errorf("Expected %v, got %v", clusters, cluster.Clusters(labels))
+	}
+}
@@ -0,0 +1,91 @@
+package cluster
+
+import (
+	"sort"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// CommunityDetection finds groups of vectors with a cosine similarity of at
+// least threshold to a common vector, as the community_detection function of
+// sentence-transformers does.
+//
+// Every vector having at least minSize vectors, itself included, with a
+// similarity of at least threshold is the center of a candidate community
+// made of those vectors. Candidates are considered from the largest and kept
+// without the vectors already assigned to a previous community, as long as
+// minSize vectors remain. Communities are returned from the largest, each one
+// listing its members by decreasing similarity to its center, which comes
+// first unless it belongs to a previous community. Vectors in no community are
+// left out.
+func CommunityDetection(vectors [][]float32, threshold float64, minSize int) ([][]int, error) {
+	if len(vectors) == 0 {
+		return nil, nil
+	}
+	units, err := normalized(vectors)
+	if err != nil {
+		return nil, err
+	}
+	minSize = max(minSize, 1)
+
+	type member struct {
+		index      int
+		similarity float32
+	}
+	var candidates [][]int
+	similarities := make([]member, len(units))
+	for i, u := range units {
+		for j, v := range units {
+			similarities[j] = member{index: j, similarity: vecmath.Dot(u, v)}
+		}
+		// The vector itself ranks first whatever rounding errors, so that
+		// it is the center of its community
+		similarities[i].similarity = 2
+
+		var community []member
+		for _, m := range similarities {
+			if float64(m.similarity) >= threshold {
+				community = append(community, m)
+			}
+		}
+		if len(community) < minSize {
+			continue
+		}
+		sort.SliceStable(community, func(a, b int) bool {
+			return community[a].similarity > community[b].similarity
+		})
+		indices := make([]int, len(community))
+		for k, m := range community {
+			indices[k] = m.index
+		}
+		candidates = append(candidates, indices)
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return len(candidates[a]) > len(candidates[b])
+	})
+
+	assigned := make([]bool, len(units))
+	var communities [][]int
+	for _, candidate := range candidates {
+		var community []int
+		for _, i := range candidate {
+			if !assigned[i] {
+				community = append(community, i)
+			}
+		}
+		if len(community) < minSize {
+			continue
+		}
+		for _, i := range community {
+			assigned[i] = true
+		}
+		communities = append(communities, community)
+	}
+
+	// Removing assigned vectors may have shrunk communities below others
+	sort.SliceStable(communities, func(a, b int) bool {
+		return len(communities[a]) > len(communities[b])
+	})
+	return communities, nil
+}
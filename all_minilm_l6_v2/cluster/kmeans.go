@@ -0,0 +1,218 @@
+package cluster
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+const (
+	DefaultMaxIterations = 100
+	DefaultRestarts      = 1
+)
+
+type kmeansOptions struct {
+	maxIterations int
+	restarts      int
+	seed          int64
+}
+
+type KMeansOption = func(*kmeansOptions)
+
+// WithMaxIterations sets the maximum number of Lloyd iterations of a run.
+func WithMaxIterations(n int) KMeansOption {
+	return func(o *kmeansOptions) {
+		o.maxIterations = n
+	}
+}
+
+// WithRestarts sets the number of runs from different k-means++ seedings, the
+// run with the lowest inertia being kept.
+func WithRestarts(n int) KMeansOption {
+	return func(o *kmeansOptions) {
+		o.restarts = n
+	}
+}
+
+// WithSeed sets the seed of the random number generator used for seeding.
+func WithSeed(seed int64) KMeansOption {
+	return func(o *kmeansOptions) {
+		o.seed = seed
+	}
+}
+
+// KMeansResult is a clustering found by KMeans.
+type KMeansResult struct {
+	Labels []int
+	// Centroids are the unit-length mean directions of the clusters.
+	Centroids [][]float32
+	// Inertia is the sum of the cosine distances between the vectors and
+	// their centroid.
+	Inertia    float64
+	Iterations int
+}
+
+// KMeans clusters vectors into k clusters with spherical k-means: vectors are
+// compared by cosine distance and centroids are normalized means. Centroids
+// are seeded with k-means++ and clusters left empty are reseeded with the
+// vector furthest from its centroid.
+func KMeans(vectors [][]float32, k int, opts ...KMeansOption) (*KMeansResult, error) {
+	o := kmeansOptions{
+		maxIterations: DefaultMaxIterations,
+		restarts:      DefaultRestarts,
+		seed:          1,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if k <= 0 || k > len(vectors) {
+		return nil, fmt.Errorf("invalid number of clusters %d for %d vectors", k, len(vectors))
+	}
+	units, err := normalized(vectors)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(o.seed))
+	var best *KMeansResult
+	for range max(o.restarts, 1) {
+		result := sphericalKMeans(units, k, o.maxIterations, rng)
+		if best == nil || result.Inertia < best.Inertia {
+			best = result
+		}
+	}
+	return best, nil
+}
+
+func sphericalKMeans(units [][]float32, k, maxIterations int, rng *rand.Rand) *KMeansResult {
+	dim := len(units[0])
+	centroids := kmeansPlusPlus(units, k, rng)
+	labels := make([]int, len(units))
+	for i := range labels {
+		labels[i] = -1
+	}
+	distances := make([]float64, len(units))
+
+	result := &KMeansResult{Labels: labels, Centroids: centroids}
+	for result.Iterations < maxIterations {
+		result.Iterations++
+
+		changed := false
+		for i, v := range units {
+			c, d := nearest(v, centroids)
+			if c != labels[i] {
+				changed = true
+			}
+			labels[i], distances[i] = c, d
+		}
+		if !changed {
+			break
+		}
+
+		sums := make([][]float64, k)
+		counts := make([]int, k)
+		for c := range sums {
+			sums[c] = make([]float64, dim)
+		}
+		for i, v := range units {
+			c := labels[i]
+			counts[c]++
+			for d, x := range v {
+				sums[c][d] += float64(x)
+			}
+		}
+
+		for c := range centroids {
+			if counts[c] == 0 {
+				far := furthest(distances)
+				copy(centroids[c], units[far])
+				distances[far] = 0
+				continue
+			}
+			var norm float64
+			for _, x := range sums[c] {
+				norm += x * x
+			}
+			norm = math.Sqrt(norm)
+			for d := range centroids[c] {
+				if norm > 0 {
+					centroids[c][d] = float32(sums[c][d] / norm)
+				}
+			}
+		}
+	}
+
+	result.Inertia = 0
+	for i, v := range units {
+		result.Inertia += cosineDistance(v, centroids[labels[i]])
+	}
+	return result
+}
+
+// kmeansPlusPlus picks k initial centroids, each new one being drawn with a
+// probability proportional to its squared cosine distance to the closest
+// centroid already picked.
+func kmeansPlusPlus(units [][]float32, k int, rng *rand.Rand) [][]float32 {
+	centroids := make([][]float32, 0, k)
+	centroids = append(centroids, clone(units[rng.Intn(len(units))]))
+
+	closest := make([]float64, len(units))
+	for i := range closest {
+		closest[i] = math.Inf(1)
+	}
+
+	for len(centroids) < k {
+		last := centroids[len(centroids)-1]
+		var total float64
+		for i, v := range units {
+			d := cosineDistance(v, last)
+			closest[i] = min(closest[i], d*d)
+			total += closest[i]
+		}
+
+		next := rng.Intn(len(units))
+		if total > 0 {
+			target := rng.Float64() * total
+			for i, d := range closest {
+				target -= d
+				if target <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, clone(units[next]))
+	}
+	return centroids
+}
+
+// nearest returns the index of the centroid closest to v and its cosine
+// distance.
+func nearest(v []float32, centroids [][]float32) (int, float64) {
+	best, bestSimilarity := 0, float32(math.Inf(-1))
+	for c, centroid := range centroids {
+		if s := vecmath.Dot(v, centroid); s > bestSimilarity {
+			best, bestSimilarity = c, s
+		}
+	}
+	return best, max(1-float64(bestSimilarity), 0)
+}
+
+func furthest(distances []float64) int {
+	far := 0
+	for i, d := range distances {
+		if d > distances[far] {
+			far = i
+		}
+	}
+	return far
+}
+
+func clone(v []float32) []float32 {
+	out := make([]float32, len(v))
+	copy(out, v)
+	return out
+}
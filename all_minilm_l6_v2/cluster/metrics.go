@@ -0,0 +1,148 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrTooFewClusters is returned by the quality scores when the labels do not
+// define at least two clusters.
+var ErrTooFewClusters = errors.New("at least two clusters are needed")
+
+// Silhouette returns the mean silhouette coefficient of the clustering, with
+// the cosine distance. The coefficient of a vector is (b - a) / max(a, b),
+// where a is its mean distance to the other vectors of its cluster and b the
+// lowest mean distance to the vectors of another cluster. It ranges from -1 to
+// 1, higher being better. Vectors alone in their cluster have a coefficient of
+// 0, and Noise vectors are ignored.
+//
+// It computes every pairwise distance, which takes O(n²) dot products.
+func Silhouette(vectors [][]float32, labels []int) (float64, error) {
+	units, clusters, err := prepareScore(vectors, labels)
+	if err != nil {
+		return 0, err
+	}
+
+	var total float64
+	var count int
+	sums := make([]float64, len(clusters))
+	for i, u := range units {
+		if labels[i] == Noise {
+			continue
+		}
+		for c, members := range clusters {
+			sums[c] = 0
+			for _, j := range members {
+				sums[c] += cosineDistance(u, units[j])
+			}
+		}
+
+		count++
+		own := labels[i]
+		if len(clusters[own]) == 1 {
+			continue
+		}
+		a := sums[own] / float64(len(clusters[own])-1)
+		b := math.Inf(1)
+		for c, members := range clusters {
+			if c != own && len(members) > 0 {
+				b = min(b, sums[c]/float64(len(members)))
+			}
+		}
+		if s := max(a, b); s > 0 {
+			total += (b - a) / s
+		}
+	}
+	return total / float64(count), nil
+}
+
+// DaviesBouldin returns the Davies-Bouldin index of the clustering, with the
+// cosine distance to normalized cluster centroids. It is the mean over the
+// clusters of the highest ratio (s_i + s_j) / d_ij over the other clusters,
+// where s_i is the mean distance of the vectors of cluster i to its centroid
+// and d_ij the distance between the centroids. It is at least 0, lower being
+// better. Noise vectors are ignored.
+func DaviesBouldin(vectors [][]float32, labels []int) (float64, error) {
+	units, clusters, err := prepareScore(vectors, labels)
+	if err != nil {
+		return 0, err
+	}
+
+	dim := len(units[0])
+	var centroids [][]float32
+	var scatters []float64
+	for _, members := range clusters {
+		if len(members) == 0 {
+			continue
+		}
+		sum := make([]float64, dim)
+		for _, i := range members {
+			for d, x := range units[i] {
+				sum[d] += float64(x)
+			}
+		}
+		var norm float64
+		for _, x := range sum {
+			norm += x * x
+		}
+		norm = math.Sqrt(norm)
+		centroid := make([]float32, dim)
+		if norm > 0 {
+			for d := range centroid {
+				centroid[d] = float32(sum[d] / norm)
+			}
+		}
+
+		var scatter float64
+		for _, i := range members {
+			scatter += cosineDistance(units[i], centroid)
+		}
+		centroids = append(centroids, centroid)
+		scatters = append(scatters, scatter/float64(len(members)))
+	}
+
+	var total float64
+	for i := range centroids {
+		worst := 0.0
+		for j := range centroids {
+			if i == j {
+				continue
+			}
+			d := cosineDistance(centroids[i], centroids[j])
+			if d == 0 {
+				worst = math.Inf(1)
+				continue
+			}
+			worst = max(worst, (scatters[i]+scatters[j])/d)
+		}
+		total += worst
+	}
+	return total / float64(len(centroids)), nil
+}
+
+func prepareScore(vectors [][]float32, labels []int) ([][]float32, [][]int, error) {
+	if len(labels) != len(vectors) {
+		return nil, nil, fmt.Errorf("got %d labels for %d vectors", len(labels), len(vectors))
+	}
+	for i, label := range labels {
+		if label < Noise {
+			return nil, nil, fmt.Errorf("invalid label %d for vector %d", label, i)
+		}
+	}
+	clusters := Clusters(labels)
+	nonEmpty := 0
+	for _, members := range clusters {
+		if len(members) > 0 {
+			nonEmpty++
+		}
+	}
+	if nonEmpty < 2 {
+		return nil, nil, ErrTooFewClusters
+	}
+	units, err := normalized(vectors)
+	if err != nil {
+		return nil, nil, err
+	}
+	return units, clusters, nil
+}
@@ -0,0 +1,535 @@
+// Package collection implements a persistent, mutable collection of vectors
+// identified by string ids.
+//
+// Every upsert and delete is appended to a write-ahead log and synced before
+// it is acknowledged, so a crash never loses an acknowledged operation and a
+// record torn by a crash is discarded when the collection is reopened.
+// Deleted and replaced vectors are tombstoned, and compaction, which runs in
+// the background once enough of them accumulate, rewrites the live vectors
+// into a snapshot and starts a new log.
+package collection
+
+import (
+	"container/heap"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/store"
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+const (
+	// DefaultCompactionRatio is the default fraction of tombstoned vectors
+	// that triggers a background compaction.
+	DefaultCompactionRatio = 0.3
+	// DefaultCompactionMinDeleted is the default number of tombstoned
+	// vectors below which no background compaction is triggered.
+	DefaultCompactionMinDeleted = 1000
+	// DefaultMaxWALSize is the default size in bytes of the write-ahead log
+	// above which a background compaction is triggered.
+	DefaultMaxWALSize = 64 << 20
+)
+
+var (
+	// ErrCorrupted is returned when a snapshot does not match its checksums.
+	ErrCorrupted = store.ErrCorrupted
+	// ErrDimensionMismatch is returned when a vector does not have the
+	// dimension of the collection.
+	ErrDimensionMismatch = errors.New("dimension mismatch")
+	// ErrClosed is returned when using a closed collection.
+	ErrClosed = errors.New("collection closed")
+)
+
+type options struct {
+	fingerprint          *[32]byte
+	compactionRatio      float64
+	compactionMinDeleted int
+	maxWALSize           int64
+}
+
+type Option = func(*options)
+
+// WithFingerprint records the fingerprint of the model that produced the
+// vectors, typically Model.Fingerprint(), and makes Open fail with
+// store.ErrFingerprintMismatch if the collection was built by another model.
+// The fingerprint is recorded by the first Open given one, and kept by later
+// ones without it.
+func WithFingerprint(fingerprint [32]byte) Option {
+	return func(o *options) {
+		o.fingerprint = &fingerprint
+	}
+}
+
+// WithCompactionThreshold sets the fraction of tombstoned vectors and the
+// minimum number of them that trigger a background compaction. A ratio of 0
+// disables compactions triggered by deletes.
+func WithCompactionThreshold(ratio float64, minDeleted int) Option {
+	return func(o *options) {
+		o.compactionRatio = ratio
+		o.compactionMinDeleted = minDeleted
+	}
+}
+
+// WithMaxWALSize sets the size in bytes of the write-ahead log above which a
+// background compaction is triggered. A size of 0 disables compactions
+// triggered by the log size.
+func WithMaxWALSize(size int64) Option {
+	return func(o *options) {
+		o.maxWALSize = size
+	}
+}
+
+// Result is a vector found by Search along with its cosine similarity to the
+// query.
+type Result struct {
+	ID    string
+	Score float32
+}
+
+// Collection is a persistent set of vectors identified by string ids.
+//
+// A Collection is safe for concurrent use. A directory must be opened by a
+// single Collection at a time.
+type Collection struct {
+	dir     string
+	dim     int
+	options options
+	// fingerprint is the fingerprint recorded in the manifest, nil if none.
+	fingerprint *[32]byte
+
+	mu         sync.RWMutex
+	ids        []string
+	vectors    [][]float32
+	deleted    []bool
+	positions  map[string]int
+	tombstones int
+	wal        *wal
+	walGen     uint64
+	closed     bool
+
+	// compactMu serializes compactions, compacting tells whether one runs
+	// in the background and compactErr holds the error of the last one.
+	compactMu  sync.Mutex
+	compacting bool
+	compactErr error
+	background sync.WaitGroup
+}
+
+// Open opens the collection of vectors of the given dimension stored in dir,
+// creating it if needed, and recovers every operation acknowledged before the
+// collection was last closed or crashed.
+func Open(dir string, dim int, opts ...Option) (*Collection, error) {
+	o := options{
+		compactionRatio:      DefaultCompactionRatio,
+		compactionMinDeleted: DefaultCompactionMinDeleted,
+		maxWALSize:           DefaultMaxWALSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if dim <= 0 {
+		return nil, fmt.Errorf("invalid dimension: %d", dim)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create collection directory: %w", err)
+	}
+
+	c := &Collection{
+		dir:       dir,
+		dim:       dim,
+		options:   o,
+		positions: make(map[string]int),
+	}
+	if err := c.recover(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Collection) recover() error {
+	m, err := readManifest(c.dir)
+	if err != nil {
+		return err
+	}
+
+	if m.Fingerprint != "" {
+		fingerprint, err := hex.DecodeString(m.Fingerprint)
+		if err != nil || len(fingerprint) != 32 {
+			return fmt.Errorf("%w: invalid manifest fingerprint %q", ErrCorrupted, m.Fingerprint)
+		}
+		c.fingerprint = (*[32]byte)(fingerprint)
+	}
+	if m.Generation > 0 {
+		ids, vectors, fingerprint, err := readSnapshot(c.dir, m.Generation, c.dim)
+		if err != nil {
+			return fmt.Errorf("failed to load snapshot: %w", err)
+		}
+		// Manifests written before fingerprints were recorded in them
+		// leave it to the snapshot
+		if c.fingerprint == nil && fingerprint != [32]byte{} {
+			c.fingerprint = &fingerprint
+		}
+		for i := range ids {
+			c.apply(record{op: opUpsert, id: ids[i], vector: vectors[i]})
+		}
+	}
+	if err := c.checkFingerprint(m); err != nil {
+		return err
+	}
+
+	gens, err := generations(c.dir, "wal", ".log")
+	if err != nil {
+		return fmt.Errorf("failed to list write-ahead logs: %w", err)
+	}
+	c.walGen = m.Generation
+	var walSize int64
+	for _, gen := range gens {
+		if gen < m.Generation {
+			continue
+		}
+		walSize, err = replayWAL(walPath(c.dir, gen), c.dim, c.apply)
+		if err != nil {
+			return fmt.Errorf("failed to replay write-ahead log: %w", err)
+		}
+		c.walGen = gen
+	}
+
+	// Only the last log can end with a torn record, the others having been
+	// closed by a compaction after their last acknowledged write.
+	if c.wal, err = openWAL(walPath(c.dir, c.walGen), walSize); err != nil {
+		return err
+	}
+	c.removeObsoleteFiles(m.Generation)
+	return nil
+}
+
+// checkFingerprint checks the fingerprint given to Open against the recorded
+// one, recording it in the manifest m if there is none.
+func (c *Collection) checkFingerprint(m manifest) error {
+	fingerprint := c.options.fingerprint
+	switch {
+	case fingerprint == nil:
+		return nil
+	case c.fingerprint == nil:
+		m.Fingerprint = hex.EncodeToString(fingerprint[:])
+		if err := writeManifest(c.dir, m); err != nil {
+			return err
+		}
+		c.fingerprint = fingerprint
+		return nil
+	case *c.fingerprint != *fingerprint:
+		return fmt.Errorf("%w: collection was written with model %x, got %x", store.ErrFingerprintMismatch, c.fingerprint[:8], fingerprint[:8])
+	}
+	return nil
+}
+
+// removeObsoleteFiles removes the files of generations before gen, and the
+// snapshots of generations after it, which are left behind by a compaction
+// interrupted before it updated the manifest.
+func (c *Collection) removeObsoleteFiles(gen uint64) {
+	gens, _ := generations(c.dir, "wal", ".log")
+	for _, g := range gens {
+		if g < gen {
+			os.Remove(walPath(c.dir, g))
+		}
+	}
+	gens, _ = generations(c.dir, "snapshot", ".ids")
+	vecGens, _ := generations(c.dir, "snapshot", ".vec")
+	for _, g := range append(gens, vecGens...) {
+		if g != gen {
+			os.Remove(snapshotVectorsPath(c.dir, g))
+			os.Remove(snapshotIDsPath(c.dir, g))
+		}
+	}
+	_ = syncDir(c.dir)
+}
+
+// apply applies an operation to the in-memory state.
+func (c *Collection) apply(r record) {
+	if pos, ok := c.positions[r.id]; ok {
+		c.deleted[pos] = true
+		c.tombstones++
+		delete(c.positions, r.id)
+	}
+	if r.op == opUpsert {
+		c.positions[r.id] = len(c.ids)
+		c.ids = append(c.ids, r.id)
+		c.vectors = append(c.vectors, r.vector)
+		c.deleted = append(c.deleted, false)
+	}
+}
+
+// Dim returns the dimension of the vectors of the collection.
+func (c *Collection) Dim() int {
+	return c.dim
+}
+
+// Len returns the number of vectors in the collection.
+func (c *Collection) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.positions)
+}
+
+// Get returns the vector with the given id.
+func (c *Collection) Get(id string) ([]float32, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pos, ok := c.positions[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]float32(nil), c.vectors[pos]...), true
+}
+
+// Upsert inserts the vector with the given id, replacing any vector with the
+// same id. The vector is durable once Upsert returns.
+func (c *Collection) Upsert(id string, vector []float32) error {
+	return c.UpsertBatch([]string{id}, [][]float32{vector})
+}
+
+// UpsertBatch upserts vectors with their ids, ids[i] being the id of
+// vectors[i], with a single sync of the write-ahead log.
+func (c *Collection) UpsertBatch(ids []string, vectors [][]float32) error {
+	if len(ids) != len(vectors) {
+		return fmt.Errorf("got %d ids for %d vectors", len(ids), len(vectors))
+	}
+	records := make([]record, len(ids))
+	for i, v := range vectors {
+		if len(v) != c.dim {
+			return fmt.Errorf("%w: %d != %d", ErrDimensionMismatch, len(v), c.dim)
+		}
+		records[i] = record{op: opUpsert, id: ids[i], vector: append([]float32(nil), v...)}
+	}
+	return c.write(records)
+}
+
+// Delete removes the vector with the given id and reports whether it was
+// present. The deletion is durable once Delete returns.
+func (c *Collection) Delete(id string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false, ErrClosed
+	}
+	if _, ok := c.positions[id]; !ok {
+		return false, nil
+	}
+	return true, c.writeLocked([]record{{op: opDelete, id: id}})
+}
+
+func (c *Collection) write(records []record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	return c.writeLocked(records)
+}
+
+// writeLocked logs and applies the records, starting a background compaction
+// if needed. It must be called with mu held.
+func (c *Collection) writeLocked(records []record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := c.wal.append(records...); err != nil {
+		return err
+	}
+	for _, r := range records {
+		c.apply(r)
+	}
+
+	if !c.compacting && c.needsCompaction() {
+		c.compacting = true
+		c.background.Add(1)
+		go func() {
+			defer c.background.Done()
+			c.compactMu.Lock()
+			if err := c.compact(); err != nil {
+				c.compactErr = err
+			}
+			c.compactMu.Unlock()
+
+			c.mu.Lock()
+			c.compacting = false
+			c.mu.Unlock()
+		}()
+	}
+	return nil
+}
+
+func (c *Collection) needsCompaction() bool {
+	o := c.options
+	if o.maxWALSize > 0 && c.wal.size > o.maxWALSize {
+		return true
+	}
+	return o.compactionRatio > 0 && c.tombstones >= o.compactionMinDeleted &&
+		float64(c.tombstones) >= o.compactionRatio*float64(len(c.ids))
+}
+
+// Compact drops the tombstoned vectors, writes the live ones to a snapshot
+// and removes the write-ahead logs it covers. Writes are only blocked while
+// the in-memory state is compacted, not while the snapshot is written.
+//
+// Compact also returns the error of a failed background compaction.
+func (c *Collection) Compact() error {
+	c.compactMu.Lock()
+	defer c.compactMu.Unlock()
+
+	if err := c.compactErr; err != nil {
+		c.compactErr = nil
+		return fmt.Errorf("failed to compact in the background: %w", err)
+	}
+
+	c.mu.RLock()
+	closed := c.closed
+	c.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+	return c.compact()
+}
+
+// compact implements Compact. It must be called with compactMu held, and also
+// runs in the background while the collection is being closed.
+func (c *Collection) compact() error {
+	c.mu.Lock()
+	gen := c.walGen + 1
+	next, err := openWAL(walPath(c.dir, gen), 0)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if err := syncDir(c.dir); err != nil {
+		c.mu.Unlock()
+		next.close()
+		return fmt.Errorf("failed to sync collection directory: %w", err)
+	}
+	c.wal.close()
+	c.wal, c.walGen = next, gen
+
+	ids := make([]string, 0, len(c.positions))
+	vectors := make([][]float32, 0, len(c.positions))
+	for i, id := range c.ids {
+		if !c.deleted[i] {
+			c.positions[id] = len(ids)
+			ids = append(ids, id)
+			vectors = append(vectors, c.vectors[i])
+		}
+	}
+	// Later writes append to fresh copies, leaving the slices being written
+	// to the snapshot untouched.
+	c.ids = ids[:len(ids):len(ids)]
+	c.vectors = vectors[:len(vectors):len(vectors)]
+	c.deleted = make([]bool, len(ids))
+	c.tombstones = 0
+	c.mu.Unlock()
+
+	m := manifest{Generation: gen}
+	var fingerprint [32]byte
+	if c.fingerprint != nil {
+		fingerprint = *c.fingerprint
+		m.Fingerprint = hex.EncodeToString(fingerprint[:])
+	}
+	if err := writeSnapshot(c.dir, gen, ids, vectors, c.dim, fingerprint); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := writeManifest(c.dir, m); err != nil {
+		return err
+	}
+	c.removeObsoleteFiles(gen)
+	return nil
+}
+
+// Search scans the live vectors and returns the k most similar to query
+// sorted by decreasing cosine similarity.
+func (c *Collection) Search(query []float32, k int) ([]Result, error) {
+	if len(query) != c.dim {
+		return nil, fmt.Errorf("%w: %d != %d", ErrDimensionMismatch, len(query), c.dim)
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	best := &resultHeap{}
+	for i, v := range c.vectors {
+		if c.deleted[i] {
+			continue
+		}
+		s := scoredPosition{position: i, score: vecmath.Cosine(query, v)}
+		if best.Len() < k {
+			heap.Push(best, s)
+		} else if best.less((*best)[0], s) {
+			(*best)[0] = s
+			heap.Fix(best, 0)
+		}
+	}
+
+	results := make([]Result, best.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		s := heap.Pop(best).(scoredPosition)
+		results[i] = Result{ID: c.ids[s.position], Score: s.score}
+	}
+	return results, nil
+}
+
+// Close waits for a background compaction to finish and closes the
+// write-ahead log. It returns the error of a failed background compaction.
+func (c *Collection) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	// No compaction starts once closed is set, wait for the running ones.
+	c.background.Wait()
+	c.compactMu.Lock()
+	defer c.compactMu.Unlock()
+
+	err := c.wal.close()
+	if c.compactErr != nil {
+		return fmt.Errorf("failed to compact in the background: %w", c.compactErr)
+	}
+	return err
+}
+
+type scoredPosition struct {
+	position int
+	score    float32
+}
+
+// resultHeap is a min-heap keeping the worst of the best results at the root.
+type resultHeap []scoredPosition
+
+func (h resultHeap) less(a, b scoredPosition) bool {
+	if a.score != b.score {
+		return a.score < b.score
+	}
+	return a.position > b.position
+}
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x any)        { *h = append(*h, x.(scoredPosition)) }
+
+func (h *resultHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,410 @@
+package collection_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/collection"
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/store"
+)
+
+const dim = 8
+
+func randomVector(rng *rand.Rand) []float32 {
+	v := make([]float32, dim)
+	for d := range v {
+		v[d] = float32(rng.NormFloat64())
+	}
+	return v
+}
+
+func open(t *testing.T, dir string, opts ...collection.Option) *collection.Collection {
+	t.Helper()
+
+	c, err := collection.Open(dir, dim, opts...)
+	if err != nil {
+		t.Fatalf("Failed to open collection: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// checkContent checks that the collection holds exactly the expected vectors.
+func checkContent(t *testing.T, c *collection.Collection, expected map[string][]float32) {
+	t.Helper()
+
+	if c.Len() != len(expected) {
+		t.Fatalf("Expected %d vectors, got %d", len(expected), c.Len())
+	}
+	for id, v := range expected {
+		got, ok := c.Get(id)
+		if !ok {
+			t.Fatalf("Vector %q is missing", id)
+		}
+		for d := range v {
+			if got[d] != v[d] {
+				t.Fatalf("Vector %q differs at %d: %f != %f", id, d, got[d], v[d])
+			}
+		}
+	}
+}
+
+func walSize(t *testing.T, dir string) int64 {
+	t.Helper()
+
+	info, err := os.Stat(filepath.Join(dir, "wal-000000.log"))
+	if err != nil {
+		t.Fatalf("Failed to stat write-ahead log: %v", err)
+	}
+	return info.Size()
+}
+
+func copyDir(t *testing.T, src string) string {
+	t.Helper()
+
+	dst := t.TempDir()
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(src, e.Name()))
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dst, e.Name()), data, 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	return dst
+}
+
+func TestUpsertAndDeleteSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(1))
+	expected := make(map[string][]float32)
+
+	c := open(t, dir)
+	for i := range 20 {
+		id := fmt.Sprintf("doc-%d", i)
+		expected[id] = randomVector(rng)
+		if err := c.Upsert(id, expected[id]); err != nil {
+			t.Fatalf("Failed to upsert %q: %v", id, err)
+		}
+	}
+	expected["doc-3"] = randomVector(rng)
+	if err := c.Upsert("doc-3", expected["doc-3"]); err != nil {
+		t.Fatalf("Failed to replace doc-3: %v", err)
+	}
+	for _, id := range []string{"doc-5", "doc-7"} {
+		delete(expected, id)
+		if deleted, err := c.Delete(id); err != nil || !deleted {
+			t.Fatalf("Failed to delete %q: %v", id, err)
+		}
+	}
+	if deleted, err := c.Delete("doc-5"); err != nil || deleted {
+		t.Errorf("Expected deleting a missing id to report false, got %v, %v", deleted, err)
+	}
+	checkContent(t, c, expected)
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Failed to close collection: %v", err)
+	}
+	if err := c.Upsert("doc-0", expected["doc-0"]); !errors.Is(err, collection.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+
+	checkContent(t, open(t, dir), expected)
+}
+
+// TestTruncatedWAL simulates a crash at every byte of the last record of the
+// log and checks that the collection recovers every previous operation, and
+// keeps working afterwards.
+func TestTruncatedWAL(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(2))
+
+	c := open(t, dir)
+	states := []map[string][]float32{{}}
+	sizes := []int64{0}
+	for i := range 6 {
+		state := make(map[string][]float32)
+		for id, v := range states[len(states)-1] {
+			state[id] = v
+		}
+
+		id := fmt.Sprintf("doc-%d", i%4)
+		if i == 4 {
+			delete(state, "doc-1")
+			_, _ = c.Delete("doc-1")
+		} else {
+			state[id] = randomVector(rng)
+			_ = c.Upsert(id, state[id])
+		}
+		states = append(states, state)
+		sizes = append(sizes, walSize(t, dir))
+	}
+	c.Close()
+
+	for op := 1; op < len(states); op++ {
+		for size := sizes[op-1]; size < sizes[op]; size++ {
+			crashed := copyDir(t, dir)
+			if err := os.Truncate(filepath.Join(crashed, "wal-000000.log"), size); err != nil {
+				t.Fatalf("Failed to truncate write-ahead log: %v", err)
+			}
+
+			c, err := collection.Open(crashed, dim)
+			if err != nil {
+				t.Fatalf("Failed to open collection truncated at %d: %v", size, err)
+			}
+			checkContent(t, c, states[op-1])
+
+			// The torn record must not hide the records written after
+			// recovery.
+			v := randomVector(rng)
+			if err := c.Upsert("after-crash", v); err != nil {
+				t.Fatalf("Failed to upsert after recovery: %v", err)
+			}
+			c.Close()
+
+			expected := map[string][]float32{"after-crash": v}
+			for id, v := range states[op-1] {
+				expected[id] = v
+			}
+			checkContent(t, open(t, crashed), expected)
+		}
+	}
+}
+
+func TestCorruptedWALRecordStopsReplay(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(3))
+	expected := make(map[string][]float32)
+
+	c := open(t, dir)
+	for i := range 10 {
+		id := fmt.Sprintf("doc-%d", i)
+		v := randomVector(rng)
+		if i < 5 {
+			expected[id] = v
+		}
+		_ = c.Upsert(id, v)
+	}
+	c.Close()
+
+	// Every record has the same size, flip a byte of the vector of the
+	// sixth one
+	recordSize := walSize(t, dir) / 10
+	f, err := os.OpenFile(filepath.Join(dir, "wal-000000.log"), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open write-ahead log: %v", err)
+	}
+	_, _ = f.WriteAt([]byte{0x42}, 5*recordSize+recordSize-3)
+	f.Close()
+
+	checkContent(t, open(t, dir), expected)
+}
+
+func TestCompaction(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(4))
+	fingerprint := [32]byte{1, 2, 3}
+	expected := make(map[string][]float32)
+
+	c := open(t, dir, collection.WithFingerprint(fingerprint))
+	for i := range 100 {
+		id := fmt.Sprintf("doc-%d", i)
+		expected[id] = randomVector(rng)
+		_ = c.Upsert(id, expected[id])
+	}
+	for i := 0; i < 100; i += 2 {
+		id := fmt.Sprintf("doc-%d", i)
+		delete(expected, id)
+		_, _ = c.Delete(id)
+	}
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	checkContent(t, c, expected)
+
+	// Writes after the compaction go to the new log
+	expected["doc-0"] = randomVector(rng)
+	_ = c.Upsert("doc-0", expected["doc-0"])
+	delete(expected, "doc-1")
+	_, _ = c.Delete("doc-1")
+	c.Close()
+
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if fmt.Sprint(names) != "[MANIFEST snapshot-000001.ids snapshot-000001.vec wal-000001.log]" {
+		t.Errorf("Unexpected files after compaction: %v", names)
+	}
+
+	checkContent(t, open(t, dir, collection.WithFingerprint(fingerprint)), expected)
+
+	if _, err := collection.Open(dir, dim, collection.WithFingerprint([32]byte{4})); !errors.Is(err, store.ErrFingerprintMismatch) {
+		t.Errorf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+	if _, err := collection.Open(dir, dim+1); !errors.Is(err, collection.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(6))
+	expected := map[string][]float32{"doc": randomVector(rng)}
+
+	// The fingerprint is checked before any compaction
+	c := open(t, dir, collection.WithFingerprint([32]byte{1}))
+	_ = c.Upsert("doc", expected["doc"])
+	c.Close()
+	if _, err := collection.Open(dir, dim, collection.WithFingerprint([32]byte{2})); !errors.Is(err, store.ErrFingerprintMismatch) {
+		t.Errorf("Expected ErrFingerprintMismatch before compaction, got %v", err)
+	}
+
+	// Compacting without the fingerprint keeps it
+	c = open(t, dir)
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	c.Close()
+	if _, err := collection.Open(dir, dim, collection.WithFingerprint([32]byte{2})); !errors.Is(err, store.ErrFingerprintMismatch) {
+		t.Errorf("Expected ErrFingerprintMismatch after compaction, got %v", err)
+	}
+	checkContent(t, open(t, dir, collection.WithFingerprint([32]byte{1})), expected)
+}
+
+func TestFingerprintRecordedLater(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(7))
+	expected := map[string][]float32{"doc": randomVector(rng)}
+
+	c := open(t, dir)
+	_ = c.Upsert("doc", expected["doc"])
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	c.Close()
+
+	// A collection created without a fingerprint records the first one given
+	c = open(t, dir, collection.WithFingerprint([32]byte{1}))
+	checkContent(t, c, expected)
+	c.Close()
+	if _, err := collection.Open(dir, dim, collection.WithFingerprint([32]byte{2})); !errors.Is(err, store.ErrFingerprintMismatch) {
+		t.Errorf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+}
+
+// TestInterruptedCompaction simulates a crash after a compaction started a
+// new log but before it updated the manifest.
+func TestInterruptedCompaction(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(5))
+	expected := make(map[string][]float32)
+
+	c := open(t, dir)
+	for i := range 10 {
+		id := fmt.Sprintf("doc-%d", i)
+		expected[id] = randomVector(rng)
+		_ = c.Upsert(id, expected[id])
+	}
+	firstLog, err := os.ReadFile(filepath.Join(dir, "wal-000000.log"))
+	if err != nil {
+		t.Fatalf("Failed to read write-ahead log: %v", err)
+	}
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	_, _ = c.Delete("doc-2")
+	delete(expected, "doc-2")
+	c.Close()
+
+	// Put the directory back in the state of a crash while the snapshot was
+	// being written: the manifest and the first log are still there and the
+	// snapshot is partial
+	_ = os.Remove(filepath.Join(dir, "MANIFEST"))
+	_ = os.WriteFile(filepath.Join(dir, "wal-000000.log"), firstLog, 0o644)
+	_ = os.Truncate(filepath.Join(dir, "snapshot-000001.vec"), 100)
+
+	checkContent(t, open(t, dir), expected)
+	if _, err := os.Stat(filepath.Join(dir, "snapshot-000001.vec")); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial snapshot to be removed, got %v", err)
+	}
+}
+
+func TestBackgroundCompaction(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(6))
+	expected := make(map[string][]float32)
+
+	c := open(t, dir, collection.WithCompactionThreshold(0.5, 10))
+	for i := range 40 {
+		id := fmt.Sprintf("doc-%d", i)
+		expected[id] = randomVector(rng)
+		_ = c.Upsert(id, expected[id])
+	}
+	for i := range 30 {
+		id := fmt.Sprintf("doc-%d", i)
+		delete(expected, id)
+		if _, err := c.Delete(id); err != nil {
+			t.Fatalf("Failed to delete %q: %v", id, err)
+		}
+	}
+	checkContent(t, c, expected)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Failed to close collection: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "MANIFEST")); err != nil {
+		t.Errorf("Expected a background compaction to write a manifest: %v", err)
+	}
+	checkContent(t, open(t, dir), expected)
+}
+
+func TestSearch(t *testing.T) {
+	c := open(t, t.TempDir())
+	rng := rand.New(rand.NewSource(7))
+
+	vectors := make([][]float32, 50)
+	for i := range vectors {
+		vectors[i] = randomVector(rng)
+		_ = c.Upsert(fmt.Sprintf("doc-%d", i), vectors[i])
+	}
+	_, _ = c.Delete("doc-10")
+
+	results, err := c.Search(vectors[10], 5)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("Expected 5 results, got %d", len(results))
+	}
+	for i, r := range results {
+		if r.ID == "doc-10" {
+			t.Errorf("Deleted vector returned at %d", i)
+		}
+		if i > 0 && r.Score > results[i-1].Score {
+			t.Errorf("Results not sorted at %d", i)
+		}
+	}
+
+	results, _ = c.Search(vectors[20], 1)
+	if len(results) != 1 || results[0].ID != "doc-20" {
+		t.Errorf("Expected doc-20 first, got %v", results)
+	}
+
+	if _, err := c.Search([]float32{1}, 5); !errors.Is(err, collection.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+	if err := c.Upsert("bad", []float32{1}); !errors.Is(err, collection.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package collection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/store"
+)
+
+// A collection directory holds:
+//
+//	MANIFEST             the current generation and the fingerprint of the
+//	                     model, as JSON
+//	snapshot-N.vec       the vectors of generation N, a store file whose ids
+//	                     are the positions of the vectors
+//	snapshot-N.ids       the string ids of generation N
+//	wal-N.log            the operations applied after snapshot N
+//
+// Opening a collection loads the snapshot of the current generation, if any,
+// and replays every log from that generation on in order. Compaction starts a
+// new log before writing the snapshot of the new generation, and only then
+// moves the manifest to it, so a crash at any point leaves a manifest whose
+// snapshot and logs cover every acknowledged operation.
+
+const (
+	manifestName = "MANIFEST"
+	idsMagic     = "MINILMID"
+)
+
+type manifest struct {
+	// Generation is the generation of the snapshot to load, 0 meaning that
+	// there is no snapshot.
+	Generation uint64 `json:"generation"`
+	// Fingerprint is the hex encoded fingerprint of the model that produced
+	// the vectors, empty if none was given.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+func snapshotVectorsPath(dir string, gen uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("snapshot-%06d.vec", gen))
+}
+
+func snapshotIDsPath(dir string, gen uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("snapshot-%06d.ids", gen))
+}
+
+func walPath(dir string, gen uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("wal-%06d.log", gen))
+}
+
+func readManifest(dir string) (manifest, error) {
+	var m manifest
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("%w: invalid manifest: %v", ErrCorrupted, err)
+	}
+	return m, nil
+}
+
+func writeManifest(dir string, m manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, manifestName), data); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// generations returns the sorted generations of the files of dir named
+// prefix-N.suffix.
+func generations(dir, prefix, suffix string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var gens []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix+"-") || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		gen, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, prefix+"-"), suffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		gens = append(gens, gen)
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i] < gens[j] })
+	return gens, nil
+}
+
+// writeSnapshot writes the vectors and ids of generation gen.
+func writeSnapshot(dir string, gen uint64, ids []string, vectors [][]float32, dim int, fingerprint [32]byte) error {
+	w, err := store.Create(snapshotVectorsPath(dir, gen), dim,
+		store.WithFingerprint(fingerprint), store.WithCapacity(len(vectors)))
+	if err != nil {
+		return err
+	}
+	positions := make([]uint64, len(vectors))
+	for i := range positions {
+		positions[i] = uint64(i)
+	}
+	if err := w.AppendBatch(positions, vectors); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	buf := []byte(idsMagic)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(ids)))
+	for _, id := range ids {
+		buf = binary.AppendUvarint(buf, uint64(len(id)))
+		buf = append(buf, id...)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+	return writeFileAtomic(snapshotIDsPath(dir, gen), buf)
+}
+
+// readSnapshot reads the vectors and ids of generation gen, checking them
+// against their checksums, along with the fingerprint of the snapshot, zero
+// if it was written without one.
+func readSnapshot(dir string, gen uint64, dim int) ([]string, [][]float32, [32]byte, error) {
+	r, err := store.Open(snapshotVectorsPath(dir, gen))
+	if err != nil {
+		return nil, nil, [32]byte{}, err
+	}
+	defer r.Close()
+
+	if r.Dim() != dim {
+		return nil, nil, [32]byte{}, fmt.Errorf("%w: snapshot has dimension %d, expected %d", ErrDimensionMismatch, r.Dim(), dim)
+	}
+	if err := r.Verify(); err != nil {
+		return nil, nil, [32]byte{}, err
+	}
+
+	ids, err := readIDs(snapshotIDsPath(dir, gen))
+	if err != nil {
+		return nil, nil, [32]byte{}, err
+	}
+	if len(ids) != r.Len() {
+		return nil, nil, [32]byte{}, fmt.Errorf("%w: snapshot has %d ids for %d vectors", ErrCorrupted, len(ids), r.Len())
+	}
+
+	// The vectors are copied since the snapshot is removed by the next
+	// compaction.
+	vectors := make([][]float32, r.Len())
+	for i := range vectors {
+		vectors[i] = append([]float32(nil), r.Vector(i)...)
+	}
+	return ids, vectors, r.Fingerprint(), nil
+}
+
+func readIDs(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot ids: %w", err)
+	}
+	if len(data) < len(idsMagic)+12 || string(data[:len(idsMagic)]) != idsMagic {
+		return nil, fmt.Errorf("%w: invalid snapshot ids", ErrCorrupted)
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, castagnoli) != sum {
+		return nil, fmt.Errorf("%w: snapshot ids checksum mismatch", ErrCorrupted)
+	}
+
+	r := bytes.NewReader(body[len(idsMagic)+8:])
+	count := binary.LittleEndian.Uint64(body[len(idsMagic):])
+	ids := make([]string, 0, min(count, uint64(len(body))))
+	for range count {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: truncated snapshot ids", ErrCorrupted)
+		}
+		id := make([]byte, n)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return nil, fmt.Errorf("%w: truncated snapshot ids", ErrCorrupted)
+		}
+		ids = append(ids, string(id))
+	}
+	return ids, nil
+}
+
+// writeFileAtomic writes data under a temporary name, syncs it and renames it
+// to path, so that path holds either its previous content or data.
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir makes the creation, removal and renaming of the files of dir
+// durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// Syncing a directory is not supported on every platform, in which case
+	// the operations are as durable as they can be.
+	_ = d.Sync()
+	return nil
+}
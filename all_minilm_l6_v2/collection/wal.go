@@ -0,0 +1,173 @@
+package collection
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+)
+
+// The write-ahead log is a sequence of records:
+//
+//	offset  size  field
+//	0       4     length n of the payload
+//	4       4     CRC-32C of the payload
+//	8       n     payload
+//
+// The payload starts with the operation, followed by the uvarint length of
+// the id and the id. Upserts end with the vector as little-endian float32
+// values.
+
+const (
+	opUpsert byte = 1
+	opDelete byte = 2
+
+	recordHeaderSize = 8
+	// maxRecordSize bounds the length read from a record header, so that a
+	// corrupted length does not trigger a huge allocation.
+	maxRecordSize = 1 << 24
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type record struct {
+	op     byte
+	id     string
+	vector []float32
+}
+
+func (r record) encode() []byte {
+	payload := make([]byte, 0, 1+binary.MaxVarintLen64+len(r.id)+4*len(r.vector))
+	payload = append(payload, r.op)
+	payload = binary.AppendUvarint(payload, uint64(len(r.id)))
+	payload = append(payload, r.id...)
+	for _, x := range r.vector {
+		payload = binary.LittleEndian.AppendUint32(payload, math.Float32bits(x))
+	}
+
+	buf := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(payload, castagnoli))
+	return append(buf, payload...)
+}
+
+var errInvalidRecord = errors.New("invalid record")
+
+func decodeRecord(payload []byte, dim int) (record, error) {
+	if len(payload) == 0 {
+		return record{}, errInvalidRecord
+	}
+	r := record{op: payload[0]}
+	idLen, n := binary.Uvarint(payload[1:])
+	if n <= 0 || uint64(len(payload)-1-n) < idLen {
+		return record{}, errInvalidRecord
+	}
+	rest := payload[1+n:]
+	r.id, rest = string(rest[:idLen]), rest[idLen:]
+
+	switch r.op {
+	case opUpsert:
+		if len(rest) != 4*dim {
+			return record{}, errInvalidRecord
+		}
+		r.vector = make([]float32, dim)
+		for i := range r.vector {
+			r.vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(rest[i*4:]))
+		}
+	case opDelete:
+		if len(rest) != 0 {
+			return record{}, errInvalidRecord
+		}
+	default:
+		return record{}, errInvalidRecord
+	}
+	return r, nil
+}
+
+// replayWAL calls apply for every valid record of the log at path and
+// returns the size of the valid prefix of the log. Replay stops at the first
+// truncated or corrupted record, which is what a crash in the middle of a
+// write leaves behind.
+func replayWAL(path string, dim int, apply func(record)) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var valid int64
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+		size := binary.LittleEndian.Uint32(header[0:])
+		if size > maxRecordSize {
+			break
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			break
+		}
+		if crc32.Checksum(payload, castagnoli) != binary.LittleEndian.Uint32(header[4:]) {
+			break
+		}
+		rec, err := decodeRecord(payload, dim)
+		if err != nil {
+			break
+		}
+		apply(rec)
+		valid += recordHeaderSize + int64(size)
+	}
+	return valid, nil
+}
+
+// wal appends records to a log file.
+type wal struct {
+	f    *os.File
+	size int64
+}
+
+// openWAL opens the log at path for appending, discarding anything past
+// validSize.
+func openWAL(path string, validSize int64) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+	if err := f.Truncate(validSize); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to truncate write-ahead log: %w", err)
+	}
+	return &wal{f: f, size: validSize}, nil
+}
+
+// append writes the records and syncs them. On failure, the log is truncated
+// back to its previous size so that no partial record is followed by valid
+// ones.
+func (w *wal) append(records ...record) error {
+	var buf []byte
+	for _, r := range records {
+		buf = append(buf, r.encode()...)
+	}
+
+	if _, err := w.f.WriteAt(buf, w.size); err != nil {
+		_ = w.f.Truncate(w.size)
+		return fmt.Errorf("failed to write to write-ahead log: %w", err)
+	}
+	if err := w.f.Sync(); err != nil {
+		_ = w.f.Truncate(w.size)
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	w.size += int64(len(buf))
+	return nil
+}
+
+func (w *wal) close() error {
+	return w.f.Close()
+}
@@ -0,0 +1,279 @@
+package all_minilm_l6_v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// DefaultCorpusBatchSize is the number of documents embedded per call to the
+// embedder by Corpus.Add.
+const DefaultCorpusBatchSize = 32
+
+// Embedder computes the embeddings of sentences. *Model implements it.
+type Embedder interface {
+	ComputeBatch(sentences []string, addSpecialTokens bool) ([][]float32, error)
+}
+
+// Document is a text indexed by a Corpus along with arbitrary metadata that
+// search filters can match on.
+type Document struct {
+	ID       string
+	Text     string
+	Metadata map[string]any
+}
+
+// SearchResult is a document found by Corpus.Search along with the cosine
+// similarity between its embedding and the query's.
+type SearchResult struct {
+	Document Document
+	Score    float64
+}
+
+// Corpus embeds documents and searches them by semantic similarity.
+//
+// A Corpus is safe for concurrent use.
+type Corpus struct {
+	embedder  Embedder
+	batchSize int
+
+	mu        sync.RWMutex
+	docs      []Document
+	vectors   [][]float32
+	positions map[string]int
+}
+
+type CorpusOption = func(*Corpus)
+
+// WithCorpusBatchSize sets the number of documents embedded per call to the
+// embedder. It defaults to DefaultCorpusBatchSize.
+func WithCorpusBatchSize(n int) CorpusOption {
+	return func(c *Corpus) {
+		c.batchSize = n
+	}
+}
+
+type searchOptions struct {
+	mmr           bool
+	mmrLambda     float64
+	mmrCandidates int
+}
+
+type SearchOption = func(*searchOptions)
+
+// WithMMR reranks the candidates most similar to the query with MMR to
+// diversify the results. The k results are selected among max(candidates, k)
+// candidates, and lambda, in [0, 1], trades relevance for diversity as in
+// MMR.
+func WithMMR(lambda float64, candidates int) SearchOption {
+	return func(o *searchOptions) {
+		o.mmr = true
+		o.mmrLambda = lambda
+		o.mmrCandidates = candidates
+	}
+}
+
+// NewCorpus creates an empty corpus embedding documents and queries with
+// embedder.
+func NewCorpus(embedder Embedder, opts ...CorpusOption) *Corpus {
+	c := &Corpus{
+		embedder:  embedder,
+		batchSize: DefaultCorpusBatchSize,
+		positions: make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.batchSize = max(c.batchSize, 1)
+	return c
+}
+
+// Add embeds docs and adds them to the corpus, replacing the documents having
+// the same ids. Either every document is added or none is.
+func (c *Corpus) Add(ctx context.Context, docs ...Document) error {
+	for _, doc := range docs {
+		if doc.ID == "" {
+			return errors.New("document id must not be empty")
+		}
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Text
+	}
+	vectors, err := embedAll(ctx, c.embedder, texts, c.batchSize)
+	if err != nil {
+		return fmt.Errorf("failed to embed documents: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dim := -1
+	if len(c.vectors) > 0 {
+		dim = len(c.vectors[0])
+	}
+	for _, v := range vectors {
+		if dim == -1 {
+			dim = len(v)
+		}
+		if err := checkDimensions(dim, len(v)); err != nil {
+			return err
+		}
+	}
+
+	for i, doc := range docs {
+		doc.Metadata = maps.Clone(doc.Metadata)
+		if pos, ok := c.positions[doc.ID]; ok {
+			c.docs[pos], c.vectors[pos] = doc, vectors[i]
+			continue
+		}
+		c.positions[doc.ID] = len(c.docs)
+		c.docs = append(c.docs, doc)
+		c.vectors = append(c.vectors, vectors[i])
+	}
+	return nil
+}
+
+// Remove removes the document with the given id and reports whether it was
+// present.
+func (c *Corpus) Remove(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pos, ok := c.positions[id]
+	if !ok {
+		return false
+	}
+	last := len(c.docs) - 1
+	if pos != last {
+		c.docs[pos], c.vectors[pos] = c.docs[last], c.vectors[last]
+		c.positions[c.docs[pos].ID] = pos
+	}
+	c.docs[last], c.vectors[last] = Document{}, nil
+	c.docs, c.vectors = c.docs[:last], c.vectors[:last]
+	delete(c.positions, id)
+	return true
+}
+
+// Get returns the document with the given id.
+func (c *Corpus) Get(id string) (Document, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pos, ok := c.positions[id]
+	if !ok {
+		return Document{}, false
+	}
+	return c.docs[pos], true
+}
+
+// Len returns the number of documents in the corpus.
+func (c *Corpus) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.docs)
+}
+
+// Search embeds query and returns the k documents most similar to it sorted
+// by decreasing score. Only the documents matched by filter are ranked, so k
+// results are returned as long as filter matches k documents. A nil filter
+// matches every document. With WithMMR, the results are in MMR selection
+// order instead.
+func (c *Corpus) Search(ctx context.Context, query string, k int, filter Filter, opts ...SearchOption) ([]SearchResult, error) {
+	var o searchOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.mmr && !(o.mmrLambda >= 0 && o.mmrLambda <= 1) {
+		return nil, fmt.Errorf("lambda must be in [0, 1], got %f", o.mmrLambda)
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+	candidates := k
+	if o.mmr {
+		candidates = max(o.mmrCandidates, k)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	embeddings, err := c.embedder.ComputeBatch([]string{query}, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(embeddings) != 1 {
+		return nil, fmt.Errorf("got %d embeddings for the query", len(embeddings))
+	}
+	queryVector := embeddings[0]
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.vectors) > 0 {
+		if err := checkDimensions(len(c.vectors[0]), len(queryVector)); err != nil {
+			return nil, err
+		}
+	}
+
+	best := &neighborHeap{}
+	for i, v := range c.vectors {
+		// Checking the context on every document would dominate the cost
+		// of scoring it.
+		if i%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if filter != nil && !filter.Match(c.docs[i].Metadata) {
+			continue
+		}
+		best.offer(candidates, Neighbor{Index: i, Score: CosineSimilarity(queryVector, v)})
+	}
+
+	neighbors := []Neighbor(*best)
+	sortNeighbors(neighbors)
+	if o.mmr {
+		vectors := make([][]float32, len(neighbors))
+		for i, n := range neighbors {
+			vectors[i] = c.vectors[n.Index]
+		}
+		selected, err := MMR(queryVector, vectors, k, o.mmrLambda)
+		if err != nil {
+			return nil, err
+		}
+		for i, s := range selected {
+			selected[i].Index = neighbors[s.Index].Index
+		}
+		neighbors = selected
+	}
+	results := make([]SearchResult, len(neighbors))
+	for i, n := range neighbors {
+		results[i] = SearchResult{Document: c.docs[n.Index], Score: n.Score}
+	}
+	return results, nil
+}
+
+// embedAll embeds texts with embedder, batchSize texts at a time, checking ctx
+// between batches.
+func embedAll(ctx context.Context, embedder Embedder, texts []string, batchSize int) ([][]float32, error) {
+	batchSize = max(batchSize, 1)
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := min(start+batchSize, len(texts))
+		embeddings, err := embedder.ComputeBatch(texts[start:end], true)
+		if err != nil {
+			return nil, err
+		}
+		if len(embeddings) != end-start {
+			return nil, fmt.Errorf("got %d embeddings for %d texts", len(embeddings), end-start)
+		}
+		vectors = append(vectors, embeddings...)
+	}
+	return vectors, nil
+}
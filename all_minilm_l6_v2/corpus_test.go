@@ -0,0 +1,230 @@
+package all_minilm_l6_v2_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+// bagOfWordsEmbedder embeds sentences as hashed bags of words, so that tests
+// exercising code built on an Embedder do not need the ONNX runtime.
+type bagOfWordsEmbedder struct {
+	dim   int
+	calls int
+	err   error
+}
+
+func (e *bagOfWordsEmbedder) ComputeBatch(sentences []string, addSpecialTokens bool) ([][]float32, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.calls++
+
+	dim := e.dim
+	if dim == 0 {
+		dim = 64
+	}
+	embeddings := make([][]float32, len(sentences))
+	for i, s := range sentences {
+		embeddings[i] = make([]float32, dim)
+		for _, word := range strings.Fields(strings.ToLower(s)) {
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			embeddings[i][h.Sum32()%uint32(dim)]++
+		}
+	}
+	return embeddings, nil
+}
+
+func newTestCorpus(t *testing.T, docs ...all_minilm_l6_v2.Document) *all_minilm_l6_v2.Corpus {
+	t.Helper()
+
+	corpus := all_minilm_l6_v2.NewCorpus(&bagOfWordsEmbedder{})
+	if err := corpus.Add(context.Background(), docs...); err != nil {
+		t.Fatalf("Failed to add documents: %v", err)
+	}
+	return corpus
+}
+
+func resultIDs(results []all_minilm_l6_v2.SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.Document.ID
+	}
+	return ids
+}
+
+func TestCorpusSearch(t *testing.T) {
+	corpus := newTestCorpus(t,
+		all_minilm_l6_v2.Document{ID: "cats", Text: "cats are small furry animals"},
+		all_minilm_l6_v2.Document{ID: "dogs", Text: "dogs are loyal animals"},
+		all_minilm_l6_v2.Document{ID: "go", Text: "go is a programming language"},
+	)
+
+	results, err := corpus.Search(context.Background(), "a programming language", 2, nil)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].Document.ID != "go" {
+		t.Errorf("Expected go first, got %v", resultIDs(results))
+	}
+	if results[1].Score > results[0].Score {
+		t.Errorf("Results not sorted: %v", results)
+	}
+
+	results, _ = corpus.Search(context.Background(), "animals", 10, nil)
+	if len(results) != 3 {
+		t.Errorf("Expected every document, got %v", resultIDs(results))
+	}
+}
+
+// TestCorpusFilterAppliedDuringSearch checks that filtering does not cut the
+// results short when the most similar documents are filtered out.
+func TestCorpusFilterAppliedDuringSearch(t *testing.T) {
+	var docs []all_minilm_l6_v2.Document
+	for i := range 20 {
+		docs = append(docs, all_minilm_l6_v2.Document{
+			ID:       fmt.Sprintf("match-%d", i),
+			Text:     "the query words",
+			Metadata: map[string]any{"lang": "en"},
+		})
+	}
+	for i := range 5 {
+		docs = append(docs, all_minilm_l6_v2.Document{
+			ID:       fmt.Sprintf("other-%d", i),
+			Text:     fmt.Sprintf("unrelated text %d", i),
+			Metadata: map[string]any{"lang": "fr"},
+		})
+	}
+	corpus := newTestCorpus(t, docs...)
+
+	results, err := corpus.Search(context.Background(), "the query words", 3, all_minilm_l6_v2.Eq("lang", "fr"))
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %v", resultIDs(results))
+	}
+	for _, r := range results {
+		if r.Document.Metadata["lang"] != "fr" {
+			t.Errorf("Result %q does not match the filter", r.Document.ID)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	metadata := map[string]any{
+		"lang":      "en",
+		"year":      int64(2021),
+		"score":     0.75,
+		"published": day,
+		"tags":      []string{"a"},
+	}
+
+	tests := []struct {
+		name     string
+		filter   all_minilm_l6_v2.Filter
+		expected bool
+	}{
+		{"string equality", all_minilm_l6_v2.Eq("lang", "en"), true},
+		{"string inequality", all_minilm_l6_v2.Eq("lang", "fr"), false},
+		{"numbers of different types", all_minilm_l6_v2.Eq("year", 2021), true},
+		{"missing key", all_minilm_l6_v2.Eq("author", "me"), false},
+		{"uncomparable value", all_minilm_l6_v2.Eq("tags", "a"), false},
+		{"in range", all_minilm_l6_v2.Range("year", 2020, 2022), true},
+		{"inclusive bounds", all_minilm_l6_v2.Range("year", 2021, 2021), true},
+		{"below range", all_minilm_l6_v2.Range("score", 0.8, nil), false},
+		{"open lower bound", all_minilm_l6_v2.Range("score", nil, 1), true},
+		{"time range", all_minilm_l6_v2.Range("published", day.AddDate(0, 0, -1), day), true},
+		{"string range", all_minilm_l6_v2.Range("lang", "a", "f"), true},
+		{"mismatched range type", all_minilm_l6_v2.Range("lang", 1, 2), false},
+		{"set membership", all_minilm_l6_v2.In("lang", "fr", "en"), true},
+		{"set non membership", all_minilm_l6_v2.In("year", 2019, 2020), false},
+		{"and", all_minilm_l6_v2.And(all_minilm_l6_v2.Eq("lang", "en"), all_minilm_l6_v2.Eq("year", 2020)), false},
+		{"or", all_minilm_l6_v2.Or(all_minilm_l6_v2.Eq("lang", "fr"), all_minilm_l6_v2.Eq("year", 2021)), true},
+		{"not", all_minilm_l6_v2.Not(all_minilm_l6_v2.Eq("lang", "fr")), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(metadata); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCorpusAddReplacesAndRemove(t *testing.T) {
+	corpus := newTestCorpus(t,
+		all_minilm_l6_v2.Document{ID: "a", Text: "apples"},
+		all_minilm_l6_v2.Document{ID: "b", Text: "bananas"},
+		all_minilm_l6_v2.Document{ID: "c", Text: "cherries"},
+	)
+
+	if err := corpus.Add(context.Background(), all_minilm_l6_v2.Document{ID: "a", Text: "apricots"}); err != nil {
+		t.Fatalf("Failed to replace document: %v", err)
+	}
+	if corpus.Len() != 3 {
+		t.Errorf("Expected 3 documents, got %d", corpus.Len())
+	}
+	if doc, _ := corpus.Get("a"); doc.Text != "apricots" {
+		t.Errorf("Expected the document to be replaced, got %q", doc.Text)
+	}
+
+	if !corpus.Remove("a") {
+		t.Errorf("Expected a to be removed")
+	}
+	if corpus.Remove("a") {
+		t.Errorf("Expected removing a twice to report false")
+	}
+	results, _ := corpus.Search(context.Background(), "cherries", 5, nil)
+	if fmt.Sprint(resultIDs(results)) != "[c b]" {
+		t.Errorf("Expected [c b], got %v", resultIDs(results))
+	}
+}
+
+func TestCorpusBatchesAndErrors(t *testing.T) {
+	embedder := &bagOfWordsEmbedder{}
+	corpus := all_minilm_l6_v2.NewCorpus(embedder, all_minilm_l6_v2.WithCorpusBatchSize(4))
+
+	var docs []all_minilm_l6_v2.Document
+	for i := range 10 {
+		docs = append(docs, all_minilm_l6_v2.Document{ID: fmt.Sprint(i), Text: "text"})
+	}
+	if err := corpus.Add(context.Background(), docs...); err != nil {
+		t.Fatalf("Failed to add documents: %v", err)
+	}
+	if embedder.calls != 3 {
+		t.Errorf("Expected 3 batches, got %d", embedder.calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := corpus.Search(ctx, "text", 1, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if err := corpus.Add(ctx, all_minilm_l6_v2.Document{ID: "x", Text: "text"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	embedder.err = errors.New("boom")
+	if err := corpus.Add(context.Background(), all_minilm_l6_v2.Document{ID: "y", Text: "text"}); !errors.Is(err, embedder.err) {
+		t.Errorf("Expected the embedder error, got %v", err)
+	}
+	if corpus.Len() != 10 {
+		t.Errorf("Expected failed adds to leave the corpus unchanged, got %d documents", corpus.Len())
+	}
+
+	if err := corpus.Add(context.Background(), all_minilm_l6_v2.Document{Text: "no id"}); err == nil {
+		t.Errorf("Expected an error for an empty id")
+	}
+}
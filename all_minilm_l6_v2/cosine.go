@@ -1,6 +1,6 @@
 package all_minilm_l6_v2
 
-import "math"
+import "github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
 
 // cosineSimilarity calculates the cosine similarity between two vectors
 func CosineSimilarity(a, b []float32) float64 {
@@ -8,16 +8,14 @@ func CosineSimilarity(a, b []float32) float64 {
 		return 0.0
 	}
 
-	var dotProduct, normA, normB float64
-	for i := range a {
-		dotProduct += float64(a[i]) * float64(b[i])
-		normA += float64(a[i]) * float64(a[i])
-		normB += float64(b[i]) * float64(b[i])
-	}
+	return float64(vecmath.Cosine(a, b))
+}
 
-	if normA == 0 || normB == 0 {
-		return 0.0
+// CosineSimilarityChecked is CosineSimilarity returning ErrDimensionMismatch
+// if the lengths of a and b differ.
+func CosineSimilarityChecked(a, b []float32) (float64, error) {
+	if err := checkDimensions(len(a), len(b)); err != nil {
+		return 0, err
 	}
-
-	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+	return float64(vecmath.Cosine(a, b)), nil
 }
@@ -0,0 +1,230 @@
+package all_minilm_l6_v2
+
+import (
+	"math"
+	"sort"
+)
+
+// symmetricEigen returns the eigenvalues of the symmetric matrix a in
+// decreasing order along with the matching unit eigenvectors, vectors[i]
+// being the eigenvector of values[i]. a is left untouched.
+//
+// The matrix is reduced to tridiagonal form with Householder reflections and
+// diagonalized with the implicit QL algorithm, following the tred2 and tql2
+// routines of EISPACK as adapted by JAMA. It takes O(n³) time.
+func symmetricEigen(a [][]float64) (values []float64, vectors [][]float64) {
+	n := len(a)
+	v := make([][]float64, n)
+	for i := range v {
+		v[i] = append([]float64(nil), a[i]...)
+	}
+	d := make([]float64, n)
+	e := make([]float64, n)
+	tridiagonalize(v, d, e)
+	diagonalize(v, d, e)
+
+	// v holds the eigenvectors as columns.
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return d[order[i]] > d[order[j]] })
+	values = make([]float64, n)
+	vectors = make([][]float64, n)
+	for k, j := range order {
+		values[k] = d[j]
+		vectors[k] = make([]float64, n)
+		for i := range n {
+			vectors[k][i] = v[i][j]
+		}
+	}
+	return values, vectors
+}
+
+// tridiagonalize reduces the symmetric matrix v to tridiagonal form, storing
+// its diagonal in d and its subdiagonal in e[1:], and replaces v with the
+// orthogonal transformation.
+func tridiagonalize(v [][]float64, d, e []float64) {
+	n := len(v)
+	if n == 0 {
+		return
+	}
+	for j := range n {
+		d[j] = v[n-1][j]
+	}
+
+	for i := n - 1; i > 0; i-- {
+		// Scale to avoid under/overflow.
+		var scale, h float64
+		for k := range i {
+			scale += math.Abs(d[k])
+		}
+		if scale == 0 {
+			e[i] = d[i-1]
+			for j := range i {
+				d[j] = v[i-1][j]
+				v[i][j] = 0
+				v[j][i] = 0
+			}
+		} else {
+			// Generate the Householder vector.
+			for k := range i {
+				d[k] /= scale
+				h += d[k] * d[k]
+			}
+			f := d[i-1]
+			g := math.Sqrt(h)
+			if f > 0 {
+				g = -g
+			}
+			e[i] = scale * g
+			h -= f * g
+			d[i-1] = f - g
+			for j := range i {
+				e[j] = 0
+			}
+
+			// Apply the similarity transformation to the remaining columns.
+			for j := range i {
+				f = d[j]
+				v[j][i] = f
+				g = e[j] + v[j][j]*f
+				for k := j + 1; k <= i-1; k++ {
+					g += v[k][j] * d[k]
+					e[k] += v[k][j] * f
+				}
+				e[j] = g
+			}
+			f = 0
+			for j := range i {
+				e[j] /= h
+				f += e[j] * d[j]
+			}
+			hh := f / (h + h)
+			for j := range i {
+				e[j] -= hh * d[j]
+			}
+			for j := range i {
+				f = d[j]
+				g = e[j]
+				for k := j; k <= i-1; k++ {
+					v[k][j] -= f*e[k] + g*d[k]
+				}
+				d[j] = v[i-1][j]
+				v[i][j] = 0
+			}
+		}
+		d[i] = h
+	}
+
+	// Accumulate the transformations.
+	for i := 0; i < n-1; i++ {
+		v[n-1][i] = v[i][i]
+		v[i][i] = 1
+		h := d[i+1]
+		if h != 0 {
+			for k := 0; k <= i; k++ {
+				d[k] = v[k][i+1] / h
+			}
+			for j := 0; j <= i; j++ {
+				var g float64
+				for k := 0; k <= i; k++ {
+					g += v[k][i+1] * v[k][j]
+				}
+				for k := 0; k <= i; k++ {
+					v[k][j] -= g * d[k]
+				}
+			}
+		}
+		for k := 0; k <= i; k++ {
+			v[k][i+1] = 0
+		}
+	}
+	for j := range n {
+		d[j] = v[n-1][j]
+		v[n-1][j] = 0
+	}
+	v[n-1][n-1] = 1
+	e[0] = 0
+}
+
+// diagonalize computes the eigenvalues and eigenvectors of the tridiagonal
+// matrix produced by tridiagonalize with the implicit QL algorithm, storing
+// the eigenvalues in d and the eigenvectors as the columns of v.
+func diagonalize(v [][]float64, d, e []float64) {
+	n := len(v)
+	if n == 0 {
+		return
+	}
+	for i := 1; i < n; i++ {
+		e[i-1] = e[i]
+	}
+	e[n-1] = 0
+
+	var f, tst1 float64
+	eps := math.Pow(2, -52)
+	for l := range n {
+		// Find a small subdiagonal element.
+		tst1 = max(tst1, math.Abs(d[l])+math.Abs(e[l]))
+		m := l
+		for m < n-1 && math.Abs(e[m]) > eps*tst1 {
+			m++
+		}
+
+		// If m == l, d[l] is already an eigenvalue, otherwise iterate.
+		if m > l {
+			for {
+				// Compute the implicit shift.
+				g := d[l]
+				p := (d[l+1] - g) / (2 * e[l])
+				r := math.Hypot(p, 1)
+				if p < 0 {
+					r = -r
+				}
+				d[l] = e[l] / (p + r)
+				d[l+1] = e[l] * (p + r)
+				dl1 := d[l+1]
+				h := g - d[l]
+				for i := l + 2; i < n; i++ {
+					d[i] -= h
+				}
+				f += h
+
+				// Implicit QL transformation.
+				p = d[m]
+				c, c2, c3 := 1.0, 1.0, 1.0
+				el1 := e[l+1]
+				var s, s2 float64
+				for i := m - 1; i >= l; i-- {
+					c3 = c2
+					c2 = c
+					s2 = s
+					g = c * e[i]
+					h = c * p
+					r = math.Hypot(p, e[i])
+					e[i+1] = s * r
+					s = e[i] / r
+					c = p / r
+					p = c*d[i] - s*g
+					d[i+1] = h + s*(c*g+s*d[i])
+
+					// Accumulate the transformation.
+					for k := range n {
+						h = v[k][i+1]
+						v[k][i+1] = s*v[k][i] + c*h
+						v[k][i] = c*v[k][i] - s*h
+					}
+				}
+				p = -s * s2 * c3 * el1 * e[l] / dl1
+				e[l] = s * p
+				d[l] = c * p
+
+				if math.Abs(e[l]) <= eps*tst1 {
+					break
+				}
+			}
+		}
+		d[l] += f
+		e[l] = 0
+	}
+}
@@ -0,0 +1,472 @@
+package all_minilm_l6_v2
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DefaultEmbeddingCacheSize is the default number of embeddings kept in
+// memory by a CachedEmbedder.
+const DefaultEmbeddingCacheSize = 10000
+
+// FingerprintedEmbedder is an Embedder whose fingerprint identifies its
+// embedding space. *Model implements it.
+type FingerprintedEmbedder interface {
+	Embedder
+	Fingerprint() [32]byte
+}
+
+// EmbeddingCacheStats counts the lookups of a CachedEmbedder.
+type EmbeddingCacheStats struct {
+	// Hits counts the sentences found in memory.
+	Hits int
+	// DiskHits counts the sentences found on disk only.
+	DiskHits int
+	// Misses counts the sentences that were embedded, duplicates within a
+	// batch counting once.
+	Misses int
+	// Entries is the number of embeddings kept in memory.
+	Entries int
+}
+
+// CachedEmbedder wraps an embedder, typically a *Model, and caches the
+// embeddings it computes in memory, evicting the least recently used ones,
+// and optionally in a file that persists across runs.
+//
+// The cache key is the SHA-256 of the fingerprint of the embedder, of
+// addSpecialTokens and of the normalized sentence, so that swapping the
+// model never returns stale embeddings.
+//
+// A CachedEmbedder is safe for concurrent use.
+type CachedEmbedder struct {
+	embedder   FingerprintedEmbedder
+	size       int
+	normalizer func(string) string
+	diskPath   string
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[[32]byte]*list.Element
+	disk    *embeddingLog
+	stats   EmbeddingCacheStats
+}
+
+type cachedEmbedding struct {
+	key    [32]byte
+	vector []float32
+}
+
+type EmbeddingCacheOption = func(*CachedEmbedder)
+
+// WithEmbeddingCacheSize sets the number of embeddings kept in memory. It
+// defaults to DefaultEmbeddingCacheSize.
+func WithEmbeddingCacheSize(n int) EmbeddingCacheOption {
+	return func(c *CachedEmbedder) {
+		c.size = n
+	}
+}
+
+// WithDiskCache also caches the embeddings in the file at path, created if
+// missing, whose embeddings are found again after a restart. The file is an
+// append-only log indexed in memory when it is opened; appends are not
+// synced, and a record torn by a crash is discarded on the next open.
+func WithDiskCache(path string) EmbeddingCacheOption {
+	return func(c *CachedEmbedder) {
+		c.diskPath = path
+	}
+}
+
+// WithCacheKeyNormalizer sets the function applied to sentences before they
+// are hashed into cache keys. It must only merge sentences that the
+// tokenizer encodes identically. It defaults to NormalizeWhitespace.
+func WithCacheKeyNormalizer(normalizer func(string) string) EmbeddingCacheOption {
+	return func(c *CachedEmbedder) {
+		c.normalizer = normalizer
+	}
+}
+
+// NormalizeWhitespace trims text and collapses its runs of spaces, tabs and
+// line breaks into a single space, which leaves the tokens of BERT tokenizers
+// unchanged. Other whitespace is kept since the BERT normalizer removes some
+// of it, such as \v and \f, and keeps the rest, such as U+00A0, inside words.
+func NormalizeWhitespace(text string) string {
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+	}
+	// The collapsed characters are ASCII, so the text is scanned by bytes
+	// to leave invalid UTF-8 untouched
+	var b strings.Builder
+	b.Grow(len(text))
+	space := false
+	for i := 0; i < len(text); i++ {
+		if isSpace(text[i]) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
+
+// NewCachedEmbedder wraps embedder with a cache, opening the disk cache if
+// one is set.
+func NewCachedEmbedder(embedder FingerprintedEmbedder, opts ...EmbeddingCacheOption) (*CachedEmbedder, error) {
+	c := &CachedEmbedder{
+		embedder:   embedder,
+		size:       DefaultEmbeddingCacheSize,
+		normalizer: NormalizeWhitespace,
+		lru:        list.New(),
+		entries:    make(map[[32]byte]*list.Element),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.diskPath != "" {
+		disk, err := openEmbeddingLog(c.diskPath)
+		if err != nil {
+			return nil, err
+		}
+		c.disk = disk
+	}
+	return c, nil
+}
+
+// Fingerprint returns the fingerprint of the wrapped embedder.
+func (c *CachedEmbedder) Fingerprint() [32]byte {
+	return c.embedder.Fingerprint()
+}
+
+// Compute returns the embedding of sentence, computing it on a miss.
+func (c *CachedEmbedder) Compute(sentence string, addSpecialTokens bool) ([]float32, error) {
+	embeddings, err := c.ComputeBatch([]string{sentence}, addSpecialTokens)
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// ComputeBatch returns the embeddings of sentences, computing the missing
+// ones in a single call to the wrapped embedder. Sentences with the same
+// key are embedded once.
+func (c *CachedEmbedder) ComputeBatch(sentences []string, addSpecialTokens bool) ([][]float32, error) {
+	if len(sentences) == 0 {
+		return nil, nil
+	}
+	fingerprint := c.embedder.Fingerprint()
+	keys := make([][32]byte, len(sentences))
+	for i, s := range sentences {
+		keys[i] = c.key(fingerprint, s, addSpecialTokens)
+	}
+
+	embeddings := make([][]float32, len(sentences))
+	// missing maps the key of each sentence to embed to its position in
+	// toEmbed.
+	missing := make(map[[32]byte]int)
+	var toEmbed []string
+	c.mu.Lock()
+	for i, key := range keys {
+		if _, ok := missing[key]; ok {
+			continue
+		}
+		vector, err := c.lookup(key)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		if vector == nil {
+			missing[key] = len(toEmbed)
+			toEmbed = append(toEmbed, sentences[i])
+			continue
+		}
+		embeddings[i] = vector
+	}
+	c.stats.Misses += len(toEmbed)
+	c.mu.Unlock()
+
+	var computed [][]float32
+	if len(toEmbed) > 0 {
+		var err error
+		computed, err = c.embedder.ComputeBatch(toEmbed, addSpecialTokens)
+		if err != nil {
+			return nil, err
+		}
+		if len(computed) != len(toEmbed) {
+			return nil, fmt.Errorf("got %d embeddings for %d sentences", len(computed), len(toEmbed))
+		}
+
+		c.mu.Lock()
+		err = c.store(missing, computed)
+		c.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, key := range keys {
+		if embeddings[i] == nil {
+			embeddings[i] = computed[missing[key]]
+		}
+		// Callers get their own copy, so that modifying it leaves the cache
+		// untouched.
+		embeddings[i] = append([]float32(nil), embeddings[i]...)
+	}
+	return embeddings, nil
+}
+
+// Stats returns the statistics of the cache.
+func (c *CachedEmbedder) Stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// Close closes the disk cache. It does not close the wrapped embedder.
+func (c *CachedEmbedder) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.disk == nil {
+		return nil
+	}
+	err := c.disk.close()
+	c.disk = nil
+	return err
+}
+
+func (c *CachedEmbedder) key(fingerprint [32]byte, sentence string, addSpecialTokens bool) [32]byte {
+	h := sha256.New()
+	h.Write(fingerprint[:])
+	if addSpecialTokens {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(c.normalizer(sentence)))
+	var key [32]byte
+	h.Sum(key[:0])
+	return key
+}
+
+// lookup returns the cached embedding of key, promoting embeddings found on
+// disk to memory, or nil.
+func (c *CachedEmbedder) lookup(key [32]byte) ([]float32, error) {
+	if element, ok := c.entries[key]; ok {
+		c.lru.MoveToBack(element)
+		c.stats.Hits++
+		return element.Value.(*cachedEmbedding).vector, nil
+	}
+	if c.disk == nil {
+		return nil, nil
+	}
+	vector, err := c.disk.get(key)
+	if err != nil || vector == nil {
+		return nil, err
+	}
+	c.stats.DiskHits++
+	c.remember(key, vector)
+	return vector, nil
+}
+
+// store caches the computed embeddings in memory and on disk.
+func (c *CachedEmbedder) store(missing map[[32]byte]int, computed [][]float32) error {
+	ordered := make([][32]byte, len(computed))
+	for key, i := range missing {
+		ordered[i] = key
+	}
+	for i, key := range ordered {
+		c.remember(key, computed[i])
+	}
+	if c.disk == nil {
+		return nil
+	}
+	return c.disk.append(ordered, computed)
+}
+
+func (c *CachedEmbedder) remember(key [32]byte, vector []float32) {
+	if c.size <= 0 {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cachedEmbedding).vector = vector
+		c.lru.MoveToBack(element)
+		return
+	}
+	c.entries[key] = c.lru.PushBack(&cachedEmbedding{key: key, vector: vector})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Remove(c.lru.Front()).(*cachedEmbedding)
+		delete(c.entries, oldest.key)
+	}
+}
+
+// An embedding log starts with the magic "MINILMEC" and the format version
+// as a little-endian uint32, followed by records:
+//
+//	offset  size  field
+//	0       4     length n of the payload
+//	4       4     CRC-32C of the payload
+//	8       n     payload: the 32-byte key and the little-endian float32
+//	              values of the embedding
+const (
+	embeddingLogMagic      = "MINILMEC"
+	embeddingLogVersion    = 1
+	embeddingLogHeaderSize = 12
+	embeddingRecordHeader  = 8
+	// maxEmbeddingRecordSize bounds the length read from a record header,
+	// so that a corrupted length does not trigger a huge allocation.
+	maxEmbeddingRecordSize = 1 << 24
+)
+
+// embeddingLog is an append-only file of embeddings indexed by key in
+// memory.
+type embeddingLog struct {
+	f    *os.File
+	size int64
+	// index holds the offset of the payload of the last record of each key.
+	index map[[32]byte]embeddingLocation
+}
+
+type embeddingLocation struct {
+	offset int64
+	dim    int
+}
+
+// openEmbeddingLog opens or creates the log at path and indexes it,
+// discarding the records past the first truncated or corrupted one.
+func openEmbeddingLog(path string) (*embeddingLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedding cache: %w", err)
+	}
+	l := &embeddingLog{f: f, index: make(map[[32]byte]embeddingLocation)}
+	if err := l.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *embeddingLog) load() error {
+	info, err := l.f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat embedding cache: %w", err)
+	}
+	if info.Size() < embeddingLogHeaderSize {
+		// The file is new or the header write was interrupted
+		header := append([]byte(embeddingLogMagic), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(header[8:], embeddingLogVersion)
+		existing := make([]byte, info.Size())
+		if _, err := l.f.ReadAt(existing, 0); err != nil || !bytes.HasPrefix(header, existing) {
+			return errors.New("not an embedding cache")
+		}
+		if _, err := l.f.WriteAt(header, 0); err != nil {
+			return fmt.Errorf("failed to write embedding cache header: %w", err)
+		}
+		l.size = embeddingLogHeaderSize
+		return nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(l.f, 0, info.Size()))
+	header := make([]byte, embeddingLogHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:8]) != embeddingLogMagic {
+		return errors.New("not an embedding cache")
+	}
+	if v := binary.LittleEndian.Uint32(header[8:]); v != embeddingLogVersion {
+		return fmt.Errorf("unsupported embedding cache version %d", v)
+	}
+
+	valid := int64(embeddingLogHeaderSize)
+	recordHeader := make([]byte, embeddingRecordHeader)
+	for {
+		if _, err := io.ReadFull(r, recordHeader); err != nil {
+			break
+		}
+		size := binary.LittleEndian.Uint32(recordHeader[0:])
+		if size > maxEmbeddingRecordSize || size < 32 || (size-32)%4 != 0 {
+			break
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			break
+		}
+		if crc32.Checksum(payload, castagnoli) != binary.LittleEndian.Uint32(recordHeader[4:]) {
+			break
+		}
+		l.index[[32]byte(payload[:32])] = embeddingLocation{
+			offset: valid + embeddingRecordHeader + 32,
+			dim:    int(size-32) / 4,
+		}
+		valid += embeddingRecordHeader + int64(size)
+	}
+	if err := l.f.Truncate(valid); err != nil {
+		return fmt.Errorf("failed to truncate embedding cache: %w", err)
+	}
+	l.size = valid
+	return nil
+}
+
+// get returns the embedding of key, or nil if the log does not hold it.
+func (l *embeddingLog) get(key [32]byte) ([]float32, error) {
+	location, ok := l.index[key]
+	if !ok {
+		return nil, nil
+	}
+	buf := make([]byte, 4*location.dim)
+	if _, err := l.f.ReadAt(buf, location.offset); err != nil {
+		return nil, fmt.Errorf("failed to read embedding cache: %w", err)
+	}
+	vector := make([]float32, location.dim)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vector, nil
+}
+
+// append writes the embeddings at the end of the log. On failure, the log is
+// truncated back to its previous size.
+func (l *embeddingLog) append(keys [][32]byte, vectors [][]float32) error {
+	var buf []byte
+	locations := make([]embeddingLocation, len(keys))
+	for i, key := range keys {
+		payload := make([]byte, 0, 32+4*len(vectors[i]))
+		payload = append(payload, key[:]...)
+		for _, x := range vectors[i] {
+			payload = binary.LittleEndian.AppendUint32(payload, math.Float32bits(x))
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+		buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(payload, castagnoli))
+		locations[i] = embeddingLocation{offset: l.size + int64(len(buf)) + 32, dim: len(vectors[i])}
+		buf = append(buf, payload...)
+	}
+
+	if _, err := l.f.WriteAt(buf, l.size); err != nil {
+		_ = l.f.Truncate(l.size)
+		return fmt.Errorf("failed to write embedding cache: %w", err)
+	}
+	l.size += int64(len(buf))
+	for i, key := range keys {
+		l.index[key] = locations[i]
+	}
+	return nil
+}
+
+func (l *embeddingLog) close() error {
+	return l.f.Close()
+}
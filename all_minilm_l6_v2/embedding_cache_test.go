@@ -0,0 +1,259 @@
+package all_minilm_l6_v2_test
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+	"github.com/sugarme/tokenizer"
+)
+
+// fingerprintedEmbedder records the sentences it embeds with a
+// bagOfWordsEmbedder.
+type fingerprintedEmbedder struct {
+	bagOfWordsEmbedder
+	fingerprint [32]byte
+	embedded    []string
+}
+
+func (e *fingerprintedEmbedder) ComputeBatch(sentences []string, addSpecialTokens bool) ([][]float32, error) {
+	e.embedded = append(e.embedded, sentences...)
+	embeddings, err := e.bagOfWordsEmbedder.ComputeBatch(sentences, addSpecialTokens)
+	if err == nil && addSpecialTokens {
+		for _, v := range embeddings {
+			v[0] += 100
+		}
+	}
+	return embeddings, err
+}
+
+func (e *fingerprintedEmbedder) Fingerprint() [32]byte {
+	return e.fingerprint
+}
+
+func computeBatch(t *testing.T, embedder all_minilm_l6_v2.Embedder, sentences ...string) [][]float32 {
+	t.Helper()
+
+	embeddings, err := embedder.ComputeBatch(sentences, false)
+	if err != nil {
+		t.Fatalf("Failed to compute embeddings: %v", err)
+	}
+	return embeddings
+}
+
+func TestCachedEmbedderDeduplicates(t *testing.T) {
+	model := &fingerprintedEmbedder{}
+	cached, err := all_minilm_l6_v2.NewCachedEmbedder(model)
+	if err != nil {
+		t.Fatalf("Failed to create cached embedder: %v", err)
+	}
+
+	embeddings := computeBatch(t, cached, "the cat", "a dog", "the  cat ", "the cat")
+	if !slices.Equal(model.embedded, []string{"the cat", "a dog"}) {
+		t.Errorf("Expected each distinct sentence to be embedded once, got %q", model.embedded)
+	}
+	expected, _ := model.bagOfWordsEmbedder.ComputeBatch([]string{"the cat", "a dog"}, false)
+	for i, j := range []int{0, 1, 0, 0} {
+		if !slices.Equal(embeddings[i], expected[j]) {
+			t.Errorf("Expected embedding %d to be %v, got %v", i, expected[j], embeddings[i])
+		}
+	}
+
+	// Callers own the returned embeddings
+	embeddings[0][0] = 42
+	embeddings = computeBatch(t, cached, "the cat", "a bird")
+	if embeddings[0][0] == 42 {
+		t.Errorf("Expected the cache not to share embeddings with callers")
+	}
+	if !slices.Equal(model.embedded, []string{"the cat", "a dog", "a bird"}) {
+		t.Errorf("Expected only the new sentence to be embedded, got %q", model.embedded)
+	}
+
+	// Embedding options are part of the key
+	withSpecialTokens, err := cached.ComputeBatch([]string{"the cat"}, true)
+	if err != nil {
+		t.Fatalf("Failed to compute embeddings: %v", err)
+	}
+	if len(model.embedded) != 4 || slices.Equal(withSpecialTokens[0], embeddings[0]) {
+		t.Errorf("Expected a miss with other options, got %q", model.embedded)
+	}
+
+	stats := cached.Stats()
+	if stats.Hits != 1 || stats.Misses != 4 || stats.DiskHits != 0 || stats.Entries != 4 {
+		t.Errorf("Expected 1 hit, 4 misses and 4 entries, got %+v", stats)
+	}
+}
+
+func TestCachedEmbedderLRU(t *testing.T) {
+	model := &fingerprintedEmbedder{}
+	cached, _ := all_minilm_l6_v2.NewCachedEmbedder(model, all_minilm_l6_v2.WithEmbeddingCacheSize(2))
+
+	computeBatch(t, cached, "one", "two")
+	computeBatch(t, cached, "one")
+	computeBatch(t, cached, "three")
+	model.embedded = nil
+	computeBatch(t, cached, "one", "two", "three")
+	if !slices.Equal(model.embedded, []string{"two"}) {
+		t.Errorf("Expected the least recently used sentence to be evicted, got %q", model.embedded)
+	}
+	if entries := cached.Stats().Entries; entries != 2 {
+		t.Errorf("Expected 2 entries, got %d", entries)
+	}
+}
+
+func TestCachedEmbedderModelSwap(t *testing.T) {
+	model := &fingerprintedEmbedder{fingerprint: [32]byte{1}}
+	cached, _ := all_minilm_l6_v2.NewCachedEmbedder(model)
+
+	computeBatch(t, cached, "hello world")
+	model.fingerprint = [32]byte{2}
+	computeBatch(t, cached, "hello world")
+	if len(model.embedded) != 2 {
+		t.Errorf("Expected a new fingerprint to invalidate the cache, got %q", model.embedded)
+	}
+	if cached.Fingerprint() != model.fingerprint {
+		t.Errorf("Expected the fingerprint of the wrapped embedder")
+	}
+}
+
+func TestCachedEmbedderDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.log")
+	model := &fingerprintedEmbedder{}
+	cached, err := all_minilm_l6_v2.NewCachedEmbedder(model, all_minilm_l6_v2.WithDiskCache(path))
+	if err != nil {
+		t.Fatalf("Failed to create cached embedder: %v", err)
+	}
+	expected := computeBatch(t, cached, "first sentence", "second sentence")
+	if err := cached.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	model.embedded = nil
+	cached, err = all_minilm_l6_v2.NewCachedEmbedder(model, all_minilm_l6_v2.WithDiskCache(path))
+	if err != nil {
+		t.Fatalf("Failed to reopen cached embedder: %v", err)
+	}
+	embeddings := computeBatch(t, cached, "second sentence", "first sentence", "third sentence")
+	if !slices.Equal(model.embedded, []string{"third sentence"}) {
+		t.Errorf("Expected the persisted sentences not to be embedded, got %q", model.embedded)
+	}
+	if !slices.Equal(embeddings[0], expected[1]) || !slices.Equal(embeddings[1], expected[0]) {
+		t.Errorf("Expected the persisted embeddings, got %v", embeddings)
+	}
+	computeBatch(t, cached, "first sentence")
+	if stats := cached.Stats(); stats.DiskHits != 2 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 2 disk hits, then a memory hit, got %+v", stats)
+	}
+	cached.Close()
+
+	// A torn record is discarded along with everything after it
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	model.embedded = nil
+	cached, err = all_minilm_l6_v2.NewCachedEmbedder(model, all_minilm_l6_v2.WithDiskCache(path))
+	if err != nil {
+		t.Fatalf("Failed to reopen a torn cache: %v", err)
+	}
+	computeBatch(t, cached, "first sentence", "second sentence", "third sentence")
+	if !slices.Equal(model.embedded, []string{"third sentence"}) {
+		t.Errorf("Expected only the torn record to be lost, got %q", model.embedded)
+	}
+	cached.Close()
+
+	cached, _ = all_minilm_l6_v2.NewCachedEmbedder(model, all_minilm_l6_v2.WithDiskCache(path))
+	model.embedded = nil
+	computeBatch(t, cached, "third sentence")
+	if len(model.embedded) != 0 {
+		t.Errorf("Expected the record appended after the repair to be persisted, got %q", model.embedded)
+	}
+	cached.Close()
+
+	// A torn header is rewritten
+	if err := os.Truncate(path, 5); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	model.embedded = nil
+	cached, err = all_minilm_l6_v2.NewCachedEmbedder(model, all_minilm_l6_v2.WithDiskCache(path))
+	if err != nil {
+		t.Fatalf("Failed to reopen a cache with a torn header: %v", err)
+	}
+	computeBatch(t, cached, "first sentence")
+	cached.Close()
+	cached, err = all_minilm_l6_v2.NewCachedEmbedder(model, all_minilm_l6_v2.WithDiskCache(path))
+	if err != nil {
+		t.Fatalf("Failed to reopen the repaired cache: %v", err)
+	}
+	computeBatch(t, cached, "first sentence")
+	if !slices.Equal(model.embedded, []string{"first sentence"}) {
+		t.Errorf("Expected the sentence to be embedded once after the repair, got %q", model.embedded)
+	}
+	cached.Close()
+
+	if err := os.WriteFile(path, []byte("not"), 0o644); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if _, err := all_minilm_l6_v2.NewCachedEmbedder(model, all_minilm_l6_v2.WithDiskCache(path)); err == nil {
+		t.Errorf("Expected an error for a short file that is not a cache")
+	}
+	if err := os.WriteFile(path, []byte("not a cache file"), 0o644); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if _, err := all_minilm_l6_v2.NewCachedEmbedder(model, all_minilm_l6_v2.WithDiskCache(path)); err == nil {
+		t.Errorf("Expected an error for a file that is not a cache")
+	}
+}
+
+func TestCachedEmbedderErrors(t *testing.T) {
+	model := &fingerprintedEmbedder{}
+	cached, _ := all_minilm_l6_v2.NewCachedEmbedder(model)
+	model.err = errors.New("boom")
+	if _, err := cached.Compute("text", false); !errors.Is(err, model.err) {
+		t.Errorf("Expected the embedder error, got %v", err)
+	}
+
+	model.err = nil
+	if embedding, err := cached.Compute("text", false); err != nil || len(embedding) != 64 {
+		t.Errorf("Expected an embedding once the embedder recovers, got %v and %v", embedding, err)
+	}
+}
+
+func TestNormalizeWhitespaceKeepsTokens(t *testing.T) {
+	reference, wordPiece := newTokenizers(t)
+
+	if got := all_minilm_l6_v2.NormalizeWhitespace(" \ta  b\r\n\nc  d\ve\ff "); got != "a b c  d\ve\ff" {
+		t.Errorf("Expected spaces, tabs and line breaks to be collapsed only, got %q", got)
+	}
+
+	texts := append(slices.Clone(wordPieceCorpus), "a\vb", "a b", "foo\fbar", "a\u0085b", "  a \t\r\n b  ", "\xff \xfe")
+	rng := rand.New(rand.NewSource(2))
+	for range 1000 {
+		texts = append(texts, randomText(rng, []string{"word", "##piece", "UPPER"}))
+	}
+	// The reference panics on some texts and mangles the tokens of those
+	// with characters removed by cleaning, see referenceInput
+	for _, tk := range []*all_minilm_l6_v2.Tokenizer{reference, wordPiece} {
+		for _, text := range texts {
+			if input, _ := referenceInput(text); tk == reference && input != text {
+				continue
+			}
+			normalized := all_minilm_l6_v2.NormalizeWhitespace(text)
+			expected, ok := encodeReference(t, func() (*tokenizer.Encoding, error) { return tk.Encode(text, true) })
+			if !ok {
+				continue
+			}
+			actual, ok := encodeReference(t, func() (*tokenizer.Encoding, error) { return tk.Encode(normalized, true) })
+			if !ok {
+				t.Fatalf("Expected %q to encode as %q does", normalized, text)
+			}
+			if !slices.Equal(expected.Ids, actual.Ids) {
+				t.Fatalf("Expected %q to keep the ids of %q, got %v and %v", normalized, text, actual.Ids, expected.Ids)
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package all_minilm_l6_v2
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Filter selects documents by their metadata.
+type Filter interface {
+	Match(metadata map[string]any) bool
+}
+
+// FilterFunc adapts a function to the Filter interface.
+type FilterFunc func(metadata map[string]any) bool
+
+func (f FilterFunc) Match(metadata map[string]any) bool {
+	return f(metadata)
+}
+
+// Eq matches documents whose metadata value for key equals value. Numbers are
+// compared by value whatever their type, so Eq("year", 2024) matches an
+// int64 or a float64 2024.
+func Eq(key string, value any) Filter {
+	return FilterFunc(func(metadata map[string]any) bool {
+		v, ok := metadata[key]
+		return ok && equalValues(v, value)
+	})
+}
+
+// In matches documents whose metadata value for key equals one of values.
+func In(key string, values ...any) Filter {
+	return FilterFunc(func(metadata map[string]any) bool {
+		v, ok := metadata[key]
+		if !ok {
+			return false
+		}
+		for _, value := range values {
+			if equalValues(v, value) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Range matches documents whose metadata value for key lies in [lower,
+// upper]. A nil bound leaves that side of the range open. Numbers, strings
+// and time.Time values are ordered; values of other types, or of a type
+// different from the bounds, never match.
+func Range(key string, lower, upper any) Filter {
+	return FilterFunc(func(metadata map[string]any) bool {
+		v, ok := metadata[key]
+		if !ok {
+			return false
+		}
+		if lower != nil {
+			if c, ok := compareValues(v, lower); !ok || c < 0 {
+				return false
+			}
+		}
+		if upper != nil {
+			if c, ok := compareValues(v, upper); !ok || c > 0 {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// And matches documents matched by every filter.
+func And(filters ...Filter) Filter {
+	return FilterFunc(func(metadata map[string]any) bool {
+		for _, f := range filters {
+			if !f.Match(metadata) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Or matches documents matched by at least one filter.
+func Or(filters ...Filter) Filter {
+	return FilterFunc(func(metadata map[string]any) bool {
+		for _, f := range filters {
+			if f.Match(metadata) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not matches documents not matched by filter.
+func Not(filter Filter) Filter {
+	return FilterFunc(func(metadata map[string]any) bool {
+		return !filter.Match(metadata)
+	})
+}
+
+func equalValues(a, b any) bool {
+	if c, ok := compareValues(a, b); ok {
+		return c == 0
+	}
+	if a == nil || b == nil {
+		return a == b
+	}
+	if !reflect.TypeOf(a).Comparable() || !reflect.TypeOf(b).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// compareValues returns the sign of a - b and whether a and b are ordered
+// values of the same kind.
+func compareValues(a, b any) (int, bool) {
+	if x, ok := toFloat64(a); ok {
+		y, ok := toFloat64(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	case time.Time:
+		y, ok := b.(time.Time)
+		return x.Compare(y), ok
+	}
+	return 0, false
+}
+
+func toFloat64(v any) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int8:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint:
+		return float64(x), true
+	case uint8:
+		return float64(x), true
+	case uint16:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
@@ -0,0 +1,168 @@
+package head
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+// Metrics measures the predictions of a classifier on a labeled set.
+type Metrics struct {
+	// Classes are the classes of the classifier and of the labels, sorted.
+	Classes []string
+	// Confusion[i][j] is the number of vectors of class Classes[i] predicted
+	// as Classes[j].
+	Confusion [][]int
+	Accuracy  float64
+	// MacroF1 is the mean F1 score of the classes that are labeled or
+	// predicted at least once.
+	MacroF1 float64
+}
+
+// Evaluate predicts the class of every vector of x and compares it with the
+// labels y.
+func Evaluate(c Classifier, x [][]float32, y []string) (*Metrics, error) {
+	if len(x) != len(y) {
+		return nil, fmt.Errorf("got %d vectors for %d labels", len(x), len(y))
+	}
+	if len(x) == 0 {
+		return nil, errors.New("no vectors to evaluate")
+	}
+
+	classes := append(c.Classes(), y...)
+	slices.Sort(classes)
+	classes = slices.Compact(classes)
+	m := &Metrics{Classes: classes, Confusion: make([][]int, len(classes))}
+	for i := range m.Confusion {
+		m.Confusion[i] = make([]int, len(classes))
+	}
+
+	correct := 0
+	for i, v := range x {
+		predicted, err := c.Predict(v)
+		if err != nil {
+			return nil, err
+		}
+		actual, _ := slices.BinarySearch(classes, y[i])
+		p, _ := slices.BinarySearch(classes, predicted)
+		m.Confusion[actual][p]++
+		if actual == p {
+			correct++
+		}
+	}
+	m.Accuracy = float64(correct) / float64(len(x))
+
+	var f1Sum float64
+	present := 0
+	for i := range classes {
+		var labeled, predicted int
+		for j := range classes {
+			labeled += m.Confusion[i][j]
+			predicted += m.Confusion[j][i]
+		}
+		if labeled+predicted == 0 {
+			continue
+		}
+		present++
+		f1Sum += 2 * float64(m.Confusion[i][i]) / float64(labeled+predicted)
+	}
+	m.MacroF1 = f1Sum / float64(present)
+	return m, nil
+}
+
+// CrossValidationResult holds the metrics of every fold of a
+// cross-validation.
+type CrossValidationResult struct {
+	Folds []Metrics
+	// MeanAccuracy and StdAccuracy are the mean and standard deviation of
+	// the accuracies of the folds.
+	MeanAccuracy float64
+	StdAccuracy  float64
+	MeanMacroF1  float64
+}
+
+// StratifiedKFold splits the indices of labels y into the given number of
+// folds, each class being spread evenly across folds. The indices of each
+// class are shuffled with seed first. It returns the indices of every fold,
+// sorted.
+func StratifiedKFold(y []string, folds int, seed int64) ([][]int, error) {
+	if folds < 2 || folds > len(y) {
+		return nil, fmt.Errorf("invalid number of folds %d for %d vectors", folds, len(y))
+	}
+
+	byClass := make(map[string][]int)
+	var classes []string
+	for i, class := range y {
+		if _, ok := byClass[class]; !ok {
+			classes = append(classes, class)
+		}
+		byClass[class] = append(byClass[class], i)
+	}
+	slices.Sort(classes)
+
+	rng := rand.New(rand.NewSource(seed))
+	split := make([][]int, folds)
+	// Dealing continues from fold to fold across classes so that folds get
+	// the same size even when classes are small.
+	next := 0
+	for _, class := range classes {
+		indices := byClass[class]
+		rng.Shuffle(len(indices), func(i, j int) { indices[i], indices[j] = indices[j], indices[i] })
+		for _, i := range indices {
+			split[next] = append(split[next], i)
+			next = (next + 1) % folds
+		}
+	}
+	for _, fold := range split {
+		slices.Sort(fold)
+	}
+	return split, nil
+}
+
+// CrossValidate trains a classifier with train on all folds of
+// StratifiedKFold but one and evaluates it on the remaining fold, for every
+// fold.
+func CrossValidate(train Trainer, x [][]float32, y []string, folds int, seed int64) (*CrossValidationResult, error) {
+	if len(x) != len(y) {
+		return nil, fmt.Errorf("got %d vectors for %d labels", len(x), len(y))
+	}
+	split, err := StratifiedKFold(y, folds, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CrossValidationResult{}
+	for f, test := range split {
+		var trainX, testX [][]float32
+		var trainY, testY []string
+		inTest := make(map[int]bool, len(test))
+		for _, i := range test {
+			inTest[i] = true
+			testX, testY = append(testX, x[i]), append(testY, y[i])
+		}
+		for i := range x {
+			if !inTest[i] {
+				trainX, trainY = append(trainX, x[i]), append(trainY, y[i])
+			}
+		}
+
+		c, err := train(trainX, trainY)
+		if err != nil {
+			return nil, fmt.Errorf("failed to train fold %d: %w", f, err)
+		}
+		metrics, err := Evaluate(c, testX, testY)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate fold %d: %w", f, err)
+		}
+		result.Folds = append(result.Folds, *metrics)
+		result.MeanAccuracy += metrics.Accuracy / float64(len(split))
+		result.MeanMacroF1 += metrics.MacroF1 / float64(len(split))
+	}
+	for _, m := range result.Folds {
+		result.StdAccuracy += (m.Accuracy - result.MeanAccuracy) * (m.Accuracy - result.MeanAccuracy)
+	}
+	result.StdAccuracy = math.Sqrt(result.StdAccuracy / float64(len(split)))
+	return result, nil
+}
@@ -0,0 +1,238 @@
+package head
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// A saved classifier is laid out as follows, integers being little-endian:
+//
+//	size  field
+//	8     magic "MINILMHD"
+//	4     format version, currently 1
+//	4     kind, 1 for KNN and 2 for LogisticRegression
+//	n     payload
+//	4     CRC-32C of all the preceding bytes
+//
+// Both payloads start with the dimension as a uint32 and the classes, a
+// uvarint count followed by uvarint-length-prefixed strings. A KNN payload
+// then holds k and the voting as uint32, the number of training vectors as a
+// uint32, the class index of every vector as a uint32 and the normalized
+// vectors as float32. A LogisticRegression payload then holds the weights as
+// float64, dim coefficients followed by the bias for every class.
+const (
+	magic   = "MINILMHD"
+	version = 1
+
+	kindKNN                = 1
+	kindLogisticRegression = 2
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Save writes c to w.
+func Save(w io.Writer, c Classifier) error {
+	kind, payload := c.encode()
+	buf := make([]byte, 0, 16+len(payload)+4)
+	buf = append(buf, magic...)
+	buf = binary.LittleEndian.AppendUint32(buf, version)
+	buf = binary.LittleEndian.AppendUint32(buf, kind)
+	buf = append(buf, payload...)
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("failed to write classifier: %w", err)
+	}
+	return nil
+}
+
+// Load reads a classifier written by Save from r.
+func Load(r io.Reader) (Classifier, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read classifier: %w", err)
+	}
+	if len(data) < 20 || string(data[:8]) != magic {
+		return nil, fmt.Errorf("%w: not a saved classifier", ErrCorrupted)
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, castagnoli) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+	}
+	if v := binary.LittleEndian.Uint32(body[8:]); v != version {
+		return nil, fmt.Errorf("unsupported classifier version %d", v)
+	}
+
+	d := &decoder{buf: body[16:]}
+	var c Classifier
+	switch kind := binary.LittleEndian.Uint32(body[12:]); kind {
+	case kindKNN:
+		c = decodeKNN(d)
+	case kindLogisticRegression:
+		c = decodeLogisticRegression(d)
+	default:
+		return nil, fmt.Errorf("unsupported classifier kind %d", kind)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.buf) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrCorrupted, len(d.buf))
+	}
+	return c, nil
+}
+
+func appendHeader(buf []byte, dim int, classes []string) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(dim))
+	buf = binary.AppendUvarint(buf, uint64(len(classes)))
+	for _, class := range classes {
+		buf = binary.AppendUvarint(buf, uint64(len(class)))
+		buf = append(buf, class...)
+	}
+	return buf
+}
+
+func (m *KNN) encode() (uint32, []byte) {
+	buf := appendHeader(nil, m.dim, m.classes)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.k))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.voting))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(m.vectors)))
+	for _, label := range m.labels {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(label))
+	}
+	for _, v := range m.vectors {
+		for _, x := range v {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(x))
+		}
+	}
+	return kindKNN, buf
+}
+
+func (m *LogisticRegression) encode() (uint32, []byte) {
+	buf := appendHeader(nil, m.dim, m.classes)
+	for _, w := range m.weights {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(w))
+	}
+	return kindLogisticRegression, buf
+}
+
+func decodeHeader(d *decoder) (int, []string) {
+	dim := int(d.uint32())
+	classes := make([]string, d.count(1))
+	for i := range classes {
+		classes[i] = string(d.bytes(d.count(1)))
+	}
+	if d.err == nil && len(classes) == 0 {
+		d.fail("no classes")
+	}
+	// Every dimension takes at least a value in the rest of the payload,
+	// which bounds the sizes computed from it.
+	if d.err == nil && (dim == 0 || dim > len(d.buf)) {
+		d.fail("invalid dimension")
+	}
+	return dim, classes
+}
+
+func decodeKNN(d *decoder) *KNN {
+	m := &KNN{}
+	m.dim, m.classes = decodeHeader(d)
+	m.k = int(d.uint32())
+	m.voting = Voting(d.uint32())
+	n := int(d.uint32())
+	if d.err == nil && (m.k <= 0 || m.voting > UniformVoting || len(d.buf) != n*4+n*m.dim*4) {
+		d.fail("invalid KNN parameters")
+	}
+	if d.err != nil {
+		return nil
+	}
+	m.labels = make([]int, n)
+	for i := range m.labels {
+		m.labels[i] = int(d.uint32())
+		if m.labels[i] >= len(m.classes) {
+			d.fail("class index out of range")
+			return nil
+		}
+	}
+	m.vectors = make([][]float32, n)
+	for i := range m.vectors {
+		m.vectors[i] = make([]float32, m.dim)
+		for j := range m.vectors[i] {
+			m.vectors[i][j] = math.Float32frombits(d.uint32())
+		}
+	}
+	return m
+}
+
+func decodeLogisticRegression(d *decoder) *LogisticRegression {
+	m := &LogisticRegression{}
+	m.dim, m.classes = decodeHeader(d)
+	if d.err == nil && len(d.buf) != len(m.classes)*(m.dim+1)*8 {
+		d.fail("invalid number of weights")
+	}
+	if d.err != nil {
+		return nil
+	}
+	m.weights = make([]float64, len(m.classes)*(m.dim+1))
+	for i := range m.weights {
+		m.weights[i] = math.Float64frombits(d.uint64())
+	}
+	return m
+}
+
+// decoder reads a payload, recording the first error so that callers check it
+// once at the end.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail(reason string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrCorrupted, reason)
+	}
+	d.buf = nil
+}
+
+func (d *decoder) uint32() uint32 {
+	if len(d.buf) < 4 {
+		d.fail("truncated payload")
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(d.buf)
+	d.buf = d.buf[4:]
+	return v
+}
+
+func (d *decoder) uint64() uint64 {
+	if len(d.buf) < 8 {
+		d.fail("truncated payload")
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(d.buf)
+	d.buf = d.buf[8:]
+	return v
+}
+
+// count reads a uvarint count of items of at least itemSize bytes, failing if
+// the remaining payload cannot hold them.
+func (d *decoder) count(itemSize int) int {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 || v > uint64(len(d.buf)-n)/uint64(itemSize) {
+		d.fail("invalid count")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return int(v)
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if len(d.buf) < n {
+		d.fail("truncated payload")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
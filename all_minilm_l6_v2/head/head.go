@@ -0,0 +1,96 @@
+// Package head trains lightweight classifiers on top of embeddings: a
+// k-nearest neighbors classifier with weighted voting and a multinomial
+// logistic regression. Classifiers are saved to and loaded from a versioned
+// binary format, and evaluated with stratified cross-validation.
+//
+// Classes are given as strings; the probabilities returned by a classifier
+// follow the order of its Classes, which are sorted.
+package head
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	// ErrDimensionMismatch is returned when a vector does not have the
+	// dimension of the training vectors.
+	ErrDimensionMismatch = errors.New("dimension mismatch")
+	// ErrCorrupted is returned when loading data that is not a valid saved
+	// classifier.
+	ErrCorrupted = errors.New("corrupted classifier")
+)
+
+// Classifier predicts the class of a vector.
+type Classifier interface {
+	// Classes returns the classes the classifier was trained on, sorted.
+	Classes() []string
+	// Dim returns the dimension of the vectors.
+	Dim() int
+	// PredictProba returns the probability of every class, in the order of
+	// Classes.
+	PredictProba(x []float32) ([]float64, error)
+	// Predict returns the most probable class.
+	Predict(x []float32) (string, error)
+
+	// encode returns the kind of the classifier and its serialized
+	// parameters, see Save.
+	encode() (kind uint32, payload []byte)
+}
+
+// Trainer trains a classifier on vectors x labeled with y, such as the ones
+// returned by KNNTrainer and LogisticRegressionTrainer.
+type Trainer = func(x [][]float32, y []string) (Classifier, error)
+
+// indexClasses checks the training set and returns its sorted classes along
+// with the index of the class of every vector.
+func indexClasses(x [][]float32, y []string) ([]string, []int, error) {
+	if len(x) == 0 {
+		return nil, nil, errors.New("no training vectors")
+	}
+	if len(x) != len(y) {
+		return nil, nil, fmt.Errorf("got %d vectors for %d labels", len(x), len(y))
+	}
+	for i, v := range x {
+		if len(v) != len(x[0]) {
+			return nil, nil, fmt.Errorf("%w: vector %d has dimension %d, expected %d", ErrDimensionMismatch, i, len(v), len(x[0]))
+		}
+	}
+
+	classes := slices.Clone(y)
+	slices.Sort(classes)
+	classes = slices.Compact(classes)
+	labels := make([]int, len(y))
+	for i, class := range y {
+		labels[i], _ = slices.BinarySearch(classes, class)
+	}
+	return classes, labels, nil
+}
+
+func checkDim(expected, actual int) error {
+	if expected != actual {
+		return fmt.Errorf("%w: got %d, expected %d", ErrDimensionMismatch, actual, expected)
+	}
+	return nil
+}
+
+// argmax returns the index of the highest value, the first one on ties.
+func argmax(values []float64) int {
+	best := 0
+	for i, v := range values {
+		if v > values[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// predict returns the most probable class of x.
+func predict(c Classifier, x []float32) (string, error) {
+	proba, err := c.PredictProba(x)
+	if err != nil {
+		return "", err
+	}
+	return c.Classes()[argmax(proba)], nil
+}
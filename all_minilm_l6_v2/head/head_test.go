@@ -0,0 +1,297 @@
+package head_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/head"
+)
+
+// blobs returns n vectors per class scattered around a random direction per
+// class with the given noise.
+func blobs(seed int64, classes, n, dim int, noise float64) ([][]float32, []string) {
+	rng := rand.New(rand.NewSource(seed))
+	centers := make([][]float64, classes)
+	for c := range centers {
+		centers[c] = make([]float64, dim)
+		for d := range centers[c] {
+			centers[c][d] = rng.NormFloat64()
+		}
+	}
+
+	var x [][]float32
+	var y []string
+	for i := range n * classes {
+		c := i % classes
+		v := make([]float32, dim)
+		for d := range v {
+			v[d] = float32(centers[c][d] + noise*rng.NormFloat64())
+		}
+		x = append(x, v)
+		y = append(y, fmt.Sprintf("class-%d", c))
+	}
+	return x, y
+}
+
+func accuracy(t *testing.T, c head.Classifier, x [][]float32, y []string) float64 {
+	t.Helper()
+	metrics, err := head.Evaluate(c, x, y)
+	if err != nil {
+		t.Fatalf("Failed to evaluate: %v", err)
+	}
+	return metrics.Accuracy
+}
+
+func checkProbabilities(t *testing.T, c head.Classifier, x []float32) []float64 {
+	t.Helper()
+	proba, err := c.PredictProba(x)
+	if err != nil {
+		t.Fatalf("Failed to predict: %v", err)
+	}
+	if len(proba) != len(c.Classes()) {
+		t.Fatalf("Expected %d probabilities, got %d", len(c.Classes()), len(proba))
+	}
+	var sum float64
+	for _, p := range proba {
+		if p < 0 || p > 1 {
+			t.Errorf("Probability %f is out of range", p)
+		}
+		sum += p
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("Expected probabilities to sum to 1, got %f", sum)
+	}
+	return proba
+}
+
+func TestKNN(t *testing.T) {
+	x, y := blobs(1, 3, 40, 16, 0.5)
+	test, testY := blobs(1, 3, 10, 16, 0.5)
+
+	for _, voting := range []head.Voting{head.SimilarityVoting, head.UniformVoting} {
+		knn, err := head.FitKNN(x, y, head.WithK(7), head.WithVoting(voting))
+		if err != nil {
+			t.Fatalf("Failed to fit KNN: %v", err)
+		}
+		if acc := accuracy(t, knn, test, testY); acc < 0.95 {
+			t.Errorf("Voting %d: expected an accuracy of at least 0.95, got %f", voting, acc)
+		}
+		checkProbabilities(t, knn, test[0])
+	}
+}
+
+func TestKNNVoting(t *testing.T) {
+	// The query is very close to the single "near" vector and less close to
+	// the two "far" ones
+	x := [][]float32{{1, 0}, {0.5, 1}, {0.5, -1}}
+	y := []string{"near", "far", "far"}
+	query := []float32{1, 0.01}
+
+	uniform, _ := head.FitKNN(x, y, head.WithK(3), head.WithVoting(head.UniformVoting))
+	if class, _ := uniform.Predict(query); class != "far" {
+		t.Errorf("Expected the majority to win with uniform votes, got %s", class)
+	}
+	weighted, _ := head.FitKNN(x, y, head.WithK(3), head.WithVoting(head.SimilarityVoting))
+	proba := checkProbabilities(t, weighted, query)
+	// Classes are sorted, so "far" comes first
+	if math.Abs(proba[1]-1/(1+2*0.4472)) > 0.01 {
+		t.Errorf("Expected votes weighted by similarity, got %v", proba)
+	}
+}
+
+func TestLogisticRegression(t *testing.T) {
+	x, y := blobs(2, 4, 50, 16, 0.8)
+	test, testY := blobs(2, 4, 10, 16, 0.8)
+
+	for _, solver := range []head.Solver{head.LBFGS, head.SGD} {
+		model, err := head.FitLogisticRegression(x, y, head.WithSolver(solver), head.WithMaxIterations(100))
+		if err != nil {
+			t.Fatalf("Failed to fit logistic regression: %v", err)
+		}
+		if acc := accuracy(t, model, test, testY); acc < 0.95 {
+			t.Errorf("Solver %d: expected an accuracy of at least 0.95, got %f", solver, acc)
+		}
+		checkProbabilities(t, model, test[0])
+	}
+}
+
+func TestLogisticRegressionSolversAgree(t *testing.T) {
+	// Overlapping classes with regularization have a unique optimum both
+	// solvers converge to
+	x, y := blobs(3, 3, 60, 4, 2)
+	lbfgs, err := head.FitLogisticRegression(x, y, head.WithL2(0.01))
+	if err != nil {
+		t.Fatalf("Failed to fit with L-BFGS: %v", err)
+	}
+	sgd, err := head.FitLogisticRegression(x, y, head.WithL2(0.01),
+		head.WithSolver(head.SGD), head.WithMaxIterations(300), head.WithBatchSize(16))
+	if err != nil {
+		t.Fatalf("Failed to fit with SGD: %v", err)
+	}
+
+	for _, v := range x[:20] {
+		a, _ := lbfgs.PredictProba(v)
+		b, _ := sgd.PredictProba(v)
+		for c := range a {
+			if math.Abs(a[c]-b[c]) > 0.05 {
+				t.Fatalf("Solvers disagree: %v and %v", a, b)
+			}
+		}
+	}
+}
+
+func TestLogisticRegressionValidation(t *testing.T) {
+	x, y := blobs(4, 1, 10, 4, 1)
+	if _, err := head.FitLogisticRegression(x, y); err == nil {
+		t.Errorf("Expected an error for a single class")
+	}
+	if _, err := head.FitLogisticRegression(x, y[:5]); err == nil {
+		t.Errorf("Expected an error for mismatched labels")
+	}
+	if _, err := head.FitKNN([][]float32{{1, 2}, {1}}, []string{"a", "b"}); !errors.Is(err, head.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+	knn, _ := head.FitKNN(x, y)
+	if _, err := knn.Predict([]float32{1}); !errors.Is(err, head.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	x, y := blobs(5, 3, 20, 8, 0.5)
+	knn, _ := head.FitKNN(x, y, head.WithK(3), head.WithVoting(head.UniformVoting))
+	logistic, _ := head.FitLogisticRegression(x, y)
+
+	for _, c := range []head.Classifier{knn, logistic} {
+		var buf bytes.Buffer
+		if err := head.Save(&buf, c); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		data := buf.Bytes()
+
+		loaded, err := head.Load(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		if fmt.Sprint(loaded.Classes()) != fmt.Sprint(c.Classes()) || loaded.Dim() != c.Dim() {
+			t.Errorf("Loaded classifier has classes %v and dimension %d", loaded.Classes(), loaded.Dim())
+		}
+		for _, v := range x {
+			a, _ := c.PredictProba(v)
+			b, _ := loaded.PredictProba(v)
+			if fmt.Sprint(a) != fmt.Sprint(b) {
+				t.Fatalf("Loaded classifier predicts %v instead of %v", b, a)
+			}
+		}
+
+		// Any flipped byte or truncation is detected
+		for i := range data {
+			corrupted := bytes.Clone(data)
+			corrupted[i] ^= 0x40
+			if _, err := head.Load(bytes.NewReader(corrupted)); err == nil {
+				t.Fatalf("Expected an error with byte %d flipped", i)
+			}
+		}
+		for n := range len(data) {
+			if _, err := head.Load(bytes.NewReader(data[:n])); err == nil {
+				t.Fatalf("Expected an error when truncated to %d bytes", n)
+			}
+		}
+	}
+}
+
+func TestStratifiedKFold(t *testing.T) {
+	var y []string
+	for i := range 30 {
+		if i < 10 {
+			y = append(y, "rare")
+		} else {
+			y = append(y, "common")
+		}
+	}
+
+	folds, err := head.StratifiedKFold(y, 5, 1)
+	if err != nil {
+		t.Fatalf("Failed to split: %v", err)
+	}
+	seen := make(map[int]bool)
+	for _, fold := range folds {
+		if len(fold) != 6 {
+			t.Errorf("Expected folds of 6 indices, got %d", len(fold))
+		}
+		rare := 0
+		for _, i := range fold {
+			if seen[i] {
+				t.Errorf("Index %d is in several folds", i)
+			}
+			seen[i] = true
+			if y[i] == "rare" {
+				rare++
+			}
+		}
+		if rare != 2 {
+			t.Errorf("Expected 2 rare labels per fold, got %d", rare)
+		}
+	}
+	if len(seen) != len(y) {
+		t.Errorf("Expected every index in a fold, got %d", len(seen))
+	}
+
+	if _, err := head.StratifiedKFold(y, 1, 1); err == nil {
+		t.Errorf("Expected an error for a single fold")
+	}
+}
+
+func TestCrossValidate(t *testing.T) {
+	x, y := blobs(6, 3, 30, 8, 0.5)
+
+	result, err := head.CrossValidate(head.KNNTrainer(head.WithK(5)), x, y, 5, 1)
+	if err != nil {
+		t.Fatalf("Failed to cross-validate: %v", err)
+	}
+	if len(result.Folds) != 5 {
+		t.Fatalf("Expected 5 folds, got %d", len(result.Folds))
+	}
+	if result.MeanAccuracy < 0.95 || result.MeanMacroF1 < 0.95 {
+		t.Errorf("Expected high scores, got accuracy %f and macro F1 %f", result.MeanAccuracy, result.MeanMacroF1)
+	}
+	total := 0
+	for _, fold := range result.Folds {
+		for _, row := range fold.Confusion {
+			for _, n := range row {
+				total += n
+			}
+		}
+	}
+	if total != len(x) {
+		t.Errorf("Expected every vector to be evaluated once, got %d", total)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	knn, _ := head.FitKNN([][]float32{{1, 0}, {0, 1}}, []string{"a", "b"}, head.WithK(1))
+	x := [][]float32{{1, 0.1}, {0.1, 1}, {1, 0}, {0, 1}}
+	y := []string{"a", "b", "b", "c"}
+
+	metrics, err := head.Evaluate(knn, x, y)
+	if err != nil {
+		t.Fatalf("Failed to evaluate: %v", err)
+	}
+	if fmt.Sprint(metrics.Classes) != "[a b c]" {
+		t.Errorf("Expected classes a, b and c, got %v", metrics.Classes)
+	}
+	if metrics.Accuracy != 0.5 {
+		t.Errorf("Expected an accuracy of 0.5, got %f", metrics.Accuracy)
+	}
+	// F1 of a is 2/3, of b 1/2 and of c 0
+	if expected := (2.0/3 + 0.5 + 0) / 3; math.Abs(metrics.MacroF1-expected) > 1e-9 {
+		t.Errorf("Expected a macro F1 of %f, got %f", expected, metrics.MacroF1)
+	}
+	if metrics.Confusion[2][1] != 1 {
+		t.Errorf("Expected c to be predicted as b once, got %v", metrics.Confusion)
+	}
+}
@@ -0,0 +1,138 @@
+package head
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// DefaultK is the default number of neighbors voting in a KNN.
+const DefaultK = 5
+
+// Voting is the weight of the vote of a neighbor in a KNN.
+type Voting uint32
+
+const (
+	// SimilarityVoting weighs each neighbor by its cosine similarity, negative
+	// similarities counting as zero.
+	SimilarityVoting Voting = iota
+	// UniformVoting gives every neighbor the same weight.
+	UniformVoting
+)
+
+// KNN classifies a vector by the votes of its k most similar training vectors
+// by cosine similarity.
+type KNN struct {
+	k       int
+	voting  Voting
+	classes []string
+	dim     int
+	// vectors are the normalized training vectors and labels the index of
+	// their class.
+	vectors [][]float32
+	labels  []int
+}
+
+type knnOptions struct {
+	k      int
+	voting Voting
+}
+
+type KNNOption = func(*knnOptions)
+
+// WithK sets the number of neighbors voting. It defaults to DefaultK.
+func WithK(k int) KNNOption {
+	return func(o *knnOptions) {
+		o.k = k
+	}
+}
+
+// WithVoting sets the weight of the votes. It defaults to SimilarityVoting.
+func WithVoting(voting Voting) KNNOption {
+	return func(o *knnOptions) {
+		o.voting = voting
+	}
+}
+
+// FitKNN returns a KNN classifying vectors by their neighbors among x,
+// labeled with y. The training vectors are copied.
+func FitKNN(x [][]float32, y []string, opts ...KNNOption) (*KNN, error) {
+	o := knnOptions{k: DefaultK, voting: SimilarityVoting}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.k <= 0 {
+		return nil, fmt.Errorf("k must be positive, got %d", o.k)
+	}
+	if o.voting != SimilarityVoting && o.voting != UniformVoting {
+		return nil, fmt.Errorf("unknown voting %d", o.voting)
+	}
+	classes, labels, err := indexClasses(x, y)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(x))
+	for i, v := range x {
+		vectors[i] = vecmath.Normalized(v)
+	}
+	return &KNN{k: o.k, voting: o.voting, classes: classes, dim: len(x[0]), vectors: vectors, labels: labels}, nil
+}
+
+// KNNTrainer returns a Trainer fitting a KNN with opts.
+func KNNTrainer(opts ...KNNOption) Trainer {
+	return func(x [][]float32, y []string) (Classifier, error) {
+		return FitKNN(x, y, opts...)
+	}
+}
+
+func (m *KNN) Classes() []string { return slices.Clone(m.classes) }
+
+func (m *KNN) Dim() int { return m.dim }
+
+// PredictProba returns the share of the votes of every class. When every
+// neighbor has a zero weight, they vote uniformly.
+func (m *KNN) PredictProba(x []float32) ([]float64, error) {
+	if err := checkDim(m.dim, len(x)); err != nil {
+		return nil, err
+	}
+
+	query := vecmath.Normalized(x)
+	type neighbor struct {
+		index int
+		score float64
+	}
+	neighbors := make([]neighbor, len(m.vectors))
+	for i, v := range m.vectors {
+		neighbors[i] = neighbor{i, float64(vecmath.Dot(query, v))}
+	}
+	sort.SliceStable(neighbors, func(i, j int) bool {
+		return neighbors[i].score > neighbors[j].score
+	})
+	neighbors = neighbors[:min(m.k, len(neighbors))]
+
+	votes := make([]float64, len(m.classes))
+	var total float64
+	for _, n := range neighbors {
+		weight := 1.0
+		if m.voting == SimilarityVoting {
+			weight = max(n.score, 0)
+		}
+		votes[m.labels[n.index]] += weight
+		total += weight
+	}
+	if total == 0 {
+		for _, n := range neighbors {
+			votes[m.labels[n.index]]++
+		}
+		total = float64(len(neighbors))
+	}
+	for i := range votes {
+		votes[i] /= total
+	}
+	return votes, nil
+}
+
+func (m *KNN) Predict(x []float32) (string, error) { return predict(m, x) }
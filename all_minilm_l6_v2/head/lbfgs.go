@@ -0,0 +1,126 @@
+package head
+
+import "math"
+
+// lbfgsHistory is the number of past updates approximating the inverse
+// Hessian.
+const lbfgsHistory = 10
+
+// lbfgs minimizes f from x, updating x in place. f returns the value at its
+// first argument and sets its second argument to the gradient. It stops after
+// maxIterations, once the largest gradient component is below tolerance, or
+// when the line search makes no progress.
+func lbfgs(x []float64, f func(x, grad []float64) float64, maxIterations int, tolerance float64) {
+	n := len(x)
+	grad := make([]float64, n)
+	value := f(x, grad)
+
+	var s, y [][]float64
+	var rho []float64
+	direction := make([]float64, n)
+	next := make([]float64, n)
+	nextGrad := make([]float64, n)
+	alpha := make([]float64, lbfgsHistory)
+
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		if maxAbs(grad) < tolerance {
+			return
+		}
+
+		// Two-loop recursion computing the direction -H·grad.
+		copy(direction, grad)
+		for i := len(s) - 1; i >= 0; i-- {
+			alpha[i] = rho[i] * dot(s[i], direction)
+			axpy(-alpha[i], y[i], direction)
+		}
+		if len(s) > 0 {
+			last := len(s) - 1
+			scale(dot(s[last], y[last])/dot(y[last], y[last]), direction)
+		} else {
+			// Without curvature information, the first step has unit
+			// length.
+			scale(1/math.Sqrt(dot(grad, grad)), direction)
+		}
+		for i := range s {
+			beta := rho[i] * dot(y[i], direction)
+			axpy(alpha[i]-beta, s[i], direction)
+		}
+		scale(-1, direction)
+
+		slope := dot(grad, direction)
+		if slope >= 0 {
+			// Not a descent direction: restart from steepest descent.
+			s, y, rho = nil, nil, nil
+			copy(direction, grad)
+			scale(-1/math.Sqrt(dot(grad, grad)), direction)
+			slope = dot(grad, direction)
+		}
+
+		// Backtracking line search with the Armijo condition.
+		step := 1.0
+		var nextValue float64
+		for {
+			for i := range x {
+				next[i] = x[i] + step*direction[i]
+			}
+			nextValue = f(next, nextGrad)
+			if nextValue <= value+1e-4*step*slope {
+				break
+			}
+			step /= 2
+			if step < 1e-10 {
+				return
+			}
+		}
+
+		sk := make([]float64, n)
+		yk := make([]float64, n)
+		for i := range x {
+			sk[i] = next[i] - x[i]
+			yk[i] = nextGrad[i] - grad[i]
+		}
+		copy(x, next)
+		copy(grad, nextGrad)
+		improvement := value - nextValue
+		value = nextValue
+
+		if sy := dot(sk, yk); sy > 1e-10 {
+			if len(s) == lbfgsHistory {
+				s, y, rho = s[1:], y[1:], rho[1:]
+			}
+			s, y, rho = append(s, sk), append(y, yk), append(rho, 1/sy)
+		}
+		if improvement <= 1e-12*max(math.Abs(value), 1) {
+			return
+		}
+	}
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// axpy adds a × x to y.
+func axpy(a float64, x, y []float64) {
+	for i := range x {
+		y[i] += a * x[i]
+	}
+}
+
+func scale(a float64, x []float64) {
+	for i := range x {
+		x[i] *= a
+	}
+}
+
+func maxAbs(x []float64) float64 {
+	var m float64
+	for _, v := range x {
+		m = max(m, math.Abs(v))
+	}
+	return m
+}
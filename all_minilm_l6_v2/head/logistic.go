@@ -0,0 +1,258 @@
+package head
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+const (
+	// DefaultL2 is the default L2 regularization strength of a
+	// LogisticRegression.
+	DefaultL2 = 1e-4
+	// DefaultMaxIterations is the default number of L-BFGS iterations, or of
+	// SGD epochs.
+	DefaultMaxIterations = 200
+	// DefaultLearningRate is the default initial SGD learning rate.
+	DefaultLearningRate = 0.5
+	// DefaultBatchSize is the default number of vectors per SGD step.
+	DefaultBatchSize = 32
+)
+
+// Solver is the optimization algorithm training a LogisticRegression.
+type Solver int
+
+const (
+	// LBFGS minimizes the loss over the whole training set with L-BFGS.
+	LBFGS Solver = iota
+	// SGD minimizes the loss with mini-batch stochastic gradient descent,
+	// which scales to training sets too large for LBFGS.
+	SGD
+)
+
+// LogisticRegression is a multinomial logistic regression: the probabilities
+// of the classes are the softmax of affine functions of the vector.
+type LogisticRegression struct {
+	classes []string
+	dim     int
+	// weights holds for every class dim coefficients followed by the bias.
+	weights []float64
+}
+
+type logisticOptions struct {
+	solver        Solver
+	l2            float64
+	maxIterations int
+	tolerance     float64
+	learningRate  float64
+	batchSize     int
+	seed          int64
+}
+
+type LogisticOption = func(*logisticOptions)
+
+// WithSolver sets the optimization algorithm. It defaults to LBFGS.
+func WithSolver(solver Solver) LogisticOption {
+	return func(o *logisticOptions) {
+		o.solver = solver
+	}
+}
+
+// WithL2 sets the strength of the L2 regularization of the coefficients,
+// biases excluded. It defaults to DefaultL2.
+func WithL2(lambda float64) LogisticOption {
+	return func(o *logisticOptions) {
+		o.l2 = lambda
+	}
+}
+
+// WithMaxIterations sets the number of L-BFGS iterations, or of SGD epochs.
+// It defaults to DefaultMaxIterations.
+func WithMaxIterations(n int) LogisticOption {
+	return func(o *logisticOptions) {
+		o.maxIterations = n
+	}
+}
+
+// WithTolerance stops L-BFGS once the largest gradient component is below
+// tolerance. It defaults to 1e-6.
+func WithTolerance(tolerance float64) LogisticOption {
+	return func(o *logisticOptions) {
+		o.tolerance = tolerance
+	}
+}
+
+// WithLearningRate sets the initial SGD learning rate, which decays with the
+// square root of the epoch. It defaults to DefaultLearningRate.
+func WithLearningRate(rate float64) LogisticOption {
+	return func(o *logisticOptions) {
+		o.learningRate = rate
+	}
+}
+
+// WithBatchSize sets the number of vectors per SGD step. It defaults to
+// DefaultBatchSize.
+func WithBatchSize(n int) LogisticOption {
+	return func(o *logisticOptions) {
+		o.batchSize = n
+	}
+}
+
+// WithSeed sets the seed of the random number generator shuffling the SGD
+// batches.
+func WithSeed(seed int64) LogisticOption {
+	return func(o *logisticOptions) {
+		o.seed = seed
+	}
+}
+
+// FitLogisticRegression trains a LogisticRegression on vectors x labeled with
+// y by minimizing the mean cross-entropy plus the L2 penalty. At least two
+// classes are required.
+func FitLogisticRegression(x [][]float32, y []string, opts ...LogisticOption) (*LogisticRegression, error) {
+	o := logisticOptions{
+		solver:        LBFGS,
+		l2:            DefaultL2,
+		maxIterations: DefaultMaxIterations,
+		tolerance:     1e-6,
+		learningRate:  DefaultLearningRate,
+		batchSize:     DefaultBatchSize,
+		seed:          1,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.l2 < 0 {
+		return nil, fmt.Errorf("l2 must not be negative, got %f", o.l2)
+	}
+	classes, labels, err := indexClasses(x, y)
+	if err != nil {
+		return nil, err
+	}
+	if len(classes) < 2 {
+		return nil, errors.New("at least two classes are required")
+	}
+
+	m := &LogisticRegression{
+		classes: classes,
+		dim:     len(x[0]),
+		weights: make([]float64, len(classes)*(len(x[0])+1)),
+	}
+	switch o.solver {
+	case LBFGS:
+		lbfgs(m.weights, func(w, grad []float64) float64 {
+			return m.loss(w, grad, x, labels, o.l2)
+		}, o.maxIterations, o.tolerance)
+	case SGD:
+		m.sgd(x, labels, o)
+	default:
+		return nil, fmt.Errorf("unknown solver %d", o.solver)
+	}
+	return m, nil
+}
+
+// LogisticRegressionTrainer returns a Trainer fitting a LogisticRegression
+// with opts.
+func LogisticRegressionTrainer(opts ...LogisticOption) Trainer {
+	return func(x [][]float32, y []string) (Classifier, error) {
+		return FitLogisticRegression(x, y, opts...)
+	}
+}
+
+func (m *LogisticRegression) Classes() []string { return slices.Clone(m.classes) }
+
+func (m *LogisticRegression) Dim() int { return m.dim }
+
+func (m *LogisticRegression) PredictProba(x []float32) ([]float64, error) {
+	if err := checkDim(m.dim, len(x)); err != nil {
+		return nil, err
+	}
+	proba := make([]float64, len(m.classes))
+	m.probabilities(m.weights, x, proba)
+	return proba, nil
+}
+
+func (m *LogisticRegression) Predict(x []float32) (string, error) { return predict(m, x) }
+
+// probabilities sets proba to the softmax of the scores of x with weights w.
+func (m *LogisticRegression) probabilities(w []float64, x []float32, proba []float64) {
+	stride := m.dim + 1
+	maxScore := math.Inf(-1)
+	for c := range proba {
+		row := w[c*stride : (c+1)*stride]
+		score := row[m.dim]
+		for d, v := range x {
+			score += row[d] * float64(v)
+		}
+		proba[c] = score
+		maxScore = max(maxScore, score)
+	}
+	var sum float64
+	for c := range proba {
+		proba[c] = math.Exp(proba[c] - maxScore)
+		sum += proba[c]
+	}
+	for c := range proba {
+		proba[c] /= sum
+	}
+}
+
+// loss returns the regularized mean cross-entropy of weights w on the vectors
+// x labeled with labels, and sets grad to its gradient.
+func (m *LogisticRegression) loss(w, grad []float64, x [][]float32, labels []int, l2 float64) float64 {
+	stride := m.dim + 1
+	clear(grad)
+	proba := make([]float64, len(m.classes))
+	var loss float64
+	for i, v := range x {
+		m.probabilities(w, v, proba)
+		loss -= math.Log(max(proba[labels[i]], math.SmallestNonzeroFloat64))
+		proba[labels[i]]--
+		for c, p := range proba {
+			row := grad[c*stride : (c+1)*stride]
+			for d, xd := range v {
+				row[d] += p * float64(xd)
+			}
+			row[m.dim] += p
+		}
+	}
+
+	n := float64(len(x))
+	loss /= n
+	for c := range m.classes {
+		row := c * stride
+		for d := range m.dim {
+			grad[row+d] = grad[row+d]/n + l2*w[row+d]
+			loss += l2 / 2 * w[row+d] * w[row+d]
+		}
+		grad[row+m.dim] /= n
+	}
+	return loss
+}
+
+func (m *LogisticRegression) sgd(x [][]float32, labels []int, o logisticOptions) {
+	rng := rand.New(rand.NewSource(o.seed))
+	batchSize := max(o.batchSize, 1)
+	order := rng.Perm(len(x))
+	grad := make([]float64, len(m.weights))
+	batchX := make([][]float32, 0, batchSize)
+	batchLabels := make([]int, 0, batchSize)
+
+	for epoch := range o.maxIterations {
+		rate := o.learningRate / math.Sqrt(float64(epoch+1))
+		rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		for start := 0; start < len(order); start += batchSize {
+			batchX, batchLabels = batchX[:0], batchLabels[:0]
+			for _, i := range order[start:min(start+batchSize, len(order))] {
+				batchX = append(batchX, x[i])
+				batchLabels = append(batchLabels, labels[i])
+			}
+			m.loss(m.weights, grad, batchX, batchLabels, o.l2)
+			for i, g := range grad {
+				m.weights[i] -= rate * g
+			}
+		}
+	}
+}
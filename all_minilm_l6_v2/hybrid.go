@@ -0,0 +1,316 @@
+package all_minilm_l6_v2
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultRRFConstant is the default k of reciprocal rank fusion, which
+	// dampens the advantage of the very first ranks.
+	DefaultRRFConstant = 60
+	// DefaultHybridCandidates is the default number of candidates retrieved
+	// by each of the semantic and lexical searches before fusion.
+	DefaultHybridCandidates = 100
+)
+
+// FusionMethod is the way HybridCorpus combines semantic and lexical results.
+type FusionMethod int
+
+const (
+	// ReciprocalRankFusion scores a document with the sum over the searches
+	// of weight / (k + rank). It only depends on ranks, so it needs no
+	// calibration of the scores.
+	ReciprocalRankFusion FusionMethod = iota
+	// WeightedScoreFusion scores a document with the weighted sum of its
+	// scores min-max normalized over the candidates of each search.
+	WeightedScoreFusion
+)
+
+func (m FusionMethod) String() string {
+	switch m {
+	case ReciprocalRankFusion:
+		return "reciprocal rank fusion"
+	case WeightedScoreFusion:
+		return "weighted score fusion"
+	}
+	return fmt.Sprintf("FusionMethod(%d)", int(m))
+}
+
+// ScoreExplanation details how the score of a HybridResult was obtained.
+type ScoreExplanation struct {
+	Method FusionMethod
+
+	// SemanticRank is the 1-based rank of the document among the semantic
+	// candidates, 0 if it was not retrieved. SemanticScore is its cosine
+	// similarity to the query.
+	SemanticRank         int
+	SemanticScore        float64
+	SemanticContribution float64
+
+	// LexicalRank is the 1-based rank of the document among the lexical
+	// candidates, 0 if it was not retrieved. LexicalScore is its BM25 score
+	// and MatchedTerms the contribution of every query term it contains.
+	LexicalRank         int
+	LexicalScore        float64
+	LexicalContribution float64
+	MatchedTerms        map[string]float64
+}
+
+func (e ScoreExplanation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%.4f by %s:", e.SemanticContribution+e.LexicalContribution, e.Method)
+	if e.SemanticRank > 0 {
+		fmt.Fprintf(&b, " semantic %.4f (rank %d, cosine %.4f)", e.SemanticContribution, e.SemanticRank, e.SemanticScore)
+	} else {
+		b.WriteString(" semantic 0 (not retrieved)")
+	}
+	if e.LexicalRank > 0 {
+		terms := make([]string, 0, len(e.MatchedTerms))
+		for term := range e.MatchedTerms {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+		for i, term := range terms {
+			terms[i] = fmt.Sprintf("%s=%.4f", term, e.MatchedTerms[term])
+		}
+		fmt.Fprintf(&b, " + lexical %.4f (rank %d, bm25 %.4f: %s)", e.LexicalContribution, e.LexicalRank, e.LexicalScore, strings.Join(terms, " "))
+	} else {
+		b.WriteString(" + lexical 0 (not retrieved)")
+	}
+	return b.String()
+}
+
+// HybridResult is a document found by HybridCorpus.Search along with its
+// fused score and how it was obtained.
+type HybridResult struct {
+	Document    Document
+	Score       float64
+	Explanation ScoreExplanation
+}
+
+// HybridCorpus searches documents both by embedding similarity and with BM25,
+// so that exact identifiers and rare terms missed by the embeddings are still
+// retrieved, and fuses the two rankings.
+//
+// A HybridCorpus is safe for concurrent use.
+type HybridCorpus struct {
+	// mu serializes the writes so that both indexes hold the same version
+	// of a document updated concurrently.
+	mu      sync.Mutex
+	corpus  *Corpus
+	lexical *BM25Index
+
+	method                        FusionMethod
+	semanticWeight, lexicalWeight float64
+	rrfConstant                   float64
+	candidates                    int
+	corpusOptions                 []CorpusOption
+	bm25Options                   []BM25Option
+}
+
+type HybridOption = func(*HybridCorpus)
+
+// WithFusion sets the fusion method. It defaults to ReciprocalRankFusion.
+func WithFusion(method FusionMethod) HybridOption {
+	return func(h *HybridCorpus) {
+		h.method = method
+	}
+}
+
+// WithFusionWeights sets the weights of the semantic and lexical searches in
+// the fused score. They default to 1.
+func WithFusionWeights(semantic, lexical float64) HybridOption {
+	return func(h *HybridCorpus) {
+		h.semanticWeight = semantic
+		h.lexicalWeight = lexical
+	}
+}
+
+// WithRRFConstant sets the k of reciprocal rank fusion. It defaults to
+// DefaultRRFConstant.
+func WithRRFConstant(k float64) HybridOption {
+	return func(h *HybridCorpus) {
+		h.rrfConstant = k
+	}
+}
+
+// WithHybridCandidates sets the number of candidates retrieved by each search
+// before fusion. It defaults to DefaultHybridCandidates and is raised to k
+// when smaller.
+func WithHybridCandidates(n int) HybridOption {
+	return func(h *HybridCorpus) {
+		h.candidates = n
+	}
+}
+
+// WithCorpusOptions sets the options of the underlying Corpus.
+func WithCorpusOptions(opts ...CorpusOption) HybridOption {
+	return func(h *HybridCorpus) {
+		h.corpusOptions = opts
+	}
+}
+
+// WithBM25Options sets the options of the underlying BM25Index.
+func WithBM25Options(opts ...BM25Option) HybridOption {
+	return func(h *HybridCorpus) {
+		h.bm25Options = opts
+	}
+}
+
+func NewHybridCorpus(embedder Embedder, opts ...HybridOption) *HybridCorpus {
+	h := &HybridCorpus{
+		method:         ReciprocalRankFusion,
+		semanticWeight: 1,
+		lexicalWeight:  1,
+		rrfConstant:    DefaultRRFConstant,
+		candidates:     DefaultHybridCandidates,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.corpus = NewCorpus(embedder, h.corpusOptions...)
+	h.lexical = NewBM25Index(h.bm25Options...)
+	return h
+}
+
+// Add embeds and indexes docs, replacing the documents having the same ids.
+func (h *HybridCorpus) Add(ctx context.Context, docs ...Document) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.corpus.Add(ctx, docs...); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		h.lexical.Add(doc.ID, doc.Text)
+	}
+	return nil
+}
+
+// Remove removes the document with the given id and reports whether it was
+// present.
+func (h *HybridCorpus) Remove(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lexical.Remove(id)
+	return h.corpus.Remove(id)
+}
+
+// Len returns the number of documents in the corpus.
+func (h *HybridCorpus) Len() int {
+	return h.corpus.Len()
+}
+
+// Search returns the k documents with the highest fused score for query,
+// sorted by decreasing score, ties being broken by id. filter restricts both
+// searches as in Corpus.Search.
+func (h *HybridCorpus) Search(ctx context.Context, query string, k int, filter Filter) ([]HybridResult, error) {
+	if k <= 0 {
+		return nil, nil
+	}
+	candidates := max(h.candidates, k)
+
+	semantic, err := h.corpus.Search(ctx, query, candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+	var accept func(id string) bool
+	if filter != nil {
+		accept = func(id string) bool {
+			doc, ok := h.corpus.Get(id)
+			return ok && filter.Match(doc.Metadata)
+		}
+	}
+	lexical := h.lexical.search(query, candidates, accept)
+
+	semanticScores := make([]float64, len(semantic))
+	for i, r := range semantic {
+		semanticScores[i] = r.Score
+	}
+	lexicalScores := make([]float64, len(lexical))
+	for i, r := range lexical {
+		lexicalScores[i] = r.Score
+	}
+	semanticContributions := h.contributions(semanticScores, h.semanticWeight)
+	lexicalContributions := h.contributions(lexicalScores, h.lexicalWeight)
+
+	fused := make(map[string]*HybridResult)
+	for i, r := range semantic {
+		fused[r.Document.ID] = &HybridResult{
+			Document: r.Document,
+			Explanation: ScoreExplanation{
+				Method:               h.method,
+				SemanticRank:         i + 1,
+				SemanticScore:        r.Score,
+				SemanticContribution: semanticContributions[i],
+			},
+		}
+	}
+	for i, r := range lexical {
+		result, ok := fused[r.ID]
+		if !ok {
+			doc, ok := h.corpus.Get(r.ID)
+			if !ok {
+				// Removed between the two searches
+				continue
+			}
+			result = &HybridResult{Document: doc, Explanation: ScoreExplanation{Method: h.method}}
+			fused[r.ID] = result
+		}
+		result.Explanation.LexicalRank = i + 1
+		result.Explanation.LexicalScore = r.Score
+		result.Explanation.LexicalContribution = lexicalContributions[i]
+		result.Explanation.MatchedTerms = r.Terms
+	}
+
+	results := make([]HybridResult, 0, len(fused))
+	for _, r := range fused {
+		r.Score = r.Explanation.SemanticContribution + r.Explanation.LexicalContribution
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Document.ID < results[j].Document.ID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// contributions returns the weighted contribution to the fused score of
+// every result of a search, given their scores in rank order.
+func (h *HybridCorpus) contributions(scores []float64, weight float64) []float64 {
+	contributions := make([]float64, len(scores))
+	if len(scores) == 0 {
+		return contributions
+	}
+
+	switch h.method {
+	case WeightedScoreFusion:
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, s := range scores {
+			lo, hi = min(lo, s), max(hi, s)
+		}
+		for i, s := range scores {
+			normalized := 1.0
+			if hi > lo {
+				normalized = (s - lo) / (hi - lo)
+			}
+			contributions[i] = weight * normalized
+		}
+	default:
+		for i := range scores {
+			contributions[i] = weight / (h.rrfConstant + float64(i+1))
+		}
+	}
+	return contributions
+}
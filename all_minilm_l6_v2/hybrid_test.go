@@ -0,0 +1,179 @@
+package all_minilm_l6_v2_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+// fixedEmbedder returns predefined embeddings.
+type fixedEmbedder map[string][]float32
+
+func (e fixedEmbedder) ComputeBatch(sentences []string, addSpecialTokens bool) ([][]float32, error) {
+	embeddings := make([][]float32, len(sentences))
+	for i, s := range sentences {
+		v, ok := e[s]
+		if !ok {
+			return nil, fmt.Errorf("no embedding for %q", s)
+		}
+		embeddings[i] = v
+	}
+	return embeddings, nil
+}
+
+const hybridQuery = "router ERR-4042"
+
+// newHybridCorpus returns a corpus where the query is semantically close to
+// the generic router documents but only one document has the identifier.
+func newHybridCorpus(t *testing.T, opts ...all_minilm_l6_v2.HybridOption) *all_minilm_l6_v2.HybridCorpus {
+	t.Helper()
+
+	embedder := fixedEmbedder{
+		hybridQuery:                {1, 0, 0},
+		"reset router":             {0.9, 0.1, 0},
+		"router setup guide":       {0.8, 0.2, 0},
+		"boot fails with ERR-4042": {0.1, 0.9, 0.1},
+		"pizza recipes":            {0, 0, 1},
+	}
+	h := all_minilm_l6_v2.NewHybridCorpus(embedder, opts...)
+	err := h.Add(context.Background(),
+		all_minilm_l6_v2.Document{ID: "reset", Text: "reset router", Metadata: map[string]any{"kind": "faq"}},
+		all_minilm_l6_v2.Document{ID: "setup", Text: "router setup guide", Metadata: map[string]any{"kind": "guide"}},
+		all_minilm_l6_v2.Document{ID: "error", Text: "boot fails with ERR-4042", Metadata: map[string]any{"kind": "faq"}},
+		all_minilm_l6_v2.Document{ID: "pizza", Text: "pizza recipes", Metadata: map[string]any{"kind": "food"}},
+	)
+	if err != nil {
+		t.Fatalf("Failed to add documents: %v", err)
+	}
+	return h
+}
+
+func hybridIDs(results []all_minilm_l6_v2.HybridResult) []string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.Document.ID
+	}
+	return ids
+}
+
+func TestHybridReciprocalRankFusion(t *testing.T) {
+	h := newHybridCorpus(t)
+
+	results, err := h.Search(context.Background(), hybridQuery, 2, nil)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+
+	// reset is first semantically and second lexically, error is third
+	// semantically and first lexically, matching both err and 4042
+	if fmt.Sprint(hybridIDs(results)) != "[reset error]" {
+		t.Fatalf("Expected [reset error], got %v", hybridIDs(results))
+	}
+
+	e := results[1].Explanation
+	if e.SemanticRank != 3 || e.LexicalRank != 1 {
+		t.Errorf("Expected ranks 3 and 1, got %d and %d", e.SemanticRank, e.LexicalRank)
+	}
+	expected := 1.0/(60+3) + 1.0/(60+1)
+	if math.Abs(results[1].Score-expected) > 1e-12 {
+		t.Errorf("Expected score %f, got %f", expected, results[1].Score)
+	}
+	if _, ok := e.MatchedTerms["4042"]; !ok {
+		t.Errorf("Expected 4042 among the matched terms, got %v", e.MatchedTerms)
+	}
+	if s := e.String(); !strings.Contains(s, "reciprocal rank fusion") || !strings.Contains(s, "4042=") {
+		t.Errorf("Unexpected explanation: %s", s)
+	}
+}
+
+func TestHybridWeights(t *testing.T) {
+	h := newHybridCorpus(t, all_minilm_l6_v2.WithFusionWeights(0.2, 1))
+
+	results, _ := h.Search(context.Background(), hybridQuery, 1, nil)
+	if len(results) != 1 || results[0].Document.ID != "error" {
+		t.Errorf("Expected the lexical match first, got %v", hybridIDs(results))
+	}
+}
+
+func TestHybridWeightedScoreFusion(t *testing.T) {
+	h := newHybridCorpus(t,
+		all_minilm_l6_v2.WithFusion(all_minilm_l6_v2.WeightedScoreFusion),
+		all_minilm_l6_v2.WithFusionWeights(0.5, 0.5))
+
+	results, err := h.Search(context.Background(), hybridQuery, 4, nil)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	for _, r := range results {
+		e := r.Explanation
+		if math.Abs(r.Score-(e.SemanticContribution+e.LexicalContribution)) > 1e-12 {
+			t.Errorf("%s: score %f is not the sum of the contributions %s", r.Document.ID, r.Score, e)
+		}
+		if e.SemanticContribution < 0 || e.SemanticContribution > 0.5 || e.LexicalContribution < 0 || e.LexicalContribution > 0.5 {
+			t.Errorf("%s: contributions out of range: %s", r.Document.ID, e)
+		}
+	}
+	// The best candidate of each search has a normalized score of 1
+	for _, r := range results {
+		e := r.Explanation
+		if e.SemanticRank == 1 && e.SemanticContribution != 0.5 {
+			t.Errorf("Expected a full semantic contribution for %s, got %s", r.Document.ID, e)
+		}
+		if e.LexicalRank == 1 && e.LexicalContribution != 0.5 {
+			t.Errorf("Expected a full lexical contribution for %s, got %s", r.Document.ID, e)
+		}
+	}
+}
+
+func TestHybridFilter(t *testing.T) {
+	h := newHybridCorpus(t)
+
+	results, err := h.Search(context.Background(), hybridQuery, 10, all_minilm_l6_v2.Eq("kind", "guide"))
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if fmt.Sprint(hybridIDs(results)) != "[setup]" {
+		t.Errorf("Expected [setup], got %v", hybridIDs(results))
+	}
+
+	h.Remove("error")
+	results, _ = h.Search(context.Background(), hybridQuery, 10, nil)
+	for _, r := range results {
+		if r.Document.ID == "error" {
+			t.Errorf("Removed document returned")
+		}
+	}
+}
+
+func TestHybridConcurrentWrites(t *testing.T) {
+	embedder := fixedEmbedder{}
+	for i := range 20 {
+		embedder[fmt.Sprintf("version%d", i)] = []float32{1, float32(i)}
+	}
+	h := all_minilm_l6_v2.NewHybridCorpus(embedder)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			_ = h.Add(context.Background(), all_minilm_l6_v2.Document{ID: "doc", Text: fmt.Sprintf("version%d", i)})
+		})
+	}
+	wg.Wait()
+
+	// Both indexes hold the same version of the document
+	for i := range 20 {
+		text := fmt.Sprintf("version%d", i)
+		results, err := h.Search(context.Background(), text, 1, nil)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if matched := results[0].Explanation.LexicalRank > 0; matched != (results[0].Document.Text == text) {
+			t.Errorf("Expected the lexical index to hold %q, got a match on %q: %v", results[0].Document.Text, text, matched)
+		}
+	}
+}
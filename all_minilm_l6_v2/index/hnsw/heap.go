@@ -0,0 +1,100 @@
+package hnsw
+
+import "sort"
+
+type candidate struct {
+	id       uint32
+	distance float32
+}
+
+// candidateHeap is a binary heap of candidates keeping the closest one at
+// the top, or the furthest one if furthestFirst is set. It is hand written
+// rather than built on container/heap to avoid boxing candidates in
+// interfaces on the hot path.
+type candidateHeap struct {
+	items         []candidate
+	furthestFirst bool
+}
+
+func (h *candidateHeap) len() int { return len(h.items) }
+
+func (h *candidateHeap) top() candidate { return h.items[0] }
+
+func (h *candidateHeap) before(a, b candidate) bool {
+	if h.furthestFirst {
+		return a.distance > b.distance
+	}
+	return a.distance < b.distance
+}
+
+func (h *candidateHeap) push(c candidate) {
+	h.items = append(h.items, c)
+	i := len(h.items) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.before(h.items[i], h.items[parent]) {
+			break
+		}
+		h.items[i], h.items[parent] = h.items[parent], h.items[i]
+		i = parent
+	}
+}
+
+func (h *candidateHeap) pop() candidate {
+	top := h.items[0]
+	last := len(h.items) - 1
+	h.items[0] = h.items[last]
+	h.items = h.items[:last]
+
+	i := 0
+	for {
+		left, right := 2*i+1, 2*i+2
+		next := i
+		if left < last && h.before(h.items[left], h.items[next]) {
+			next = left
+		}
+		if right < last && h.before(h.items[right], h.items[next]) {
+			next = right
+		}
+		if next == i {
+			break
+		}
+		h.items[i], h.items[next] = h.items[next], h.items[i]
+		i = next
+	}
+	return top
+}
+
+func sortCandidates(candidates []candidate) {
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+}
+
+// visitedSet tracks the nodes visited by a search. Marks are compared with
+// an epoch incremented on every reset, so that the set does not need to be
+// cleared between searches.
+type visitedSet struct {
+	marks []uint32
+	epoch uint32
+}
+
+func (v *visitedSet) reset(n int) {
+	if len(v.marks) < n {
+		v.marks = append(v.marks, make([]uint32, n-len(v.marks))...)
+	}
+	v.epoch++
+	if v.epoch == 0 {
+		clear(v.marks)
+		v.epoch = 1
+	}
+}
+
+// visit marks node i as visited and reports whether it was not already.
+func (v *visitedSet) visit(i uint32) bool {
+	if v.marks[i] == v.epoch {
+		return false
+	}
+	v.marks[i] = v.epoch
+	return true
+}
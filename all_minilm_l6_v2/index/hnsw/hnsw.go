@@ -0,0 +1,442 @@
+// Package hnsw implements an in-memory Hierarchical Navigable Small World
+// graph for approximate nearest neighbour search over the embeddings produced
+// by the all-MiniLM-L6-v2 model.
+//
+// Vectors are normalized when added and compared with the cosine similarity.
+// An Index can be searched by many goroutines at once while a single writer
+// adds or deletes vectors.
+package hnsw
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+const (
+	DefaultM              = 16
+	DefaultEfConstruction = 200
+	DefaultEfSearch       = 64
+)
+
+// ErrDimensionMismatch is returned when a vector does not have the dimension
+// the index was created with.
+var ErrDimensionMismatch = errors.New("dimension mismatch")
+
+// Result is a vector found by Search along with its cosine similarity to the
+// query.
+type Result struct {
+	ID    uint64
+	Score float32
+}
+
+type node struct {
+	id      uint64
+	vector  []float32
+	deleted bool
+	// friends[l] holds the neighbors of the node on layer l.
+	friends [][]uint32
+}
+
+type Index struct {
+	mu sync.RWMutex
+
+	dim            int
+	m              int
+	maxM0          int
+	efConstruction int
+	efSearch       int
+	levelMult      float64
+	rng            *rand.Rand
+
+	nodes    []node
+	ids      map[uint64]uint32
+	entry    uint32
+	maxLevel int
+	live     int
+
+	visitedPool sync.Pool
+}
+
+type Option = func(*Index)
+
+// WithM sets the number of neighbors kept per node on the upper layers. The
+// bottom layer keeps twice as many. Higher values improve recall at the cost
+// of memory and insertion time.
+func WithM(m int) Option {
+	return func(idx *Index) {
+		idx.m = m
+	}
+}
+
+// WithEfConstruction sets the size of the candidate list used when inserting.
+func WithEfConstruction(ef int) Option {
+	return func(idx *Index) {
+		idx.efConstruction = ef
+	}
+}
+
+// WithEfSearch sets the default size of the candidate list used when
+// searching. It can be changed later with SetEfSearch.
+func WithEfSearch(ef int) Option {
+	return func(idx *Index) {
+		idx.efSearch = ef
+	}
+}
+
+// WithSeed seeds the random generator drawing the layer of every node so that
+// the graph is reproducible.
+func WithSeed(seed int64) Option {
+	return func(idx *Index) {
+		idx.rng = rand.New(rand.NewSource(seed))
+	}
+}
+
+// New creates an empty index for vectors of the given dimension, 384 for the
+// all-MiniLM-L6-v2 model.
+func New(dim int, opts ...Option) *Index {
+	idx := &Index{
+		dim:            dim,
+		m:              DefaultM,
+		efConstruction: DefaultEfConstruction,
+		efSearch:       DefaultEfSearch,
+		rng:            rand.New(rand.NewSource(rand.Int63())),
+		ids:            make(map[uint64]uint32),
+	}
+
+	for _, opt := range opts {
+		opt(idx)
+	}
+
+	idx.m = max(idx.m, 2)
+	idx.maxM0 = 2 * idx.m
+	idx.efConstruction = max(idx.efConstruction, idx.m)
+	idx.levelMult = 1 / math.Log(float64(idx.m))
+	return idx
+}
+
+// Len returns the number of vectors in the index, deleted ones excluded.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.live
+}
+
+// Deleted returns the number of deleted or replaced vectors the graph still
+// holds. They are reclaimed by Compact.
+func (idx *Index) Deleted() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.nodes) - idx.live
+}
+
+// Compact rebuilds the graph from the vectors that are not deleted, in the
+// order they were added, reclaiming the memory of the deleted ones.
+func (idx *Index) Compact() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	nodes := idx.nodes
+	idx.nodes = make([]node, 0, idx.live)
+	idx.ids = make(map[uint64]uint32, idx.live)
+	idx.entry, idx.maxLevel, idx.live = 0, 0, 0
+	for _, n := range nodes {
+		if !n.deleted {
+			idx.add(n.id, n.vector)
+		}
+	}
+}
+
+// SetEfSearch changes the size of the candidate list used by Search. Larger
+// values improve recall at the cost of latency.
+func (idx *Index) SetEfSearch(ef int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.efSearch = ef
+}
+
+// Add inserts the vector under the given id. If the id is already present,
+// its previous vector is replaced.
+func (idx *Index) Add(id uint64, vector []float32) error {
+	if len(vector) != idx.dim {
+		return fmt.Errorf("%w: %d != %d", ErrDimensionMismatch, len(vector), idx.dim)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.add(id, vecmath.Normalized(vector))
+	return nil
+}
+
+// add inserts the normalized vector under the given id.
+func (idx *Index) add(id uint64, vector []float32) {
+	if previous, ok := idx.ids[id]; ok {
+		idx.nodes[previous].deleted = true
+		idx.live--
+	}
+
+	level := int(-math.Log(1-idx.rng.Float64()) * idx.levelMult)
+	n := node{
+		id:      id,
+		vector:  vector,
+		friends: make([][]uint32, level+1),
+	}
+	for l := range n.friends {
+		n.friends[l] = make([]uint32, 0, idx.maxFriends(l)+1)
+	}
+
+	current := uint32(len(idx.nodes))
+	idx.nodes = append(idx.nodes, n)
+	idx.ids[id] = current
+	idx.live++
+
+	if len(idx.nodes) == 1 {
+		idx.entry = current
+		idx.maxLevel = level
+		return
+	}
+
+	visited := idx.getVisited()
+	defer idx.visitedPool.Put(visited)
+
+	// Greedily descend the layers above the node level, then connect the node
+	// on every layer it belongs to.
+	entry := idx.entry
+	for l := idx.maxLevel; l > level; l-- {
+		entry = idx.greedyClosest(n.vector, entry, l)
+	}
+
+	entries := []candidate{{id: entry, distance: idx.distance(n.vector, entry)}}
+	for l := min(level, idx.maxLevel); l >= 0; l-- {
+		candidates := idx.searchLayer(n.vector, entries, idx.efConstruction, l, false, visited)
+		neighbors := idx.selectNeighbors(candidates, idx.m)
+
+		friends := make([]uint32, len(neighbors))
+		for i, c := range neighbors {
+			friends[i] = c.id
+		}
+		idx.nodes[current].friends[l] = append(idx.nodes[current].friends[l], friends...)
+
+		for _, c := range neighbors {
+			idx.connect(c.id, current, l)
+		}
+		entries = candidates
+	}
+
+	if level > idx.maxLevel {
+		idx.maxLevel = level
+		idx.entry = current
+	}
+}
+
+// Delete marks the vector with the given id as deleted. Deleted vectors keep
+// routing searches through the graph, but are never returned, until Compact
+// reclaims them. It reports whether the id was present.
+func (idx *Index) Delete(id uint64) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	i, ok := idx.ids[id]
+	if !ok {
+		return false
+	}
+	idx.nodes[i].deleted = true
+	delete(idx.ids, id)
+	idx.live--
+	return true
+}
+
+// Search returns the k vectors closest to query sorted by decreasing cosine
+// similarity, using the ef set by WithEfSearch or SetEfSearch.
+func (idx *Index) Search(query []float32, k int) ([]Result, error) {
+	idx.mu.RLock()
+	ef := idx.efSearch
+	idx.mu.RUnlock()
+	return idx.SearchWithEf(query, k, ef)
+}
+
+// SearchWithEf is Search with an explicit candidate list size, which is raised
+// to k if lower.
+func (idx *Index) SearchWithEf(query []float32, k int, ef int) ([]Result, error) {
+	if len(query) != idx.dim {
+		return nil, fmt.Errorf("%w: %d != %d", ErrDimensionMismatch, len(query), idx.dim)
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if idx.live == 0 || k <= 0 {
+		return nil, nil
+	}
+
+	visited := idx.getVisited()
+	defer idx.visitedPool.Put(visited)
+
+	q := vecmath.Normalized(query)
+	entry := idx.entry
+	for l := idx.maxLevel; l > 0; l-- {
+		entry = idx.greedyClosest(q, entry, l)
+	}
+
+	entries := []candidate{{id: entry, distance: idx.distance(q, entry)}}
+	candidates := idx.searchLayer(q, entries, max(ef, k), 0, true, visited)
+
+	results := make([]Result, 0, k)
+	for _, c := range candidates {
+		results = append(results, Result{
+			ID:    idx.nodes[c.id].id,
+			Score: 1 - c.distance,
+		})
+		if len(results) == k {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (idx *Index) maxFriends(level int) int {
+	if level == 0 {
+		return idx.maxM0
+	}
+	return idx.m
+}
+
+func (idx *Index) distance(q []float32, i uint32) float32 {
+	return 1 - vecmath.Dot(q, idx.nodes[i].vector)
+}
+
+// greedyClosest walks layer l from entry towards q until no neighbor is
+// closer.
+func (idx *Index) greedyClosest(q []float32, entry uint32, l int) uint32 {
+	best := entry
+	bestDistance := idx.distance(q, best)
+	for changed := true; changed; {
+		changed = false
+		for _, f := range idx.nodes[best].friends[l] {
+			if d := idx.distance(q, f); d < bestDistance {
+				best, bestDistance = f, d
+				changed = true
+			}
+		}
+	}
+	return best
+}
+
+// searchLayer returns up to ef nodes of layer l closest to q, sorted by
+// increasing distance. With liveOnly, deleted nodes are traversed but not
+// returned, and the search goes on until ef live nodes are found.
+func (idx *Index) searchLayer(q []float32, entries []candidate, ef int, l int, liveOnly bool, visited *visitedSet) []candidate {
+	visited.reset(len(idx.nodes))
+
+	var candidates, results candidateHeap
+	results.furthestFirst = true
+	for _, e := range entries {
+		visited.visit(e.id)
+		candidates.push(e)
+		if !liveOnly || !idx.nodes[e.id].deleted {
+			results.push(e)
+		}
+	}
+	for results.len() > ef {
+		results.pop()
+	}
+
+	for candidates.len() > 0 {
+		c := candidates.pop()
+		if results.len() >= ef && c.distance > results.top().distance {
+			break
+		}
+
+		for _, f := range idx.nodes[c.id].friends[l] {
+			if !visited.visit(f) {
+				continue
+			}
+			d := idx.distance(q, f)
+			if results.len() < ef || d < results.top().distance {
+				candidates.push(candidate{id: f, distance: d})
+				if liveOnly && idx.nodes[f].deleted {
+					continue
+				}
+				results.push(candidate{id: f, distance: d})
+				if results.len() > ef {
+					results.pop()
+				}
+			}
+		}
+	}
+
+	sorted := make([]candidate, results.len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = results.pop()
+	}
+	return sorted
+}
+
+// selectNeighbors keeps up to m candidates, sorted by increasing distance,
+// preferring candidates that are closer to the base vector than to any
+// already selected neighbor so that the graph links distinct regions. Pruned
+// candidates fill the remaining slots.
+func (idx *Index) selectNeighbors(candidates []candidate, m int) []candidate {
+	if len(candidates) <= m {
+		return candidates
+	}
+
+	selected := make([]candidate, 0, m)
+	var pruned []candidate
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if idx.distance(idx.nodes[c.id].vector, s.id) < c.distance {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c)
+		} else {
+			pruned = append(pruned, c)
+		}
+	}
+	for _, c := range pruned {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// connect adds a link from node i to node j on layer l, pruning the
+// neighbors of i if it has too many.
+func (idx *Index) connect(i, j uint32, l int) {
+	friends := append(idx.nodes[i].friends[l], j)
+	if len(friends) > idx.maxFriends(l) {
+		base := idx.nodes[i].vector
+		candidates := make([]candidate, len(friends))
+		for k, f := range friends {
+			candidates[k] = candidate{id: f, distance: idx.distance(base, f)}
+		}
+		sortCandidates(candidates)
+
+		friends = friends[:0]
+		for _, c := range idx.selectNeighbors(candidates, idx.maxFriends(l)) {
+			friends = append(friends, c.id)
+		}
+	}
+	idx.nodes[i].friends[l] = friends
+}
+
+func (idx *Index) getVisited() *visitedSet {
+	if v, ok := idx.visitedPool.Get().(*visitedSet); ok {
+		return v
+	}
+	return &visitedSet{}
+}
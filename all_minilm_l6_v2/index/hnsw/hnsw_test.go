@@ -0,0 +1,236 @@
+package hnsw_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/index/hnsw"
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/internal/testvec"
+)
+
+// clusteredVectors draws testvec.Clustered vectors with the noise these tests
+// are tuned for
+func clusteredVectors(seed int64, n, dim int) [][]float32 {
+	return testvec.Clustered(seed, n, dim, 2)
+}
+
+func buildIndex(t *testing.T, vectors [][]float32) *hnsw.Index {
+	t.Helper()
+
+	idx := hnsw.New(len(vectors[0]), hnsw.WithSeed(42))
+	for i, v := range vectors {
+		if err := idx.Add(uint64(i), v); err != nil {
+			t.Fatalf("Failed to add vector %d: %v", i, err)
+		}
+	}
+	return idx
+}
+
+func TestRecallAgainstBruteForce(t *testing.T) {
+	vectors := clusteredVectors(1, 5000, 384)
+	queries := clusteredVectors(2, 100, 384)
+	idx := buildIndex(t, vectors)
+	idx.SetEfSearch(100)
+
+	const k = 10
+	hits := 0
+	for _, q := range queries {
+		results, err := idx.Search(q, k)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+
+		expected := map[uint64]bool{}
+		for _, id := range testvec.BruteForce(q, vectors, k) {
+			expected[id] = true
+		}
+		for _, r := range results {
+			if expected[r.ID] {
+				hits++
+			}
+		}
+	}
+
+	recall := float64(hits) / float64(len(queries)*k)
+	if recall < 0.95 {
+		t.Errorf("Expected recall@10 of at least 0.95, got %.3f", recall)
+	}
+	t.Logf("recall@10 = %.3f", recall)
+}
+
+func TestSearchSortedByScore(t *testing.T) {
+	vectors := clusteredVectors(3, 500, 32)
+	idx := buildIndex(t, vectors)
+
+	results, err := idx.Search(vectors[7], 20)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+
+	if len(results) != 20 {
+		t.Fatalf("Expected 20 results, got %d", len(results))
+	}
+	if results[0].ID != 7 {
+		t.Errorf("Expected the vector itself first, got %d", results[0].ID)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("Results not sorted at %d: %f > %f", i, results[i].Score, results[i-1].Score)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	vectors := clusteredVectors(4, 300, 32)
+	idx := buildIndex(t, vectors)
+
+	if !idx.Delete(7) {
+		t.Fatal("Expected vector 7 to be deleted")
+	}
+	if idx.Delete(7) {
+		t.Error("Deleting twice should report the id as missing")
+	}
+	if idx.Len() != len(vectors)-1 {
+		t.Errorf("Expected %d vectors, got %d", len(vectors)-1, idx.Len())
+	}
+
+	results, err := idx.Search(vectors[7], 10)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	for _, r := range results {
+		if r.ID == 7 {
+			t.Error("Deleted vector returned by search")
+		}
+	}
+}
+
+func TestSearchAfterDeletes(t *testing.T) {
+	vectors := clusteredVectors(6, 1000, 32)
+	idx := buildIndex(t, vectors)
+	idx.SetEfSearch(10)
+
+	// Delete the neighbourhood of the query, including the vector itself,
+	// so that only tombstones surround it
+	neighbors := testvec.BruteForce(vectors[0], vectors, 200)
+	for _, id := range neighbors {
+		idx.Delete(id)
+	}
+	results, err := idx.Search(vectors[0], 10)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 10 {
+		t.Fatalf("Expected 10 live results, got %d", len(results))
+	}
+	deleted := map[uint64]bool{}
+	for _, id := range neighbors {
+		deleted[id] = true
+	}
+	for _, r := range results {
+		if deleted[r.ID] {
+			t.Errorf("Deleted vector %d returned by search", r.ID)
+		}
+	}
+
+	// A single live vector is found whatever the tombstones
+	for id := range vectors[1:] {
+		idx.Delete(uint64(id + 1))
+	}
+	_ = idx.Add(5000, vectors[0])
+	results, _ = idx.Search(vectors[0], 1)
+	if len(results) != 1 || results[0].ID != 5000 {
+		t.Errorf("Expected the only live vector, got %v", results)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	vectors := clusteredVectors(7, 1000, 32)
+	idx := buildIndex(t, vectors)
+	for i := range 600 {
+		idx.Delete(uint64(i))
+	}
+	_ = idx.Add(999, vectors[0])
+	if idx.Deleted() != 601 {
+		t.Errorf("Expected 601 deleted vectors, got %d", idx.Deleted())
+	}
+
+	idx.Compact()
+	if idx.Deleted() != 0 || idx.Len() != 400 {
+		t.Errorf("Expected 400 vectors and no deleted ones, got %d and %d", idx.Len(), idx.Deleted())
+	}
+	results, _ := idx.Search(vectors[0], 1)
+	if len(results) != 1 || results[0].ID != 999 {
+		t.Errorf("Expected the replaced vector, got %v", results)
+	}
+	results, _ = idx.Search(vectors[700], 1)
+	if len(results) != 1 || results[0].ID != 700 {
+		t.Errorf("Expected vector 700, got %v", results)
+	}
+
+	// The compacted index keeps accepting vectors
+	if err := idx.Add(0, vectors[0]); err != nil {
+		t.Fatalf("Failed to add: %v", err)
+	}
+	if idx.Len() != 401 {
+		t.Errorf("Expected 401 vectors, got %d", idx.Len())
+	}
+}
+
+func TestAddReplacesExistingID(t *testing.T) {
+	idx := hnsw.New(2)
+	_ = idx.Add(1, []float32{1, 0})
+	_ = idx.Add(2, []float32{0, 1})
+	_ = idx.Add(1, []float32{-1, 0})
+
+	if idx.Len() != 2 {
+		t.Errorf("Expected 2 vectors, got %d", idx.Len())
+	}
+
+	results, _ := idx.Search([]float32{1, 0}, 2)
+	if len(results) != 2 || results[0].ID != 2 || results[1].ID != 1 {
+		t.Errorf("Expected ids [2 1], got %v", results)
+	}
+}
+
+func TestDimensionMismatch(t *testing.T) {
+	idx := hnsw.New(3)
+
+	if err := idx.Add(1, []float32{1, 2}); !errors.Is(err, hnsw.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch on add, got %v", err)
+	}
+	if _, err := idx.Search([]float32{1}, 1); !errors.Is(err, hnsw.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch on search, got %v", err)
+	}
+}
+
+func TestConcurrentSearchWhileAdding(t *testing.T) {
+	vectors := clusteredVectors(5, 1000, 32)
+	idx := buildIndex(t, vectors[:500])
+
+	var wg sync.WaitGroup
+	for r := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				if _, err := idx.Search(vectors[(r*200+i)%len(vectors)], 5); err != nil {
+					t.Errorf("Failed to search: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 500; i < len(vectors); i++ {
+		if err := idx.Add(uint64(i), vectors[i]); err != nil {
+			t.Fatalf("Failed to add vector %d: %v", i, err)
+		}
+	}
+	wg.Wait()
+
+	if idx.Len() != len(vectors) {
+		t.Errorf("Expected %d vectors, got %d", len(vectors), idx.Len())
+	}
+}
@@ -0,0 +1,410 @@
+// Package ivfpq implements an inverted file index with product quantization
+// (IVF-PQ) for corpora of all-MiniLM-L6-v2 embeddings too large to be kept
+// as float vectors in memory.
+//
+// Vectors are normalized and assigned to the closest of a set of coarse
+// centroids. The residual between a vector and its centroid is split in
+// subvectors, each encoded as the index of the closest entry of a 256-entry
+// codebook, so that a 384-dim embedding is stored in 48 bytes with the
+// default settings. Searches only scan the lists of the nprobe centroids
+// closest to the query and compare codes with precomputed distance tables.
+package ivfpq
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+const (
+	DefaultLists        = 256
+	DefaultSubquantizer = 48
+	DefaultNProbe       = 8
+	DefaultIterations   = 20
+
+	// codebookSize is the number of entries of every subquantizer codebook,
+	// so that each code fits in a byte.
+	codebookSize = 256
+)
+
+var (
+	// ErrDimensionMismatch is returned when a vector does not have the
+	// dimension the index was created with.
+	ErrDimensionMismatch = errors.New("dimension mismatch")
+	// ErrNotTrained is returned when adding or searching before Train.
+	ErrNotTrained = errors.New("index is not trained")
+)
+
+// Result is a vector found by Search along with its estimated cosine
+// similarity to the query, or its exact similarity when reranking.
+type Result struct {
+	ID    uint64
+	Score float32
+}
+
+type list struct {
+	ids []uint64
+	// codes holds the PQ codes of the vectors of the list back to back.
+	codes []byte
+	// vectors holds the normalized vectors when reranking is enabled.
+	vectors [][]float32
+}
+
+type Index struct {
+	mu sync.RWMutex
+
+	dim          int
+	lists        int
+	subquantizer int
+	subDim       int
+	nprobe       int
+	iterations   int
+	rerank       int
+	rng          *rand.Rand
+
+	trained   bool
+	centroids [][]float32
+	// codebooks[m][c] is entry c of the codebook of subvector m.
+	codebooks [][][]float32
+	inverted  []list
+	size      int
+}
+
+type Option = func(*Index)
+
+// WithLists sets the number of coarse centroids, that is of inverted lists.
+func WithLists(n int) Option {
+	return func(idx *Index) {
+		idx.lists = n
+	}
+}
+
+// WithSubquantizers sets the number of subvectors each vector is split into,
+// which is also the number of bytes used to store it. It must divide the
+// dimension.
+func WithSubquantizers(m int) Option {
+	return func(idx *Index) {
+		idx.subquantizer = m
+	}
+}
+
+// WithNProbe sets the default number of lists scanned by a search. It can be
+// changed later with SetNProbe.
+func WithNProbe(n int) Option {
+	return func(idx *Index) {
+		idx.nprobe = n
+	}
+}
+
+// WithIterations sets the maximum number of k-means iterations used to train
+// the centroids and codebooks.
+func WithIterations(n int) Option {
+	return func(idx *Index) {
+		idx.iterations = n
+	}
+}
+
+// WithRerank keeps the original vectors next to their codes and re-ranks the
+// factor*k best candidates of every search with their exact similarity. This
+// improves precision at the cost of the memory the codes were saving.
+func WithRerank(factor int) Option {
+	return func(idx *Index) {
+		idx.rerank = factor
+	}
+}
+
+// WithSeed seeds the random generator used for training so that it is
+// reproducible.
+func WithSeed(seed int64) Option {
+	return func(idx *Index) {
+		idx.rng = rand.New(rand.NewSource(seed))
+	}
+}
+
+// New creates an untrained index for vectors of the given dimension, 384 for
+// the all-MiniLM-L6-v2 model.
+func New(dim int, opts ...Option) (*Index, error) {
+	idx := &Index{
+		dim:          dim,
+		lists:        DefaultLists,
+		subquantizer: DefaultSubquantizer,
+		nprobe:       DefaultNProbe,
+		iterations:   DefaultIterations,
+		rng:          rand.New(rand.NewSource(rand.Int63())),
+	}
+
+	for _, opt := range opts {
+		opt(idx)
+	}
+
+	if idx.lists <= 0 {
+		return nil, fmt.Errorf("invalid number of lists: %d", idx.lists)
+	}
+	if idx.subquantizer <= 0 || dim%idx.subquantizer != 0 {
+		return nil, fmt.Errorf("number of subquantizers %d does not divide dimension %d", idx.subquantizer, dim)
+	}
+	idx.subDim = dim / idx.subquantizer
+	return idx, nil
+}
+
+// CodeSize returns the number of bytes used to store the code of a vector.
+func (idx *Index) CodeSize() int {
+	return idx.subquantizer
+}
+
+// Len returns the number of vectors in the index.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.size
+}
+
+// SetNProbe changes the number of lists scanned by Search. Larger values
+// improve recall at the cost of latency.
+func (idx *Index) SetNProbe(n int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.nprobe = n
+}
+
+// Train learns the coarse centroids and the codebooks from a sample of
+// embeddings representative of the corpus. The sample should hold at least
+// several times as many vectors as there are lists and codebook entries.
+// Training again discards every vector added so far.
+func (idx *Index) Train(samples [][]float32) error {
+	if len(samples) < max(idx.lists, codebookSize) {
+		return fmt.Errorf("need at least %d training vectors, got %d", max(idx.lists, codebookSize), len(samples))
+	}
+
+	normalized := make([][]float32, len(samples))
+	for i, s := range samples {
+		if len(s) != idx.dim {
+			return fmt.Errorf("%w: %d != %d", ErrDimensionMismatch, len(s), idx.dim)
+		}
+		normalized[i] = vecmath.Normalized(s)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	centroids := kmeans(normalized, idx.lists, idx.iterations, idx.rng)
+
+	// The codebooks quantize the residuals, which are much smaller than the
+	// vectors themselves and spread more evenly across subspaces.
+	subvectors := make([][][]float32, idx.subquantizer)
+	for _, v := range normalized {
+		c, _ := nearest(v, centroids)
+		r := residual(v, centroids[c])
+		for m := range subvectors {
+			subvectors[m] = append(subvectors[m], r[m*idx.subDim:(m+1)*idx.subDim])
+		}
+	}
+
+	codebooks := make([][][]float32, idx.subquantizer)
+	for m := range codebooks {
+		codebooks[m] = kmeans(subvectors[m], codebookSize, idx.iterations, idx.rng)
+	}
+
+	idx.centroids = centroids
+	idx.codebooks = codebooks
+	idx.inverted = make([]list, idx.lists)
+	idx.size = 0
+	idx.trained = true
+	return nil
+}
+
+// Add encodes the vector and appends it to the list of its closest centroid.
+func (idx *Index) Add(id uint64, vector []float32) error {
+	if len(vector) != idx.dim {
+		return fmt.Errorf("%w: %d != %d", ErrDimensionMismatch, len(vector), idx.dim)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.trained {
+		return ErrNotTrained
+	}
+
+	v := vecmath.Normalized(vector)
+	c, _ := nearest(v, idx.centroids)
+	r := residual(v, idx.centroids[c])
+
+	l := &idx.inverted[c]
+	l.ids = append(l.ids, id)
+	for m, codebook := range idx.codebooks {
+		code, _ := nearest(r[m*idx.subDim:(m+1)*idx.subDim], codebook)
+		l.codes = append(l.codes, byte(code))
+	}
+	if idx.rerank > 0 {
+		l.vectors = append(l.vectors, v)
+	}
+	idx.size++
+	return nil
+}
+
+// Search returns the k vectors closest to query sorted by decreasing
+// similarity, scanning the lists set by WithNProbe or SetNProbe.
+func (idx *Index) Search(query []float32, k int) ([]Result, error) {
+	idx.mu.RLock()
+	nprobe := idx.nprobe
+	idx.mu.RUnlock()
+	return idx.SearchWithNProbe(query, k, nprobe)
+}
+
+// SearchWithNProbe is Search with an explicit number of lists to scan.
+func (idx *Index) SearchWithNProbe(query []float32, k int, nprobe int) ([]Result, error) {
+	if len(query) != idx.dim {
+		return nil, fmt.Errorf("%w: %d != %d", ErrDimensionMismatch, len(query), idx.dim)
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.trained {
+		return nil, ErrNotTrained
+	}
+	if k <= 0 || idx.size == 0 {
+		return nil, nil
+	}
+
+	q := vecmath.Normalized(query)
+
+	probes := make([]scored, len(idx.centroids))
+	for c, centroid := range idx.centroids {
+		probes[c] = scored{list: c, distance: vecmath.L2Squared(q, centroid)}
+	}
+	sort.Slice(probes, func(i, j int) bool {
+		return probes[i].distance < probes[j].distance
+	})
+	probes = probes[:min(max(nprobe, 1), len(probes))]
+
+	keep := k
+	if idx.rerank > 0 {
+		keep = k * idx.rerank
+	}
+
+	best := &scoredHeap{}
+	table := make([]float32, idx.subquantizer*codebookSize)
+	for _, p := range probes {
+		l := &idx.inverted[p.list]
+		if len(l.ids) == 0 {
+			continue
+		}
+		idx.distanceTable(residual(q, idx.centroids[p.list]), table)
+
+		for i := range l.ids {
+			code := l.codes[i*idx.subquantizer : (i+1)*idx.subquantizer]
+			var d float32
+			for m, c := range code {
+				d += table[m*codebookSize+int(c)]
+			}
+			best.offer(keep, scored{list: p.list, offset: i, distance: d})
+		}
+	}
+
+	candidates := best.sorted()
+	results := make([]Result, len(candidates))
+	for i, c := range candidates {
+		l := &idx.inverted[c.list]
+		if idx.rerank > 0 {
+			results[i] = Result{ID: l.ids[c.offset], Score: vecmath.Dot(q, l.vectors[c.offset])}
+		} else {
+			// For unit vectors, |q-v|² = 2 - 2cos(q, v)
+			results[i] = Result{ID: l.ids[c.offset], Score: 1 - c.distance/2}
+		}
+	}
+
+	if idx.rerank > 0 {
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Score > results[j].Score
+		})
+	}
+	return results[:min(k, len(results))], nil
+}
+
+// distanceTable fills table with the squared distance between every
+// subvector of the query residual r and every entry of the matching codebook,
+// so that the distance to an encoded vector is a sum of table lookups.
+func (idx *Index) distanceTable(r []float32, table []float32) {
+	for m, codebook := range idx.codebooks {
+		sub := r[m*idx.subDim : (m+1)*idx.subDim]
+		for c, entry := range codebook {
+			table[m*codebookSize+c] = vecmath.L2Squared(sub, entry)
+		}
+	}
+}
+
+type scored struct {
+	list     int
+	offset   int
+	distance float32
+}
+
+// scoredHeap is a max-heap keeping the furthest of the best candidates seen
+// so far at the root.
+type scoredHeap struct {
+	items []scored
+}
+
+func (h *scoredHeap) offer(k int, s scored) {
+	if len(h.items) < k {
+		h.items = append(h.items, s)
+		h.up(len(h.items) - 1)
+		return
+	}
+	if s.distance < h.items[0].distance {
+		h.items[0] = s
+		h.down(0)
+	}
+}
+
+func (h *scoredHeap) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if h.items[i].distance <= h.items[parent].distance {
+			break
+		}
+		h.items[i], h.items[parent] = h.items[parent], h.items[i]
+		i = parent
+	}
+}
+
+func (h *scoredHeap) down(i int) {
+	n := len(h.items)
+	for {
+		left, right := 2*i+1, 2*i+2
+		next := i
+		if left < n && h.items[left].distance > h.items[next].distance {
+			next = left
+		}
+		if right < n && h.items[right].distance > h.items[next].distance {
+			next = right
+		}
+		if next == i {
+			return
+		}
+		h.items[i], h.items[next] = h.items[next], h.items[i]
+		i = next
+	}
+}
+
+// sorted returns the candidates by increasing distance.
+func (h *scoredHeap) sorted() []scored {
+	sort.Slice(h.items, func(i, j int) bool {
+		return h.items[i].distance < h.items[j].distance
+	})
+	return h.items
+}
+
+func residual(v, centroid []float32) []float32 {
+	r := make([]float32, len(v))
+	for i := range v {
+		r[i] = v[i] - centroid[i]
+	}
+	return r
+}
@@ -0,0 +1,138 @@
+package ivfpq_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/index/ivfpq"
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/internal/testvec"
+)
+
+// clusteredVectors draws testvec.Clustered vectors with the noise these tests
+// are tuned for
+func clusteredVectors(seed int64, n, dim int) [][]float32 {
+	return testvec.Clustered(seed, n, dim, 0.5)
+}
+
+func recallAt(t *testing.T, idx *ivfpq.Index, vectors, queries [][]float32, k int) float64 {
+	t.Helper()
+
+	hits := 0
+	for _, q := range queries {
+		results, err := idx.Search(q, k)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+
+		expected := map[uint64]bool{}
+		for _, id := range testvec.BruteForce(q, vectors, k) {
+			expected[id] = true
+		}
+		for _, r := range results {
+			if expected[r.ID] {
+				hits++
+			}
+		}
+	}
+	return float64(hits) / float64(len(queries)*k)
+}
+
+func buildIndex(t *testing.T, vectors [][]float32, opts ...ivfpq.Option) *ivfpq.Index {
+	t.Helper()
+
+	opts = append([]ivfpq.Option{ivfpq.WithLists(16), ivfpq.WithIterations(8), ivfpq.WithSeed(42)}, opts...)
+	idx, err := ivfpq.New(len(vectors[0]), opts...)
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := idx.Train(vectors); err != nil {
+		t.Fatalf("Failed to train index: %v", err)
+	}
+	for i, v := range vectors {
+		if err := idx.Add(uint64(i), v); err != nil {
+			t.Fatalf("Failed to add vector %d: %v", i, err)
+		}
+	}
+	return idx
+}
+
+func TestRecall(t *testing.T) {
+	vectors := clusteredVectors(1, 2000, 384)
+	queries := clusteredVectors(2, 50, 384)
+
+	idx := buildIndex(t, vectors, ivfpq.WithNProbe(4))
+	if idx.CodeSize() != 48 {
+		t.Errorf("Expected 48 bytes per vector, got %d", idx.CodeSize())
+	}
+
+	recall := recallAt(t, idx, vectors, queries, 10)
+	t.Logf("recall@10 = %.3f", recall)
+	if recall < 0.6 {
+		t.Errorf("Expected recall@10 of at least 0.6, got %.3f", recall)
+	}
+
+	reranked := buildIndex(t, vectors, ivfpq.WithNProbe(4), ivfpq.WithRerank(10))
+	rerankedRecall := recallAt(t, reranked, vectors, queries, 10)
+	t.Logf("recall@10 with rerank = %.3f", rerankedRecall)
+	if rerankedRecall < 0.9 {
+		t.Errorf("Expected recall@10 of at least 0.9 with rerank, got %.3f", rerankedRecall)
+	}
+	if rerankedRecall < recall {
+		t.Errorf("Reranking should not lower recall: %.3f < %.3f", rerankedRecall, recall)
+	}
+}
+
+func TestSearchSortedByScore(t *testing.T) {
+	vectors := clusteredVectors(3, 1000, 64)
+	idx := buildIndex(t, vectors, ivfpq.WithSubquantizers(8))
+
+	results, err := idx.Search(vectors[0], 20)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 20 {
+		t.Fatalf("Expected 20 results, got %d", len(results))
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("Results not sorted at %d: %f > %f", i, results[i].Score, results[i-1].Score)
+		}
+	}
+}
+
+func TestNotTrained(t *testing.T) {
+	idx, err := ivfpq.New(8, ivfpq.WithSubquantizers(2))
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	if err := idx.Add(1, make([]float32, 8)); !errors.Is(err, ivfpq.ErrNotTrained) {
+		t.Errorf("Expected ErrNotTrained on add, got %v", err)
+	}
+	if _, err := idx.Search(make([]float32, 8), 1); !errors.Is(err, ivfpq.ErrNotTrained) {
+		t.Errorf("Expected ErrNotTrained on search, got %v", err)
+	}
+	if err := idx.Train(clusteredVectors(4, 10, 8)); err == nil {
+		t.Error("Expected an error when training with too few vectors")
+	}
+}
+
+func TestInvalidConfiguration(t *testing.T) {
+	if _, err := ivfpq.New(384, ivfpq.WithSubquantizers(5)); err == nil {
+		t.Error("Expected an error when the subquantizers do not divide the dimension")
+	}
+	if _, err := ivfpq.New(384, ivfpq.WithLists(0)); err == nil {
+		t.Error("Expected an error with no lists")
+	}
+}
+
+func TestDimensionMismatch(t *testing.T) {
+	idx := buildIndex(t, clusteredVectors(5, 300, 16), ivfpq.WithSubquantizers(4))
+
+	if err := idx.Add(1, []float32{1}); !errors.Is(err, ivfpq.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch on add, got %v", err)
+	}
+	if _, err := idx.Search([]float32{1}, 1); !errors.Is(err, ivfpq.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch on search, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package ivfpq
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// kmeans clusters vectors into k centroids with the squared Euclidean
+// distance, seeding the centroids with k-means++ and refining them with
+// Lloyd iterations. Clusters left empty are reseeded with the vector furthest
+// from its centroid.
+func kmeans(vectors [][]float32, k, iterations int, rng *rand.Rand) [][]float32 {
+	dim := len(vectors[0])
+	centroids := kmeansPlusPlus(vectors, k, rng)
+	assignments := make([]int, len(vectors))
+	distances := make([]float32, len(vectors))
+
+	for range iterations {
+		changed := assign(vectors, centroids, assignments, distances)
+
+		sums := make([][]float64, k)
+		counts := make([]int, k)
+		for c := range sums {
+			sums[c] = make([]float64, dim)
+		}
+		for i, v := range vectors {
+			c := assignments[i]
+			counts[c]++
+			for d, x := range v {
+				sums[c][d] += float64(x)
+			}
+		}
+
+		for c := range centroids {
+			if counts[c] == 0 {
+				far := furthest(distances)
+				copy(centroids[c], vectors[far])
+				distances[far] = 0
+				changed = true
+				continue
+			}
+			for d := range centroids[c] {
+				centroids[c][d] = float32(sums[c][d] / float64(counts[c]))
+			}
+		}
+
+		if !changed {
+			break
+		}
+	}
+	return centroids
+}
+
+// assign stores the closest centroid of every vector and its squared distance,
+// splitting the vectors across all cores. It reports whether any assignment
+// changed.
+func assign(vectors, centroids [][]float32, assignments []int, distances []float32) bool {
+	workers := min(runtime.GOMAXPROCS(0), len(vectors))
+	chunk := (len(vectors) + workers - 1) / workers
+
+	var changed atomic.Bool
+	var wg sync.WaitGroup
+	for lo := 0; lo < len(vectors); lo += chunk {
+		hi := min(lo+chunk, len(vectors))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := lo; i < hi; i++ {
+				c, d := nearest(vectors[i], centroids)
+				if c != assignments[i] {
+					changed.Store(true)
+				}
+				assignments[i], distances[i] = c, d
+			}
+		}()
+	}
+	wg.Wait()
+	return changed.Load()
+}
+
+// kmeansPlusPlus picks k initial centroids, each new one being drawn with a
+// probability proportional to its squared distance to the closest centroid
+// already picked.
+func kmeansPlusPlus(vectors [][]float32, k int, rng *rand.Rand) [][]float32 {
+	centroids := make([][]float32, 0, k)
+	centroids = append(centroids, clone(vectors[rng.Intn(len(vectors))]))
+
+	closest := make([]float64, len(vectors))
+	for i := range closest {
+		closest[i] = math.Inf(1)
+	}
+
+	for len(centroids) < k {
+		last := centroids[len(centroids)-1]
+		var total float64
+		for i, v := range vectors {
+			closest[i] = min(closest[i], float64(vecmath.L2Squared(v, last)))
+			total += closest[i]
+		}
+
+		next := rng.Intn(len(vectors))
+		if total > 0 {
+			target := rng.Float64() * total
+			for i, d := range closest {
+				target -= d
+				if target <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, clone(vectors[next]))
+	}
+	return centroids
+}
+
+// nearest returns the index of the centroid closest to v and its squared
+// distance.
+func nearest(v []float32, centroids [][]float32) (int, float32) {
+	best, bestDistance := 0, float32(math.Inf(1))
+	for c, centroid := range centroids {
+		if d := vecmath.L2Squared(v, centroid); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best, bestDistance
+}
+
+func furthest(distances []float32) int {
+	far := 0
+	for i, d := range distances {
+		if d > distances[far] {
+			far = i
+		}
+	}
+	return far
+}
+
+func clone(v []float32) []float32 {
+	out := make([]float32, len(v))
+	copy(out, v)
+	return out
+}
@@ -0,0 +1,65 @@
+// Package testvec generates the vectors the index tests search.
+package testvec
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// Clustered generates n vectors spread around a few random centers of a
+// low-dimensional subspace, which is closer to the structure of sentence
+// embeddings than uniform noise. noise is the standard deviation of the
+// vectors around their center along every direction of the subspace.
+func Clustered(seed int64, n, dim int, noise float32) [][]float32 {
+	// The generator of the basis and centers is fixed so that vectors drawn
+	// with different seeds share the same structure
+	structure := rand.New(rand.NewSource(0))
+	const latent = 64
+
+	basis := make([][]float32, latent)
+	for i := range basis {
+		basis[i] = make([]float32, dim)
+		for d := range basis[i] {
+			basis[i][d] = float32(structure.NormFloat64())
+		}
+	}
+
+	centers := make([][]float32, 50)
+	for i := range centers {
+		centers[i] = make([]float32, latent)
+		for d := range centers[i] {
+			centers[i][d] = float32(structure.NormFloat64())
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		center := centers[rng.Intn(len(centers))]
+		vectors[i] = make([]float32, dim)
+		for l := range latent {
+			coord := center[l] + float32(rng.NormFloat64())*noise
+			for d := range vectors[i] {
+				vectors[i][d] += coord * basis[l][d]
+			}
+		}
+	}
+	return vectors
+}
+
+// BruteForce returns the ids, i.e. the positions, of the k vectors most
+// similar to the query.
+func BruteForce(query []float32, vectors [][]float32, k int) []uint64 {
+	ids := make([]uint64, len(vectors))
+	scores := make([]float32, len(vectors))
+	for i := range vectors {
+		ids[i] = uint64(i)
+	}
+	vecmath.CosineBatch(query, vectors, scores)
+	sort.Slice(ids, func(i, j int) bool {
+		return scores[ids[i]] > scores[ids[j]]
+	})
+	return ids[:k]
+}
@@ -0,0 +1,288 @@
+package all_minilm_l6_v2
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Assignment is the way Join restricts matches to one per record.
+type Assignment int
+
+const (
+	// NoAssignment keeps up to k matches per left record, a right record
+	// possibly matching several left records.
+	NoAssignment Assignment = iota
+	// GreedyAssignment matches every record at most once by taking the
+	// candidate pairs from the most similar, skipping those involving an
+	// already matched record.
+	GreedyAssignment
+	// HungarianAssignment matches every record at most once so that the sum
+	// of the scores of the matches is maximal, the scores being offset by a
+	// negative threshold. It takes O(n³) time where n is the number of records
+	// having candidates.
+	HungarianAssignment
+)
+
+// JoinMatch is a pair of matched records, identified by their index in the
+// left and right inputs, along with their cosine similarity.
+type JoinMatch struct {
+	Left, Right int
+	Score       float64
+}
+
+// JoinResult holds the matches of Join, sorted by left record then by
+// decreasing score, and the records matching nothing.
+type JoinResult struct {
+	Matches        []JoinMatch
+	UnmatchedLeft  []int
+	UnmatchedRight []int
+}
+
+type joinOptions struct {
+	assignment Assignment
+	batchSize  int
+}
+
+type JoinOption = func(*joinOptions)
+
+// WithAssignment restricts matches to one per record. It defaults to
+// NoAssignment.
+func WithAssignment(assignment Assignment) JoinOption {
+	return func(o *joinOptions) {
+		o.assignment = assignment
+	}
+}
+
+// WithJoinBatchSize sets the number of records embedded per call to the
+// embedder. It defaults to DefaultCorpusBatchSize.
+func WithJoinBatchSize(n int) JoinOption {
+	return func(o *joinOptions) {
+		o.batchSize = n
+	}
+}
+
+// Join embeds both sides and matches each left record with the right records
+// it is most similar to, as JoinEmbeddings does.
+func Join(ctx context.Context, embedder Embedder, left, right []string, threshold float64, k int, opts ...JoinOption) (*JoinResult, error) {
+	o := joinOptions{batchSize: DefaultCorpusBatchSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	leftEmbeddings, err := embedAll(ctx, embedder, left, o.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed left records: %w", err)
+	}
+	rightEmbeddings, err := embedAll(ctx, embedder, right, o.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed right records: %w", err)
+	}
+	return JoinEmbeddings(leftEmbeddings, rightEmbeddings, threshold, k, opts...)
+}
+
+// JoinEmbeddings matches each left embedding with its k most similar right
+// embeddings having a cosine similarity of at least threshold. With an
+// assignment, each record is then matched at most once among those
+// candidates.
+func JoinEmbeddings(left, right [][]float32, threshold float64, k int, opts ...JoinOption) (*JoinResult, error) {
+	var o joinOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	neighbors, err := TopK(left, right, k)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []JoinMatch
+	for l, list := range neighbors {
+		for _, n := range list {
+			if n.Score >= threshold {
+				candidates = append(candidates, JoinMatch{Left: l, Right: n.Index, Score: n.Score})
+			}
+		}
+	}
+
+	var matches []JoinMatch
+	switch o.assignment {
+	case GreedyAssignment:
+		matches = greedyAssignment(candidates)
+	case HungarianAssignment:
+		matches = hungarianAssignment(candidates, threshold)
+	default:
+		matches = candidates
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Left != matches[j].Left {
+			return matches[i].Left < matches[j].Left
+		}
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Right < matches[j].Right
+	})
+
+	result := &JoinResult{Matches: matches}
+	matchedLeft := make([]bool, len(left))
+	matchedRight := make([]bool, len(right))
+	for _, m := range matches {
+		matchedLeft[m.Left], matchedRight[m.Right] = true, true
+	}
+	for i, matched := range matchedLeft {
+		if !matched {
+			result.UnmatchedLeft = append(result.UnmatchedLeft, i)
+		}
+	}
+	for i, matched := range matchedRight {
+		if !matched {
+			result.UnmatchedRight = append(result.UnmatchedRight, i)
+		}
+	}
+	return result, nil
+}
+
+func greedyAssignment(candidates []JoinMatch) []JoinMatch {
+	sorted := append([]JoinMatch(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Score > sorted[j].Score
+	})
+
+	usedLeft := make(map[int]bool)
+	usedRight := make(map[int]bool)
+	var matches []JoinMatch
+	for _, c := range sorted {
+		if usedLeft[c.Left] || usedRight[c.Right] {
+			continue
+		}
+		usedLeft[c.Left], usedRight[c.Right] = true, true
+		matches = append(matches, c)
+	}
+	return matches
+}
+
+// hungarianAssignment returns the matching among candidates maximizing the
+// sum of the scores. Records are only matched along candidate pairs, other
+// pairs weighing 0. With a negative threshold, the scores are offset by it so
+// that every candidate is worth a match, as with greedyAssignment.
+func hungarianAssignment(candidates []JoinMatch, threshold float64) []JoinMatch {
+	offset := min(threshold, 0)
+
+	// Rows and columns are the records having candidates, rows being the
+	// smaller side as the solver expects.
+	rowOf, colOf := make(map[int]int), make(map[int]int)
+	var rows, cols []int
+	for _, c := range candidates {
+		if _, ok := rowOf[c.Left]; !ok {
+			rowOf[c.Left] = len(rows)
+			rows = append(rows, c.Left)
+		}
+		if _, ok := colOf[c.Right]; !ok {
+			colOf[c.Right] = len(cols)
+			cols = append(cols, c.Right)
+		}
+	}
+	transposed := len(rows) > len(cols)
+	n, m := len(rows), len(cols)
+	if transposed {
+		n, m = m, n
+	}
+
+	cost := make([][]float64, n)
+	for i := range cost {
+		cost[i] = make([]float64, m)
+	}
+	scores := make(map[[2]int]float64)
+	for _, c := range candidates {
+		r, col := rowOf[c.Left], colOf[c.Right]
+		if transposed {
+			r, col = col, r
+		}
+		cost[r][col] = offset - c.Score
+		scores[[2]int{c.Left, c.Right}] = c.Score
+	}
+
+	var matches []JoinMatch
+	for r, col := range solveAssignment(cost) {
+		if transposed {
+			r, col = col, r
+		}
+		left, right := rows[r], cols[col]
+		score, ok := scores[[2]int{left, right}]
+		if ok {
+			matches = append(matches, JoinMatch{Left: left, Right: right, Score: score})
+		}
+	}
+	return matches
+}
+
+// solveAssignment returns the column assigned to every row minimizing the
+// total cost, for n rows and m >= n columns, with the Hungarian algorithm
+// using potentials.
+func solveAssignment(cost [][]float64) []int {
+	n := len(cost)
+	if n == 0 {
+		return nil
+	}
+	m := len(cost[0])
+
+	// The algorithm is 1-indexed, row and column 0 being sentinels. p[j] is
+	// the row assigned to column j.
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	p := make([]int, m+1)
+	way := make([]int, m+1)
+	minv := make([]float64, m+1)
+	used := make([]bool, m+1)
+
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		for j := range minv {
+			minv[j] = math.Inf(1)
+			used[j] = false
+		}
+		for {
+			used[j0] = true
+			i0, delta, j1 := p[j0], math.Inf(1), 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				cur := cost[i0-1][j-1] - u[i0] - v[j]
+				if cur < minv[j] {
+					minv[j], way[j] = cur, j0
+				}
+				if minv[j] < delta {
+					delta, j1 = minv[j], j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	assignment := make([]int, n)
+	for j := 1; j <= m; j++ {
+		if p[j] != 0 {
+			assignment[p[j]-1] = j - 1
+		}
+	}
+	return assignment
+}
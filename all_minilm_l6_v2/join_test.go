@@ -0,0 +1,184 @@
+package all_minilm_l6_v2_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+func unitVector(degrees float64) []float32 {
+	rad := degrees * math.Pi / 180
+	return []float32{float32(math.Cos(rad)), float32(math.Sin(rad))}
+}
+
+func totalScore(matches []all_minilm_l6_v2.JoinMatch) float64 {
+	var total float64
+	for _, m := range matches {
+		total += m.Score
+	}
+	return total
+}
+
+func TestJoinKeepsTopKPerLeftRecord(t *testing.T) {
+	embedder := fixedEmbedder{
+		"apple iphone 15":  {1, 0, 0},
+		"samsung galaxy":   {0, 1, 0},
+		"garden hose":      {0, 0, 1},
+		"iphone 15 apple":  {0.99, 0.1, 0},
+		"apple iphone 14":  {0.9, 0.3, 0},
+		"galaxy s24":       {0.1, 0.95, 0},
+		"office chair":     {-1, 0, 0},
+		"smartphone cover": {0.5, 0.5, 0},
+	}
+	left := []string{"apple iphone 15", "samsung galaxy", "garden hose"}
+	right := []string{"iphone 15 apple", "apple iphone 14", "galaxy s24", "office chair", "smartphone cover"}
+
+	result, err := all_minilm_l6_v2.Join(context.Background(), embedder, left, right, 0.8, 2)
+	if err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+
+	expected := [][2]int{{0, 0}, {0, 1}, {1, 2}}
+	if len(result.Matches) != len(expected) {
+		t.Fatalf("Expected %d matches, got %v", len(expected), result.Matches)
+	}
+	for i, m := range result.Matches {
+		if m.Left != expected[i][0] || m.Right != expected[i][1] {
+			t.Errorf("Match %d is %v, expected %v", i, m, expected[i])
+		}
+		if m.Score < 0.8 {
+			t.Errorf("Match %v is below the threshold", m)
+		}
+	}
+	if len(result.UnmatchedLeft) != 1 || result.UnmatchedLeft[0] != 2 {
+		t.Errorf("Expected left record 2 to be unmatched, got %v", result.UnmatchedLeft)
+	}
+	if len(result.UnmatchedRight) != 2 || result.UnmatchedRight[0] != 3 || result.UnmatchedRight[1] != 4 {
+		t.Errorf("Expected right records 3 and 4 to be unmatched, got %v", result.UnmatchedRight)
+	}
+}
+
+func TestJoinAssignmentMatchesOnce(t *testing.T) {
+	// Both left records are closest to right record 0, the first one being
+	// closer to it
+	left := [][]float32{unitVector(0), unitVector(60)}
+	right := [][]float32{unitVector(20), unitVector(-30)}
+
+	greedy, err := all_minilm_l6_v2.JoinEmbeddings(left, right, 0.5, 2,
+		all_minilm_l6_v2.WithAssignment(all_minilm_l6_v2.GreedyAssignment))
+	if err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	if len(greedy.Matches) != 1 || greedy.Matches[0].Left != 0 || greedy.Matches[0].Right != 0 {
+		t.Fatalf("Expected greedy to match left 0 with right 0 only, got %v", greedy.Matches)
+	}
+	if len(greedy.UnmatchedLeft) != 1 || len(greedy.UnmatchedRight) != 1 {
+		t.Errorf("Expected a record unmatched on each side, got %v and %v", greedy.UnmatchedLeft, greedy.UnmatchedRight)
+	}
+
+	hungarian, err := all_minilm_l6_v2.JoinEmbeddings(left, right, 0.5, 2,
+		all_minilm_l6_v2.WithAssignment(all_minilm_l6_v2.HungarianAssignment))
+	if err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	if len(hungarian.Matches) != 2 || hungarian.Matches[0].Right != 1 || hungarian.Matches[1].Right != 0 {
+		t.Fatalf("Expected Hungarian to match left 0 with right 1 and left 1 with right 0, got %v", hungarian.Matches)
+	}
+	if totalScore(hungarian.Matches) <= totalScore(greedy.Matches) {
+		t.Errorf("Expected Hungarian to score more than greedy")
+	}
+	if len(hungarian.UnmatchedLeft) != 0 || len(hungarian.UnmatchedRight) != 0 {
+		t.Errorf("Expected every record to be matched, got %v and %v", hungarian.UnmatchedLeft, hungarian.UnmatchedRight)
+	}
+}
+
+func TestJoinAssignmentNegativeThreshold(t *testing.T) {
+	// Both right records are dissimilar to the left one but above the
+	// threshold
+	left := [][]float32{unitVector(0)}
+	right := [][]float32{unitVector(120), unitVector(135)}
+
+	for _, assignment := range []all_minilm_l6_v2.Assignment{all_minilm_l6_v2.GreedyAssignment, all_minilm_l6_v2.HungarianAssignment} {
+		result, err := all_minilm_l6_v2.JoinEmbeddings(left, right, -1, 2, all_minilm_l6_v2.WithAssignment(assignment))
+		if err != nil {
+			t.Fatalf("Failed to join: %v", err)
+		}
+		if len(result.Matches) != 1 || result.Matches[0].Right != 0 {
+			t.Errorf("Expected assignment %d to match left 0 with right 0, got %v", assignment, result.Matches)
+		}
+	}
+}
+
+// bestMatching returns the highest total score of a matching between left and
+// right records along pairs scoring at least threshold.
+func bestMatching(scores [][]float64, threshold float64, row int, usedRight []bool) float64 {
+	if row == len(scores) {
+		return 0
+	}
+	best := bestMatching(scores, threshold, row+1, usedRight)
+	for j, s := range scores[row] {
+		if usedRight[j] || s < threshold {
+			continue
+		}
+		usedRight[j] = true
+		best = max(best, s+bestMatching(scores, threshold, row+1, usedRight))
+		usedRight[j] = false
+	}
+	return best
+}
+
+func TestJoinHungarianIsOptimal(t *testing.T) {
+	for seed := range int64(20) {
+		left := randomVectors(seed, 5+int(seed%3), 4)
+		right := randomVectors(seed+100, 7-int(seed%4), 4)
+		scores := make([][]float64, len(left))
+		for i, l := range left {
+			for _, r := range right {
+				scores[i] = append(scores[i], all_minilm_l6_v2.CosineSimilarity(l, r))
+			}
+		}
+		expected := bestMatching(scores, 0.1, 0, make([]bool, len(right)))
+
+		result, err := all_minilm_l6_v2.JoinEmbeddings(left, right, 0.1, len(right),
+			all_minilm_l6_v2.WithAssignment(all_minilm_l6_v2.HungarianAssignment))
+		if err != nil {
+			t.Fatalf("Failed to join: %v", err)
+		}
+		usedLeft, usedRight := make(map[int]bool), make(map[int]bool)
+		for _, m := range result.Matches {
+			if usedLeft[m.Left] || usedRight[m.Right] {
+				t.Fatalf("Seed %d: record matched twice in %v", seed, result.Matches)
+			}
+			usedLeft[m.Left], usedRight[m.Right] = true, true
+		}
+		if got := totalScore(result.Matches); math.Abs(got-expected) > 1e-5 {
+			t.Errorf("Seed %d: expected a total score of %f, got %f", seed, expected, got)
+		}
+
+		greedy, _ := all_minilm_l6_v2.JoinEmbeddings(left, right, 0.1, len(right),
+			all_minilm_l6_v2.WithAssignment(all_minilm_l6_v2.GreedyAssignment))
+		if totalScore(greedy.Matches) > expected+1e-5 {
+			t.Errorf("Seed %d: greedy scores more than the optimum", seed)
+		}
+	}
+}
+
+func TestJoinBatchesEmbeddings(t *testing.T) {
+	embedder := &bagOfWordsEmbedder{}
+	left := []string{"a", "b", "c", "d", "e"}
+	right := []string{"a", "b", "c"}
+
+	result, err := all_minilm_l6_v2.Join(context.Background(), embedder, left, right, 0.99, 1,
+		all_minilm_l6_v2.WithJoinBatchSize(2))
+	if err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	if embedder.calls != 5 {
+		t.Errorf("Expected 5 batches, got %d", embedder.calls)
+	}
+	if len(result.Matches) != 3 || len(result.UnmatchedLeft) != 2 || len(result.UnmatchedRight) != 0 {
+		t.Errorf("Expected 3 matches and 2 unmatched left records, got %+v", result)
+	}
+}
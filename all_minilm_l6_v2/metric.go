@@ -0,0 +1,222 @@
+package all_minilm_l6_v2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// ErrDimensionMismatch is returned by the checked similarity and distance
+// functions when the compared vectors do not have the same length.
+var ErrDimensionMismatch = errors.New("dimension mismatch")
+
+func checkDimensions(a, b int) error {
+	if a != b {
+		return fmt.Errorf("%w: %d != %d", ErrDimensionMismatch, a, b)
+	}
+	return nil
+}
+
+// Metric measures how far apart two embeddings are. Lower distances mean more
+// similar embeddings whatever the metric, so that metrics can be swapped
+// without changing the ranking code.
+type Metric interface {
+	Name() string
+	Distance(a, b []float32) (float64, error)
+}
+
+// The unchecked distance functions return NaN rather than a distance when the
+// lengths of the vectors differ, the Checked ones an error.
+//
+// The model outputs unit-length embeddings. Metrics with Normalized set skip
+// the norm computations and are only correct for such vectors.
+
+// CosineMetric is the cosine distance, 1 - cosine similarity, in [0, 2].
+type CosineMetric struct {
+	Normalized bool
+}
+
+func (CosineMetric) Name() string { return "cosine" }
+
+func (m CosineMetric) Distance(a, b []float32) (float64, error) {
+	if err := checkDimensions(len(a), len(b)); err != nil {
+		return 0, err
+	}
+	if m.Normalized {
+		return 1 - CosineSimilarityNormalized(a, b), nil
+	}
+	return 1 - CosineSimilarity(a, b), nil
+}
+
+// DotProductMetric is the negated dot product.
+type DotProductMetric struct{}
+
+func (DotProductMetric) Name() string { return "dot" }
+
+func (DotProductMetric) Distance(a, b []float32) (float64, error) {
+	dot, err := DotProductChecked(a, b)
+	return -dot, err
+}
+
+// EuclideanMetric is the Euclidean (L2) distance.
+type EuclideanMetric struct {
+	Normalized bool
+}
+
+func (EuclideanMetric) Name() string { return "euclidean" }
+
+func (m EuclideanMetric) Distance(a, b []float32) (float64, error) {
+	if err := checkDimensions(len(a), len(b)); err != nil {
+		return 0, err
+	}
+	if m.Normalized {
+		return EuclideanDistanceNormalized(a, b), nil
+	}
+	return EuclideanDistance(a, b), nil
+}
+
+// ManhattanMetric is the Manhattan (L1) distance.
+type ManhattanMetric struct{}
+
+func (ManhattanMetric) Name() string { return "manhattan" }
+
+func (ManhattanMetric) Distance(a, b []float32) (float64, error) {
+	return ManhattanDistanceChecked(a, b)
+}
+
+// AngularMetric is the angle between the vectors divided by π, in [0, 1].
+// Unlike the cosine distance it satisfies the triangle inequality.
+type AngularMetric struct {
+	Normalized bool
+}
+
+func (AngularMetric) Name() string { return "angular" }
+
+func (m AngularMetric) Distance(a, b []float32) (float64, error) {
+	if err := checkDimensions(len(a), len(b)); err != nil {
+		return 0, err
+	}
+	if m.Normalized {
+		return AngularDistanceNormalized(a, b), nil
+	}
+	return AngularDistance(a, b), nil
+}
+
+// CosineSimilarityNormalized is CosineSimilarity for unit-length vectors,
+// that is their dot product.
+func CosineSimilarityNormalized(a, b []float32) float64 {
+	return DotProduct(a, b)
+}
+
+// DotProduct returns the dot product of a and b, or 0 if their lengths
+// differ.
+func DotProduct(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0.0
+	}
+	return float64(vecmath.Dot(a, b))
+}
+
+// DotProductChecked is DotProduct returning ErrDimensionMismatch if the
+// lengths of a and b differ.
+func DotProductChecked(a, b []float32) (float64, error) {
+	if err := checkDimensions(len(a), len(b)); err != nil {
+		return 0, err
+	}
+	return float64(vecmath.Dot(a, b)), nil
+}
+
+// EuclideanDistance returns the L2 distance between a and b, or NaN if their
+// lengths differ.
+func EuclideanDistance(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return math.NaN()
+	}
+	return math.Sqrt(float64(vecmath.L2Squared(a, b)))
+}
+
+// EuclideanDistanceChecked is EuclideanDistance returning
+// ErrDimensionMismatch if the lengths of a and b differ.
+func EuclideanDistanceChecked(a, b []float32) (float64, error) {
+	if err := checkDimensions(len(a), len(b)); err != nil {
+		return 0, err
+	}
+	return math.Sqrt(float64(vecmath.L2Squared(a, b))), nil
+}
+
+// EuclideanDistanceNormalized is EuclideanDistance for unit-length vectors,
+// derived from their dot product since |a-b|² = 2 - 2a·b. It is NaN if
+// their lengths differ.
+func EuclideanDistanceNormalized(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return math.NaN()
+	}
+	return math.Sqrt(max(0, 2-2*DotProduct(a, b)))
+}
+
+// ManhattanDistance returns the L1 distance between a and b, or NaN if their
+// lengths differ.
+func ManhattanDistance(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return math.NaN()
+	}
+
+	var distance float64
+	for i := range a {
+		distance += math.Abs(float64(a[i]) - float64(b[i]))
+	}
+	return distance
+}
+
+// ManhattanDistanceChecked is ManhattanDistance returning
+// ErrDimensionMismatch if the lengths of a and b differ.
+func ManhattanDistanceChecked(a, b []float32) (float64, error) {
+	if err := checkDimensions(len(a), len(b)); err != nil {
+		return 0, err
+	}
+	return ManhattanDistance(a, b), nil
+}
+
+// AngularDistance returns the angle between a and b divided by π, or NaN if
+// their lengths differ.
+func AngularDistance(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return math.NaN()
+	}
+	return angleFromCosine(CosineSimilarity(a, b))
+}
+
+// AngularDistanceChecked is AngularDistance returning ErrDimensionMismatch if
+// the lengths of a and b differ.
+func AngularDistanceChecked(a, b []float32) (float64, error) {
+	similarity, err := CosineSimilarityChecked(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return angleFromCosine(similarity), nil
+}
+
+// AngularDistanceNormalized is AngularDistance for unit-length vectors.
+func AngularDistanceNormalized(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return math.NaN()
+	}
+	return angleFromCosine(DotProduct(a, b))
+}
+
+func angleFromCosine(similarity float64) float64 {
+	// Rounding errors can push the similarity of (almost) identical vectors
+	// slightly outside of the domain of Acos
+	return math.Acos(min(max(similarity, -1), 1)) / math.Pi
+}
+
+// HammingChecked is Hamming returning ErrDimensionMismatch if the lengths of
+// a and b differ.
+func HammingChecked(a, b []uint64) (int, error) {
+	if err := checkDimensions(len(a), len(b)); err != nil {
+		return 0, err
+	}
+	return Hamming(a, b), nil
+}
@@ -0,0 +1,125 @@
+package all_minilm_l6_v2_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+// normalize returns a unit-length copy of v
+func normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	norm = math.Sqrt(norm)
+
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+func TestMetricDistances(t *testing.T) {
+	a := []float32{1, 0}
+	b := []float32{0, 2}
+
+	testCases := []struct {
+		metric   all_minilm_l6_v2.Metric
+		expected float64
+	}{
+		{all_minilm_l6_v2.CosineMetric{}, 1},
+		{all_minilm_l6_v2.DotProductMetric{}, 0},
+		{all_minilm_l6_v2.EuclideanMetric{}, math.Sqrt(5)},
+		{all_minilm_l6_v2.ManhattanMetric{}, 3},
+		{all_minilm_l6_v2.AngularMetric{}, 0.5},
+	}
+
+	for _, tc := range testCases {
+		distance, err := tc.metric.Distance(a, b)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.metric.Name(), err)
+			continue
+		}
+		if math.Abs(distance-tc.expected) > 1e-6 {
+			t.Errorf("%s: expected distance %f, got %f", tc.metric.Name(), tc.expected, distance)
+		}
+	}
+}
+
+func TestMetricDimensionMismatch(t *testing.T) {
+	metrics := []all_minilm_l6_v2.Metric{
+		all_minilm_l6_v2.CosineMetric{},
+		all_minilm_l6_v2.CosineMetric{Normalized: true},
+		all_minilm_l6_v2.DotProductMetric{},
+		all_minilm_l6_v2.EuclideanMetric{},
+		all_minilm_l6_v2.EuclideanMetric{Normalized: true},
+		all_minilm_l6_v2.ManhattanMetric{},
+		all_minilm_l6_v2.AngularMetric{},
+		all_minilm_l6_v2.AngularMetric{Normalized: true},
+	}
+
+	for _, m := range metrics {
+		if _, err := m.Distance([]float32{1, 2}, []float32{1}); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+			t.Errorf("%s: expected ErrDimensionMismatch, got %v", m.Name(), err)
+		}
+	}
+
+	if _, err := all_minilm_l6_v2.CosineSimilarityChecked([]float32{1}, nil); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+	if _, err := all_minilm_l6_v2.HammingChecked([]uint64{1}, nil); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+
+	// Unchecked distances never report mismatched vectors as identical
+	distances := map[string]func(a, b []float32) float64{
+		"euclidean":            all_minilm_l6_v2.EuclideanDistance,
+		"euclidean normalized": all_minilm_l6_v2.EuclideanDistanceNormalized,
+		"manhattan":            all_minilm_l6_v2.ManhattanDistance,
+		"angular":              all_minilm_l6_v2.AngularDistance,
+		"angular normalized":   all_minilm_l6_v2.AngularDistanceNormalized,
+	}
+	for name, distance := range distances {
+		if d := distance([]float32{1, 0}, []float32{1}); !math.IsNaN(d) {
+			t.Errorf("%s: expected NaN on dimension mismatch, got %f", name, d)
+		}
+	}
+}
+
+func TestNormalizedFastPaths(t *testing.T) {
+	vectors := randomVectors(3, 20, 384)
+	for i := range vectors {
+		vectors[i] = normalize(vectors[i])
+	}
+
+	pairs := []struct {
+		exact, fast all_minilm_l6_v2.Metric
+	}{
+		{all_minilm_l6_v2.CosineMetric{}, all_minilm_l6_v2.CosineMetric{Normalized: true}},
+		{all_minilm_l6_v2.EuclideanMetric{}, all_minilm_l6_v2.EuclideanMetric{Normalized: true}},
+		{all_minilm_l6_v2.AngularMetric{}, all_minilm_l6_v2.AngularMetric{Normalized: true}},
+	}
+
+	for _, p := range pairs {
+		for i := 1; i < len(vectors); i++ {
+			exact, _ := p.exact.Distance(vectors[0], vectors[i])
+			fast, _ := p.fast.Distance(vectors[0], vectors[i])
+			if math.Abs(exact-fast) > 1e-4 {
+				t.Errorf("%s: normalized distance %f differs from %f", p.exact.Name(), fast, exact)
+			}
+		}
+	}
+}
+
+func TestAngularDistanceOfIdenticalVectors(t *testing.T) {
+	v := normalize([]float32{0.3, 0.3, 0.3})
+
+	// Rounding can make the dot product slightly greater than 1
+	if d := all_minilm_l6_v2.AngularDistanceNormalized(v, v); math.IsNaN(d) || d > 1e-3 {
+		t.Errorf("Expected a distance close to 0, got %f", d)
+	}
+}
@@ -0,0 +1,75 @@
+package all_minilm_l6_v2
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// MMR selects k candidates by Maximal Marginal Relevance: each step picks the
+// candidate maximizing
+//
+//	lambda * sim(query, c) - (1 - lambda) * max sim(c, s) over selected s
+//
+// where sim is the cosine similarity, so that a lambda of 1 ranks by
+// relevance only and lower values favor candidates unlike those already
+// selected. It returns the selected candidates in selection order along with
+// their similarity to the query.
+//
+// The similarity of every candidate to the selected ones is maintained
+// incrementally, which takes O(k × len(candidates)) dot products.
+func MMR(query []float32, candidates [][]float32, k int, lambda float64) ([]Neighbor, error) {
+	if !(lambda >= 0 && lambda <= 1) {
+		return nil, fmt.Errorf("lambda must be in [0, 1], got %f", lambda)
+	}
+	if err := checkBatchDimensions([][]float32{query}, candidates); err != nil {
+		return nil, err
+	}
+	k = min(k, len(candidates))
+	if k <= 0 {
+		return nil, nil
+	}
+
+	candidateNorms := norms(candidates)
+	queryNorm := float64(vecmath.Norm(query))
+	relevance := make([]float64, len(candidates))
+	for i, c := range candidates {
+		relevance[i] = cosineFromNorms(vecmath.Dot(query, c), queryNorm, candidateNorms[i])
+	}
+
+	// redundancy[i] is the highest similarity of candidate i to a selected
+	// candidate.
+	redundancy := make([]float64, len(candidates))
+	for i := range redundancy {
+		redundancy[i] = math.Inf(-1)
+	}
+	selected := make([]bool, len(candidates))
+	neighbors := make([]Neighbor, 0, k)
+
+	for len(neighbors) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range candidates {
+			if selected[i] {
+				continue
+			}
+			score := lambda * relevance[i]
+			if len(neighbors) > 0 {
+				score -= (1 - lambda) * redundancy[i]
+			}
+			if best == -1 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		selected[best] = true
+		neighbors = append(neighbors, Neighbor{Index: best, Score: relevance[best]})
+		for i, c := range candidates {
+			if !selected[i] {
+				sim := cosineFromNorms(vecmath.Dot(candidates[best], c), candidateNorms[best], candidateNorms[i])
+				redundancy[i] = max(redundancy[i], sim)
+			}
+		}
+	}
+	return neighbors, nil
+}
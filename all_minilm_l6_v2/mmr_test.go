@@ -0,0 +1,144 @@
+package all_minilm_l6_v2_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+// naiveMMR recomputes every similarity at every step
+func naiveMMR(query []float32, candidates [][]float32, k int, lambda float64) []int {
+	var selected []int
+	for len(selected) < k && len(selected) < len(candidates) {
+		best, bestScore := -1, math.Inf(-1)
+		for i, c := range candidates {
+			isSelected := false
+			redundancy := math.Inf(-1)
+			for _, s := range selected {
+				isSelected = isSelected || s == i
+				redundancy = math.Max(redundancy, all_minilm_l6_v2.CosineSimilarity(c, candidates[s]))
+			}
+			if isSelected {
+				continue
+			}
+			score := lambda * all_minilm_l6_v2.CosineSimilarity(query, c)
+			if len(selected) > 0 {
+				score -= (1 - lambda) * redundancy
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		selected = append(selected, best)
+	}
+	return selected
+}
+
+func TestMMRMatchesNaiveImplementation(t *testing.T) {
+	query := randomVectors(1, 1, 32)[0]
+	candidates := randomVectors(2, 200, 32)
+
+	for _, lambda := range []float64{0, 0.3, 0.7, 1} {
+		neighbors, err := all_minilm_l6_v2.MMR(query, candidates, 10, lambda)
+		if err != nil {
+			t.Fatalf("Failed to compute MMR: %v", err)
+		}
+		expected := naiveMMR(query, candidates, 10, lambda)
+		for i, n := range neighbors {
+			if n.Index != expected[i] {
+				t.Fatalf("Lambda %f: expected %v, got index %d at %d", lambda, expected, n.Index, i)
+			}
+			if math.Abs(n.Score-all_minilm_l6_v2.CosineSimilarity(query, candidates[n.Index])) > 1e-5 {
+				t.Errorf("Lambda %f: score of %d is not its similarity to the query", lambda, n.Index)
+			}
+		}
+	}
+}
+
+func TestMMRLambdaOneIsTopK(t *testing.T) {
+	query := randomVectors(3, 1, 16)[0]
+	candidates := randomVectors(4, 100, 16)
+
+	neighbors, _ := all_minilm_l6_v2.MMR(query, candidates, 5, 1)
+	expected := bruteForceTopK(query, candidates, 5)
+	for i := range expected {
+		if neighbors[i].Index != expected[i].Index {
+			t.Errorf("Expected %v, got %v", expected, neighbors)
+			break
+		}
+	}
+}
+
+func TestMMRSkipsNearDuplicates(t *testing.T) {
+	query := []float32{1, 0.3, 0}
+	candidates := [][]float32{
+		{1, 0.2, 0},
+		{1, 0.21, 0},
+		{1, 0.19, 0.01},
+		{0.6, 0.8, 0},
+	}
+
+	neighbors, err := all_minilm_l6_v2.MMR(query, candidates, 2, 0.5)
+	if err != nil {
+		t.Fatalf("Failed to compute MMR: %v", err)
+	}
+	if neighbors[0].Index > 2 || neighbors[1].Index != 3 {
+		t.Errorf("Expected a near duplicate then the distinct candidate, got %v", neighbors)
+	}
+}
+
+func TestMMRErrors(t *testing.T) {
+	candidates := randomVectors(5, 3, 4)
+	for _, lambda := range []float64{-0.5, 1.5, math.NaN()} {
+		if _, err := all_minilm_l6_v2.MMR(candidates[0], candidates, 2, lambda); err == nil {
+			t.Errorf("Expected an error for a lambda of %f", lambda)
+		}
+	}
+	if _, err := all_minilm_l6_v2.MMR([]float32{1}, candidates, 2, 0.5); err == nil {
+		t.Errorf("Expected an error for mismatched dimensions")
+	}
+	if neighbors, _ := all_minilm_l6_v2.MMR(candidates[0], candidates, 10, 0.5); len(neighbors) != 3 {
+		t.Errorf("Expected every candidate when k exceeds their number, got %v", neighbors)
+	}
+}
+
+func TestCorpusSearchWithMMR(t *testing.T) {
+	embedder := fixedEmbedder{
+		"query":  {1, 0.3, 0},
+		"copy 1": {1, 0.2, 0},
+		"copy 2": {1, 0.21, 0},
+		"copy 3": {1, 0.19, 0.01},
+		"other":  {0.6, 0.8, 0},
+	}
+	corpus := all_minilm_l6_v2.NewCorpus(embedder)
+	for _, text := range []string{"copy 1", "copy 2", "copy 3", "other"} {
+		_ = corpus.Add(context.Background(), all_minilm_l6_v2.Document{ID: text, Text: text})
+	}
+
+	results, _ := corpus.Search(context.Background(), "query", 2, nil)
+	if results[1].Document.ID == "other" {
+		t.Fatalf("Expected plain search to return duplicates, got %v", resultIDs(results))
+	}
+
+	results, err := corpus.Search(context.Background(), "query", 2, nil, all_minilm_l6_v2.WithMMR(0.5, 10))
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 2 || results[1].Document.ID != "other" {
+		t.Errorf("Expected the distinct document second, got %v", resultIDs(results))
+	}
+
+	// Without more candidates, MMR still reorders the k results
+	results, _ = corpus.Search(context.Background(), "query", 4, nil, all_minilm_l6_v2.WithMMR(0.5, 0))
+	if len(results) != 4 || results[1].Document.ID != "other" {
+		t.Errorf("Expected MMR among the k results, got %v", resultIDs(results))
+	}
+
+	for _, lambda := range []float64{1.5, math.NaN()} {
+		if _, err := corpus.Search(context.Background(), "query", 2, nil, all_minilm_l6_v2.WithMMR(lambda, 10)); err == nil {
+			t.Errorf("Expected an error for a lambda of %f", lambda)
+		}
+	}
+}
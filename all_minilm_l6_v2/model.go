@@ -2,12 +2,14 @@ package all_minilm_l6_v2
 
 import (
 	"bytes"
+	"crypto/sha256"
 	_ "embed"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/sugarme/tokenizer"
-	"github.com/sugarme/tokenizer/pretrained"
 	ort "github.com/yalue/onnxruntime_go"
 )
 
@@ -17,11 +19,34 @@ var embeddedTokenizer []byte
 //go:embed model.onnx
 var onnxModel []byte
 
+// EmbeddedModelFingerprint returns the SHA-256 of the embedded ONNX model. It
+// is computed on first use.
+var EmbeddedModelFingerprint = sync.OnceValue(func() [32]byte {
+	return sha256.Sum256(onnxModel)
+})
+
+// DefaultOutputName is the name of the output read from the embedded
+// all-MiniLM-L6-v2 model.
+const DefaultOutputName = "sentence_embedding"
+
 type Model struct {
-	tk      tokenizer.Tokenizer
+	tk      textEncoder
 	session *ort.DynamicAdvancedSession
 
-	runtimePath string
+	runtimePath   string
+	modelPath     string
+	tokenizerPath string
+	outputName    string
+	wordPiece     bool
+
+	// fingerprint is the SHA-256 of the model loaded with WithModelPath. It
+	// is left zero for the embedded model whose hash is computed lazily.
+	fingerprint [32]byte
+	// tokenizerFingerprint is the SHA-256 of the tokenizer loaded with
+	// WithTokenizerPath, zero when it is the embedded one.
+	tokenizerFingerprint [32]byte
+
+	adapter *Adapter
 }
 
 type ModelOption = func(*Model)
@@ -32,19 +57,76 @@ func WithRuntimePath(path string) ModelOption {
 	}
 }
 
+// WithModelPath loads the ONNX model from path instead of the embedded
+// all-MiniLM-L6-v2 weights. This is how cross-encoders such as
+// ms-marco-MiniLM-L-6-v2 are served.
+func WithModelPath(path string) ModelOption {
+	return func(m *Model) {
+		m.modelPath = path
+	}
+}
+
+// WithTokenizerPath loads the tokenizer.json at path instead of the embedded
+// one. It is only needed when the model given to WithModelPath was trained
+// with a different vocabulary or truncation settings.
+func WithTokenizerPath(path string) ModelOption {
+	return func(m *Model) {
+		m.tokenizerPath = path
+	}
+}
+
+// WithWordPieceTokenizer tokenizes with the pure Go WordPiece implementation
+// instead of github.com/sugarme/tokenizer. It supports the tokenizer.json of
+// BERT models only and allocates far less, but its inputs differ from
+// sugarme's on some texts, see NewWordPieceTokenizer, so it changes the
+// fingerprint of the model.
+func WithWordPieceTokenizer() ModelOption {
+	return func(m *Model) {
+		m.wordPiece = true
+	}
+}
+
+// WithOutputName selects the model output to read, for instance "logits" for
+// cross-encoders. It defaults to DefaultOutputName.
+func WithOutputName(name string) ModelOption {
+	return func(m *Model) {
+		m.outputName = name
+	}
+}
+
 func NewModel(opts ...ModelOption) (*Model, error) {
-	model := new(Model)
+	model := &Model{
+		outputName: DefaultOutputName,
+	}
 
 	for _, opt := range opts {
 		opt(model)
 	}
+	if model.adapter != nil && len(model.adapter.weights) == 0 {
+		return nil, errors.New("adapter must be created with NewAdapter, TrainAdapter or UnmarshalBinary")
+	}
 
-	tk, err := pretrained.FromReader(
-		bytes.NewBuffer(embeddedTokenizer))
+	tokenizerData, err := readTokenizer(model.tokenizerPath)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tokenizerData, embeddedTokenizer) {
+		model.tokenizerFingerprint = sha256.Sum256(tokenizerData)
+	}
+	tk, err := newTextEncoder(tokenizerData, model.wordPiece)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
 	}
 
+	modelData := onnxModel
+	if model.modelPath != "" {
+		modelData, err = os.ReadFile(model.modelPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read model: %w", err)
+		}
+		model.fingerprint = sha256.Sum256(modelData)
+	}
+
 	if model.runtimePath != "" {
 		ort.SetSharedLibraryPath(model.runtimePath)
 	} else {
@@ -61,17 +143,54 @@ func NewModel(opts ...ModelOption) (*Model, error) {
 
 	// Create a dynamic session that accepts tensors at runtime
 	inputNames := []string{"input_ids", "attention_mask", "token_type_ids"}
-	outputNames := []string{"sentence_embedding"}
+	outputNames := []string{model.outputName}
 
-	session, err := ort.NewDynamicAdvancedSessionWithONNXData(onnxModel, inputNames, outputNames, nil)
+	session, err := ort.NewDynamicAdvancedSessionWithONNXData(modelData, inputNames, outputNames, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
-	return &Model{
-		tk:      *tk,
-		session: session,
-	}, nil
+	model.tk = tk
+	model.session = session
+	return model, nil
+}
+
+// Fingerprint returns the SHA-256 of the ONNX model. It identifies the
+// embedding space, so that embeddings persisted with it can be invalidated
+// when the model changes. A tokenizer other than the embedded one, the
+// WordPiece implementation and an output other than DefaultOutputName are
+// hashed along with the model. With
+// an adapter, it is the SHA-256 of the model's and the adapter's
+// fingerprints.
+func (m *Model) Fingerprint() [32]byte {
+	fingerprint := m.fingerprint
+	if m.modelPath == "" {
+		fingerprint = EmbeddedModelFingerprint()
+	}
+	// The default configuration keeps the hash of the model alone, so that
+	// the embeddings persisted before the options were hashed stay valid.
+	if m.tokenizerFingerprint != [32]byte{} || m.wordPiece || m.outputName != DefaultOutputName {
+		h := sha256.New()
+		h.Write(fingerprint[:])
+		h.Write(m.tokenizerFingerprint[:])
+		if m.wordPiece {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+		}
+		h.Write([]byte(m.outputName))
+		h.Sum(fingerprint[:0])
+	}
+	if m.adapter == nil {
+		return fingerprint
+	}
+	adapterFingerprint := m.adapter.fingerprint()
+	return sha256.Sum256(append(fingerprint[:], adapterFingerprint[:]...))
+}
+
+// Tokenizer returns the tokenizer the model encodes sentences with.
+func (m *Model) Tokenizer() *Tokenizer {
+	return &Tokenizer{tk: m.tk}
 }
 
 func (m *Model) Close() error {
@@ -106,25 +225,34 @@ func (m *Model) ComputeBatch(sentences []string, addSpecialTokens bool) ([][]flo
 		return nil, nil
 	}
 
-	inputBatch := []tokenizer.EncodeInput{}
-	for _, s := range sentences {
-		inputBatch = append(inputBatch, tokenizer.NewSingleEncodeInput(tokenizer.NewRawInputSequence(s)))
-	}
-
-	if len(inputBatch) == 0 {
-		return nil, nil
-	}
-	encodings, err := m.tk.EncodeBatch(inputBatch, addSpecialTokens)
+	encodings, err := m.tk.encodeBatch(sentences, addSpecialTokens)
 	if err != nil {
 		return nil, fmt.Errorf("failed to tokenize sentence: %w", err)
 	}
 	return m.ComputeBatchFromEncodings(encodings)
 }
 
+// ComputeBatchFromEncodings runs the model on encodings and applies the
+// adapter, if any, to the sentence embeddings.
 func (m *Model) ComputeBatchFromEncodings(encodings []tokenizer.Encoding) ([][]float32, error) {
+	results, err := m.run(encodings)
+	if err != nil || m.adapter == nil || m.outputName != DefaultOutputName {
+		return results, err
+	}
+	results, err = m.adapter.TransformBatch(results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply adapter: %w", err)
+	}
+	return results, nil
+}
+
+// run returns the raw model output for each encoding.
+func (m *Model) run(encodings []tokenizer.Encoding) ([][]float32, error) {
 	batchSize := len(encodings)
+	if batchSize == 0 {
+		return nil, nil
+	}
 	seqLength := len(encodings[0].Ids)
-	hiddenSize := 384
 
 	inputShape := ort.NewShape(int64(batchSize), int64(seqLength))
 
@@ -163,38 +291,43 @@ func (m *Model) ComputeBatchFromEncodings(encodings []tokenizer.Encoding) ([][]f
 	}
 	defer tokenTypeIdsTensor.Destroy()
 
-	sentenceOutputShape := ort.NewShape(int64(batchSize), int64(hiddenSize))
-	sentenceOutputTensor, err := ort.NewEmptyTensor[float32](sentenceOutputShape)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create empty tensor: %w", err)
-	}
-	defer sentenceOutputTensor.Destroy()
-
+	// The output is allocated by the runtime so that models with a different
+	// output width, such as cross-encoders returning a single logit, can be
+	// served by the same code path.
 	inputTensors := []ort.Value{inputIdsTensor, attentionMaskTensor, tokenTypeIdsTensor}
-	outputTensors := []ort.Value{sentenceOutputTensor}
+	outputTensors := []ort.Value{nil}
 
 	err = m.session.Run(inputTensors, outputTensors)
 	if err != nil {
 		return nil, fmt.Errorf("failed to run session: %w", err)
 	}
+	defer outputTensors[0].Destroy()
 
-	flatOutput := sentenceOutputTensor.GetData()
+	outputTensor, ok := outputTensors[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("unexpected output type for %q: expected a float32 tensor", m.outputName)
+	}
 
-	// We want to have the highest throughput possible so we skip this assuming that the size of the
-	// array is correct, that is (batshSize, hiddenSize).
-	//
-	expectedTotalSize := batchSize * hiddenSize
+	// A rank 1 output, e.g. (batchSize) logits, holds a single value per input.
+	outputShape := outputTensor.GetShape()
+	outputSize := 1
+	if len(outputShape) > 1 {
+		outputSize = int(outputShape[len(outputShape)-1])
+	}
+
+	flatOutput := outputTensor.GetData()
+
+	expectedTotalSize := batchSize * outputSize
 	if len(flatOutput) != expectedTotalSize {
 		return nil, fmt.Errorf("unexpected output tensor size: got %d elements, expected %d elements", len(flatOutput), expectedTotalSize)
 	}
 
 	results := make([][]float32, batchSize)
 	for i := range batchSize {
-		start := i * hiddenSize
-		end := start + hiddenSize
-		results[i] = make([]float32, hiddenSize)
+		start := i * outputSize
+		end := start + outputSize
+		results[i] = make([]float32, outputSize)
 		copy(results[i], flatOutput[start:end])
 	}
-
 	return results, nil
 }
@@ -1,7 +1,10 @@
 package all_minilm_l6_v2_test
 
 import (
+	"bytes"
 	"math"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
@@ -216,6 +219,41 @@ func TestEmptyBatch(t *testing.T) {
 	}
 }
 
+func TestFingerprintCoversTokenizer(t *testing.T) {
+	fingerprint := func(opts ...all_minilm_l6_v2.ModelOption) [32]byte {
+		t.Helper()
+		model, err := all_minilm_l6_v2.NewModel(opts...)
+		if err != nil {
+			t.Fatalf("Failed to create model: %v", err)
+		}
+		defer model.Close()
+		return model.Fingerprint()
+	}
+
+	if fingerprint() != all_minilm_l6_v2.EmbeddedModelFingerprint() {
+		t.Errorf("Expected the fingerprint of the embedded model")
+	}
+	if fingerprint(all_minilm_l6_v2.WithTokenizerPath("tokenizer.json")) != all_minilm_l6_v2.EmbeddedModelFingerprint() {
+		t.Errorf("Expected a copy of the embedded tokenizer to keep the fingerprint")
+	}
+	if fingerprint(all_minilm_l6_v2.WithWordPieceTokenizer()) == all_minilm_l6_v2.EmbeddedModelFingerprint() {
+		t.Errorf("Expected the WordPiece tokenizer to change the fingerprint")
+	}
+
+	data, err := os.ReadFile("tokenizer.json")
+	if err != nil {
+		t.Fatalf("Failed to read tokenizer: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	data = bytes.Replace(data, []byte(`"max_length": 128`), []byte(`"max_length": 64`), 1)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Failed to write tokenizer: %v", err)
+	}
+	if fingerprint(all_minilm_l6_v2.WithTokenizerPath(path)) == all_minilm_l6_v2.EmbeddedModelFingerprint() {
+		t.Errorf("Expected another tokenizer to change the fingerprint")
+	}
+}
+
 // Helper function to compare two vectors for equality with a small tolerance
 func vectorsEqual(a, b []float32) bool {
 	if len(a) != len(b) {
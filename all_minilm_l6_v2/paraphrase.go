@@ -0,0 +1,261 @@
+package all_minilm_l6_v2
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// DefaultMiningTopK is the default number of most similar sentences
+	// considered per sentence by ParaphraseMining.
+	DefaultMiningTopK = 100
+	// DefaultMaxPairs is the default maximum number of pairs returned by
+	// ParaphraseMining.
+	DefaultMaxPairs = 500000
+	// DefaultMiningChunkSize is the default number of sentences whose
+	// neighbors are searched at once by ParaphraseMining.
+	DefaultMiningChunkSize = 5000
+)
+
+// ParaphrasePair is a pair of sentences, identified by their index with I <
+// J, along with their cosine similarity.
+type ParaphrasePair struct {
+	I, J  int
+	Score float64
+}
+
+type miningOptions struct {
+	topK      int
+	maxPairs  int
+	minScore  float64
+	chunkSize int
+	batchSize int
+}
+
+type MiningOption = func(*miningOptions)
+
+// WithMiningTopK sets the number of most similar sentences considered per
+// sentence. A pair is found when one of its sentences is among the topK most
+// similar to the other. It defaults to DefaultMiningTopK.
+func WithMiningTopK(k int) MiningOption {
+	return func(o *miningOptions) {
+		o.topK = k
+	}
+}
+
+// WithMaxPairs sets the maximum number of pairs returned. It defaults to
+// DefaultMaxPairs.
+func WithMaxPairs(n int) MiningOption {
+	return func(o *miningOptions) {
+		o.maxPairs = n
+	}
+}
+
+// WithMinScore drops the pairs with a similarity below score.
+func WithMinScore(score float64) MiningOption {
+	return func(o *miningOptions) {
+		o.minScore = score
+	}
+}
+
+// WithMiningChunkSize sets the number of sentences whose neighbors are
+// searched at once. It defaults to DefaultMiningChunkSize.
+func WithMiningChunkSize(n int) MiningOption {
+	return func(o *miningOptions) {
+		o.chunkSize = n
+	}
+}
+
+// WithMiningBatchSize sets the number of sentences embedded per call to the
+// embedder by ParaphraseMining. It defaults to DefaultCorpusBatchSize.
+func WithMiningBatchSize(n int) MiningOption {
+	return func(o *miningOptions) {
+		o.batchSize = n
+	}
+}
+
+func newMiningOptions(opts []MiningOption) miningOptions {
+	o := miningOptions{
+		topK:      DefaultMiningTopK,
+		maxPairs:  DefaultMaxPairs,
+		minScore:  math.Inf(-1),
+		chunkSize: DefaultMiningChunkSize,
+		batchSize: DefaultCorpusBatchSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.chunkSize = max(o.chunkSize, 1)
+	return o
+}
+
+// ParaphraseMining embeds sentences and returns the pairs of most similar
+// sentences, as ParaphraseMiningEmbeddings.
+func ParaphraseMining(ctx context.Context, embedder Embedder, sentences []string, opts ...MiningOption) ([]ParaphrasePair, error) {
+	o := newMiningOptions(opts)
+	embeddings, err := embedAll(ctx, embedder, sentences, o.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed sentences: %w", err)
+	}
+	return ParaphraseMiningEmbeddings(embeddings, opts...)
+}
+
+// ParaphraseMiningEmbeddings returns the pairs of most similar embeddings
+// sorted by decreasing similarity, ties being broken by indices, like the
+// paraphrase_mining function of sentence-transformers.
+//
+// The neighbors of a chunk of embeddings are searched at a time and only the
+// best pairs are kept, so memory is bounded by the chunk size times topK plus
+// the maximum number of pairs instead of growing with the square of the
+// number of embeddings.
+func ParaphraseMiningEmbeddings(embeddings [][]float32, opts ...MiningOption) ([]ParaphrasePair, error) {
+	o := newMiningOptions(opts)
+	if err := checkBatchDimensions(embeddings, nil); err != nil {
+		return nil, err
+	}
+	if o.topK <= 0 || o.maxPairs <= 0 {
+		return nil, nil
+	}
+
+	best := &pairHeap{}
+	kept := make(map[[2]int]bool)
+	for lo := 0; lo < len(embeddings); lo += o.chunkSize {
+		hi := min(lo+o.chunkSize, len(embeddings))
+		// One more neighbor is searched as the sentence itself is among
+		// them
+		neighbors, err := TopK(embeddings[lo:hi], embeddings, o.topK+1)
+		if err != nil {
+			return nil, err
+		}
+
+		for q, list := range neighbors {
+			i := lo + q
+			found := 0
+			for _, n := range list {
+				if n.Index == i || found == o.topK {
+					continue
+				}
+				found++
+				if n.Score < o.minScore {
+					continue
+				}
+				pair := ParaphrasePair{I: min(i, n.Index), J: max(i, n.Index), Score: n.Score}
+				key := [2]int{pair.I, pair.J}
+				if kept[key] {
+					continue
+				}
+				if evicted, added := best.offer(o.maxPairs, pair); added {
+					kept[key] = true
+					if evicted != nil {
+						delete(kept, [2]int{evicted.I, evicted.J})
+					}
+				}
+			}
+		}
+	}
+
+	pairs := []ParaphrasePair(*best)
+	sort.Slice(pairs, func(a, b int) bool {
+		return pairLess(pairs[b], pairs[a])
+	})
+	return pairs, nil
+}
+
+// DuplicateGroup is a group of near-duplicate embeddings, identified by their
+// index, along with the one chosen to represent the group.
+type DuplicateGroup struct {
+	Representative int
+	Members        []int
+}
+
+// Deduplicate groups embeddings whose similarity is at least threshold,
+// directly or through other members of the group, and picks the first member
+// of each group as its representative. Every embedding belongs to exactly one
+// group, so the representatives are the deduplicated set. Groups are sorted
+// by representative and their members by index.
+//
+// Pairs are found with ParaphraseMiningEmbeddings, whose options apply; an
+// embedding is only linked to its topK most similar ones.
+func Deduplicate(embeddings [][]float32, threshold float64, opts ...MiningOption) ([]DuplicateGroup, error) {
+	opts = append(opts, WithMinScore(threshold), WithMaxPairs(math.MaxInt))
+	pairs, err := ParaphraseMiningEmbeddings(embeddings, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := make([]int, len(embeddings))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for _, p := range pairs {
+		a, b := find(p.I), find(p.J)
+		// The root is the lowest index, which makes it the representative
+		parent[max(a, b)] = min(a, b)
+	}
+
+	var groups []DuplicateGroup
+	groupOf := make(map[int]int)
+	for i := range embeddings {
+		root := find(i)
+		g, ok := groupOf[root]
+		if !ok {
+			g = len(groups)
+			groupOf[root] = g
+			groups = append(groups, DuplicateGroup{Representative: root})
+		}
+		groups[g].Members = append(groups[g].Members, i)
+	}
+	return groups, nil
+}
+
+// pairLess reports whether a ranks below b.
+func pairLess(a, b ParaphrasePair) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	if a.I != b.I {
+		return a.I > b.I
+	}
+	return a.J > b.J
+}
+
+// pairHeap is a min-heap keeping the worst ranked pair at the root.
+type pairHeap []ParaphrasePair
+
+func (h pairHeap) Len() int           { return len(h) }
+func (h pairHeap) Less(i, j int) bool { return pairLess(h[i], h[j]) }
+func (h pairHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *pairHeap) Push(x any)        { *h = append(*h, x.(ParaphrasePair)) }
+
+func (h *pairHeap) Pop() any {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
+
+// offer adds p to the heap if it ranks among the n best seen so far, and
+// returns the pair it evicted, if any.
+func (h *pairHeap) offer(n int, p ParaphrasePair) (*ParaphrasePair, bool) {
+	if h.Len() < n {
+		heap.Push(h, p)
+		return nil, true
+	}
+	if !pairLess((*h)[0], p) {
+		return nil, false
+	}
+	evicted := (*h)[0]
+	(*h)[0] = p
+	heap.Fix(h, 0)
+	return &evicted, true
+}
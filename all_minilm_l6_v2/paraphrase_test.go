@@ -0,0 +1,112 @@
+package all_minilm_l6_v2_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+// bruteForcePairs scores every pair
+func bruteForcePairs(embeddings [][]float32) []all_minilm_l6_v2.ParaphrasePair {
+	var pairs []all_minilm_l6_v2.ParaphrasePair
+	for i := range embeddings {
+		for j := i + 1; j < len(embeddings); j++ {
+			pairs = append(pairs, all_minilm_l6_v2.ParaphrasePair{
+				I: i, J: j, Score: all_minilm_l6_v2.CosineSimilarity(embeddings[i], embeddings[j]),
+			})
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool { return pairs[a].Score > pairs[b].Score })
+	return pairs
+}
+
+func TestParaphraseMiningMatchesBruteForce(t *testing.T) {
+	embeddings := randomVectors(1, 60, 16)
+	expected := bruteForcePairs(embeddings)
+
+	// With topK covering every sentence, mining finds every pair whatever
+	// the chunk size
+	for _, chunkSize := range []int{1, 7, 100} {
+		pairs, err := all_minilm_l6_v2.ParaphraseMiningEmbeddings(embeddings,
+			all_minilm_l6_v2.WithMiningTopK(60),
+			all_minilm_l6_v2.WithMiningChunkSize(chunkSize),
+			all_minilm_l6_v2.WithMaxPairs(50))
+		if err != nil {
+			t.Fatalf("Failed to mine pairs: %v", err)
+		}
+		if len(pairs) != 50 {
+			t.Fatalf("Chunk size %d: expected 50 pairs, got %d", chunkSize, len(pairs))
+		}
+		for i, p := range pairs {
+			if p.I != expected[i].I || p.J != expected[i].J || math.Abs(p.Score-expected[i].Score) > 1e-5 {
+				t.Fatalf("Chunk size %d: pair %d is %v, expected %v", chunkSize, i, p, expected[i])
+			}
+		}
+	}
+}
+
+func TestParaphraseMiningTopKAndMinScore(t *testing.T) {
+	embeddings := randomVectors(2, 40, 16)
+
+	pairs, _ := all_minilm_l6_v2.ParaphraseMiningEmbeddings(embeddings, all_minilm_l6_v2.WithMiningTopK(1))
+	// Every sentence contributes its nearest neighbor, some pairs being
+	// found from both sides
+	if len(pairs) < 20 || len(pairs) > 40 {
+		t.Errorf("Expected between 20 and 40 pairs, got %d", len(pairs))
+	}
+	seen := make(map[[2]int]bool)
+	for _, p := range pairs {
+		if p.I >= p.J {
+			t.Errorf("Expected I < J, got %v", p)
+		}
+		if seen[[2]int{p.I, p.J}] {
+			t.Errorf("Pair %v found twice", p)
+		}
+		seen[[2]int{p.I, p.J}] = true
+	}
+
+	pairs, _ = all_minilm_l6_v2.ParaphraseMiningEmbeddings(embeddings, all_minilm_l6_v2.WithMinScore(0.5))
+	for _, p := range pairs {
+		if p.Score < 0.5 {
+			t.Errorf("Pair %v is below the minimum score", p)
+		}
+	}
+}
+
+func TestParaphraseMiningSentences(t *testing.T) {
+	sentences := []string{
+		"the cat sits on the mat",
+		"a recipe for pizza",
+		"the cat sits on the mat today",
+		"stock markets fell sharply",
+	}
+	pairs, err := all_minilm_l6_v2.ParaphraseMining(context.Background(), &bagOfWordsEmbedder{}, sentences,
+		all_minilm_l6_v2.WithMaxPairs(1))
+	if err != nil {
+		t.Fatalf("Failed to mine pairs: %v", err)
+	}
+	if len(pairs) != 1 || pairs[0].I != 0 || pairs[0].J != 2 {
+		t.Errorf("Expected the pair (0, 2), got %v", pairs)
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	base := randomVectors(3, 4, 32)
+	// 0 and 3 are copies of base[0], 2 and 4 of base[1] and 5 is close to
+	// base[1]
+	near := append([]float32(nil), base[1]...)
+	near[0] += 0.5
+	embeddings := [][]float32{base[0], base[2], base[1], base[0], base[1], near}
+
+	groups, err := all_minilm_l6_v2.Deduplicate(embeddings, 0.95)
+	if err != nil {
+		t.Fatalf("Failed to deduplicate: %v", err)
+	}
+	if fmt.Sprint(groups) != "[{0 [0 3]} {1 [1]} {2 [2 4 5]}]" {
+		t.Errorf("Unexpected groups: %v", groups)
+	}
+}
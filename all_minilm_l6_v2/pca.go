@@ -0,0 +1,447 @@
+package all_minilm_l6_v2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/rand"
+	"runtime"
+)
+
+const (
+	// DefaultPCAOversampling is the default number of extra random
+	// directions sampled by the randomized solver.
+	DefaultPCAOversampling = 10
+	// DefaultPCAPowerIterations is the default number of power iterations
+	// of the randomized solver.
+	DefaultPCAPowerIterations = 4
+)
+
+// PCASolver is the algorithm computing the principal components.
+type PCASolver int
+
+const (
+	// AutoPCASolver uses the randomized solver when the input is larger than
+	// 500 in any dimension and fewer than 80% of the components are kept, as
+	// scikit-learn does, and the exact solver otherwise.
+	AutoPCASolver PCASolver = iota
+	// ExactPCASolver eigendecomposes the covariance matrix, which takes
+	// O(n × dim² + dim³) time.
+	ExactPCASolver
+	// RandomizedPCASolver approximates the top components with the
+	// randomized SVD of Halko et al., which takes O(n × dim × k) time.
+	RandomizedPCASolver
+)
+
+// PCA projects vectors on the principal components of a corpus, the
+// directions of highest variance, to reduce their dimension.
+type PCA struct {
+	mean []float32
+	// components holds k unit rows of len(mean) coefficients, by decreasing
+	// variance.
+	components    []float32
+	variances     []float64
+	totalVariance float64
+}
+
+type pcaOptions struct {
+	solver          PCASolver
+	oversampling    int
+	powerIterations int
+	seed            int64
+}
+
+type PCAOption = func(*pcaOptions)
+
+// WithPCASolver sets the algorithm computing the components. It defaults to
+// AutoPCASolver.
+func WithPCASolver(solver PCASolver) PCAOption {
+	return func(o *pcaOptions) {
+		o.solver = solver
+	}
+}
+
+// WithPCAOversampling sets the number of extra random directions sampled by
+// the randomized solver. It defaults to DefaultPCAOversampling.
+func WithPCAOversampling(n int) PCAOption {
+	return func(o *pcaOptions) {
+		o.oversampling = n
+	}
+}
+
+// WithPCAPowerIterations sets the number of power iterations of the
+// randomized solver, which improve its accuracy when the variances decay
+// slowly. It defaults to DefaultPCAPowerIterations.
+func WithPCAPowerIterations(n int) PCAOption {
+	return func(o *pcaOptions) {
+		o.powerIterations = n
+	}
+}
+
+// WithPCASeed sets the seed of the random directions of the randomized
+// solver.
+func WithPCASeed(seed int64) PCAOption {
+	return func(o *pcaOptions) {
+		o.seed = seed
+	}
+}
+
+// FitPCA computes the k principal components of vectors. The sign of each
+// component is chosen so that its largest coefficient is positive, which
+// makes the projection deterministic.
+func FitPCA(vectors [][]float32, k int, opts ...PCAOption) (*PCA, error) {
+	o := pcaOptions{
+		solver:          AutoPCASolver,
+		oversampling:    DefaultPCAOversampling,
+		powerIterations: DefaultPCAPowerIterations,
+		seed:            1,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(vectors) == 0 {
+		return nil, errors.New("no vectors to fit")
+	}
+	if err := checkBatchDimensions(vectors, nil); err != nil {
+		return nil, err
+	}
+	n, dim := len(vectors), len(vectors[0])
+	if k <= 0 || k > dim {
+		return nil, fmt.Errorf("invalid number of components %d for vectors of dimension %d", k, dim)
+	}
+
+	solver := o.solver
+	if solver == AutoPCASolver {
+		solver = ExactPCASolver
+		if max(n, dim) > 500 && float64(k) < 0.8*float64(min(n, dim)) {
+			solver = RandomizedPCASolver
+		}
+	}
+
+	var mean []float64
+	var components [][]float64
+	var variances []float64
+	switch solver {
+	case ExactPCASolver:
+		var covariance [][]float64
+		mean, covariance = meanAndCovariance(vectors)
+		values, eigenvectors := symmetricEigen(covariance)
+		components, variances = eigenvectors[:k], values[:k]
+	case RandomizedPCASolver:
+		mean = columnMeans(vectors)
+		components, variances = randomizedPCA(vectors, mean, k, o)
+	default:
+		return nil, fmt.Errorf("unknown PCA solver %d", o.solver)
+	}
+
+	p := &PCA{mean: make([]float32, dim), variances: make([]float64, k)}
+	for d, m := range mean {
+		p.mean[d] = float32(m)
+	}
+	for i, c := range components {
+		// Variances of a rank-deficient input can come out slightly
+		// negative.
+		p.variances[i] = max(variances[i], 0)
+		largest := 0
+		for d, x := range c {
+			if math.Abs(x) > math.Abs(c[largest]) {
+				largest = d
+			}
+		}
+		sign := 1.0
+		if c[largest] < 0 {
+			sign = -1
+		}
+		for _, x := range c {
+			p.components = append(p.components, float32(sign*x))
+		}
+	}
+	for _, v := range vectors {
+		for d, x := range v {
+			centered := float64(x) - mean[d]
+			p.totalVariance += centered * centered
+		}
+	}
+	p.totalVariance /= float64(n)
+	return p, nil
+}
+
+// columnMeans returns the mean of vectors.
+func columnMeans(vectors [][]float32) []float64 {
+	mean := make([]float64, len(vectors[0]))
+	for _, v := range vectors {
+		for d, x := range v {
+			mean[d] += float64(x)
+		}
+	}
+	for d := range mean {
+		mean[d] /= float64(len(vectors))
+	}
+	return mean
+}
+
+// randomizedPCA returns the k top principal components of vectors and their
+// variances with the randomized SVD: the centered matrix X is multiplied by
+// random directions, refined with power iterations, to find an orthonormal
+// basis Q of its range, and the small matrix QᵀX is decomposed exactly.
+func randomizedPCA(vectors [][]float32, mean []float64, k int, o pcaOptions) ([][]float64, []float64) {
+	n, dim := len(vectors), len(mean)
+	l := min(k+max(o.oversampling, 0), n, dim)
+	rng := rand.New(rand.NewSource(o.seed))
+
+	// Matrices are stored as columns: omega holds l columns of length dim
+	// and y l columns of length n.
+	omega := make([][]float64, l)
+	for j := range omega {
+		omega[j] = make([]float64, dim)
+		for d := range omega[j] {
+			omega[j][d] = rng.NormFloat64()
+		}
+	}
+	y := multiplyCentered(vectors, mean, omega)
+	for range max(o.powerIterations, 0) {
+		orthonormalize(y)
+		z := multiplyCenteredTransposed(vectors, mean, y)
+		orthonormalize(z)
+		y = multiplyCentered(vectors, mean, z)
+	}
+	orthonormalize(y)
+
+	// The rows of B = QᵀX are the columns of XᵀQ.
+	b := multiplyCenteredTransposed(vectors, mean, y)
+	gram := make([][]float64, l)
+	for i := range gram {
+		gram[i] = make([]float64, l)
+		for j := range gram[i] {
+			gram[i][j] = dotFloat64(b[i], b[j])
+		}
+	}
+	values, left := symmetricEigen(gram)
+
+	// B = U Σ Vᵀ, so the right singular vectors are Vᵀ = Σ⁻¹ Uᵀ B. With
+	// fewer vectors than components, the extra components are left zero.
+	components := make([][]float64, k)
+	variances := make([]float64, k)
+	for c := range k {
+		components[c] = make([]float64, dim)
+		if c >= l {
+			continue
+		}
+		sigma := math.Sqrt(max(values[c], 0))
+		if sigma == 0 {
+			continue
+		}
+		for j, u := range left[c] {
+			axpy64(u/sigma, b[j], components[c])
+		}
+		variances[c] = values[c] / float64(n)
+	}
+	return components, variances
+}
+
+// multiplyCentered returns the columns of X × m, X being vectors centered on
+// mean and m given as columns.
+func multiplyCentered(vectors [][]float32, mean []float64, m [][]float64) [][]float64 {
+	out := make([][]float64, len(m))
+	for j := range out {
+		out[j] = make([]float64, len(vectors))
+	}
+	parallelFor(len(vectors), runtime.GOMAXPROCS(0), func(i int) {
+		centered := make([]float64, len(mean))
+		for d, x := range vectors[i] {
+			centered[d] = float64(x) - mean[d]
+		}
+		for j, column := range m {
+			out[j][i] = dotFloat64(centered, column)
+		}
+	})
+	return out
+}
+
+// multiplyCenteredTransposed returns the columns of Xᵀ × m, X being vectors
+// centered on mean and m given as columns.
+func multiplyCenteredTransposed(vectors [][]float32, mean []float64, m [][]float64) [][]float64 {
+	out := make([][]float64, len(m))
+	parallelFor(len(m), runtime.GOMAXPROCS(0), func(j int) {
+		out[j] = make([]float64, len(mean))
+		for i, v := range vectors {
+			w := m[j][i]
+			for d, x := range v {
+				out[j][d] += w * (float64(x) - mean[d])
+			}
+		}
+	})
+	return out
+}
+
+// orthonormalize makes columns orthonormal with the modified Gram-Schmidt
+// process, zeroing the columns that depend on the previous ones.
+func orthonormalize(columns [][]float64) {
+	for j, c := range columns {
+		for _, previous := range columns[:j] {
+			axpy64(-dotFloat64(c, previous), previous, c)
+		}
+		norm := math.Sqrt(dotFloat64(c, c))
+		if norm < 1e-12 {
+			clear(c)
+			continue
+		}
+		for i := range c {
+			c[i] /= norm
+		}
+	}
+}
+
+// InputDim returns the dimension of the vectors the projection applies to.
+func (p *PCA) InputDim() int { return len(p.mean) }
+
+// OutputDim returns the number of components.
+func (p *PCA) OutputDim() int { return len(p.variances) }
+
+// Components returns a copy of the principal components, by decreasing
+// variance.
+func (p *PCA) Components() [][]float32 {
+	dim := len(p.mean)
+	components := make([][]float32, len(p.variances))
+	for i := range components {
+		components[i] = append([]float32(nil), p.components[i*dim:(i+1)*dim]...)
+	}
+	return components
+}
+
+// Variances returns the variance of the corpus along each component.
+func (p *PCA) Variances() []float64 {
+	return append([]float64(nil), p.variances...)
+}
+
+// ExplainedVarianceRatio returns the share of the total variance of the
+// corpus along each component.
+func (p *PCA) ExplainedVarianceRatio() []float64 {
+	ratios := make([]float64, len(p.variances))
+	if p.totalVariance == 0 {
+		return ratios
+	}
+	for i, v := range p.variances {
+		ratios[i] = v / p.totalVariance
+	}
+	return ratios
+}
+
+// Transform returns the coordinates of v along the components.
+func (p *PCA) Transform(v []float32) ([]float32, error) {
+	dim := len(p.mean)
+	if err := checkDimensions(dim, len(v)); err != nil {
+		return nil, err
+	}
+	out := make([]float32, len(p.variances))
+	for i := range out {
+		row := p.components[i*dim : (i+1)*dim]
+		var sum float64
+		for d, x := range v {
+			sum += float64(row[d]) * float64(x-p.mean[d])
+		}
+		out[i] = float32(sum)
+	}
+	return out, nil
+}
+
+// TransformBatch projects every vector of vs.
+func (p *PCA) TransformBatch(vs [][]float32) ([][]float32, error) {
+	out := make([][]float32, len(vs))
+	for i, v := range vs {
+		var err error
+		if out[i], err = p.Transform(v); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// InverseTransform returns the vector of the input space whose projection is
+// coordinates and that lies in the span of the components.
+func (p *PCA) InverseTransform(coordinates []float32) ([]float32, error) {
+	if err := checkDimensions(len(p.variances), len(coordinates)); err != nil {
+		return nil, err
+	}
+	dim := len(p.mean)
+	out := append([]float32(nil), p.mean...)
+	for i, c := range coordinates {
+		row := p.components[i*dim : (i+1)*dim]
+		for d := range out {
+			out[d] += c * row[d]
+		}
+	}
+	return out, nil
+}
+
+// A serialized PCA is the magic "MINILMPC", the format version, the input and
+// output dimensions as little-endian uint32, the total variance and the
+// variances as float64, the mean and the components as float32, and the
+// CRC-32C of all the preceding bytes.
+const (
+	pcaMagic   = "MINILMPC"
+	pcaVersion = 1
+)
+
+// MarshalBinary encodes the projection in a versioned binary format.
+func (p *PCA) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 28+len(p.variances)*8+len(p.mean)*4+len(p.components)*4+4)
+	buf = append(buf, pcaMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, pcaVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(p.mean)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(p.variances)))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(p.totalVariance))
+	for _, v := range p.variances {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+	}
+	for _, m := range p.mean {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(m))
+	}
+	for _, c := range p.components {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(c))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a projection encoded with MarshalBinary.
+func (p *PCA) UnmarshalBinary(data []byte) error {
+	if len(data) < 32 || string(data[:8]) != pcaMagic {
+		return errors.New("not a PCA")
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, castagnoli) != sum {
+		return errors.New("PCA checksum mismatch")
+	}
+	if v := binary.LittleEndian.Uint32(body[8:]); v != pcaVersion {
+		return fmt.Errorf("unsupported PCA version %d", v)
+	}
+	in := uint64(binary.LittleEndian.Uint32(body[12:]))
+	out := uint64(binary.LittleEndian.Uint32(body[16:]))
+	if in == 0 || out == 0 || out > in || uint64(len(body)-28) != out*8+in*4+in*out*4 {
+		return errors.New("invalid PCA dimensions")
+	}
+
+	*p = PCA{
+		mean:          make([]float32, in),
+		components:    make([]float32, in*out),
+		variances:     make([]float64, out),
+		totalVariance: math.Float64frombits(binary.LittleEndian.Uint64(body[20:])),
+	}
+	offset := 28
+	for i := range p.variances {
+		p.variances[i] = math.Float64frombits(binary.LittleEndian.Uint64(body[offset:]))
+		offset += 8
+	}
+	for i := range p.mean {
+		p.mean[i] = math.Float32frombits(binary.LittleEndian.Uint32(body[offset:]))
+		offset += 4
+	}
+	for i := range p.components {
+		p.components[i] = math.Float32frombits(binary.LittleEndian.Uint32(body[offset:]))
+		offset += 4
+	}
+	return nil
+}
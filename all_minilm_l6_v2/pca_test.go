@@ -0,0 +1,156 @@
+package all_minilm_l6_v2_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+// decayingVectors returns n vectors of dimension dim whose variance along
+// random orthogonal directions decays geometrically.
+func decayingVectors(seed int64, n, dim int) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	rotation := randomRotation(seed, dim)
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		v := make([]float32, dim)
+		for k, axis := range rotation {
+			x := rng.NormFloat64() * math.Pow(0.8, float64(k))
+			for d := range v {
+				v[d] += float32(x * axis[d])
+			}
+		}
+		vectors[i] = v
+	}
+	return vectors
+}
+
+func TestFitPCAKnownCovariance(t *testing.T) {
+	variances := []float64{9, 4, 2, 1, 0.5, 0.25}
+	rotation := randomRotation(5, len(variances))
+	vectors := knownCovarianceData([]float64{1, 2, 3, 4, 5, 6}, rotation, variances)
+
+	pca, err := all_minilm_l6_v2.FitPCA(vectors, 3)
+	if err != nil {
+		t.Fatalf("Failed to fit PCA: %v", err)
+	}
+	if pca.InputDim() != 6 || pca.OutputDim() != 3 {
+		t.Fatalf("Expected a 6 to 3 projection, got %d to %d", pca.InputDim(), pca.OutputDim())
+	}
+	for i, v := range pca.Variances() {
+		if math.Abs(v-variances[i]) > 1e-4 {
+			t.Errorf("Expected variance %f for component %d, got %f", variances[i], i, v)
+		}
+	}
+	for i, ratio := range pca.ExplainedVarianceRatio() {
+		if expected := variances[i] / 16.75; math.Abs(ratio-expected) > 1e-5 {
+			t.Errorf("Expected an explained variance ratio of %f for component %d, got %f", expected, i, ratio)
+		}
+	}
+	for i, c := range pca.Components() {
+		var dot float64
+		for d := range c {
+			dot += float64(c[d]) * rotation[i][d]
+		}
+		if math.Abs(math.Abs(dot)-1) > 1e-4 {
+			t.Errorf("Expected component %d to be ±%v, got %v", i, rotation[i], c)
+		}
+	}
+
+	// The first vector lies on the first axis, which is kept
+	projected, _ := pca.Transform(vectors[0])
+	restored, err := pca.InverseTransform(projected)
+	if err != nil {
+		t.Fatalf("Failed to inverse the projection: %v", err)
+	}
+	for d := range restored {
+		if math.Abs(float64(restored[d]-vectors[0][d])) > 1e-4 {
+			t.Fatalf("Expected %v to be restored, got %v", vectors[0], restored)
+		}
+	}
+
+	if _, err := all_minilm_l6_v2.FitPCA(vectors, 7); err == nil {
+		t.Errorf("Expected an error for more components than dimensions")
+	}
+	if _, err := pca.Transform(make([]float32, 3)); err == nil {
+		t.Errorf("Expected a dimension mismatch error")
+	}
+}
+
+func TestFitPCARandomizedMatchesExact(t *testing.T) {
+	vectors := decayingVectors(6, 800, 64)
+
+	exact, err := all_minilm_l6_v2.FitPCA(vectors, 5, all_minilm_l6_v2.WithPCASolver(all_minilm_l6_v2.ExactPCASolver))
+	if err != nil {
+		t.Fatalf("Failed to fit exact PCA: %v", err)
+	}
+	randomized, err := all_minilm_l6_v2.FitPCA(vectors, 5, all_minilm_l6_v2.WithPCASolver(all_minilm_l6_v2.RandomizedPCASolver))
+	if err != nil {
+		t.Fatalf("Failed to fit randomized PCA: %v", err)
+	}
+
+	exactVariances, randomizedVariances := exact.Variances(), randomized.Variances()
+	exactComponents, randomizedComponents := exact.Components(), randomized.Components()
+	for i := range exactVariances {
+		if math.Abs(randomizedVariances[i]-exactVariances[i]) > 1e-3*exactVariances[i] {
+			t.Errorf("Expected variance %f for component %d, got %f", exactVariances[i], i, randomizedVariances[i])
+		}
+		// Signs are normalized, so the components are equal
+		for d := range exactComponents[i] {
+			if math.Abs(float64(randomizedComponents[i][d]-exactComponents[i][d])) > 1e-2 {
+				t.Fatalf("Expected component %d to be %v, got %v", i, exactComponents[i], randomizedComponents[i])
+			}
+		}
+	}
+
+	again, _ := all_minilm_l6_v2.FitPCA(vectors, 5, all_minilm_l6_v2.WithPCASolver(all_minilm_l6_v2.RandomizedPCASolver))
+	for i, c := range again.Components() {
+		for d := range c {
+			if c[d] != randomizedComponents[i][d] {
+				t.Fatalf("Expected the randomized solver to be deterministic for a fixed seed")
+			}
+		}
+	}
+}
+
+func TestPCAMarshalBinary(t *testing.T) {
+	vectors := randomVectors(7, 50, 8)
+	pca, _ := all_minilm_l6_v2.FitPCA(vectors, 3)
+	data, err := pca.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	var loaded all_minilm_l6_v2.PCA
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	for _, v := range vectors {
+		a, _ := pca.Transform(v)
+		b, err := loaded.Transform(v)
+		if err != nil {
+			t.Fatalf("Failed to transform: %v", err)
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				t.Fatalf("Expected %v, got %v", a, b)
+			}
+		}
+	}
+	ratios, loadedRatios := pca.ExplainedVarianceRatio(), loaded.ExplainedVarianceRatio()
+	for i := range ratios {
+		if ratios[i] != loadedRatios[i] {
+			t.Fatalf("Expected explained variance ratios %v, got %v", ratios, loadedRatios)
+		}
+	}
+
+	for i := range data {
+		corrupted := append([]byte(nil), data...)
+		corrupted[i] ^= 1
+		if err := loaded.UnmarshalBinary(corrupted); err == nil {
+			t.Fatalf("Expected an error with byte %d flipped", i)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package all_minilm_l6_v2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// ScalarQuantizer maps float32 embeddings to int8 codes symmetrically and
+// per dimension: a value x of dimension d gets the code
+// round(x / Scales[d] * 127). Calibrating every dimension on its own range
+// keeps the precision of the dimensions that vary little. Dot scores a float
+// query against codes. The fields are exported so that a calibrated quantizer
+// can be stored next to the codes it produced.
+type ScalarQuantizer struct {
+	// Scales holds, for every dimension, the largest absolute value of the
+	// calibration embeddings, mapped to the code 127.
+	Scales []float32 `json:"scales"`
+}
+
+// CalibrateScalarQuantizer computes the per-dimension ranges of the given
+// embeddings, typically the output of ComputeBatch on a representative sample.
+func CalibrateScalarQuantizer(embeddings [][]float32) (*ScalarQuantizer, error) {
+	if len(embeddings) == 0 {
+		return nil, errors.New("cannot calibrate quantizer without embeddings")
+	}
+
+	q := &ScalarQuantizer{Scales: make([]float32, len(embeddings[0]))}
+	for i, e := range embeddings {
+		if len(e) != len(q.Scales) {
+			return nil, fmt.Errorf("embedding %d has dimension %d, expected %d", i, len(e), len(q.Scales))
+		}
+		for d, v := range e {
+			q.Scales[d] = max(q.Scales[d], float32(math.Abs(float64(v))))
+		}
+	}
+	return q, nil
+}
+
+// Dim returns the dimension of the embeddings.
+func (q *ScalarQuantizer) Dim() int {
+	return len(q.Scales)
+}
+
+// Quantize maps every value of v to [-127, 127]. Values outside of the
+// calibrated range of their dimension are clamped.
+func (q *ScalarQuantizer) Quantize(v []float32) ([]int8, error) {
+	if err := checkDimensions(len(q.Scales), len(v)); err != nil {
+		return nil, err
+	}
+	codes := make([]int8, len(v))
+	for d, x := range v {
+		if q.Scales[d] == 0 {
+			continue
+		}
+		level := math.Round(float64(x / q.Scales[d] * 127))
+		codes[d] = int8(min(max(level, -127), 127))
+	}
+	return codes, nil
+}
+
+// QuantizeBatch quantizes every vector of the batch.
+func (q *ScalarQuantizer) QuantizeBatch(vs [][]float32) ([][]int8, error) {
+	codes := make([][]int8, len(vs))
+	for i, v := range vs {
+		var err error
+		if codes[i], err = q.Quantize(v); err != nil {
+			return nil, fmt.Errorf("failed to quantize vector %d: %w", i, err)
+		}
+	}
+	return codes, nil
+}
+
+// Dequantize approximately reconstructs the float vector a code was produced
+// from.
+func (q *ScalarQuantizer) Dequantize(codes []int8) ([]float32, error) {
+	if err := checkDimensions(len(q.Scales), len(codes)); err != nil {
+		return nil, err
+	}
+	v := make([]float32, len(codes))
+	for d, c := range codes {
+		v[d] = float32(c) / 127 * q.Scales[d]
+	}
+	return v, nil
+}
+
+// Dot computes the dot product of a float query with the embedding codes
+// were produced from, as reconstructed by Dequantize, without allocating.
+// Queries are not quantized, so that only the stored vectors lose precision.
+func (q *ScalarQuantizer) Dot(query []float32, codes []int8) (float32, error) {
+	if err := checkDimensions(len(q.Scales), len(query)); err != nil {
+		return 0, err
+	}
+	if err := checkDimensions(len(q.Scales), len(codes)); err != nil {
+		return 0, err
+	}
+	var dot float32
+	for d, c := range codes {
+		dot += query[d] * q.Scales[d] * float32(c)
+	}
+	return dot / 127, nil
+}
+
+// DotInt8 computes the dot product of two int8 codes. It is proportional to
+// the dot product of the embeddings only when every dimension has the same
+// scale; ScalarQuantizer.Dot accounts for the per-dimension scales. Vectors
+// of different lengths have a dot product of 0.
+func DotInt8(a, b []int8) int32 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot int32
+	for i := range a {
+		dot += int32(a[i]) * int32(b[i])
+	}
+	return dot
+}
+
+// QuantizeBinary keeps the sign of every value of v, packing 64 dimensions
+// per word: bit i%64 of word i/64 is set when v[i] > 0. A 384-dim embedding
+// is stored in 6 words.
+func QuantizeBinary(v []float32) []uint64 {
+	codes := make([]uint64, (len(v)+63)/64)
+	for i, x := range v {
+		if x > 0 {
+			codes[i/64] |= 1 << (i % 64)
+		}
+	}
+	return codes
+}
+
+// QuantizeBinaryBatch binary quantizes every vector of the batch.
+func QuantizeBinaryBatch(vs [][]float32) [][]uint64 {
+	codes := make([][]uint64, len(vs))
+	for i, v := range vs {
+		codes[i] = QuantizeBinary(v)
+	}
+	return codes
+}
+
+// Hamming returns the number of differing bits between two binary codes.
+// Codes of different lengths are at the maximum distance of the longest one.
+func Hamming(a, b []uint64) int {
+	if len(a) != len(b) {
+		return 64 * max(len(a), len(b))
+	}
+
+	distance := 0
+	for i := range a {
+		distance += bits.OnesCount64(a[i] ^ b[i])
+	}
+	return distance
+}
+
+// Neighbor is a vector identified by its index in a collection along with its
+// similarity score to a query.
+type Neighbor struct {
+	Index int
+	Score float64
+}
+
+// Rescore re-ranks candidates, typically the top results of a search over
+// quantized codes, by the cosine similarity between query and their original
+// float vectors. candidates are indices into vectors. It returns at most k
+// neighbors sorted by decreasing score, ties being broken by index. A k of 0
+// or less keeps every candidate.
+func Rescore(query []float32, candidates []int, vectors [][]float32, k int) []Neighbor {
+	neighbors := make([]Neighbor, len(candidates))
+	for i, c := range candidates {
+		neighbors[i] = Neighbor{
+			Index: c,
+			Score: CosineSimilarity(query, vectors[c]),
+		}
+	}
+
+	sortNeighbors(neighbors)
+
+	if k > 0 && k < len(neighbors) {
+		neighbors = neighbors[:k]
+	}
+	return neighbors
+}
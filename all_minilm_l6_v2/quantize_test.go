@@ -0,0 +1,225 @@
+package all_minilm_l6_v2_test
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+// randomVectors generates n pseudo-random vectors of the given dimension
+func randomVectors(seed int64, n, dim int) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for d := range vectors[i] {
+			vectors[i][d] = float32(rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+func TestScalarQuantizerRoundTrip(t *testing.T) {
+	vectors := randomVectors(1, 100, 384)
+
+	q, err := all_minilm_l6_v2.CalibrateScalarQuantizer(vectors)
+	if err != nil {
+		t.Fatalf("Failed to calibrate quantizer: %v", err)
+	}
+
+	// The reconstruction error is at most half the quantization step of the
+	// dimension
+	for i, v := range vectors {
+		codes, err := q.Quantize(v)
+		if err != nil {
+			t.Fatalf("Failed to quantize: %v", err)
+		}
+		restored, err := q.Dequantize(codes)
+		if err != nil {
+			t.Fatalf("Failed to dequantize: %v", err)
+		}
+		for d := range v {
+			step := q.Scales[d] / 127
+			if math.Abs(float64(restored[d]-v[d])) > float64(step)/2+1e-6 {
+				t.Fatalf("Vector %d dim %d: restored %f too far from %f", i, d, restored[d], v[d])
+			}
+		}
+	}
+}
+
+func TestScalarQuantizerClampsOutOfRange(t *testing.T) {
+	q, err := all_minilm_l6_v2.CalibrateScalarQuantizer([][]float32{{0, -1}, {1, 0.5}})
+	if err != nil {
+		t.Fatalf("Failed to calibrate quantizer: %v", err)
+	}
+
+	codes, _ := q.Quantize([]float32{2, -3})
+	if codes[0] != 127 || codes[1] != -127 {
+		t.Errorf("Expected clamped codes [127 -127], got %v", codes)
+	}
+
+	// Every dimension is quantized with its own range
+	codes, _ = q.Quantize([]float32{0.5, 0.5})
+	if codes[0] != 64 || codes[1] != 64 {
+		t.Errorf("Expected per-dimension codes [64 64], got %v", codes)
+	}
+}
+
+func TestScalarQuantizerDimensionMismatch(t *testing.T) {
+	q, _ := all_minilm_l6_v2.CalibrateScalarQuantizer([][]float32{{1, 2}})
+
+	if _, err := q.Quantize([]float32{1, 2, 3}); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected a dimension mismatch quantizing, got %v", err)
+	}
+	if _, err := q.QuantizeBatch([][]float32{{1, 2}, {1}}); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected a dimension mismatch quantizing a batch, got %v", err)
+	}
+	if _, err := q.Dequantize([]int8{1, 2, 3}); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected a dimension mismatch dequantizing, got %v", err)
+	}
+	if _, err := q.Dot([]float32{1}, []int8{1, 2}); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected a dimension mismatch scoring a query, got %v", err)
+	}
+	if _, err := q.Dot([]float32{1, 2}, []int8{1}); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected a dimension mismatch scoring codes, got %v", err)
+	}
+}
+
+func TestCalibrateScalarQuantizerErrors(t *testing.T) {
+	if _, err := all_minilm_l6_v2.CalibrateScalarQuantizer(nil); err == nil {
+		t.Error("Expected an error without embeddings")
+	}
+	if _, err := all_minilm_l6_v2.CalibrateScalarQuantizer([][]float32{{1, 2}, {1}}); err == nil {
+		t.Error("Expected an error on dimension mismatch")
+	}
+}
+
+// embeddingLikeVectors returns unit vectors sharing a common direction, with
+// dimensions of uneven spread and offset, as sentence embeddings do.
+func embeddingLikeVectors(seed int64, n, dim int) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	offsets := make([]float64, dim)
+	spreads := make([]float64, dim)
+	for d := range dim {
+		offsets[d] = 0.05 * rng.NormFloat64()
+		spreads[d] = 0.01 + 0.1*rng.Float64()
+	}
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		v := make([]float32, dim)
+		for d := range v {
+			v[d] = float32(offsets[d] + spreads[d]*rng.NormFloat64())
+		}
+		vectors[i] = normalize(v)
+	}
+	return vectors
+}
+
+func TestScalarQuantizerDotRanksLikeCosine(t *testing.T) {
+	vectors := embeddingLikeVectors(1, 1000, 384)
+	q, err := all_minilm_l6_v2.CalibrateScalarQuantizer(vectors)
+	if err != nil {
+		t.Fatalf("Failed to calibrate quantizer: %v", err)
+	}
+	codes, err := q.QuantizeBatch(vectors)
+	if err != nil {
+		t.Fatalf("Failed to quantize: %v", err)
+	}
+
+	// The top 10 by the dot product of the query with the codes are mostly
+	// the top 10 by cosine
+	dot := func(query, i int) float32 {
+		score, err := q.Dot(vectors[query], codes[i])
+		if err != nil {
+			t.Fatalf("Failed to score: %v", err)
+		}
+		return score
+	}
+	const k = 10
+	found := 0
+	for query := range 20 {
+		byCosine := make([]int, len(vectors))
+		byDot := make([]int, len(vectors))
+		for i := range vectors {
+			byCosine[i], byDot[i] = i, i
+		}
+		sort.SliceStable(byCosine, func(i, j int) bool {
+			return all_minilm_l6_v2.CosineSimilarity(vectors[query], vectors[byCosine[i]]) > all_minilm_l6_v2.CosineSimilarity(vectors[query], vectors[byCosine[j]])
+		})
+		sort.SliceStable(byDot, func(i, j int) bool {
+			return dot(query, byDot[i]) > dot(query, byDot[j])
+		})
+		for _, i := range byDot[:k] {
+			if slices.Contains(byCosine[:k], i) {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / (20 * k); recall < 0.9 {
+		t.Errorf("Expected the quantized ranking to agree with cosine, got a recall of %.2f", recall)
+	}
+}
+
+func TestDotInt8(t *testing.T) {
+	a := []int8{1, -2, 127, -128}
+	b := []int8{3, 4, 127, -128}
+
+	expected := int32(3 - 8 + 127*127 + 128*128)
+	if got := all_minilm_l6_v2.DotInt8(a, b); got != expected {
+		t.Errorf("Expected %d, got %d", expected, got)
+	}
+}
+
+func TestQuantizeBinary(t *testing.T) {
+	v := make([]float32, 130)
+	v[0] = 1
+	v[63] = 0.5
+	v[64] = -1
+	v[129] = 2
+
+	codes := all_minilm_l6_v2.QuantizeBinary(v)
+	if len(codes) != 3 {
+		t.Fatalf("Expected 3 words, got %d", len(codes))
+	}
+	if codes[0] != 1|1<<63 || codes[1] != 0 || codes[2] != 1<<1 {
+		t.Errorf("Unexpected packed codes %b", codes)
+	}
+}
+
+func TestHamming(t *testing.T) {
+	a := []uint64{0b1011, 0}
+	b := []uint64{0b0001, 1 << 63}
+
+	if got := all_minilm_l6_v2.Hamming(a, b); got != 3 {
+		t.Errorf("Expected distance 3, got %d", got)
+	}
+	if got := all_minilm_l6_v2.Hamming(a, a); got != 0 {
+		t.Errorf("Expected distance 0, got %d", got)
+	}
+}
+
+func TestRescore(t *testing.T) {
+	vectors := [][]float32{
+		{1, 0},
+		{0, 1},
+		{1, 1},
+		{1, 1},
+	}
+
+	neighbors := all_minilm_l6_v2.Rescore([]float32{1, 0.9}, []int{0, 1, 3, 2}, vectors, 3)
+
+	expected := []int{2, 3, 0}
+	if len(neighbors) != len(expected) {
+		t.Fatalf("Expected %d neighbors, got %d", len(expected), len(neighbors))
+	}
+	for i, n := range neighbors {
+		if n.Index != expected[i] {
+			t.Errorf("Neighbor %d: expected index %d, got %d", i, expected[i], n.Index)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package all_minilm_l6_v2
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RerankResult is a document scored against a query by a cross-encoder.
+type RerankResult struct {
+	// Index is the position of the document in the slice given to Rerank.
+	Index    int
+	Document string
+	Score    float32
+}
+
+// ComputePairs encodes every (text_a, text_b) pair as a single sequence
+// "[CLS] text_a [SEP] text_b [SEP]" with token_type_ids set to 1 for the
+// second segment, and returns the raw model output for each pair.
+//
+// Special tokens are always added since pair-trained models rely on the [SEP]
+// separator to tell both segments apart.
+func (m *Model) ComputePairs(pairs [][2]string) ([][]float32, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	encodings, err := m.tk.encodePairs(pairs, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize sentence pairs: %w", err)
+	}
+	// The adapter projects sentence embeddings, not the scores of pairs
+	return m.run(encodings)
+}
+
+// Rerank scores every document against the query with a cross-encoder and
+// returns the documents sorted by decreasing score. Ties keep the order of
+// docs.
+//
+// The model must produce a single logit per pair, which is the case of the
+// ms-marco cross-encoders loaded with WithModelPath and WithOutputName("logits").
+func (m *Model) Rerank(query string, docs []string) ([]RerankResult, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	pairs := make([][2]string, len(docs))
+	for i, doc := range docs {
+		pairs[i] = [2]string{query, doc}
+	}
+
+	scores, err := m.ComputePairs(pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RerankResult, len(docs))
+	for i, score := range scores {
+		if len(score) != 1 {
+			return nil, fmt.Errorf("rerank requires a model with a single score output, got %d values", len(score))
+		}
+		results[i] = RerankResult{
+			Index:    i,
+			Document: docs[i],
+			Score:    score[0],
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, nil
+}
@@ -0,0 +1,103 @@
+package all_minilm_l6_v2_test
+
+import (
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+func TestComputePairs(t *testing.T) {
+	model, err := all_minilm_l6_v2.NewModel()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer model.Close()
+
+	pairs := [][2]string{
+		{"How old is the universe?", "The universe is about 13.8 billion years old."},
+		{"The universe is about 13.8 billion years old.", "How old is the universe?"},
+	}
+
+	outputs, err := model.ComputePairs(pairs)
+	if err != nil {
+		t.Fatalf("Failed to compute pairs: %v", err)
+	}
+
+	if len(outputs) != len(pairs) {
+		t.Fatalf("Expected %d outputs, got %d", len(pairs), len(outputs))
+	}
+	for i, output := range outputs {
+		if len(output) != 384 {
+			t.Errorf("Output %d: expected dimension 384, got %d", i, len(output))
+		}
+	}
+
+	// Segment ids differ when the pair is swapped, so should the output
+	if vectorsEqual(outputs[0], outputs[1]) {
+		t.Error("Swapped pairs should produce different outputs")
+	}
+}
+
+func TestComputePairsEmpty(t *testing.T) {
+	model, err := all_minilm_l6_v2.NewModel()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer model.Close()
+
+	outputs, err := model.ComputePairs(nil)
+	if err != nil {
+		t.Fatalf("Failed to compute empty pairs: %v", err)
+	}
+	if outputs != nil {
+		t.Error("Expected nil outputs for empty pairs")
+	}
+}
+
+func TestRerankRequiresScoreOutput(t *testing.T) {
+	model, err := all_minilm_l6_v2.NewModel()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer model.Close()
+
+	// The embedded model outputs 384-dim embeddings, not a relevance score
+	_, err = model.Rerank("query", []string{"a document"})
+	if err == nil {
+		t.Error("Expected an error when reranking with an embedding model")
+	}
+}
+
+func TestComputePairsIgnoresAdapter(t *testing.T) {
+	// A 384 to 1 projection would turn pair outputs into a single score
+	weights := [][]float32{make([]float32, 384)}
+	weights[0][0] = 1
+	adapter, err := all_minilm_l6_v2.NewAdapter(weights)
+	if err != nil {
+		t.Fatalf("Failed to create adapter: %v", err)
+	}
+	model, err := all_minilm_l6_v2.NewModel(all_minilm_l6_v2.WithAdapter(adapter))
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer model.Close()
+
+	outputs, err := model.ComputePairs([][2]string{{"query", "a document"}})
+	if err != nil {
+		t.Fatalf("Failed to compute pairs: %v", err)
+	}
+	if len(outputs[0]) != 384 {
+		t.Errorf("Expected the raw 384-dim output of the pair, got %d values", len(outputs[0]))
+	}
+	if _, err := model.Rerank("query", []string{"a document"}); err == nil {
+		t.Error("Expected the adapter not to turn the pair outputs into scores")
+	}
+
+	embedding, err := model.Compute("query", true)
+	if err != nil {
+		t.Fatalf("Failed to compute embedding: %v", err)
+	}
+	if len(embedding) != 1 {
+		t.Errorf("Expected the adapter to project sentence embeddings, got %d values", len(embedding))
+	}
+}
@@ -0,0 +1,408 @@
+package all_minilm_l6_v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultRouteThreshold is the default similarity from which a text is
+	// routed to a route.
+	DefaultRouteThreshold = 0.5
+	// DefaultRouterTopN is the default number of utterances averaged by
+	// MeanAggregation.
+	DefaultRouterTopN = 3
+)
+
+// Route is a destination of a Router described by example utterances.
+type Route struct {
+	Name       string   `json:"name" yaml:"name"`
+	Utterances []string `json:"utterances" yaml:"utterances"`
+	// Threshold is the similarity from which a text is routed to the route.
+	// Nil means the router's threshold set with WithRouteThreshold.
+	Threshold *float64 `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+}
+
+// Aggregation is the way the similarities between a text and the utterances
+// of a route are combined into the score of the route.
+type Aggregation int
+
+const (
+	// MaxAggregation scores a route with its most similar utterance.
+	MaxAggregation Aggregation = iota
+	// MeanAggregation scores a route with the mean similarity of its top n
+	// most similar utterances, which is less sensitive to a single
+	// misleading utterance.
+	MeanAggregation
+)
+
+// MarshalText encodes the aggregation as "max" or "mean".
+func (a Aggregation) MarshalText() ([]byte, error) {
+	switch a {
+	case MaxAggregation:
+		return []byte("max"), nil
+	case MeanAggregation:
+		return []byte("mean"), nil
+	}
+	return nil, fmt.Errorf("unknown aggregation %d", a)
+}
+
+// UnmarshalText decodes "max" or "mean".
+func (a *Aggregation) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "max":
+		*a = MaxAggregation
+	case "mean":
+		*a = MeanAggregation
+	default:
+		return fmt.Errorf("unknown aggregation %q", text)
+	}
+	return nil
+}
+
+// RouteScore is the score of a route for a text.
+type RouteScore struct {
+	Route string
+	Score float64
+	// Matched reports whether the score reaches the threshold of the route.
+	Matched bool
+}
+
+// RouterConfig is the configuration of a Router, typically loaded from a
+// YAML or JSON file with LoadRouterConfig:
+//
+//	threshold: 0.6
+//	aggregation: mean
+//	top_n: 3
+//	routes:
+//	  - name: billing
+//	    utterances: ["I was charged twice", "Where is my invoice?"]
+//	  - name: chitchat
+//	    threshold: 0.7
+//	    utterances: ["How are you?", "Tell me a joke"]
+//
+// Zero values and a nil threshold mean the defaults.
+type RouterConfig struct {
+	Threshold   *float64    `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	Aggregation Aggregation `json:"aggregation" yaml:"aggregation"`
+	TopN        int         `json:"top_n,omitempty" yaml:"top_n,omitempty"`
+	Routes      []Route     `json:"routes" yaml:"routes"`
+}
+
+// ParseRouterConfig decodes a router configuration in YAML or JSON, JSON
+// being a subset of YAML.
+func ParseRouterConfig(data []byte) (*RouterConfig, error) {
+	var config RouterConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse router config: %w", err)
+	}
+	return &config, nil
+}
+
+// LoadRouterConfig reads a router configuration from a YAML or JSON file.
+func LoadRouterConfig(path string) (*RouterConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read router config: %w", err)
+	}
+	return ParseRouterConfig(data)
+}
+
+// Router routes texts, such as chat messages, to the route whose example
+// utterances they are the most similar to.
+//
+// A Router is safe for concurrent use, including while routes are added or
+// removed.
+type Router struct {
+	embedder    Embedder
+	threshold   float64
+	aggregation Aggregation
+	topN        int
+	batchSize   int
+
+	mu     sync.RWMutex
+	routes []*embeddedRoute
+	dim    int
+}
+
+// embeddedRoute holds the normalized embeddings of the utterances of a
+// route.
+type embeddedRoute struct {
+	route   Route
+	vectors [][]float32
+}
+
+type RouterOption = func(*Router)
+
+// WithRouteThreshold sets the similarity from which a text is routed to the
+// routes having no threshold of their own. It defaults to
+// DefaultRouteThreshold.
+func WithRouteThreshold(score float64) RouterOption {
+	return func(r *Router) {
+		r.threshold = score
+	}
+}
+
+// WithAggregation sets the way utterance similarities are combined into
+// route scores. It defaults to MaxAggregation.
+func WithAggregation(aggregation Aggregation) RouterOption {
+	return func(r *Router) {
+		r.aggregation = aggregation
+	}
+}
+
+// WithRouterTopN sets the number of most similar utterances averaged by
+// MeanAggregation. It defaults to DefaultRouterTopN.
+func WithRouterTopN(n int) RouterOption {
+	return func(r *Router) {
+		r.topN = n
+	}
+}
+
+// WithRouterBatchSize sets the number of texts embedded per call to the
+// embedder. It defaults to DefaultCorpusBatchSize.
+func WithRouterBatchSize(n int) RouterOption {
+	return func(r *Router) {
+		r.batchSize = n
+	}
+}
+
+// NewRouter embeds the utterances of routes in batches and creates a router
+// between them. Routes can also be added later with AddRoutes.
+func NewRouter(ctx context.Context, embedder Embedder, routes []Route, opts ...RouterOption) (*Router, error) {
+	r := &Router{
+		embedder:    embedder,
+		threshold:   DefaultRouteThreshold,
+		aggregation: MaxAggregation,
+		topN:        DefaultRouterTopN,
+		batchSize:   DefaultCorpusBatchSize,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.aggregation != MaxAggregation && r.aggregation != MeanAggregation {
+		return nil, fmt.Errorf("unknown aggregation %d", r.aggregation)
+	}
+	if r.topN <= 0 {
+		return nil, fmt.Errorf("top n must be positive, got %d", r.topN)
+	}
+	if err := r.AddRoutes(ctx, routes...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewRouterFromConfig creates a router from a configuration. opts apply
+// after the configuration and override it.
+func NewRouterFromConfig(ctx context.Context, embedder Embedder, config *RouterConfig, opts ...RouterOption) (*Router, error) {
+	var configOpts []RouterOption
+	if config.Threshold != nil {
+		configOpts = append(configOpts, WithRouteThreshold(*config.Threshold))
+	}
+	if config.TopN != 0 {
+		configOpts = append(configOpts, WithRouterTopN(config.TopN))
+	}
+	configOpts = append(configOpts, WithAggregation(config.Aggregation))
+	return NewRouter(ctx, embedder, config.Routes, append(configOpts, opts...)...)
+}
+
+// AddRoutes embeds the utterances of routes in batches and adds them to the
+// router, replacing the routes having the same names. Either every route is
+// added or none is.
+func (r *Router) AddRoutes(ctx context.Context, routes ...Route) error {
+	var utterances []string
+	seen := make(map[string]bool)
+	for _, route := range routes {
+		if route.Name == "" {
+			return errors.New("route name must not be empty")
+		}
+		if seen[route.Name] {
+			return fmt.Errorf("duplicate route %q", route.Name)
+		}
+		seen[route.Name] = true
+		if len(route.Utterances) == 0 {
+			return fmt.Errorf("route %q has no utterances", route.Name)
+		}
+		utterances = append(utterances, route.Utterances...)
+	}
+
+	embeddings, err := embedAll(ctx, r.embedder, utterances, r.batchSize)
+	if err != nil {
+		return fmt.Errorf("failed to embed utterances: %w", err)
+	}
+	if err := checkBatchDimensions(embeddings, nil); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(embeddings) > 0 {
+		if len(r.routes) > 0 {
+			if err := checkDimensions(r.dim, len(embeddings[0])); err != nil {
+				return err
+			}
+		}
+		r.dim = len(embeddings[0])
+	}
+	for _, route := range routes {
+		embedded := &embeddedRoute{route: cloneRoute(route)}
+		for _, v := range embeddings[:len(route.Utterances)] {
+			embedded.vectors = append(embedded.vectors, vecmath.Normalized(v))
+		}
+		embeddings = embeddings[len(route.Utterances):]
+
+		replaced := false
+		for i, existing := range r.routes {
+			if existing.route.Name == route.Name {
+				r.routes[i], replaced = embedded, true
+				break
+			}
+		}
+		if !replaced {
+			r.routes = append(r.routes, embedded)
+		}
+	}
+	return nil
+}
+
+// RemoveRoute removes the route with the given name and reports whether it
+// was present.
+func (r *Router) RemoveRoute(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.routes {
+		if existing.route.Name == name {
+			r.routes = append(r.routes[:i], r.routes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Routes returns the routes in the order they were added.
+func (r *Router) Routes() []Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	routes := make([]Route, len(r.routes))
+	for i, embedded := range r.routes {
+		routes[i] = cloneRoute(embedded.route)
+	}
+	return routes
+}
+
+// cloneRoute returns a copy of route sharing no memory with it, so that the
+// routes of a router can only be changed under its lock.
+func cloneRoute(route Route) Route {
+	route.Utterances = append([]string(nil), route.Utterances...)
+	if route.Threshold != nil {
+		threshold := *route.Threshold
+		route.Threshold = &threshold
+	}
+	return route
+}
+
+// Route embeds text and returns the score of the route with the highest
+// score among those whose threshold it reaches, and false when there is
+// none.
+func (r *Router) Route(ctx context.Context, text string) (RouteScore, bool, error) {
+	scores, err := r.Scores(ctx, text)
+	if err != nil {
+		return RouteScore{}, false, err
+	}
+	for _, s := range scores {
+		if s.Matched {
+			return s, true, nil
+		}
+	}
+	return RouteScore{}, false, nil
+}
+
+// RouteBatch embeds texts in batches and routes each of them. The name of
+// the route of a text is empty when there is none.
+func (r *Router) RouteBatch(ctx context.Context, texts []string) ([]string, error) {
+	embeddings, err := embedAll(ctx, r.embedder, texts, r.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed texts: %w", err)
+	}
+	routes := make([]string, len(texts))
+	for i, embedding := range embeddings {
+		scores, err := r.ScoreEmbedding(embedding)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range scores {
+			if s.Matched {
+				routes[i] = s.Route
+				break
+			}
+		}
+	}
+	return routes, nil
+}
+
+// Scores embeds text and returns the score of every route by decreasing
+// score.
+func (r *Router) Scores(ctx context.Context, text string) ([]RouteScore, error) {
+	embeddings, err := embedAll(ctx, r.embedder, []string{text}, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed text: %w", err)
+	}
+	return r.ScoreEmbedding(embeddings[0])
+}
+
+// ScoreEmbedding returns the score of every route for a text from its
+// embedding, by decreasing score.
+func (r *Router) ScoreEmbedding(embedding []float32) ([]RouteScore, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.routes) == 0 {
+		return nil, nil
+	}
+	if err := checkDimensions(r.dim, len(embedding)); err != nil {
+		return nil, err
+	}
+	query := vecmath.Normalized(embedding)
+
+	scores := make([]RouteScore, len(r.routes))
+	for i, embedded := range r.routes {
+		similarities := make([]float32, len(embedded.vectors))
+		vecmath.DotBatch(query, embedded.vectors, similarities)
+
+		var score float64
+		switch r.aggregation {
+		case MaxAggregation:
+			score = float64(similarities[0])
+			for _, s := range similarities[1:] {
+				score = max(score, float64(s))
+			}
+		case MeanAggregation:
+			sort.Slice(similarities, func(a, b int) bool { return similarities[a] > similarities[b] })
+			top := similarities[:min(r.topN, len(similarities))]
+			for _, s := range top {
+				score += float64(s)
+			}
+			score /= float64(len(top))
+		}
+
+		threshold := r.threshold
+		if embedded.route.Threshold != nil {
+			threshold = *embedded.route.Threshold
+		}
+		scores[i] = RouteScore{Route: embedded.route.Name, Score: score, Matched: score >= threshold}
+	}
+	sort.SliceStable(scores, func(a, b int) bool {
+		return scores[a].Score > scores[b].Score
+	})
+	return scores, nil
+}
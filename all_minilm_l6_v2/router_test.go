@@ -0,0 +1,281 @@
+package all_minilm_l6_v2_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+var routerEmbedder = fixedEmbedder{
+	"I was charged twice":        {1, 0, 0},
+	"Where is my invoice?":       {0.8, 0.4, 0.447},
+	"How are you?":               {0, 1, 0},
+	"Tell me a joke":             {0, 0.8, 0.6},
+	"Refund the double charge":   {0.96, 0.28, 0},
+	"What is the weather like?":  {0, 0, 1},
+	"Cancel my subscription":     {0, 0.6, 0.8},
+	"Hi, a question on my bill":  {0.5, 0.866, 0},
+	"Please stop billing me":     {0.6, 0, 0.8},
+	"I want to end the contract": {0.1, 0.5, 0.86},
+}
+
+var routerRoutes = []all_minilm_l6_v2.Route{
+	{Name: "billing", Utterances: []string{"I was charged twice", "Where is my invoice?"}},
+	{Name: "chitchat", Utterances: []string{"How are you?", "Tell me a joke"}, Threshold: float64Ptr(0.9)},
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+func TestRouterRoute(t *testing.T) {
+	ctx := context.Background()
+	router, err := all_minilm_l6_v2.NewRouter(ctx, routerEmbedder, routerRoutes)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	route, ok, err := router.Route(ctx, "Refund the double charge")
+	if err != nil {
+		t.Fatalf("Failed to route: %v", err)
+	}
+	if !ok || route.Route != "billing" || math.Abs(route.Score-0.96) > 1e-6 {
+		t.Errorf("Expected billing with a score of 0.96, got %+v (%v)", route, ok)
+	}
+
+	// The best route is below its own threshold, but billing is above the
+	// router's
+	route, ok, _ = router.Route(ctx, "Hi, a question on my bill")
+	if !ok || route.Route != "billing" {
+		t.Errorf("Expected billing, got %+v (%v)", route, ok)
+	}
+	scores, _ := router.Scores(ctx, "Hi, a question on my bill")
+	if len(scores) != 2 || scores[0].Route != "chitchat" || scores[0].Matched || !scores[1].Matched {
+		t.Errorf("Expected an unmatched chitchat then billing, got %+v", scores)
+	}
+
+	if _, ok, _ := router.Route(ctx, "What is the weather like?"); ok {
+		t.Errorf("Expected no route for an unrelated text")
+	}
+
+	routes, err := router.RouteBatch(ctx, []string{"Refund the double charge", "What is the weather like?", "How are you?"})
+	if err != nil {
+		t.Fatalf("Failed to route batch: %v", err)
+	}
+	if routes[0] != "billing" || routes[1] != "" || routes[2] != "chitchat" {
+		t.Errorf("Expected [billing  chitchat], got %q", routes)
+	}
+
+	// A zero threshold is a threshold, not the router's default
+	zeroRoutes := append([]all_minilm_l6_v2.Route(nil), routerRoutes...)
+	zeroRoutes[0].Threshold = float64Ptr(0)
+	router, _ = all_minilm_l6_v2.NewRouter(ctx, routerEmbedder, zeroRoutes)
+	if route, ok, _ := router.Route(ctx, "What is the weather like?"); !ok || route.Route != "billing" {
+		t.Errorf("Expected billing with a zero threshold, got %+v (%v)", route, ok)
+	}
+}
+
+func TestRouterMeanAggregation(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		aggregation all_minilm_l6_v2.Aggregation
+		expected    float64
+	}{
+		{all_minilm_l6_v2.MaxAggregation, 0.96},
+		{all_minilm_l6_v2.MeanAggregation, (0.96 + 0.8*0.96 + 0.4*0.28) / 2},
+	} {
+		router, err := all_minilm_l6_v2.NewRouter(ctx, routerEmbedder, routerRoutes,
+			all_minilm_l6_v2.WithAggregation(test.aggregation),
+			all_minilm_l6_v2.WithRouterTopN(2))
+		if err != nil {
+			t.Fatalf("Failed to create router: %v", err)
+		}
+		scores, _ := router.Scores(ctx, "Refund the double charge")
+		if math.Abs(scores[0].Score-test.expected) > 1e-4 {
+			t.Errorf("Expected a score of %f with aggregation %d, got %f", test.expected, test.aggregation, scores[0].Score)
+		}
+	}
+}
+
+func TestRouterDynamicRoutes(t *testing.T) {
+	ctx := context.Background()
+	embedder := &countingEmbedder{embedder: routerEmbedder}
+	router, err := all_minilm_l6_v2.NewRouter(ctx, embedder, routerRoutes, all_minilm_l6_v2.WithRouterBatchSize(8))
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	if embedder.calls != 1 {
+		t.Errorf("Expected the utterances to be embedded in a single batch, got %d calls", embedder.calls)
+	}
+
+	if err := router.AddRoutes(ctx, all_minilm_l6_v2.Route{
+		Name:       "cancellation",
+		Utterances: []string{"Cancel my subscription", "Please stop billing me"},
+	}); err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+	if route, ok, _ := router.Route(ctx, "I want to end the contract"); !ok || route.Route != "cancellation" {
+		t.Errorf("Expected cancellation, got %+v (%v)", route, ok)
+	}
+
+	// Replacing a route keeps its position
+	if err := router.AddRoutes(ctx, all_minilm_l6_v2.Route{Name: "billing", Utterances: []string{"Where is my invoice?"}}); err != nil {
+		t.Fatalf("Failed to replace route: %v", err)
+	}
+	routes := router.Routes()
+	if len(routes) != 3 || routes[0].Name != "billing" || len(routes[0].Utterances) != 1 {
+		t.Errorf("Expected billing to be replaced in place, got %+v", routes)
+	}
+
+	if !router.RemoveRoute("cancellation") || router.RemoveRoute("cancellation") {
+		t.Errorf("Expected the route to be removed once")
+	}
+	if route, ok, _ := router.Route(ctx, "I want to end the contract"); ok && route.Route == "cancellation" {
+		t.Errorf("Expected the removed route not to match")
+	}
+
+	for _, invalid := range [][]all_minilm_l6_v2.Route{
+		{{Name: "", Utterances: []string{"How are you?"}}},
+		{{Name: "empty"}},
+		{{Name: "twice", Utterances: []string{"How are you?"}}, {Name: "twice", Utterances: []string{"Tell me a joke"}}},
+		{{Name: "unknown", Utterances: []string{"not embedded"}}},
+	} {
+		if err := router.AddRoutes(ctx, invalid...); err == nil {
+			t.Errorf("Expected an error adding %+v", invalid)
+		}
+	}
+	if len(router.Routes()) != 2 {
+		t.Errorf("Expected failed additions to leave the routes unchanged, got %+v", router.Routes())
+	}
+
+	// The router shares no thresholds with callers
+	threshold := 2.0
+	if err := router.AddRoutes(ctx, all_minilm_l6_v2.Route{
+		Name:       "cancellation",
+		Utterances: []string{"Cancel my subscription"},
+		Threshold:  &threshold,
+	}); err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+	threshold = -1
+	*router.Routes()[2].Threshold = -1
+	scores, err := router.Scores(ctx, "Cancel my subscription")
+	if err != nil {
+		t.Fatalf("Failed to score: %v", err)
+	}
+	for _, score := range scores {
+		if score.Route == "cancellation" && score.Matched {
+			t.Errorf("Expected the threshold of the route to be unchanged, got %+v", score)
+		}
+	}
+}
+
+// countingEmbedder counts the calls to an embedder.
+type countingEmbedder struct {
+	embedder all_minilm_l6_v2.Embedder
+	calls    int
+}
+
+func (e *countingEmbedder) ComputeBatch(sentences []string, addSpecialTokens bool) ([][]float32, error) {
+	e.calls++
+	return e.embedder.ComputeBatch(sentences, addSpecialTokens)
+}
+
+func TestRouterConfig(t *testing.T) {
+	ctx := context.Background()
+	yamlConfig := `
+threshold: 0.95
+aggregation: mean
+top_n: 2
+routes:
+  - name: billing
+    utterances: ["I was charged twice", "Where is my invoice?"]
+  - name: chitchat
+    threshold: 0.5
+    utterances:
+      - How are you?
+      - Tell me a joke
+`
+	jsonConfig := `{
+	"threshold": 0.95,
+	"aggregation": "mean",
+	"top_n": 2,
+	"routes": [
+		{"name": "billing", "utterances": ["I was charged twice", "Where is my invoice?"]},
+		{"name": "chitchat", "threshold": 0.5, "utterances": ["How are you?", "Tell me a joke"]}
+	]
+}`
+	dir := t.TempDir()
+	for name, content := range map[string]string{"router.yaml": yamlConfig, "router.json": jsonConfig} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		config, err := all_minilm_l6_v2.LoadRouterConfig(path)
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", name, err)
+		}
+		if config.Aggregation != all_minilm_l6_v2.MeanAggregation || config.TopN != 2 || len(config.Routes) != 2 ||
+			config.Routes[1].Threshold == nil || *config.Routes[1].Threshold != 0.5 || len(config.Routes[1].Utterances) != 2 {
+			t.Fatalf("Unexpected config from %s: %+v", name, config)
+		}
+
+		router, err := all_minilm_l6_v2.NewRouterFromConfig(ctx, routerEmbedder, config)
+		if err != nil {
+			t.Fatalf("Failed to create router from %s: %v", name, err)
+		}
+		// The mean of billing is below the configured threshold
+		if route, ok, _ := router.Route(ctx, "Refund the double charge"); ok {
+			t.Errorf("Expected no route with the config of %s, got %+v", name, route)
+		}
+		if route, ok, _ := router.Route(ctx, "How are you?"); !ok || route.Route != "chitchat" {
+			t.Errorf("Expected chitchat with the config of %s, got %+v (%v)", name, route, ok)
+		}
+
+		// Options override the config
+		router, _ = all_minilm_l6_v2.NewRouterFromConfig(ctx, routerEmbedder, config,
+			all_minilm_l6_v2.WithAggregation(all_minilm_l6_v2.MaxAggregation))
+		if route, ok, _ := router.Route(ctx, "Refund the double charge"); !ok || route.Route != "billing" {
+			t.Errorf("Expected billing with max aggregation, got %+v (%v)", route, ok)
+		}
+	}
+
+	if _, err := all_minilm_l6_v2.ParseRouterConfig([]byte("aggregation: median")); err == nil {
+		t.Errorf("Expected an error for an unknown aggregation")
+	}
+	if _, err := all_minilm_l6_v2.LoadRouterConfig(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+func TestRouterErrors(t *testing.T) {
+	ctx := context.Background()
+	embedder := &bagOfWordsEmbedder{}
+	router, err := all_minilm_l6_v2.NewRouter(ctx, embedder, nil)
+	if err != nil {
+		t.Fatalf("Failed to create an empty router: %v", err)
+	}
+	if _, ok, err := router.Route(ctx, "anything"); ok || err != nil {
+		t.Errorf("Expected no route from an empty router, got %v and %v", ok, err)
+	}
+
+	if err := router.AddRoutes(ctx, all_minilm_l6_v2.Route{Name: "a", Utterances: []string{"hello"}}); err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+	embedder.dim = 32
+	if _, _, err := router.Route(ctx, "hello"); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected a dimension mismatch, got %v", err)
+	}
+	if err := router.AddRoutes(ctx, all_minilm_l6_v2.Route{Name: "b", Utterances: []string{"hello"}}); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected a dimension mismatch, got %v", err)
+	}
+
+	if _, err := all_minilm_l6_v2.NewRouter(ctx, embedder, nil, all_minilm_l6_v2.WithRouterTopN(0)); err == nil {
+		t.Errorf("Expected an error for a zero top n")
+	}
+}
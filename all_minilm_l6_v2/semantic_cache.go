@@ -0,0 +1,494 @@
+package all_minilm_l6_v2
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/index/hnsw"
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// DefaultSemanticCacheCapacity is the default maximum number of entries of a
+// SemanticCache.
+const DefaultSemanticCacheCapacity = 10000
+
+// CacheIndex finds the cached keys most similar to a query. A SemanticCache
+// creates one index per namespace and serializes the calls to it.
+type CacheIndex interface {
+	// Add inserts the vector under the given id.
+	Add(id uint64, vector []float32) error
+	// Delete removes the vector with the given id and reports whether it
+	// was present.
+	Delete(id uint64) bool
+	// Search returns the k vectors most similar to query sorted by
+	// decreasing cosine similarity.
+	Search(query []float32, k int) ([]CacheCandidate, error)
+}
+
+// CacheCandidate is a vector found by CacheIndex.Search along with its cosine
+// similarity to the query.
+type CacheCandidate struct {
+	ID    uint64
+	Score float64
+}
+
+// CacheHit is an entry found by SemanticCache.Get.
+type CacheHit struct {
+	// Key is the text the value was stored under.
+	Key   string
+	Value any
+	// Similarity is the cosine similarity between the embeddings of Key and
+	// the looked up text.
+	Similarity float64
+}
+
+// CacheStats counts the lookups and removals of a SemanticCache.
+type CacheStats struct {
+	Hits   int
+	Misses int
+	// Evictions counts the entries removed to stay within the capacity.
+	Evictions int
+	// Expirations counts the entries removed after their time to live.
+	Expirations int
+	Entries     int
+}
+
+// HitRate returns the share of lookups that were hits, or 0 without lookups.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// SemanticCache stores values under texts, such as the responses of a
+// language model to prompts, and returns them for texts with a similar
+// meaning: a lookup hits when the cosine similarity between the embeddings of
+// the looked up text and of a stored key reaches the threshold.
+//
+// Entries live in namespaces, and lookups only match the keys of their
+// namespace. Entries expire after the time to live set by WithCacheTTL, and
+// the least recently used entries are evicted beyond the capacity.
+//
+// A SemanticCache is safe for concurrent use.
+type SemanticCache struct {
+	embedder  Embedder
+	threshold float64
+	capacity  int
+	ttl       time.Duration
+	now       func() time.Time
+	newIndex  func(dim int) CacheIndex
+
+	mu         sync.Mutex
+	namespaces map[string]*cacheNamespace
+	entries    map[uint64]*cacheEntry
+	// lru holds the entries from the least to the most recently used, and
+	// expiry from the oldest to the newest, which is also their expiration
+	// order since they share the time to live.
+	lru    *list.List
+	expiry *list.List
+	nextID uint64
+	// unknownMisses counts the lookups in namespaces that were never set,
+	// which are not created so that lookups cannot grow the cache.
+	unknownMisses int
+}
+
+type cacheNamespace struct {
+	// index is created with the dimension of the first key.
+	index CacheIndex
+	dim   int
+	keys  map[string]*cacheEntry
+	stats CacheStats
+}
+
+type cacheEntry struct {
+	id        uint64
+	namespace string
+	key       string
+	value     any
+	expires   time.Time
+	lru       *list.Element
+	expiry    *list.Element
+}
+
+type SemanticCacheOption = func(*SemanticCache)
+
+// WithCacheCapacity sets the maximum number of entries across namespaces,
+// beyond which the least recently used entries are evicted. Zero disables
+// the limit. It defaults to DefaultSemanticCacheCapacity.
+func WithCacheCapacity(n int) SemanticCacheOption {
+	return func(c *SemanticCache) {
+		c.capacity = n
+	}
+}
+
+// WithCacheTTL sets the time after which an entry expires, counted from its
+// last Set. Zero, the default, keeps entries until they are evicted.
+func WithCacheTTL(ttl time.Duration) SemanticCacheOption {
+	return func(c *SemanticCache) {
+		c.ttl = ttl
+	}
+}
+
+// WithCacheIndex sets the function creating the index of a namespace for
+// vectors of dimension dim. It defaults to NewFlatCacheIndex.
+func WithCacheIndex(newIndex func(dim int) CacheIndex) SemanticCacheOption {
+	return func(c *SemanticCache) {
+		c.newIndex = newIndex
+	}
+}
+
+// WithCacheClock sets the function returning the current time, which
+// defaults to time.Now.
+func WithCacheClock(now func() time.Time) SemanticCacheOption {
+	return func(c *SemanticCache) {
+		c.now = now
+	}
+}
+
+// NewSemanticCache creates an empty cache embedding keys with embedder and
+// matching them at or above the cosine similarity threshold.
+func NewSemanticCache(embedder Embedder, threshold float64, opts ...SemanticCacheOption) *SemanticCache {
+	c := &SemanticCache{
+		embedder:   embedder,
+		threshold:  threshold,
+		capacity:   DefaultSemanticCacheCapacity,
+		now:        time.Now,
+		newIndex:   NewFlatCacheIndex,
+		namespaces: make(map[string]*cacheNamespace),
+		entries:    make(map[uint64]*cacheEntry),
+		lru:        list.New(),
+		expiry:     list.New(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Get returns the entry of namespace whose key is the most similar to text,
+// if their similarity reaches the threshold, and marks it as recently used.
+func (c *SemanticCache) Get(ctx context.Context, namespace, text string) (CacheHit, bool, error) {
+	vector, err := c.embed(ctx, text)
+	if err != nil {
+		return CacheHit{}, false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired()
+	ns, ok := c.namespaces[namespace]
+	if !ok {
+		c.unknownMisses++
+		return CacheHit{}, false, nil
+	}
+	if err := checkDimensions(ns.dim, len(vector)); err != nil {
+		return CacheHit{}, false, err
+	}
+	candidates, err := ns.index.Search(vector, 1)
+	if err != nil {
+		return CacheHit{}, false, fmt.Errorf("failed to search the cache index: %w", err)
+	}
+	if len(candidates) == 0 || candidates[0].Score < c.threshold {
+		ns.stats.Misses++
+		return CacheHit{}, false, nil
+	}
+	entry, ok := c.entries[candidates[0].ID]
+	if !ok {
+		return CacheHit{}, false, fmt.Errorf("cache index returned unknown id %d", candidates[0].ID)
+	}
+	ns.stats.Hits++
+	c.lru.MoveToBack(entry.lru)
+	return CacheHit{Key: entry.key, Value: entry.value, Similarity: candidates[0].Score}, true, nil
+}
+
+// Set stores value under text in namespace, replacing the value of the same
+// text, and evicts the least recently used entries beyond the capacity.
+func (c *SemanticCache) Set(ctx context.Context, namespace, text string, value any) error {
+	vector, err := c.embed(ctx, text)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired()
+	ns, ok := c.namespaces[namespace]
+	if !ok {
+		ns = &cacheNamespace{index: c.newIndex(len(vector)), dim: len(vector), keys: make(map[string]*cacheEntry)}
+		c.namespaces[namespace] = ns
+	}
+	if err := checkDimensions(ns.dim, len(vector)); err != nil {
+		return err
+	}
+
+	// The previous value is only removed once the new one is indexed, so
+	// that it is kept if indexing fails
+	c.nextID++
+	entry := &cacheEntry{id: c.nextID, namespace: namespace, key: text, value: value}
+	if err := ns.index.Add(entry.id, vector); err != nil {
+		return fmt.Errorf("failed to add to the cache index: %w", err)
+	}
+	if previous, ok := ns.keys[text]; ok {
+		c.remove(previous)
+	}
+	if c.ttl > 0 {
+		entry.expires = c.now().Add(c.ttl)
+	}
+	entry.lru = c.lru.PushBack(entry)
+	entry.expiry = c.expiry.PushBack(entry)
+	c.entries[entry.id] = entry
+	ns.keys[text] = entry
+
+	for c.capacity > 0 && len(c.entries) > c.capacity {
+		oldest := c.lru.Front().Value.(*cacheEntry)
+		c.namespaces[oldest.namespace].stats.Evictions++
+		c.remove(oldest)
+	}
+	return nil
+}
+
+// Delete removes the entry stored under exactly text in namespace and
+// reports whether it was present.
+func (c *SemanticCache) Delete(namespace, text string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ns, ok := c.namespaces[namespace]
+	if !ok {
+		return false
+	}
+	entry, ok := ns.keys[text]
+	if ok {
+		c.remove(entry)
+	}
+	return ok
+}
+
+// Clear removes every entry of namespace along with its statistics.
+func (c *SemanticCache) Clear(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ns, ok := c.namespaces[namespace]
+	if !ok {
+		return
+	}
+	for _, entry := range ns.keys {
+		c.lru.Remove(entry.lru)
+		c.expiry.Remove(entry.expiry)
+		delete(c.entries, entry.id)
+	}
+	delete(c.namespaces, namespace)
+}
+
+// Len returns the number of entries across namespaces, expired ones
+// excluded.
+func (c *SemanticCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired()
+	return len(c.entries)
+}
+
+// Namespaces returns the sorted names of the namespaces holding entries.
+func (c *SemanticCache) Namespaces() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired()
+	var names []string
+	for name, ns := range c.namespaces {
+		if len(ns.keys) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats returns the statistics summed over namespaces.
+func (c *SemanticCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired()
+	stats := CacheStats{Misses: c.unknownMisses}
+	for _, ns := range c.namespaces {
+		stats.Hits += ns.stats.Hits
+		stats.Misses += ns.stats.Misses
+		stats.Evictions += ns.stats.Evictions
+		stats.Expirations += ns.stats.Expirations
+		stats.Entries += len(ns.keys)
+	}
+	return stats
+}
+
+// NamespaceStats returns the statistics of namespace. The misses in a
+// namespace that was never set are only counted by Stats.
+func (c *SemanticCache) NamespaceStats(namespace string) CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired()
+	ns, ok := c.namespaces[namespace]
+	if !ok {
+		return CacheStats{}
+	}
+	stats := ns.stats
+	stats.Entries = len(ns.keys)
+	return stats
+}
+
+func (c *SemanticCache) embed(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := embedAll(ctx, c.embedder, []string{text}, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed key: %w", err)
+	}
+	return vectors[0], nil
+}
+
+// removeExpired removes the entries whose time to live has elapsed.
+func (c *SemanticCache) removeExpired() {
+	if c.ttl <= 0 {
+		return
+	}
+	now := c.now()
+	for c.expiry.Len() > 0 {
+		oldest := c.expiry.Front().Value.(*cacheEntry)
+		if now.Before(oldest.expires) {
+			return
+		}
+		c.namespaces[oldest.namespace].stats.Expirations++
+		c.remove(oldest)
+	}
+}
+
+func (c *SemanticCache) remove(entry *cacheEntry) {
+	ns := c.namespaces[entry.namespace]
+	ns.index.Delete(entry.id)
+	delete(ns.keys, entry.key)
+	delete(c.entries, entry.id)
+	c.lru.Remove(entry.lru)
+	c.expiry.Remove(entry.expiry)
+}
+
+// flatCacheIndex compares the query with every vector.
+type flatCacheIndex struct {
+	ids       []uint64
+	vectors   [][]float32
+	positions map[uint64]int
+}
+
+// NewFlatCacheIndex creates an exact CacheIndex comparing the query with
+// every vector, which is fast enough for up to tens of thousands of entries.
+func NewFlatCacheIndex(dim int) CacheIndex {
+	return &flatCacheIndex{positions: make(map[uint64]int)}
+}
+
+func (idx *flatCacheIndex) Add(id uint64, vector []float32) error {
+	if pos, ok := idx.positions[id]; ok {
+		idx.vectors[pos] = vecmath.Normalized(vector)
+		return nil
+	}
+	idx.positions[id] = len(idx.ids)
+	idx.ids = append(idx.ids, id)
+	idx.vectors = append(idx.vectors, vecmath.Normalized(vector))
+	return nil
+}
+
+func (idx *flatCacheIndex) Delete(id uint64) bool {
+	pos, ok := idx.positions[id]
+	if !ok {
+		return false
+	}
+	last := len(idx.ids) - 1
+	idx.ids[pos], idx.vectors[pos] = idx.ids[last], idx.vectors[last]
+	idx.positions[idx.ids[pos]] = pos
+	idx.ids, idx.vectors = idx.ids[:last], idx.vectors[:last]
+	delete(idx.positions, id)
+	return true
+}
+
+func (idx *flatCacheIndex) Search(query []float32, k int) ([]CacheCandidate, error) {
+	if len(idx.vectors) == 0 || k <= 0 {
+		return nil, nil
+	}
+	if err := checkDimensions(len(idx.vectors[0]), len(query)); err != nil {
+		return nil, err
+	}
+	scores := make([]float32, len(idx.vectors))
+	vecmath.DotBatch(query, idx.vectors, scores)
+	norm := float64(vecmath.Norm(query))
+
+	candidates := make([]CacheCandidate, len(scores))
+	for i, s := range scores {
+		candidates[i] = CacheCandidate{ID: idx.ids[i]}
+		if norm > 0 {
+			candidates[i].Score = float64(s) / norm
+		}
+	}
+	sort.Slice(candidates, func(a, b int) bool {
+		if candidates[a].Score != candidates[b].Score {
+			return candidates[a].Score > candidates[b].Score
+		}
+		return candidates[a].ID < candidates[b].ID
+	})
+	return candidates[:min(k, len(candidates))], nil
+}
+
+// hnswCacheIndex adapts an HNSW index, compacting it once deleted vectors,
+// which the graph keeps, outnumber the live ones.
+type hnswCacheIndex struct {
+	index *hnsw.Index
+}
+
+// NewHNSWCacheIndex returns a function creating approximate CacheIndex
+// backed by an hnsw.Index built with opts, for caches of millions of
+// entries.
+func NewHNSWCacheIndex(opts ...hnsw.Option) func(dim int) CacheIndex {
+	return func(dim int) CacheIndex {
+		return &hnswCacheIndex{index: hnsw.New(dim, opts...)}
+	}
+}
+
+func (idx *hnswCacheIndex) Add(id uint64, vector []float32) error {
+	if err := idx.index.Add(id, vector); err != nil {
+		return err
+	}
+	idx.compact()
+	return nil
+}
+
+func (idx *hnswCacheIndex) Delete(id uint64) bool {
+	if !idx.index.Delete(id) {
+		return false
+	}
+	idx.compact()
+	return true
+}
+
+func (idx *hnswCacheIndex) compact() {
+	if idx.index.Deleted() > max(idx.index.Len(), 1000) {
+		idx.index.Compact()
+	}
+}
+
+func (idx *hnswCacheIndex) Search(query []float32, k int) ([]CacheCandidate, error) {
+	results, err := idx.index.Search(query, k)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]CacheCandidate, len(results))
+	for i, r := range results {
+		candidates[i] = CacheCandidate{ID: r.ID, Score: float64(r.Score)}
+	}
+	return candidates, nil
+}
@@ -0,0 +1,232 @@
+package all_minilm_l6_v2_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/index/hnsw"
+)
+
+func cacheGet(t *testing.T, cache *all_minilm_l6_v2.SemanticCache, namespace, text string) (all_minilm_l6_v2.CacheHit, bool) {
+	t.Helper()
+
+	hit, ok, err := cache.Get(context.Background(), namespace, text)
+	if err != nil {
+		t.Fatalf("Failed to get %q: %v", text, err)
+	}
+	return hit, ok
+}
+
+func cacheSet(t *testing.T, cache *all_minilm_l6_v2.SemanticCache, namespace, text string, value any) {
+	t.Helper()
+
+	if err := cache.Set(context.Background(), namespace, text, value); err != nil {
+		t.Fatalf("Failed to set %q: %v", text, err)
+	}
+}
+
+func TestSemanticCacheGet(t *testing.T) {
+	for name, index := range map[string]func(int) all_minilm_l6_v2.CacheIndex{
+		"flat": all_minilm_l6_v2.NewFlatCacheIndex,
+		"hnsw": all_minilm_l6_v2.NewHNSWCacheIndex(hnsw.WithSeed(1)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			cache := all_minilm_l6_v2.NewSemanticCache(&bagOfWordsEmbedder{dim: 256}, 0.9,
+				all_minilm_l6_v2.WithCacheIndex(index))
+			cacheSet(t, cache, "", "what is the capital of france", "Paris")
+			cacheSet(t, cache, "", "how do i bake bread at home", "Knead, proof, bake")
+
+			hit, ok := cacheGet(t, cache, "", "what is the capital of france ?")
+			if !ok || hit.Value != "Paris" || hit.Key != "what is the capital of france" {
+				t.Fatalf("Expected a hit on Paris, got %+v (%v)", hit, ok)
+			}
+			if hit.Similarity < 0.9 || hit.Similarity > 1+1e-6 {
+				t.Errorf("Expected a similarity between 0.9 and 1, got %f", hit.Similarity)
+			}
+			if _, ok := cacheGet(t, cache, "", "what is the capital of germany"); ok {
+				t.Errorf("Expected a miss below the threshold")
+			}
+
+			stats := cache.Stats()
+			if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 2 || stats.HitRate() != 0.5 {
+				t.Errorf("Expected 1 hit, 1 miss and 2 entries, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestSemanticCacheNamespaces(t *testing.T) {
+	cache := all_minilm_l6_v2.NewSemanticCache(&bagOfWordsEmbedder{}, 0.9)
+	cacheSet(t, cache, "gpt", "summarize this article", "summary by gpt")
+	cacheSet(t, cache, "claude", "summarize this article", "summary by claude")
+
+	for _, namespace := range []string{"gpt", "claude"} {
+		hit, ok := cacheGet(t, cache, namespace, "summarize this article")
+		if !ok || hit.Value != "summary by "+namespace {
+			t.Errorf("Expected the value of namespace %s, got %+v", namespace, hit)
+		}
+	}
+	if _, ok := cacheGet(t, cache, "other", "summarize this article"); ok {
+		t.Errorf("Expected a miss in another namespace")
+	}
+	// Lookups do not create namespaces, their misses being counted globally
+	if stats := cache.NamespaceStats("other"); stats.Misses != 0 || stats.Entries != 0 {
+		t.Errorf("Expected no statistics for the other namespace, got %+v", stats)
+	}
+	if stats := cache.Stats(); stats.Misses != 1 {
+		t.Errorf("Expected the miss in the other namespace to be counted, got %+v", stats)
+	}
+	if names := cache.Namespaces(); fmt.Sprint(names) != "[claude gpt]" {
+		t.Errorf("Expected namespaces [claude gpt], got %v", names)
+	}
+
+	cacheSet(t, cache, "gpt", "summarize this article", "new summary")
+	if hit, _ := cacheGet(t, cache, "gpt", "summarize this article"); hit.Value != "new summary" {
+		t.Errorf("Expected the replaced value, got %v", hit.Value)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.Len())
+	}
+
+	if !cache.Delete("gpt", "summarize this article") || cache.Delete("gpt", "summarize this article") {
+		t.Errorf("Expected the entry to be deleted once")
+	}
+	cache.Clear("claude")
+	if cache.Len() != 0 || len(cache.Namespaces()) != 0 {
+		t.Errorf("Expected an empty cache, got %d entries in %v", cache.Len(), cache.Namespaces())
+	}
+}
+
+func TestSemanticCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := all_minilm_l6_v2.NewSemanticCache(&bagOfWordsEmbedder{}, 0.9,
+		all_minilm_l6_v2.WithCacheTTL(time.Minute),
+		all_minilm_l6_v2.WithCacheClock(func() time.Time { return now }))
+
+	cacheSet(t, cache, "", "first question", 1)
+	now = now.Add(30 * time.Second)
+	cacheSet(t, cache, "", "second question", 2)
+	now = now.Add(30 * time.Second)
+
+	if _, ok := cacheGet(t, cache, "", "first question"); ok {
+		t.Errorf("Expected the first entry to have expired")
+	}
+	if _, ok := cacheGet(t, cache, "", "second question"); !ok {
+		t.Errorf("Expected the second entry to be alive")
+	}
+
+	// Setting again restarts the time to live
+	cacheSet(t, cache, "", "second question", 3)
+	now = now.Add(59 * time.Second)
+	if hit, ok := cacheGet(t, cache, "", "second question"); !ok || hit.Value != 3 {
+		t.Errorf("Expected the refreshed entry, got %+v (%v)", hit, ok)
+	}
+	now = now.Add(time.Second)
+	if cache.Len() != 0 {
+		t.Errorf("Expected every entry to have expired, got %d", cache.Len())
+	}
+	if stats := cache.Stats(); stats.Expirations != 2 {
+		t.Errorf("Expected 2 expirations, got %+v", stats)
+	}
+}
+
+func TestSemanticCacheLRU(t *testing.T) {
+	cache := all_minilm_l6_v2.NewSemanticCache(&bagOfWordsEmbedder{}, 0.9,
+		all_minilm_l6_v2.WithCacheCapacity(2))
+	cacheSet(t, cache, "a", "alpha", 1)
+	cacheSet(t, cache, "b", "beta", 2)
+	cacheGet(t, cache, "a", "alpha")
+	cacheSet(t, cache, "a", "gamma", 3)
+
+	if _, ok := cacheGet(t, cache, "b", "beta"); ok {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+	for _, text := range []string{"alpha", "gamma"} {
+		if _, ok := cacheGet(t, cache, "a", text); !ok {
+			t.Errorf("Expected %q to be kept", text)
+		}
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("Expected 1 eviction and 2 entries, got %+v", stats)
+	}
+}
+
+func TestSemanticCacheHNSWDeletes(t *testing.T) {
+	embedder := fixedEmbedder{}
+	for i, v := range randomVectors(10, 3000, 32) {
+		embedder[fmt.Sprint(i)] = v
+	}
+
+	// Evicted entries stay in the graph as deleted vectors that must not
+	// hide the live ones, until thousands of them compact the graph
+	for _, n := range []int{500, 3000} {
+		cache := all_minilm_l6_v2.NewSemanticCache(embedder, 0.99,
+			all_minilm_l6_v2.WithCacheCapacity(100),
+			all_minilm_l6_v2.WithCacheIndex(all_minilm_l6_v2.NewHNSWCacheIndex(hnsw.WithSeed(1), hnsw.WithEfSearch(1))))
+		for i := range n {
+			cacheSet(t, cache, "", fmt.Sprint(i), i)
+		}
+		for i := range n {
+			hit, ok := cacheGet(t, cache, "", fmt.Sprint(i))
+			if kept := i >= n-100; ok != kept || (kept && hit.Value != i) {
+				t.Fatalf("Expected entry %d of %d to be kept: %v, got %+v (%v)", i, n, kept, hit, ok)
+			}
+		}
+	}
+}
+
+func TestSemanticCacheErrors(t *testing.T) {
+	embedder := &bagOfWordsEmbedder{}
+	cache := all_minilm_l6_v2.NewSemanticCache(embedder, 0.9)
+	cacheSet(t, cache, "", "text", 1)
+
+	embedder.dim = 32
+	if _, _, err := cache.Get(context.Background(), "", "text"); !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected a dimension mismatch, got %v", err)
+	}
+
+	embedder.err = errors.New("boom")
+	if err := cache.Set(context.Background(), "", "text", 1); err == nil {
+		t.Errorf("Expected the embedder error")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := cache.Get(ctx, "", "text"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// failingCacheIndex fails to add vectors once fail is set.
+type failingCacheIndex struct {
+	all_minilm_l6_v2.CacheIndex
+	fail bool
+}
+
+func (idx *failingCacheIndex) Add(id uint64, vector []float32) error {
+	if idx.fail {
+		return errors.New("index full")
+	}
+	return idx.CacheIndex.Add(id, vector)
+}
+
+func TestSemanticCacheKeepsValueOnFailedSet(t *testing.T) {
+	index := &failingCacheIndex{}
+	cache := all_minilm_l6_v2.NewSemanticCache(&bagOfWordsEmbedder{}, 0.9,
+		all_minilm_l6_v2.WithCacheIndex(func(dim int) all_minilm_l6_v2.CacheIndex {
+			index.CacheIndex = all_minilm_l6_v2.NewFlatCacheIndex(dim)
+			return index
+		}))
+	cacheSet(t, cache, "", "text", 1)
+
+	index.fail = true
+	if err := cache.Set(context.Background(), "", "text", 2); err == nil {
+		t.Fatalf("Expected the index error")
+	}
+	if hit, ok := cacheGet(t, cache, "", "text"); !ok || hit.Value != 1 {
+		t.Errorf("Expected the previous value to be kept, got %+v (%v)", hit, ok)
+	}
+}
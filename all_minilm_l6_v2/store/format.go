@@ -0,0 +1,177 @@
+// Package store persists embeddings in a flat file that can be memory-mapped
+// and searched without copying or decoding the vectors.
+//
+// # File format
+//
+// All integers are little-endian. The file starts with a 4096-byte header:
+//
+//	offset  size  field
+//	0       8     magic "MINILMVS"
+//	8       4     format version, currently 1
+//	12      4     dimension of the vectors
+//	16      4     dtype of the vectors, 1 for float32
+//	20      4     reserved, zero
+//	24      8     capacity, the number of vectors the file has room for
+//	32      32    model fingerprint, the SHA-256 of the ONNX model
+//	64      4     CRC-32C of bytes 0 to 64
+//	128     64    commit slot 0
+//	192     64    commit slot 1
+//
+// followed by the vector region, capacity × dimension float32 values padded to
+// a multiple of 8 bytes, and the id table, capacity uint64 ids. The i-th id is
+// the id of the i-th vector.
+//
+// A commit slot records how many vectors are committed:
+//
+//	offset  size  field
+//	0       8     sequence number of the commit
+//	8       8     count, the number of committed vectors
+//	16      4     CRC-32C of the first count vectors
+//	20      4     CRC-32C of the first count ids
+//	24      4     CRC-32C of bytes 0 to 24 of the slot
+//
+// The valid slot with the highest sequence number is the current commit, so
+// that a slot torn by a crash falls back to the previous commit. The writer
+// only writes past the committed vectors and syncs them before updating the
+// slot that is not current, which makes partially written appends invisible.
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	magic   = "MINILMVS"
+	version = 1
+
+	// DTypeFloat32 is the dtype of float32 vectors, the only one supported.
+	DTypeFloat32 = 1
+
+	headerSize     = 4096
+	staticSize     = 64
+	slotOffset     = 128
+	slotSize       = 64
+	slotFieldsSize = 24
+)
+
+var (
+	// ErrCorrupted is returned when the header or the checksums of a file do
+	// not match its content.
+	ErrCorrupted = errors.New("corrupted vector store")
+	// ErrDimensionMismatch is returned when a vector does not have the
+	// dimension of the store.
+	ErrDimensionMismatch = errors.New("dimension mismatch")
+	// ErrFingerprintMismatch is returned when the vectors of a store were
+	// produced by a different model.
+	ErrFingerprintMismatch = errors.New("model fingerprint mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type header struct {
+	dim         int
+	capacity    int
+	fingerprint [32]byte
+}
+
+type commit struct {
+	seq        uint64
+	count      int
+	vectorsCRC uint32
+	idsCRC     uint32
+}
+
+func (h header) vectorsOffset() int64 {
+	return headerSize
+}
+
+// idsOffset is padded to a multiple of 8 bytes so that the ids are aligned.
+func (h header) idsOffset() int64 {
+	return headerSize + (int64(h.capacity)*int64(h.dim)*4+7)&^7
+}
+
+func (h header) fileSize() int64 {
+	return h.idsOffset() + int64(h.capacity)*8
+}
+
+func (h header) encode() []byte {
+	buf := make([]byte, staticSize+4)
+	copy(buf, magic)
+	binary.LittleEndian.PutUint32(buf[8:], version)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(h.dim))
+	binary.LittleEndian.PutUint32(buf[16:], DTypeFloat32)
+	binary.LittleEndian.PutUint64(buf[24:], uint64(h.capacity))
+	copy(buf[32:64], h.fingerprint[:])
+	binary.LittleEndian.PutUint32(buf[staticSize:], crc32.Checksum(buf[:staticSize], castagnoli))
+	return buf
+}
+
+func decodeHeader(buf []byte) (header, error) {
+	var h header
+	if len(buf) < staticSize+4 || string(buf[:8]) != magic {
+		return h, fmt.Errorf("%w: not a vector store", ErrCorrupted)
+	}
+	if crc32.Checksum(buf[:staticSize], castagnoli) != binary.LittleEndian.Uint32(buf[staticSize:]) {
+		return h, fmt.Errorf("%w: header checksum mismatch", ErrCorrupted)
+	}
+	if v := binary.LittleEndian.Uint32(buf[8:]); v != version {
+		return h, fmt.Errorf("unsupported vector store version %d", v)
+	}
+	if dtype := binary.LittleEndian.Uint32(buf[16:]); dtype != DTypeFloat32 {
+		return h, fmt.Errorf("unsupported vector store dtype %d", dtype)
+	}
+
+	h.dim = int(binary.LittleEndian.Uint32(buf[12:]))
+	h.capacity = int(binary.LittleEndian.Uint64(buf[24:]))
+	copy(h.fingerprint[:], buf[32:64])
+	return h, nil
+}
+
+func (c commit) encode() []byte {
+	buf := make([]byte, slotSize)
+	binary.LittleEndian.PutUint64(buf[0:], c.seq)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(c.count))
+	binary.LittleEndian.PutUint32(buf[16:], c.vectorsCRC)
+	binary.LittleEndian.PutUint32(buf[20:], c.idsCRC)
+	binary.LittleEndian.PutUint32(buf[slotFieldsSize:], crc32.Checksum(buf[:slotFieldsSize], castagnoli))
+	return buf
+}
+
+// currentCommit returns the valid commit slot with the highest sequence
+// number of the header.
+func currentCommit(buf []byte, h header) (commit, error) {
+	var current commit
+	found := false
+	for i := range 2 {
+		slot := buf[slotOffset+i*slotSize : slotOffset+(i+1)*slotSize]
+		if crc32.Checksum(slot[:slotFieldsSize], castagnoli) != binary.LittleEndian.Uint32(slot[slotFieldsSize:]) {
+			continue
+		}
+		c := commit{
+			seq:        binary.LittleEndian.Uint64(slot[0:]),
+			count:      int(binary.LittleEndian.Uint64(slot[8:])),
+			vectorsCRC: binary.LittleEndian.Uint32(slot[16:]),
+			idsCRC:     binary.LittleEndian.Uint32(slot[20:]),
+		}
+		if c.count > h.capacity {
+			continue
+		}
+		if !found || c.seq > current.seq {
+			current, found = c, true
+		}
+	}
+	if !found {
+		return current, fmt.Errorf("%w: no valid commit", ErrCorrupted)
+	}
+	return current, nil
+}
+
+// slotFor returns the offset of the slot a commit with the given sequence
+// number is written to, which alternates so that the current commit is never
+// overwritten.
+func slotFor(seq uint64) int64 {
+	return slotOffset + int64(seq%2)*slotSize
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"unsafe"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+// littleEndian reports whether the vectors can be used in place, the file
+// being little-endian.
+var littleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// Result is a vector found by Search along with its cosine similarity to the
+// query.
+type Result struct {
+	ID    uint64
+	Score float32
+}
+
+// Reader gives access to the vectors committed to a store file when it was
+// opened. The file is memory-mapped so opening is instantaneous whatever its
+// size, and the vectors are used in place.
+//
+// A Reader is safe for concurrent use. Slices it returns must not be used
+// after Close.
+type Reader struct {
+	data   []byte
+	unmap  func() error
+	header header
+	commit commit
+
+	vectors []float32
+	ids     []uint64
+}
+
+// Open memory-maps the store file at path. Only the header is validated; use
+// Verify to check the vectors and ids against their checksums.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vector store: %w", err)
+	}
+	defer f.Close()
+
+	data, unmap, err := mapFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map vector store: %w", err)
+	}
+
+	r, err := newReader(data, unmap)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	return r, nil
+}
+
+func newReader(data []byte, unmap func() error) (*Reader, error) {
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%w: file too short", ErrCorrupted)
+	}
+	h, err := decodeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) < h.fileSize() {
+		return nil, fmt.Errorf("%w: file is %d bytes, expected %d", ErrCorrupted, len(data), h.fileSize())
+	}
+	c, err := currentCommit(data, h)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{
+		data:   data,
+		unmap:  unmap,
+		header: h,
+		commit: c,
+	}
+
+	vectorBytes := data[h.vectorsOffset() : h.vectorsOffset()+int64(c.count)*int64(h.dim)*4]
+	idBytes := data[h.idsOffset() : h.idsOffset()+int64(c.count)*8]
+	if c.count == 0 {
+		return r, nil
+	}
+
+	if littleEndian {
+		r.vectors = unsafe.Slice((*float32)(unsafe.Pointer(&vectorBytes[0])), c.count*h.dim)
+		r.ids = unsafe.Slice((*uint64)(unsafe.Pointer(&idBytes[0])), c.count)
+	} else {
+		r.vectors = make([]float32, c.count*h.dim)
+		for i := range r.vectors {
+			r.vectors[i] = math.Float32frombits(binary.LittleEndian.Uint32(vectorBytes[i*4:]))
+		}
+		r.ids = make([]uint64, c.count)
+		for i := range r.ids {
+			r.ids[i] = binary.LittleEndian.Uint64(idBytes[i*8:])
+		}
+	}
+	return r, nil
+}
+
+// Close unmaps the file.
+func (r *Reader) Close() error {
+	r.vectors, r.ids = nil, nil
+	return r.unmap()
+}
+
+// Len returns the number of vectors.
+func (r *Reader) Len() int {
+	return r.commit.count
+}
+
+// Dim returns the dimension of the vectors.
+func (r *Reader) Dim() int {
+	return r.header.dim
+}
+
+// Fingerprint returns the fingerprint of the model that produced the vectors.
+func (r *Reader) Fingerprint() [32]byte {
+	return r.header.fingerprint
+}
+
+// CheckFingerprint returns ErrFingerprintMismatch if the vectors were not
+// produced by the model with the given fingerprint.
+func (r *Reader) CheckFingerprint(fingerprint [32]byte) error {
+	if r.header.fingerprint != fingerprint {
+		return fmt.Errorf("%w: store was written with model %x, got %x", ErrFingerprintMismatch, r.header.fingerprint[:8], fingerprint[:8])
+	}
+	return nil
+}
+
+// Vector returns the i-th vector. The slice points into the mapped file and
+// must not be modified.
+func (r *Reader) Vector(i int) []float32 {
+	return r.vectors[i*r.header.dim : (i+1)*r.header.dim : (i+1)*r.header.dim]
+}
+
+// ID returns the id of the i-th vector.
+func (r *Reader) ID(i int) uint64 {
+	return r.ids[i]
+}
+
+// Verify checks the vectors and ids against the checksums of the commit.
+func (r *Reader) Verify() error {
+	h, c := r.header, r.commit
+	vectorBytes := r.data[h.vectorsOffset() : h.vectorsOffset()+int64(c.count)*int64(h.dim)*4]
+	if crc32.Checksum(vectorBytes, castagnoli) != c.vectorsCRC {
+		return fmt.Errorf("%w: vectors checksum mismatch", ErrCorrupted)
+	}
+	idBytes := r.data[h.idsOffset() : h.idsOffset()+int64(c.count)*8]
+	if crc32.Checksum(idBytes, castagnoli) != c.idsCRC {
+		return fmt.Errorf("%w: ids checksum mismatch", ErrCorrupted)
+	}
+	return nil
+}
+
+// Search scans every vector and returns the k most similar to query sorted
+// by decreasing cosine similarity, ties being broken by position in the file.
+func (r *Reader) Search(query []float32, k int) ([]Result, error) {
+	if len(query) != r.header.dim {
+		return nil, fmt.Errorf("%w: %d != %d", ErrDimensionMismatch, len(query), r.header.dim)
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+
+	best := &resultHeap{}
+	for i := range r.commit.count {
+		s := scoredPosition{position: i, score: vecmath.Cosine(query, r.Vector(i))}
+		if best.Len() < k {
+			heap.Push(best, s)
+		} else if best.less((*best)[0], s) {
+			(*best)[0] = s
+			heap.Fix(best, 0)
+		}
+	}
+
+	results := make([]Result, best.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		s := heap.Pop(best).(scoredPosition)
+		results[i] = Result{ID: r.ids[s.position], Score: s.score}
+	}
+	return results, nil
+}
+
+type scoredPosition struct {
+	position int
+	score    float32
+}
+
+// resultHeap is a min-heap keeping the worst of the best results at the root.
+type resultHeap []scoredPosition
+
+func (h resultHeap) less(a, b scoredPosition) bool {
+	if a.score != b.score {
+		return a.score < b.score
+	}
+	return a.position > b.position
+}
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x any)        { *h = append(*h, x.(scoredPosition)) }
+
+func (h *resultHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
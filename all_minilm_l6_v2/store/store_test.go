@@ -0,0 +1,232 @@
+package store_test
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/store"
+)
+
+func randomVectors(seed int64, n, dim int) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for d := range vectors[i] {
+			vectors[i][d] = float32(rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+func writeStore(t *testing.T, path string, vectors [][]float32, opts ...store.WriterOption) {
+	t.Helper()
+
+	w, err := store.Create(path, len(vectors[0]), opts...)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	for i, v := range vectors {
+		if err := w.Append(uint64(1000+i), v); err != nil {
+			t.Fatalf("Failed to append vector %d: %v", i, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+}
+
+func openStore(t *testing.T, path string) *store.Reader {
+	t.Helper()
+
+	r, err := store.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func checkContent(t *testing.T, r *store.Reader, vectors [][]float32) {
+	t.Helper()
+
+	if r.Len() != len(vectors) {
+		t.Fatalf("Expected %d vectors, got %d", len(vectors), r.Len())
+	}
+	for i, v := range vectors {
+		if r.ID(i) != uint64(1000+i) {
+			t.Errorf("Vector %d: expected id %d, got %d", i, 1000+i, r.ID(i))
+		}
+		got := r.Vector(i)
+		for d := range v {
+			if got[d] != v[d] {
+				t.Fatalf("Vector %d differs at %d: %f != %f", i, d, got[d], v[d])
+			}
+		}
+	}
+	if err := r.Verify(); err != nil {
+		t.Errorf("Failed to verify store: %v", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.bin")
+	vectors := randomVectors(1, 100, 384)
+	fingerprint := [32]byte{1, 2, 3}
+
+	// A small capacity makes the file grow several times
+	writeStore(t, path, vectors, store.WithFingerprint(fingerprint), store.WithCapacity(7))
+
+	r := openStore(t, path)
+	if r.Dim() != 384 {
+		t.Errorf("Expected dimension 384, got %d", r.Dim())
+	}
+	checkContent(t, r, vectors)
+
+	if err := r.CheckFingerprint(fingerprint); err != nil {
+		t.Errorf("Unexpected fingerprint error: %v", err)
+	}
+	if err := r.CheckFingerprint([32]byte{4}); !errors.Is(err, store.ErrFingerprintMismatch) {
+		t.Errorf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+}
+
+func TestReopenAndAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.bin")
+	vectors := randomVectors(2, 30, 16)
+	writeStore(t, path, vectors[:10])
+
+	w, err := store.OpenWriter(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen writer: %v", err)
+	}
+	for i := 10; i < len(vectors); i++ {
+		if err := w.Append(uint64(1000+i), vectors[i]); err != nil {
+			t.Fatalf("Failed to append vector %d: %v", i, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	checkContent(t, openStore(t, path), vectors)
+}
+
+func TestUncommittedVectorsAreInvisible(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.bin")
+	vectors := randomVectors(3, 20, 8)
+
+	w, err := store.Create(path, 8)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer w.Close()
+
+	for i, v := range vectors[:5] {
+		_ = w.Append(uint64(1000+i), v)
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	// Simulate a crash in the middle of an append
+	for i, v := range vectors[5:] {
+		_ = w.Append(uint64(1005+i), v)
+	}
+
+	checkContent(t, openStore(t, path), vectors[:5])
+}
+
+func TestTornCommitFallsBackToPreviousCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.bin")
+	vectors := randomVectors(4, 10, 8)
+
+	w, err := store.Create(path, 8)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	for i, v := range vectors[:4] {
+		_ = w.Append(uint64(1000+i), v)
+	}
+	_ = w.Commit()
+	for i, v := range vectors[4:] {
+		_ = w.Append(uint64(1004+i), v)
+	}
+	_ = w.Close()
+
+	// The creation is commit 1 and the two commits above are 2 and 3, so
+	// the latest commit lives in slot 1 at offset 192
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	_, _ = f.WriteAt([]byte{0xff, 0xff, 0xff}, 192+10)
+	f.Close()
+
+	checkContent(t, openStore(t, path), vectors[:4])
+}
+
+func TestVerifyDetectsCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.bin")
+	writeStore(t, path, randomVectors(5, 10, 8))
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	_, _ = f.WriteAt([]byte{0x42}, 4096+17)
+	f.Close()
+
+	r := openStore(t, path)
+	if err := r.Verify(); !errors.Is(err, store.ErrCorrupted) {
+		t.Errorf("Expected ErrCorrupted, got %v", err)
+	}
+}
+
+func TestOpenRejectsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	notAStore := filepath.Join(dir, "garbage.bin")
+	_ = os.WriteFile(notAStore, make([]byte, 8192), 0o644)
+	if _, err := store.Open(notAStore); !errors.Is(err, store.ErrCorrupted) {
+		t.Errorf("Expected ErrCorrupted, got %v", err)
+	}
+
+	truncated := filepath.Join(dir, "truncated.bin")
+	writeStore(t, truncated, randomVectors(6, 10, 8))
+	_ = os.Truncate(truncated, 4096+100)
+	if _, err := store.Open(truncated); !errors.Is(err, store.ErrCorrupted) {
+		t.Errorf("Expected ErrCorrupted, got %v", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.bin")
+	vectors := randomVectors(7, 200, 32)
+	writeStore(t, path, vectors)
+
+	r := openStore(t, path)
+	results, err := r.Search(vectors[42], 5)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+
+	if len(results) != 5 {
+		t.Fatalf("Expected 5 results, got %d", len(results))
+	}
+	if results[0].ID != 1042 {
+		t.Errorf("Expected the vector itself first, got %d", results[0].ID)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("Results not sorted at %d", i)
+		}
+	}
+
+	if _, err := r.Search([]float32{1}, 5); !errors.Is(err, store.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}
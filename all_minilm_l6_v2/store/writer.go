@@ -0,0 +1,315 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCapacity is the number of vectors a new file has room for before it
+// needs to grow.
+const DefaultCapacity = 1024
+
+type writerOptions struct {
+	fingerprint [32]byte
+	capacity    int
+}
+
+type WriterOption = func(*writerOptions)
+
+// WithFingerprint records the fingerprint of the model that produced the
+// vectors, typically Model.Fingerprint().
+func WithFingerprint(fingerprint [32]byte) WriterOption {
+	return func(o *writerOptions) {
+		o.fingerprint = fingerprint
+	}
+}
+
+// WithCapacity sets the initial number of vectors the file has room for.
+func WithCapacity(n int) WriterOption {
+	return func(o *writerOptions) {
+		o.capacity = n
+	}
+}
+
+// Writer appends vectors to a store file. Appended vectors become visible to
+// readers opening the file once committed.
+//
+// A Writer is not safe for concurrent use and a file must have a single
+// writer at a time.
+type Writer struct {
+	f      *os.File
+	path   string
+	header header
+
+	committed commit
+	// count and the checksums cover every appended vector, committed or not.
+	count      int
+	vectorsCRC uint32
+	idsCRC     uint32
+}
+
+// Create creates a store file for vectors of the given dimension, replacing
+// any existing file at path. The file is created under a temporary name and
+// renamed once its header is durable.
+func Create(path string, dim int, opts ...WriterOption) (*Writer, error) {
+	options := writerOptions{
+		capacity: DefaultCapacity,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if dim <= 0 {
+		return nil, fmt.Errorf("invalid dimension: %d", dim)
+	}
+
+	h := header{
+		dim:         dim,
+		capacity:    max(options.capacity, 1),
+		fingerprint: options.fingerprint,
+	}
+	f, err := createFile(path, h, commit{seq: 1})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		f:         f,
+		path:      path,
+		header:    h,
+		committed: commit{seq: 1},
+	}, nil
+}
+
+// OpenWriter opens an existing store file to append vectors to it. Vectors
+// appended but not committed before a crash are discarded.
+func OpenWriter(path string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vector store: %w", err)
+	}
+
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: failed to read header: %v", ErrCorrupted, err)
+	}
+	h, err := decodeHeader(buf)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	c, err := currentCommit(buf, h)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Writer{
+		f:          f,
+		path:       path,
+		header:     h,
+		committed:  c,
+		count:      c.count,
+		vectorsCRC: c.vectorsCRC,
+		idsCRC:     c.idsCRC,
+	}, nil
+}
+
+// Dim returns the dimension of the vectors of the store.
+func (w *Writer) Dim() int {
+	return w.header.dim
+}
+
+// Len returns the number of vectors appended, committed or not.
+func (w *Writer) Len() int {
+	return w.count
+}
+
+// Append appends a vector with its id.
+func (w *Writer) Append(id uint64, vector []float32) error {
+	return w.AppendBatch([]uint64{id}, [][]float32{vector})
+}
+
+// AppendBatch appends vectors with their ids, ids[i] being the id of
+// vectors[i].
+func (w *Writer) AppendBatch(ids []uint64, vectors [][]float32) error {
+	if len(ids) != len(vectors) {
+		return fmt.Errorf("got %d ids for %d vectors", len(ids), len(vectors))
+	}
+	if len(vectors) == 0 {
+		return nil
+	}
+	for _, v := range vectors {
+		if len(v) != w.header.dim {
+			return fmt.Errorf("%w: %d != %d", ErrDimensionMismatch, len(v), w.header.dim)
+		}
+	}
+
+	if w.count+len(vectors) > w.header.capacity {
+		if err := w.grow(w.count + len(vectors)); err != nil {
+			return err
+		}
+	}
+
+	vectorBytes := make([]byte, 0, len(vectors)*w.header.dim*4)
+	for _, v := range vectors {
+		for _, x := range v {
+			vectorBytes = binary.LittleEndian.AppendUint32(vectorBytes, math.Float32bits(x))
+		}
+	}
+	idBytes := make([]byte, 0, len(ids)*8)
+	for _, id := range ids {
+		idBytes = binary.LittleEndian.AppendUint64(idBytes, id)
+	}
+
+	vectorsAt := w.header.vectorsOffset() + int64(w.count)*int64(w.header.dim)*4
+	if _, err := w.f.WriteAt(vectorBytes, vectorsAt); err != nil {
+		return fmt.Errorf("failed to write vectors: %w", err)
+	}
+	if _, err := w.f.WriteAt(idBytes, w.header.idsOffset()+int64(w.count)*8); err != nil {
+		return fmt.Errorf("failed to write ids: %w", err)
+	}
+
+	w.vectorsCRC = crc32.Update(w.vectorsCRC, castagnoli, vectorBytes)
+	w.idsCRC = crc32.Update(w.idsCRC, castagnoli, idBytes)
+	w.count += len(vectors)
+	return nil
+}
+
+// Commit makes the appended vectors durable and visible to readers opening
+// the file afterwards.
+func (w *Writer) Commit() error {
+	if w.count == w.committed.count {
+		return nil
+	}
+
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync vectors: %w", err)
+	}
+
+	c := commit{
+		seq:        w.committed.seq + 1,
+		count:      w.count,
+		vectorsCRC: w.vectorsCRC,
+		idsCRC:     w.idsCRC,
+	}
+	if _, err := w.f.WriteAt(c.encode(), slotFor(c.seq)); err != nil {
+		return fmt.Errorf("failed to write commit: %w", err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync commit: %w", err)
+	}
+
+	w.committed = c
+	return nil
+}
+
+// Close commits the appended vectors and closes the file.
+func (w *Writer) Close() error {
+	return errors.Join(w.Commit(), w.f.Close())
+}
+
+// grow moves the store to a new file with room for at least n vectors. The
+// new file is written next to the current one and renamed over it, so that a
+// crash leaves either file intact.
+func (w *Writer) grow(n int) error {
+	h := w.header
+	h.capacity = max(2*h.capacity, n)
+
+	tmpPath := w.path + ".grow"
+	f, err := createFileAt(tmpPath, h, w.committed)
+	if err != nil {
+		return err
+	}
+
+	copyRegion := func(from, to, size int64) error {
+		_, err := io.Copy(io.NewOffsetWriter(f, to), io.NewSectionReader(w.f, from, size))
+		return err
+	}
+	err = errors.Join(
+		copyRegion(w.header.vectorsOffset(), h.vectorsOffset(), int64(w.count)*int64(h.dim)*4),
+		copyRegion(w.header.idsOffset(), h.idsOffset(), int64(w.count)*8),
+	)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = rename(tmpPath, w.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to grow vector store: %w", err)
+	}
+
+	w.f.Close()
+	w.f = f
+	w.header = h
+	return nil
+}
+
+// createFile writes a new store file under a temporary name and renames it to
+// path.
+func createFile(path string, h header, c commit) (*os.File, error) {
+	tmpPath := path + ".tmp"
+	f, err := createFileAt(tmpPath, h, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := rename(tmpPath, path); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to create vector store: %w", err)
+	}
+	return f, nil
+}
+
+// createFileAt creates a file holding the header and commit, with room for
+// the capacity of the header. The regions are left sparse.
+func createFileAt(path string, h header, c commit) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vector store: %w", err)
+	}
+
+	err = f.Truncate(h.fileSize())
+	if err == nil {
+		_, err = f.WriteAt(h.encode(), 0)
+	}
+	if err == nil {
+		_, err = f.WriteAt(c.encode(), slotFor(c.seq))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write vector store header: %w", err)
+	}
+	return f, nil
+}
+
+// rename atomically replaces newPath by oldPath and syncs the parent
+// directory so that the rename survives a crash.
+func rename(oldPath, newPath string) error {
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(newPath))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	// Syncing a directory is not supported on every platform, in which case
+	// the rename is as durable as it can be.
+	_ = dir.Sync()
+	return nil
+}
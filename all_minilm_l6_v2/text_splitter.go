@@ -0,0 +1,337 @@
+package all_minilm_l6_v2
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultChunkSize is the default number of tokens of the chunks of a
+// TextSplitter, the window of the model.
+const DefaultChunkSize = 128
+
+// TextChunk is a part of a text split by a TextSplitter.
+type TextChunk struct {
+	Text string
+	// Start and End are the byte offsets of the chunk in the source text,
+	// so that Text is text[Start:End].
+	Start, End int
+	// Tokens is the number of tokens of Text, special tokens included.
+	Tokens int
+}
+
+// TextSplitter splits documents into chunks that fit in the window of the
+// model. Texts are split into paragraphs and sentences, the sentences that
+// are too long into words, and the words that are still too long at token
+// boundaries. Consecutive pieces are then merged into chunks of at most the
+// chunk size, counted with the special tokens, each chunk starting with the
+// last pieces of the previous one, usually sentences, up to the overlap.
+type TextSplitter struct {
+	tk        *Tokenizer
+	chunkSize int
+	overlap   int
+	// specialTokens is the number of special tokens added to each chunk.
+	specialTokens int
+}
+
+type TextSplitterOption = func(*TextSplitter)
+
+// WithChunkSize sets the maximum number of tokens of a chunk, special tokens
+// included. It defaults to DefaultChunkSize.
+func WithChunkSize(n int) TextSplitterOption {
+	return func(s *TextSplitter) {
+		s.chunkSize = n
+	}
+}
+
+// WithChunkOverlap sets the maximum number of tokens a chunk repeats from
+// the end of the previous one. It defaults to 0.
+func WithChunkOverlap(n int) TextSplitterOption {
+	return func(s *TextSplitter) {
+		s.overlap = n
+	}
+}
+
+// NewTextSplitter returns a splitter counting tokens with tk, usually the
+// tokenizer of the model embedding the chunks.
+func NewTextSplitter(tk *Tokenizer, opts ...TextSplitterOption) (*TextSplitter, error) {
+	s := &TextSplitter{
+		tk:        tk,
+		chunkSize: DefaultChunkSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	specialTokens, err := tk.CountTokens("", true)
+	if err != nil {
+		return nil, err
+	}
+	s.specialTokens = specialTokens
+	if s.chunkSize <= specialTokens {
+		return nil, fmt.Errorf("chunk size must be larger than the %d special tokens", specialTokens)
+	}
+	if s.overlap < 0 || s.overlap >= s.chunkSize-specialTokens {
+		return nil, errors.New("chunk overlap must not be negative and must leave room in the chunks")
+	}
+	return s, nil
+}
+
+// textSpan is the byte range [start, end) of a text.
+type textSpan struct {
+	start, end int
+}
+
+// Split splits text into chunks of at most the chunk size, in order. Texts
+// made of whitespace only have no chunks.
+func (s *TextSplitter) Split(text string) ([]TextChunk, error) {
+	pieces, err := s.split(text, textSpan{0, len(text)}, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []TextChunk
+	for first := 0; first < len(pieces); {
+		// Extend the chunk with the following pieces while it fits
+		last := first
+		tokens, err := s.count(text, pieces[first].start, pieces[first].end, true)
+		if err != nil {
+			return nil, err
+		}
+		for last+1 < len(pieces) {
+			n, err := s.count(text, pieces[first].start, pieces[last+1].end, true)
+			if err != nil {
+				return nil, err
+			}
+			if n > s.chunkSize {
+				break
+			}
+			last, tokens = last+1, n
+		}
+		start, end := pieces[first].start, pieces[last].end
+		chunks = append(chunks, TextChunk{Text: text[start:end], Start: start, End: end, Tokens: tokens})
+		if last == len(pieces)-1 {
+			break
+		}
+
+		// Start the next chunk with the last pieces of this one that fit in
+		// the overlap and leave room for the next piece
+		next := last + 1
+		for j := last; j > first; j-- {
+			n, err := s.count(text, pieces[j].start, pieces[last].end, false)
+			if err != nil {
+				return nil, err
+			}
+			if n > s.overlap {
+				break
+			}
+			n, err = s.count(text, pieces[j].start, pieces[last+1].end, true)
+			if err != nil {
+				return nil, err
+			}
+			if n > s.chunkSize {
+				break
+			}
+			next = j
+		}
+		first = next
+	}
+	return chunks, nil
+}
+
+func (s *TextSplitter) count(text string, start, end int, addSpecialTokens bool) (int, error) {
+	return s.tk.CountTokens(text[start:end], addSpecialTokens)
+}
+
+// textSeparators split a span into paragraphs, sentences and words.
+var textSeparators = []func(text string, span textSpan) []textSpan{
+	splitParagraphs,
+	splitSentences,
+	splitWords,
+}
+
+// wordLevel is the level of splitWords in textSeparators.
+const wordLevel = 2
+
+// split appends to pieces the trimmed sentences of span, splitting those
+// that do not fit in a chunk with textSeparators[level:] then at token
+// boundaries.
+func (s *TextSplitter) split(text string, span textSpan, level int, pieces []textSpan) ([]textSpan, error) {
+	span = trimSpan(text, span)
+	if span.start == span.end {
+		return pieces, nil
+	}
+	n, err := s.count(text, span.start, span.end, true)
+	if err != nil {
+		return nil, err
+	}
+	// Spans are always split into sentences so that chunks overlap by whole
+	// sentences, and into words only when they do not fit
+	levels := len(textSeparators)
+	if n <= s.chunkSize {
+		levels = wordLevel
+	}
+	for ; level < levels; level++ {
+		parts := textSeparators[level](text, span)
+		if len(parts) < 2 {
+			continue
+		}
+		for _, part := range parts {
+			pieces, err = s.split(text, part, level+1, pieces)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return pieces, nil
+	}
+	if n <= s.chunkSize {
+		return append(pieces, span), nil
+	}
+	return s.splitTokens(text, span, pieces)
+}
+
+// splitTokens appends to pieces the parts of a span without whitespace,
+// cut at the offsets of its tokens.
+func (s *TextSplitter) splitTokens(text string, span textSpan, pieces []textSpan) ([]textSpan, error) {
+	for span.start < span.end {
+		n, err := s.count(text, span.start, span.end, true)
+		if err != nil {
+			return nil, err
+		}
+		if n <= s.chunkSize {
+			return append(pieces, span), nil
+		}
+
+		encoding, err := s.tk.Encode(text[span.start:span.end], false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to tokenize: %w", err)
+		}
+		// The encoding is truncated to the window of the model, which
+		// leaves enough tokens to fill a chunk no larger than it
+		cut := 0
+		for k := min(s.chunkSize-s.specialTokens, len(encoding.Offsets)-1); k > 0 && cut == 0; k-- {
+			offset := span.start + encoding.Offsets[k][0]
+			if encoding.AttentionMask[k] == 0 || offset <= span.start || offset >= span.end {
+				continue
+			}
+			n, err := s.count(text, span.start, offset, true)
+			if err != nil {
+				return nil, err
+			}
+			if n <= s.chunkSize {
+				cut = offset
+			}
+		}
+		if cut == 0 {
+			// Fall back to a character boundary, each character being at
+			// most a token
+			cut = span.start + runeCut(text[span.start:span.end], s.chunkSize-s.specialTokens)
+		}
+		pieces = append(pieces, textSpan{span.start, cut})
+		span.start = cut
+	}
+	return pieces, nil
+}
+
+// runeCut returns the offset of the n-th rune of text, or of its last rune
+// when it is shorter.
+func runeCut(text string, n int) int {
+	offset := 0
+	for i := 0; i < n; i++ {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		if offset+size == len(text) {
+			break
+		}
+		offset += size
+	}
+	return offset
+}
+
+func trimSpan(text string, span textSpan) textSpan {
+	part := text[span.start:span.end]
+	trimmed := strings.TrimLeftFunc(part, unicode.IsSpace)
+	span.start += len(part) - len(trimmed)
+	span.end = span.start + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+	return span
+}
+
+// splitParagraphs splits span at the runs of whitespace holding at least two
+// line breaks.
+func splitParagraphs(text string, span textSpan) []textSpan {
+	var parts []textSpan
+	start := span.start
+	for i := span.start; i < span.end; {
+		r, size := utf8.DecodeRuneInString(text[i:span.end])
+		if !unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+		j, lineBreaks := i, 0
+		for j < span.end {
+			r, size := utf8.DecodeRuneInString(text[j:span.end])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			if r == '\n' {
+				lineBreaks++
+			}
+			j += size
+		}
+		if lineBreaks >= 2 {
+			parts = append(parts, textSpan{start, i})
+			start = j
+		}
+		i = j
+	}
+	return append(parts, textSpan{start, span.end})
+}
+
+// splitSentences splits span after the terminal punctuation followed by
+// whitespace, or after the ideographic one.
+func splitSentences(text string, span textSpan) []textSpan {
+	var parts []textSpan
+	start := span.start
+	for i := span.start; i < span.end; {
+		r, size := utf8.DecodeRuneInString(text[i:span.end])
+		i += size
+		if !strings.ContainsRune(".!?…。！？", r) {
+			continue
+		}
+		ideographic := strings.ContainsRune("。！？", r)
+		// Keep the following terminal punctuation and closing quotes or
+		// brackets in the sentence
+		for i < span.end {
+			r, size := utf8.DecodeRuneInString(text[i:span.end])
+			if !strings.ContainsRune(".!?…。！？\"')]}”’»」』", r) {
+				break
+			}
+			i += size
+		}
+		if r, _ := utf8.DecodeRuneInString(text[i:span.end]); i < span.end && (ideographic || unicode.IsSpace(r)) {
+			parts = append(parts, textSpan{start, i})
+			start = i
+		}
+	}
+	return append(parts, textSpan{start, span.end})
+}
+
+// splitWords splits span at whitespace.
+func splitWords(text string, span textSpan) []textSpan {
+	var parts []textSpan
+	start := -1
+	for i, r := range text[span.start:span.end] {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			parts = append(parts, textSpan{start, span.start + i})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = span.start + i
+		}
+	}
+	if start >= 0 {
+		parts = append(parts, textSpan{start, span.end})
+	}
+	return parts
+}
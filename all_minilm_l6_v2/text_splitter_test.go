@@ -0,0 +1,197 @@
+package all_minilm_l6_v2_test
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+func TestCountTokens(t *testing.T) {
+	reference, wordPiece := newTokenizers(t)
+
+	for _, tk := range []*all_minilm_l6_v2.Tokenizer{reference, wordPiece} {
+		if n, err := tk.CountTokens("Hello, World!", false); err != nil || n != 4 {
+			t.Errorf("Expected 4 tokens, got %d and %v", n, err)
+		}
+		if n, _ := tk.CountTokens("Hello, World!", true); n != 6 {
+			t.Errorf("Expected 6 tokens with special tokens, got %d", n)
+		}
+		// Counts are not truncated to the window of the model
+		if n, _ := tk.CountTokens(strings.Repeat("word ", 300), true); n != 302 {
+			t.Errorf("Expected 302 tokens, got %d", n)
+		}
+		if n, _ := tk.CountTokens("", false); n != 0 {
+			t.Errorf("Expected no tokens for an empty text, got %d", n)
+		}
+	}
+}
+
+// checkChunks checks that the chunks fit, point at their source text and
+// cover all of it in order.
+func checkChunks(t *testing.T, tk *all_minilm_l6_v2.Tokenizer, text string, chunks []all_minilm_l6_v2.TextChunk, size int) {
+	t.Helper()
+
+	covered := 0
+	for i, chunk := range chunks {
+		if chunk.Text != text[chunk.Start:chunk.End] {
+			t.Fatalf("Expected chunk %d to be the text at [%d, %d), got %q", i, chunk.Start, chunk.End, chunk.Text)
+		}
+		if n, _ := tk.CountTokens(chunk.Text, true); n != chunk.Tokens || n > size {
+			t.Fatalf("Expected chunk %d to have %d <= %d tokens, got %d", i, n, size, chunk.Tokens)
+		}
+		if chunk.Text != strings.TrimSpace(chunk.Text) || chunk.Text == "" {
+			t.Fatalf("Expected chunk %d to be trimmed, got %q", i, chunk.Text)
+		}
+		if strings.TrimSpace(text[covered:max(covered, chunk.Start)]) != "" {
+			t.Fatalf("Expected chunk %d to follow the previous one, got a gap before %d", i, chunk.Start)
+		}
+		if i > 0 && (chunk.Start <= chunks[i-1].Start || chunk.End <= chunks[i-1].End) {
+			t.Fatalf("Expected chunk %d to move forward, got [%d, %d) after [%d, %d)", i, chunk.Start, chunk.End, chunks[i-1].Start, chunks[i-1].End)
+		}
+		covered = chunk.End
+	}
+	if strings.TrimSpace(text[covered:]) != "" {
+		t.Fatalf("Expected the chunks to cover the text, got %q left", text[covered:])
+	}
+}
+
+func TestTextSplitter(t *testing.T) {
+	_, tk := newTokenizers(t)
+
+	var b strings.Builder
+	for i := range 12 {
+		b.WriteString("Embeddings map sentences to vectors. Similar sentences get close vectors! ")
+		b.WriteString("Is the cosine similarity enough? It usually is, for short texts.")
+		if i%3 == 2 {
+			b.WriteString("\n\n")
+		} else {
+			b.WriteString(" ")
+		}
+	}
+	text := b.String()
+
+	splitter, err := all_minilm_l6_v2.NewTextSplitter(tk, all_minilm_l6_v2.WithChunkSize(48), all_minilm_l6_v2.WithChunkOverlap(12))
+	if err != nil {
+		t.Fatalf("Failed to create splitter: %v", err)
+	}
+	chunks, err := splitter.Split(text)
+	if err != nil {
+		t.Fatalf("Failed to split: %v", err)
+	}
+	if len(chunks) < 5 {
+		t.Fatalf("Expected the text to be split, got %d chunks", len(chunks))
+	}
+	checkChunks(t, tk, text, chunks, 48)
+
+	for i := 1; i < len(chunks); i++ {
+		prev, chunk := chunks[i-1], chunks[i]
+		if chunk.Start >= prev.End {
+			t.Errorf("Expected chunk %d to overlap the previous one", i)
+			continue
+		}
+		// The overlap is made of whole sentences
+		overlap := text[chunk.Start:prev.End]
+		if n, _ := tk.CountTokens(overlap, false); n > 12 {
+			t.Errorf("Expected at most 12 overlapping tokens, got %d in %q", n, overlap)
+		}
+		if !strings.ContainsAny(overlap[len(overlap)-1:], ".!?") || !unicode.IsUpper(rune(overlap[0])) {
+			t.Errorf("Expected the overlap to be made of sentences, got %q", overlap)
+		}
+	}
+
+	// Without overlap, chunks are separated
+	splitter, _ = all_minilm_l6_v2.NewTextSplitter(tk, all_minilm_l6_v2.WithChunkSize(48))
+	chunks, _ = splitter.Split(text)
+	checkChunks(t, tk, text, chunks, 48)
+	for i := 1; i < len(chunks); i++ {
+		if chunks[i].Start < chunks[i-1].End {
+			t.Errorf("Expected chunk %d not to overlap the previous one", i)
+		}
+	}
+}
+
+func TestTextSplitterParagraphs(t *testing.T) {
+	_, tk := newTokenizers(t)
+
+	paragraphs := []string{
+		"The first paragraph is short.",
+		"The second one is short too, and fits along with the first.",
+		"A third paragraph that is too long for the remaining room of the chunk starts a new one.",
+	}
+	text := strings.Join(paragraphs, "\n\n")
+	splitter, _ := all_minilm_l6_v2.NewTextSplitter(tk, all_minilm_l6_v2.WithChunkSize(40), all_minilm_l6_v2.WithChunkOverlap(4))
+	chunks, err := splitter.Split(text)
+	if err != nil {
+		t.Fatalf("Failed to split: %v", err)
+	}
+	if len(chunks) != 2 || chunks[0].Text != paragraphs[0]+"\n\n"+paragraphs[1] || chunks[1].Text != paragraphs[2] {
+		t.Fatalf("Expected the paragraphs to be kept whole, got %+v", chunks)
+	}
+	if chunks[1].Start != strings.Index(text, paragraphs[2]) || chunks[1].End != len(text) {
+		t.Errorf("Expected the offsets of the last paragraph, got [%d, %d)", chunks[1].Start, chunks[1].End)
+	}
+
+	if chunks, _ := splitter.Split(" \n\t "); len(chunks) != 0 {
+		t.Errorf("Expected no chunks for whitespace, got %+v", chunks)
+	}
+}
+
+func TestTextSplitterOverlapsParagraphs(t *testing.T) {
+	_, tk := newTokenizers(t)
+
+	// Paragraphs fit in a chunk but not in the overlap, which is made of
+	// their last sentences
+	var paragraphs []string
+	for range 6 {
+		paragraphs = append(paragraphs, "Vectors encode meaning. Close vectors mean close texts. Chunks overlap by sentences.")
+	}
+	text := strings.Join(paragraphs, "\n\n")
+	splitter, _ := all_minilm_l6_v2.NewTextSplitter(tk, all_minilm_l6_v2.WithChunkSize(48), all_minilm_l6_v2.WithChunkOverlap(12))
+	chunks, err := splitter.Split(text)
+	if err != nil {
+		t.Fatalf("Failed to split: %v", err)
+	}
+	checkChunks(t, tk, text, chunks, 48)
+	for i := 1; i < len(chunks); i++ {
+		if chunks[i].Start >= chunks[i-1].End {
+			t.Errorf("Expected chunk %d to overlap the previous one", i)
+		}
+	}
+}
+
+func TestTextSplitterLongWords(t *testing.T) {
+	reference, wordPiece := newTokenizers(t)
+
+	// Words longer than a chunk are cut at token boundaries, whatever the
+	// tokenizer and even beyond the window of the model
+	text := "Before " + strings.Repeat("中", 300) + " " + strings.Repeat("a.", 200) + " after"
+	for _, tk := range []*all_minilm_l6_v2.Tokenizer{reference, wordPiece} {
+		for _, size := range []int{8, 128, 200} {
+			splitter, err := all_minilm_l6_v2.NewTextSplitter(tk, all_minilm_l6_v2.WithChunkSize(size), all_minilm_l6_v2.WithChunkOverlap(2))
+			if err != nil {
+				t.Fatalf("Failed to create splitter: %v", err)
+			}
+			chunks, err := splitter.Split(text)
+			if err != nil {
+				t.Fatalf("Failed to split: %v", err)
+			}
+			checkChunks(t, tk, text, chunks, size)
+		}
+	}
+}
+
+func TestTextSplitterOptions(t *testing.T) {
+	_, tk := newTokenizers(t)
+
+	if _, err := all_minilm_l6_v2.NewTextSplitter(tk, all_minilm_l6_v2.WithChunkSize(2)); err == nil {
+		t.Errorf("Expected an error for chunks without room for tokens")
+	}
+	if _, err := all_minilm_l6_v2.NewTextSplitter(tk, all_minilm_l6_v2.WithChunkSize(10), all_minilm_l6_v2.WithChunkOverlap(8)); err == nil {
+		t.Errorf("Expected an error for an overlap filling the chunks")
+	}
+	if _, err := all_minilm_l6_v2.NewTextSplitter(tk, all_minilm_l6_v2.WithChunkOverlap(-1)); err == nil {
+		t.Errorf("Expected an error for a negative overlap")
+	}
+}
@@ -3,17 +3,122 @@ package all_minilm_l6_v2
 import (
 	"bytes"
 	"fmt"
+	"os"
 
 	"github.com/sugarme/tokenizer"
 	"github.com/sugarme/tokenizer/pretrained"
 )
 
-type Tokenizer struct {
+// textEncoder turns texts into the encodings fed to the model. It is
+// implemented by the sugarme tokenizer and by the pure Go WordPiece
+// tokenizer.
+type textEncoder interface {
+	encode(text string, addSpecialTokens bool) (*tokenizer.Encoding, error)
+	encodeBatch(texts []string, addSpecialTokens bool) ([]tokenizer.Encoding, error)
+	encodePairs(pairs [][2]string, addSpecialTokens bool) ([]tokenizer.Encoding, error)
+	decode(ids []int, skipSpecialTokens bool) string
+	// countTokens counts the tokens of text, ignoring truncation and
+	// padding.
+	countTokens(text string, addSpecialTokens bool) (int, error)
+}
+
+// readTokenizer reads the tokenizer.json at path, or returns the embedded one
+// when path is empty.
+func readTokenizer(path string) ([]byte, error) {
+	if path == "" {
+		return embeddedTokenizer, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer: %w", err)
+	}
+	return data, nil
+}
+
+// newTextEncoder loads the tokenizer.json data.
+func newTextEncoder(data []byte, wordPiece bool) (textEncoder, error) {
+	if wordPiece {
+		return newWordPieceTokenizer(data)
+	}
+	tk, err := pretrained.FromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	counter := *tk
+	counter.WithTruncation(nil)
+	counter.WithPadding(nil)
+	return sugarmeEncoder{tk: tk, counter: &counter}, nil
+}
+
+type sugarmeEncoder struct {
 	tk *tokenizer.Tokenizer
+	// counter is a copy of tk without truncation nor padding.
+	counter *tokenizer.Tokenizer
+}
+
+func (e sugarmeEncoder) encode(text string, addSpecialTokens bool) (*tokenizer.Encoding, error) {
+	return e.tk.EncodeSingle(text, addSpecialTokens)
+}
+
+func (e sugarmeEncoder) encodeBatch(texts []string, addSpecialTokens bool) ([]tokenizer.Encoding, error) {
+	inputBatch := make([]tokenizer.EncodeInput, 0, len(texts))
+	for _, s := range texts {
+		inputBatch = append(inputBatch, tokenizer.NewSingleEncodeInput(tokenizer.NewRawInputSequence(s)))
+	}
+	return e.tk.EncodeBatch(inputBatch, addSpecialTokens)
+}
+
+func (e sugarmeEncoder) encodePairs(pairs [][2]string, addSpecialTokens bool) ([]tokenizer.Encoding, error) {
+	inputBatch := make([]tokenizer.EncodeInput, 0, len(pairs))
+	for _, p := range pairs {
+		inputBatch = append(inputBatch, tokenizer.NewDualEncodeInput(
+			tokenizer.NewRawInputSequence(p[0]),
+			tokenizer.NewRawInputSequence(p[1])))
+	}
+	return e.tk.EncodeBatch(inputBatch, addSpecialTokens)
+}
+
+func (e sugarmeEncoder) decode(ids []int, skipSpecialTokens bool) string {
+	return e.tk.Decode(ids, skipSpecialTokens)
+}
+
+func (e sugarmeEncoder) countTokens(text string, addSpecialTokens bool) (int, error) {
+	encoding, err := e.counter.EncodeSingle(text, addSpecialTokens)
+	if err != nil {
+		return 0, err
+	}
+	return len(encoding.Ids), nil
+}
+
+type Tokenizer struct {
+	tk textEncoder
 }
 
 func NewTokenizer() (*Tokenizer, error) {
-	tk, err := pretrained.FromReader(bytes.NewBuffer(embeddedTokenizer))
+	tk, err := newTextEncoder(embeddedTokenizer, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+	return &Tokenizer{
+		tk: tk,
+	}, nil
+}
+
+// NewWordPieceTokenizer loads the embedded tokenizer with the pure Go
+// WordPiece implementation. It allocates far less than NewTokenizer and leaves
+// Words and Overflowing empty. Its encodings differ from NewTokenizer's where
+// sugarme is wrong:
+//   - control and format characters removed by cleaning are dropped, while
+//     sugarme shifts the offsets after them and mangles the tokens when they
+//     start the text or follow a special token;
+//   - offsets point into the original text even when lowercasing changes the
+//     byte length of a character;
+//   - texts on which sugarme panics, such as some with characters growing
+//     when lowercased, are encoded.
+//
+// On other texts, the encodings are the same.
+func NewWordPieceTokenizer() (*Tokenizer, error) {
+	tk, err := newTextEncoder(embeddedTokenizer, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
 	}
@@ -23,9 +128,29 @@ func NewTokenizer() (*Tokenizer, error) {
 }
 
 func (tk *Tokenizer) Encode(s string, addSpecialTokens bool) (*tokenizer.Encoding, error) {
-	return tk.tk.EncodeSingle(s, addSpecialTokens)
+	return tk.tk.encode(s, addSpecialTokens)
+}
+
+// EncodePair encodes two texts as a single sequence, e.g.
+// "[CLS] a [SEP] b [SEP]" with the type ids of b set to 1.
+func (tk *Tokenizer) EncodePair(a, b string, addSpecialTokens bool) (*tokenizer.Encoding, error) {
+	encodings, err := tk.tk.encodePairs([][2]string{{a, b}}, addSpecialTokens)
+	if err != nil {
+		return nil, err
+	}
+	return &encodings[0], nil
 }
 
 func (tk *Tokenizer) Decode(ids []int, skipSpecialTokens bool) string {
-	return tk.tk.Decode(ids, skipSpecialTokens)
+	return tk.tk.decode(ids, skipSpecialTokens)
+}
+
+// CountTokens returns the number of tokens of s, without truncating it to
+// the model window nor padding it.
+func (tk *Tokenizer) CountTokens(s string, addSpecialTokens bool) (int, error) {
+	n, err := tk.tk.countTokens(s, addSpecialTokens)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tokens: %w", err)
+	}
+	return n, nil
 }
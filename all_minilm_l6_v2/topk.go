@@ -0,0 +1,222 @@
+package all_minilm_l6_v2
+
+import (
+	"container/heap"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2/vecmath"
+)
+
+type topKOptions struct {
+	excludeSelf bool
+	workers     int
+}
+
+type TopKOption = func(*topKOptions)
+
+// WithExcludeSelf skips the corpus vector having the same index as the query,
+// which is useful when the queries are the corpus itself.
+func WithExcludeSelf() TopKOption {
+	return func(o *topKOptions) {
+		o.excludeSelf = true
+	}
+}
+
+// WithWorkers sets the number of goroutines used to score the corpus. It
+// defaults to GOMAXPROCS.
+func WithWorkers(n int) TopKOption {
+	return func(o *topKOptions) {
+		o.workers = n
+	}
+}
+
+// SimilarityMatrix returns the cosine similarity between every vector of a
+// and every vector of b, m[i][j] being the similarity of a[i] and b[j]. Rows
+// are computed in parallel.
+func SimilarityMatrix(a, b [][]float32) ([][]float64, error) {
+	if err := checkBatchDimensions(a, b); err != nil {
+		return nil, err
+	}
+
+	normsB := norms(b)
+	matrix := make([][]float64, len(a))
+	parallelFor(len(a), runtime.GOMAXPROCS(0), func(i int) {
+		row := make([]float64, len(b))
+		normA := float64(vecmath.Norm(a[i]))
+		for j, v := range b {
+			row[j] = cosineFromNorms(vecmath.Dot(a[i], v), normA, normsB[j])
+		}
+		matrix[i] = row
+	})
+	return matrix, nil
+}
+
+// TopK returns, for every query, the k corpus vectors with the highest cosine
+// similarity. Each result list is sorted by decreasing score, ties being
+// broken by increasing index, so that the output is deterministic whatever
+// the number of workers.
+//
+// Only k neighbors per query are kept in memory while scoring, so the corpus
+// can be much larger than the number of queries times k.
+func TopK(queries, corpus [][]float32, k int, opts ...TopKOption) ([][]Neighbor, error) {
+	options := topKOptions{
+		workers: runtime.GOMAXPROCS(0),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.workers = max(options.workers, 1)
+
+	if err := checkBatchDimensions(queries, corpus); err != nil {
+		return nil, err
+	}
+
+	results := make([][]Neighbor, len(queries))
+	if k <= 0 || len(queries) == 0 {
+		return results, nil
+	}
+
+	corpusNorms := norms(corpus)
+
+	// When there are fewer queries than workers, the corpus is split in
+	// shards scored concurrently and merged afterwards.
+	shards := max(1, options.workers/len(queries))
+	shardSize := (len(corpus) + shards - 1) / shards
+	partials := make([]neighborHeap, len(queries)*shards)
+
+	parallelFor(len(partials), options.workers, func(task int) {
+		q, shard := task/shards, task%shards
+		lo := min(shard*shardSize, len(corpus))
+		hi := min(lo+shardSize, len(corpus))
+
+		query := queries[q]
+		queryNorm := float64(vecmath.Norm(query))
+		h := make(neighborHeap, 0, min(k, hi-lo))
+		for j := lo; j < hi; j++ {
+			if options.excludeSelf && j == q {
+				continue
+			}
+			h.offer(k, Neighbor{
+				Index: j,
+				Score: cosineFromNorms(vecmath.Dot(query, corpus[j]), queryNorm, corpusNorms[j]),
+			})
+		}
+		partials[task] = h
+	})
+
+	for q := range queries {
+		h := partials[q*shards]
+		for _, partial := range partials[q*shards+1 : (q+1)*shards] {
+			for _, n := range partial {
+				h.offer(k, n)
+			}
+		}
+		neighbors := []Neighbor(h)
+		sortNeighbors(neighbors)
+		results[q] = neighbors
+	}
+	return results, nil
+}
+
+// sortNeighbors sorts by decreasing score, then by increasing index.
+func sortNeighbors(neighbors []Neighbor) {
+	sort.Slice(neighbors, func(i, j int) bool {
+		return neighborLess(neighbors[j], neighbors[i])
+	})
+}
+
+// neighborLess reports whether a ranks below b.
+func neighborLess(a, b Neighbor) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	return a.Index > b.Index
+}
+
+// neighborHeap is a min-heap keeping the worst ranked neighbor at the root.
+type neighborHeap []Neighbor
+
+func (h neighborHeap) Len() int           { return len(h) }
+func (h neighborHeap) Less(i, j int) bool { return neighborLess(h[i], h[j]) }
+func (h neighborHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *neighborHeap) Push(x any)        { *h = append(*h, x.(Neighbor)) }
+
+func (h *neighborHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// offer adds n to the heap if it ranks among the k best seen so far.
+func (h *neighborHeap) offer(k int, n Neighbor) {
+	if h.Len() < k {
+		heap.Push(h, n)
+		return
+	}
+	if neighborLess((*h)[0], n) {
+		(*h)[0] = n
+		heap.Fix(h, 0)
+	}
+}
+
+func checkBatchDimensions(a, b [][]float32) error {
+	dim := -1
+	for _, batch := range [][][]float32{a, b} {
+		for _, v := range batch {
+			if dim == -1 {
+				dim = len(v)
+			}
+			if err := checkDimensions(dim, len(v)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func norms(vectors [][]float32) []float64 {
+	n := make([]float64, len(vectors))
+	for i, v := range vectors {
+		n[i] = float64(vecmath.Norm(v))
+	}
+	return n
+}
+
+func cosineFromNorms(dot float32, normA, normB float64) float64 {
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return min(max(float64(dot)/(normA*normB), -1), 1)
+}
+
+// parallelFor calls fn for every index in [0, n) using up to workers
+// goroutines.
+func parallelFor(n, workers int, fn func(i int)) {
+	workers = min(workers, n)
+	if workers <= 1 {
+		for i := range n {
+			fn(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
@@ -0,0 +1,138 @@
+package all_minilm_l6_v2_test
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+// bruteForceTopK ranks the whole corpus for the query with CosineSimilarity
+func bruteForceTopK(query []float32, corpus [][]float32, k int) []all_minilm_l6_v2.Neighbor {
+	neighbors := make([]all_minilm_l6_v2.Neighbor, len(corpus))
+	for i, v := range corpus {
+		neighbors[i] = all_minilm_l6_v2.Neighbor{Index: i, Score: all_minilm_l6_v2.CosineSimilarity(query, v)}
+	}
+	sort.SliceStable(neighbors, func(i, j int) bool {
+		return neighbors[i].Score > neighbors[j].Score
+	})
+	return neighbors[:min(k, len(neighbors))]
+}
+
+func TestSimilarityMatrix(t *testing.T) {
+	a := randomVectors(1, 5, 32)
+	b := randomVectors(2, 7, 32)
+
+	matrix, err := all_minilm_l6_v2.SimilarityMatrix(a, b)
+	if err != nil {
+		t.Fatalf("Failed to compute similarity matrix: %v", err)
+	}
+
+	if len(matrix) != len(a) {
+		t.Fatalf("Expected %d rows, got %d", len(a), len(matrix))
+	}
+	for i := range a {
+		if len(matrix[i]) != len(b) {
+			t.Fatalf("Row %d: expected %d columns, got %d", i, len(b), len(matrix[i]))
+		}
+		for j := range b {
+			expected := all_minilm_l6_v2.CosineSimilarity(a[i], b[j])
+			if math.Abs(matrix[i][j]-expected) > 1e-5 {
+				t.Errorf("m[%d][%d]: expected %f, got %f", i, j, expected, matrix[i][j])
+			}
+		}
+	}
+}
+
+func TestTopKMatchesBruteForce(t *testing.T) {
+	queries := randomVectors(1, 3, 64)
+	corpus := randomVectors(2, 500, 64)
+
+	for _, workers := range []int{1, 4, 16} {
+		results, err := all_minilm_l6_v2.TopK(queries, corpus, 10, all_minilm_l6_v2.WithWorkers(workers))
+		if err != nil {
+			t.Fatalf("Failed to compute top-k: %v", err)
+		}
+
+		for q, query := range queries {
+			expected := bruteForceTopK(query, corpus, 10)
+			if len(results[q]) != len(expected) {
+				t.Fatalf("Query %d: expected %d results, got %d", q, len(expected), len(results[q]))
+			}
+			for i := range expected {
+				if results[q][i].Index != expected[i].Index {
+					t.Errorf("Workers %d, query %d, rank %d: expected index %d, got %d",
+						workers, q, i, expected[i].Index, results[q][i].Index)
+				}
+			}
+		}
+	}
+}
+
+func TestTopKTiesBrokenByIndex(t *testing.T) {
+	corpus := [][]float32{
+		{0, 1},
+		{1, 0},
+		{0, 1},
+		{1, 0},
+		{1, 0},
+	}
+
+	results, err := all_minilm_l6_v2.TopK([][]float32{{1, 0}}, corpus, 2, all_minilm_l6_v2.WithWorkers(8))
+	if err != nil {
+		t.Fatalf("Failed to compute top-k: %v", err)
+	}
+
+	if len(results[0]) != 2 || results[0][0].Index != 1 || results[0][1].Index != 3 {
+		t.Errorf("Expected indices [1 3], got %v", results[0])
+	}
+}
+
+func TestTopKExcludeSelf(t *testing.T) {
+	corpus := randomVectors(3, 50, 16)
+
+	results, err := all_minilm_l6_v2.TopK(corpus, corpus, 5, all_minilm_l6_v2.WithExcludeSelf())
+	if err != nil {
+		t.Fatalf("Failed to compute top-k: %v", err)
+	}
+
+	for q, neighbors := range results {
+		if len(neighbors) != 5 {
+			t.Fatalf("Query %d: expected 5 results, got %d", q, len(neighbors))
+		}
+		for _, n := range neighbors {
+			if n.Index == q {
+				t.Errorf("Query %d matched itself", q)
+			}
+		}
+	}
+}
+
+func TestTopKLargerThanCorpus(t *testing.T) {
+	corpus := randomVectors(4, 3, 8)
+
+	results, err := all_minilm_l6_v2.TopK(corpus[:1], corpus, 10)
+	if err != nil {
+		t.Fatalf("Failed to compute top-k: %v", err)
+	}
+	if len(results[0]) != 3 {
+		t.Errorf("Expected 3 results, got %d", len(results[0]))
+	}
+	if results[0][0].Index != 0 {
+		t.Errorf("Expected the query to match itself first, got %d", results[0][0].Index)
+	}
+}
+
+func TestTopKDimensionMismatch(t *testing.T) {
+	_, err := all_minilm_l6_v2.TopK([][]float32{{1, 2}}, [][]float32{{1, 2}, {1}}, 1)
+	if !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+
+	_, err = all_minilm_l6_v2.SimilarityMatrix([][]float32{{1}}, [][]float32{{1, 2}})
+	if !errors.Is(err, all_minilm_l6_v2.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}
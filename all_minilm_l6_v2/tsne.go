@@ -0,0 +1,537 @@
+package all_minilm_l6_v2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+)
+
+const (
+	// DefaultPerplexity is the default perplexity of the input affinities.
+	DefaultPerplexity = 30
+	// DefaultTSNEIterations is the default number of gradient descent
+	// iterations.
+	DefaultTSNEIterations = 1000
+	// DefaultTSNETheta is the default Barnes-Hut accuracy threshold.
+	DefaultTSNETheta = 0.5
+	// DefaultEarlyExaggeration is the default factor applied to the input
+	// affinities during the first iterations, which helps clusters form.
+	DefaultEarlyExaggeration = 12
+
+	// earlyExaggerationIterations is the number of iterations run with early
+	// exaggeration and low momentum.
+	earlyExaggerationIterations = 250
+	// quadTreeMaxDepth bounds the depth of the Barnes-Hut tree, points
+	// closer than the cells at this depth sharing a leaf.
+	quadTreeMaxDepth = 50
+)
+
+// TSNEInit is the way the 2D coordinates of t-SNE are initialized.
+type TSNEInit int
+
+const (
+	// PCATSNEInit starts from the projection on the two principal
+	// components, which preserves the global structure better.
+	PCATSNEInit TSNEInit = iota
+	// RandomTSNEInit starts from small random coordinates drawn with the
+	// seed.
+	RandomTSNEInit
+)
+
+type tsneOptions struct {
+	perplexity   float64
+	iterations   int
+	learningRate float64
+	theta        float64
+	exaggeration float64
+	init         TSNEInit
+	seed         int64
+}
+
+type TSNEOption = func(*tsneOptions)
+
+// WithPerplexity sets the perplexity, roughly the number of neighbors each
+// vector pays attention to. It defaults to DefaultPerplexity.
+func WithPerplexity(perplexity float64) TSNEOption {
+	return func(o *tsneOptions) {
+		o.perplexity = perplexity
+	}
+}
+
+// WithTSNEIterations sets the number of gradient descent iterations. It
+// defaults to DefaultTSNEIterations.
+func WithTSNEIterations(n int) TSNEOption {
+	return func(o *tsneOptions) {
+		o.iterations = n
+	}
+}
+
+// WithTSNELearningRate sets the learning rate. It defaults to
+// max(n / early exaggeration / 4, 50) for n vectors, as in scikit-learn.
+func WithTSNELearningRate(rate float64) TSNEOption {
+	return func(o *tsneOptions) {
+		o.learningRate = rate
+	}
+}
+
+// WithTSNETheta sets the Barnes-Hut accuracy threshold: cells seen under an
+// angle below theta are approximated by their center of mass. Zero computes
+// the exact gradient in O(n²). It defaults to DefaultTSNETheta.
+func WithTSNETheta(theta float64) TSNEOption {
+	return func(o *tsneOptions) {
+		o.theta = theta
+	}
+}
+
+// WithEarlyExaggeration sets the factor applied to the input affinities
+// during the first 250 iterations. It defaults to DefaultEarlyExaggeration.
+func WithEarlyExaggeration(factor float64) TSNEOption {
+	return func(o *tsneOptions) {
+		o.exaggeration = factor
+	}
+}
+
+// WithTSNEInit sets the initialization of the coordinates. It defaults to
+// PCATSNEInit.
+func WithTSNEInit(init TSNEInit) TSNEOption {
+	return func(o *tsneOptions) {
+		o.init = init
+	}
+}
+
+// WithTSNESeed sets the seed of the random initialization and of the
+// randomized PCA initialization.
+func WithTSNESeed(seed int64) TSNEOption {
+	return func(o *tsneOptions) {
+		o.seed = seed
+	}
+}
+
+// TSNE embeds vectors in 2D with t-SNE so that similar vectors end up close,
+// to visualize clusters. It returns the x and y coordinates of every vector.
+//
+// Input affinities are computed from the cosine similarities with the
+// 3 × perplexity nearest neighbors of each vector, and the repulsion between
+// all points is approximated with a Barnes-Hut quadtree, so an iteration
+// takes O(n log n) time after the O(n²) neighbor search. The output only
+// depends on the vectors and the options.
+func TSNE(vectors [][]float32, opts ...TSNEOption) ([][]float32, error) {
+	o := tsneOptions{
+		perplexity:   DefaultPerplexity,
+		iterations:   DefaultTSNEIterations,
+		theta:        DefaultTSNETheta,
+		exaggeration: DefaultEarlyExaggeration,
+		init:         PCATSNEInit,
+		seed:         1,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.perplexity <= 0 {
+		return nil, fmt.Errorf("perplexity must be positive, got %f", o.perplexity)
+	}
+	if len(vectors) == 0 {
+		return nil, errors.New("no vectors to embed")
+	}
+	if err := checkBatchDimensions(vectors, nil); err != nil {
+		return nil, err
+	}
+	n := len(vectors)
+	if n == 1 {
+		return [][]float32{{0, 0}}, nil
+	}
+	if o.learningRate <= 0 {
+		o.learningRate = max(float64(n)/o.exaggeration/4, 50)
+	}
+
+	affinities, err := tsneAffinities(vectors, o.perplexity)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := tsneInit(vectors, o)
+	if err != nil {
+		return nil, err
+	}
+
+	gradients := make([][2]float64, n)
+	updates := make([][2]float64, n)
+	gains := make([][2]float64, n)
+	for i := range gains {
+		gains[i] = [2]float64{1, 1}
+	}
+	repulsions := make([][2]float64, n)
+	normalizations := make([]float64, n)
+	workers := runtime.GOMAXPROCS(0)
+
+	for iteration := range o.iterations {
+		exaggeration, momentum := 1.0, 0.8
+		if iteration < earlyExaggerationIterations {
+			exaggeration, momentum = o.exaggeration, 0.5
+		}
+
+		tree := newQuadTree(positions)
+		parallelFor(n, workers, func(i int) {
+			if o.theta > 0 {
+				repulsions[i], normalizations[i] = tree.repulsion(i, o.theta)
+			} else {
+				repulsions[i], normalizations[i] = exactRepulsion(positions, i)
+			}
+		})
+		var z float64
+		for _, zi := range normalizations {
+			z += zi
+		}
+
+		parallelFor(n, workers, func(i int) {
+			var attraction [2]float64
+			for _, a := range affinities[i] {
+				dx := positions[i][0] - positions[a.index][0]
+				dy := positions[i][1] - positions[a.index][1]
+				q := 1 / (1 + dx*dx + dy*dy)
+				attraction[0] += a.p * q * dx
+				attraction[1] += a.p * q * dy
+			}
+			for d := range 2 {
+				gradients[i][d] = 4 * (exaggeration*attraction[d] - repulsions[i][d]/z)
+			}
+		})
+
+		// Gradient descent with momentum and per-coordinate gains, which
+		// grow while the gradient keeps its direction.
+		var mean [2]float64
+		for i := range positions {
+			for d := range 2 {
+				if (gradients[i][d] > 0) != (updates[i][d] > 0) {
+					gains[i][d] += 0.2
+				} else {
+					gains[i][d] = max(gains[i][d]*0.8, 0.01)
+				}
+				updates[i][d] = momentum*updates[i][d] - o.learningRate*gains[i][d]*gradients[i][d]
+				positions[i][d] += updates[i][d]
+				mean[d] += positions[i][d] / float64(n)
+			}
+		}
+		for i := range positions {
+			positions[i][0] -= mean[0]
+			positions[i][1] -= mean[1]
+		}
+	}
+
+	out := make([][]float32, n)
+	for i, p := range positions {
+		out[i] = []float32{float32(p[0]), float32(p[1])}
+	}
+	return out, nil
+}
+
+// affinity is the symmetric input affinity p of a vector with the vector at
+// index.
+type affinity struct {
+	index int
+	p     float64
+}
+
+// tsneAffinities returns the sparse symmetric input affinities: the Gaussian
+// conditional probabilities over the nearest neighbors of each vector, whose
+// bandwidth gives the perplexity, averaged over both directions.
+func tsneAffinities(vectors [][]float32, perplexity float64) ([][]affinity, error) {
+	n := len(vectors)
+	k := min(n-1, int(math.Ceil(3*perplexity)))
+	neighbors, err := TopK(vectors, vectors, k, WithExcludeSelf())
+	if err != nil {
+		return nil, err
+	}
+
+	conditional := make([][]float64, n)
+	parallelFor(n, runtime.GOMAXPROCS(0), func(i int) {
+		// The squared Euclidean distance between the normalized vectors.
+		distances := make([]float64, len(neighbors[i]))
+		for j, nb := range neighbors[i] {
+			distances[j] = max(2*(1-nb.Score), 0)
+		}
+		conditional[i] = gaussianForPerplexity(distances, perplexity)
+	})
+
+	symmetric := make([]map[int]float64, n)
+	for i := range symmetric {
+		symmetric[i] = make(map[int]float64)
+	}
+	for i, list := range neighbors {
+		for j, nb := range list {
+			p := conditional[i][j] / float64(2*n)
+			symmetric[i][nb.Index] += p
+			symmetric[nb.Index][i] += p
+		}
+	}
+	affinities := make([][]affinity, n)
+	for i, row := range symmetric {
+		for j, p := range row {
+			affinities[i] = append(affinities[i], affinity{j, p})
+		}
+		// Sorting keeps the floating point sums deterministic.
+		sort.Slice(affinities[i], func(a, b int) bool {
+			return affinities[i][a].index < affinities[i][b].index
+		})
+	}
+	return affinities, nil
+}
+
+// gaussianForPerplexity returns the probabilities proportional to
+// exp(-beta × distance), beta being found by bisection so that their
+// perplexity is the given one.
+func gaussianForPerplexity(distances []float64, perplexity float64) []float64 {
+	p := make([]float64, len(distances))
+	if len(distances) == 0 {
+		return p
+	}
+	// Shifting the distances leaves the probabilities unchanged and avoids
+	// underflows.
+	nearest := math.Inf(1)
+	for _, d := range distances {
+		nearest = min(nearest, d)
+	}
+	target := math.Log(perplexity)
+	beta, lo, hi := 1.0, 0.0, math.Inf(1)
+	for range 200 {
+		var sum, weighted float64
+		for j, d := range distances {
+			p[j] = math.Exp(-beta * (d - nearest))
+			sum += p[j]
+			weighted += (d - nearest) * p[j]
+		}
+		entropy := math.Log(sum) + beta*weighted/sum
+		for j := range p {
+			p[j] /= sum
+		}
+		diff := entropy - target
+		if math.Abs(diff) < 1e-5 {
+			break
+		}
+		if diff > 0 {
+			lo = beta
+			if math.IsInf(hi, 1) {
+				beta *= 2
+			} else {
+				beta = (beta + hi) / 2
+			}
+		} else {
+			hi = beta
+			beta = (beta + lo) / 2
+		}
+	}
+	return p
+}
+
+// tsneInit returns the initial coordinates, scaled so that the first
+// coordinate has a standard deviation of 1e-4.
+func tsneInit(vectors [][]float32, o tsneOptions) ([][2]float64, error) {
+	n := len(vectors)
+	positions := make([][2]float64, n)
+	switch {
+	case o.init == PCATSNEInit && len(vectors[0]) >= 2:
+		pca, err := FitPCA(vectors, 2, WithPCASeed(o.seed))
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize with PCA: %w", err)
+		}
+		for i, v := range vectors {
+			projected, _ := pca.Transform(v)
+			positions[i] = [2]float64{float64(projected[0]), float64(projected[1])}
+		}
+	case o.init == PCATSNEInit || o.init == RandomTSNEInit:
+		rng := rand.New(rand.NewSource(o.seed))
+		for i := range positions {
+			positions[i] = [2]float64{rng.NormFloat64(), rng.NormFloat64()}
+		}
+	default:
+		return nil, fmt.Errorf("unknown t-SNE initialization %d", o.init)
+	}
+
+	var mean, variance float64
+	for _, p := range positions {
+		mean += p[0] / float64(n)
+	}
+	for _, p := range positions {
+		variance += (p[0] - mean) * (p[0] - mean) / float64(n)
+	}
+	if variance == 0 {
+		variance = 1
+	}
+	scale := 1e-4 / math.Sqrt(variance)
+	for i := range positions {
+		positions[i][0] *= scale
+		positions[i][1] *= scale
+	}
+	return positions, nil
+}
+
+// exactRepulsion returns the unnormalized repulsive force on point i and its
+// contribution to the normalization of the output affinities.
+func exactRepulsion(positions [][2]float64, i int) ([2]float64, float64) {
+	var force [2]float64
+	var z float64
+	for j, p := range positions {
+		if j == i {
+			continue
+		}
+		dx, dy := positions[i][0]-p[0], positions[i][1]-p[1]
+		q := 1 / (1 + dx*dx + dy*dy)
+		z += q
+		force[0] += q * q * dx
+		force[1] += q * q * dy
+	}
+	return force, z
+}
+
+// quadTree is a Barnes-Hut tree over 2D points. Each cell records the number
+// of points it holds and their center of mass.
+type quadTree struct {
+	positions [][2]float64
+	nodes     []quadNode
+	// leaves holds the leaf of each point.
+	leaves []int
+}
+
+type quadNode struct {
+	center [2]float64
+	half   float64
+	mass   float64
+	com    [2]float64
+	// children is the index of the first of 4 consecutive children, or -1
+	// for a leaf.
+	children int
+	// point is the index of the point held by a leaf with a mass of one.
+	// Leaves holding duplicate points or at the maximum depth can hold
+	// several points, point then being -1.
+	point int
+}
+
+func newQuadTree(positions [][2]float64) *quadTree {
+	lo := [2]float64{math.Inf(1), math.Inf(1)}
+	hi := [2]float64{math.Inf(-1), math.Inf(-1)}
+	for _, p := range positions {
+		for d := range 2 {
+			lo[d] = min(lo[d], p[d])
+			hi[d] = max(hi[d], p[d])
+		}
+	}
+	half := max(hi[0]-lo[0], hi[1]-lo[1])/2 + 1e-9
+	t := &quadTree{
+		positions: positions,
+		nodes:     make([]quadNode, 0, 2*len(positions)),
+		leaves:    make([]int, len(positions)),
+	}
+	t.nodes = append(t.nodes, quadNode{
+		center:   [2]float64{(lo[0] + hi[0]) / 2, (lo[1] + hi[1]) / 2},
+		half:     half,
+		children: -1,
+		point:    -1,
+	})
+	for i := range positions {
+		t.insert(i)
+	}
+	return t
+}
+
+func (t *quadTree) insert(i int) {
+	p := t.positions[i]
+	node := 0
+	for depth := 0; ; depth++ {
+		n := &t.nodes[node]
+		n.com[0] = (n.com[0]*n.mass + p[0]) / (n.mass + 1)
+		n.com[1] = (n.com[1]*n.mass + p[1]) / (n.mass + 1)
+		n.mass++
+
+		if n.children < 0 {
+			t.leaves[i] = node
+			if n.mass == 1 {
+				n.point = i
+				return
+			}
+			if n.point < 0 || depth >= quadTreeMaxDepth || t.positions[n.point] == p {
+				n.point = -1
+				return
+			}
+			existing := n.point
+			t.subdivide(node)
+			child := t.childFor(node, t.positions[existing])
+			t.nodes[child].mass = 1
+			t.nodes[child].com = t.positions[existing]
+			t.nodes[child].point = existing
+			t.nodes[node].point = -1
+			t.leaves[existing] = child
+		}
+		node = t.childFor(node, p)
+	}
+}
+
+func (t *quadTree) subdivide(node int) {
+	n := t.nodes[node]
+	first := len(t.nodes)
+	half := n.half / 2
+	for q := range 4 {
+		center := n.center
+		if q&1 == 0 {
+			center[0] -= half
+		} else {
+			center[0] += half
+		}
+		if q&2 == 0 {
+			center[1] -= half
+		} else {
+			center[1] += half
+		}
+		t.nodes = append(t.nodes, quadNode{center: center, half: half, children: -1, point: -1})
+	}
+	t.nodes[node].children = first
+}
+
+func (t *quadTree) childFor(node int, p [2]float64) int {
+	n := t.nodes[node]
+	q := 0
+	if p[0] >= n.center[0] {
+		q |= 1
+	}
+	if p[1] >= n.center[1] {
+		q |= 2
+	}
+	return n.children + q
+}
+
+// repulsion returns the approximate unnormalized repulsive force on point i
+// and its contribution to the normalization of the output affinities.
+func (t *quadTree) repulsion(i int, theta float64) ([2]float64, float64) {
+	var force [2]float64
+	var z float64
+	p := t.positions[i]
+	stack := []int{0}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		n := &t.nodes[node]
+		mass := n.mass
+		if t.leaves[i] == node {
+			// The leaf of i repels it with the other points it holds.
+			mass--
+		}
+		if mass == 0 {
+			continue
+		}
+		dx, dy := p[0]-n.com[0], p[1]-n.com[1]
+		d2 := dx*dx + dy*dy
+		width := 2 * n.half
+		if n.children >= 0 && width*width >= theta*theta*d2 {
+			for q := range 4 {
+				stack = append(stack, n.children+q)
+			}
+			continue
+		}
+		q := 1 / (1 + d2)
+		z += mass * q
+		force[0] += mass * q * q * dx
+		force[1] += mass * q * q * dy
+	}
+	return force, z
+}
@@ -0,0 +1,119 @@
+package all_minilm_l6_v2_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+// blobs returns perCluster noisy normalized vectors around each of clusters
+// random centers, with the cluster of every vector.
+func blobs(seed int64, clusters, perCluster, dim int) ([][]float32, []int) {
+	rng := rand.New(rand.NewSource(seed))
+	centers := randomVectors(seed, clusters, dim)
+	var vectors [][]float32
+	var labels []int
+	for c, center := range centers {
+		for range perCluster {
+			v := make([]float32, dim)
+			for d := range v {
+				v[d] = center[d] + float32(rng.NormFloat64()*0.02)
+			}
+			vectors = append(vectors, normalize(v))
+			labels = append(labels, c)
+		}
+	}
+	return vectors, labels
+}
+
+// nearestNeighborAgreement returns the share of points whose nearest 2D
+// neighbor has the same label.
+func nearestNeighborAgreement(points [][]float32, labels []int) float64 {
+	agree := 0
+	for i, p := range points {
+		nearest, best := -1, math.Inf(1)
+		for j, q := range points {
+			if j == i {
+				continue
+			}
+			dx, dy := float64(p[0]-q[0]), float64(p[1]-q[1])
+			if d := dx*dx + dy*dy; d < best {
+				nearest, best = j, d
+			}
+		}
+		if labels[nearest] == labels[i] {
+			agree++
+		}
+	}
+	return float64(agree) / float64(len(points))
+}
+
+func TestTSNESeparatesClusters(t *testing.T) {
+	vectors, labels := blobs(8, 4, 40, 32)
+
+	for _, theta := range []float64{all_minilm_l6_v2.DefaultTSNETheta, 0} {
+		points, err := all_minilm_l6_v2.TSNE(vectors,
+			all_minilm_l6_v2.WithPerplexity(10),
+			all_minilm_l6_v2.WithTSNEIterations(500),
+			all_minilm_l6_v2.WithTSNETheta(theta))
+		if err != nil {
+			t.Fatalf("Failed to run t-SNE: %v", err)
+		}
+		if len(points) != len(vectors) || len(points[0]) != 2 {
+			t.Fatalf("Expected %d 2D points, got %d of dimension %d", len(vectors), len(points), len(points[0]))
+		}
+		if agreement := nearestNeighborAgreement(points, labels); agreement < 0.98 {
+			t.Errorf("Expected nearest neighbors in the same cluster with theta %v, got an agreement of %f", theta, agreement)
+		}
+	}
+}
+
+func TestTSNEDeterministic(t *testing.T) {
+	vectors, _ := blobs(9, 3, 20, 16)
+	for _, init := range []all_minilm_l6_v2.TSNEInit{all_minilm_l6_v2.PCATSNEInit, all_minilm_l6_v2.RandomTSNEInit} {
+		opts := []all_minilm_l6_v2.TSNEOption{
+			all_minilm_l6_v2.WithPerplexity(5),
+			all_minilm_l6_v2.WithTSNEIterations(300),
+			all_minilm_l6_v2.WithTSNEInit(init),
+			all_minilm_l6_v2.WithTSNESeed(42),
+		}
+		first, err := all_minilm_l6_v2.TSNE(vectors, opts...)
+		if err != nil {
+			t.Fatalf("Failed to run t-SNE: %v", err)
+		}
+		second, _ := all_minilm_l6_v2.TSNE(vectors, opts...)
+		for i := range first {
+			if first[i][0] != second[i][0] || first[i][1] != second[i][1] {
+				t.Fatalf("Expected identical coordinates for a fixed seed, got %v and %v", first[i], second[i])
+			}
+		}
+	}
+}
+
+func TestTSNEEdgeCases(t *testing.T) {
+	points, err := all_minilm_l6_v2.TSNE([][]float32{{1, 0}})
+	if err != nil || len(points) != 1 {
+		t.Fatalf("Expected a single point, got %v and %v", points, err)
+	}
+
+	// Duplicates must not break the Barnes-Hut tree
+	duplicates := [][]float32{{1, 0}, {1, 0}, {1, 0}, {0, 1}, {0, 1}}
+	points, err = all_minilm_l6_v2.TSNE(duplicates, all_minilm_l6_v2.WithPerplexity(2), all_minilm_l6_v2.WithTSNEIterations(100))
+	if err != nil {
+		t.Fatalf("Failed to run t-SNE: %v", err)
+	}
+	for _, p := range points {
+		if math.IsNaN(float64(p[0])) || math.IsNaN(float64(p[1])) {
+			t.Fatalf("Expected finite coordinates, got %v", points)
+		}
+	}
+
+	if _, err := all_minilm_l6_v2.TSNE(nil); err == nil {
+		t.Errorf("Expected an error without vectors")
+	}
+	if _, err := all_minilm_l6_v2.TSNE(duplicates, all_minilm_l6_v2.WithPerplexity(0)); err == nil {
+		t.Errorf("Expected an error for a zero perplexity")
+	}
+}
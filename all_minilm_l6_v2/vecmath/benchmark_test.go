@@ -0,0 +1,51 @@
+package vecmath
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// BenchmarkDot benchmarks the dispatched dot product on 384-dim vectors
+func BenchmarkDot(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x, y := randomVector(rng, 384), randomVector(rng, 384)
+
+	for b.Loop() {
+		Dot(x, y)
+	}
+}
+
+// BenchmarkDotGeneric benchmarks the pure-Go dot product on 384-dim vectors
+func BenchmarkDotGeneric(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x, y := randomVector(rng, 384), randomVector(rng, 384)
+
+	for b.Loop() {
+		dotGeneric(x, y)
+	}
+}
+
+// BenchmarkCosine benchmarks the dispatched cosine similarity on 384-dim vectors
+func BenchmarkCosine(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x, y := randomVector(rng, 384), randomVector(rng, 384)
+
+	for b.Loop() {
+		Cosine(x, y)
+	}
+}
+
+// BenchmarkCosineBatch benchmarks scoring one query against 10,000 vectors
+func BenchmarkCosineBatch(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	query := randomVector(rng, 384)
+	vectors := make([][]float32, 10000)
+	for i := range vectors {
+		vectors[i] = randomVector(rng, 384)
+	}
+	out := make([]float32, len(vectors))
+
+	for b.Loop() {
+		CosineBatch(query, vectors, out)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build amd64 && !purego
+
+package vecmath
+
+import "golang.org/x/sys/cpu"
+
+func init() {
+	if cpu.X86.HasAVX2 && cpu.X86.HasFMA {
+		dotImpl = dotAVX2
+		l2SquaredImpl = l2SquaredAVX2
+		cosineImpl = cosineAVX2
+	}
+}
+
+//go:noescape
+func dotAVX2(a, b []float32) float32
+
+//go:noescape
+func l2SquaredAVX2(a, b []float32) float32
+
+//go:noescape
+func cosineAVX2(a, b []float32) (dot, normA, normB float32)
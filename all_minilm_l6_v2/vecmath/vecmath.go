@@ -0,0 +1,167 @@
+// Package vecmath provides float32 vector kernels used to compare the
+// embeddings produced by the all-MiniLM-L6-v2 model.
+//
+// On amd64 CPUs supporting AVX2 and FMA the kernels are implemented in
+// assembly, otherwise unrolled pure-Go versions are used. The implementation
+// is selected once at startup. Building with the purego tag forces the Go
+// implementation.
+//
+// Unless stated otherwise, functions taking two vectors panic if they do not
+// have the same length.
+package vecmath
+
+import "math"
+
+var (
+	dotImpl       = dotGeneric
+	l2SquaredImpl = l2SquaredGeneric
+	cosineImpl    = cosineGeneric
+)
+
+// Dot returns the dot product of a and b.
+func Dot(a, b []float32) float32 {
+	checkLengths(a, b)
+	return dotImpl(a, b)
+}
+
+// L2Squared returns the squared Euclidean distance between a and b.
+func L2Squared(a, b []float32) float32 {
+	checkLengths(a, b)
+	return l2SquaredImpl(a, b)
+}
+
+// Norm returns the Euclidean norm of a.
+func Norm(a []float32) float32 {
+	return float32(math.Sqrt(float64(dotImpl(a, a))))
+}
+
+// Normalized returns a unit-length copy of a, or a zero vector if a is the
+// zero vector.
+func Normalized(a []float32) []float32 {
+	out := make([]float32, len(a))
+	norm := Norm(a)
+	if norm == 0 {
+		return out
+	}
+	for i, x := range a {
+		out[i] = x / norm
+	}
+	return out
+}
+
+// Cosine returns the cosine similarity between a and b, or 0 if either of
+// them is the zero vector. The dot product and both norms are computed in a
+// single pass.
+func Cosine(a, b []float32) float32 {
+	checkLengths(a, b)
+	dot, normA, normB := cosineImpl(a, b)
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(float64(dot) / math.Sqrt(float64(normA)*float64(normB)))
+}
+
+// DotBatch writes the dot product between query and every vector of vectors
+// into out, which must be at least as long as vectors.
+func DotBatch(query []float32, vectors [][]float32, out []float32) {
+	out = out[:len(vectors)]
+	for i, v := range vectors {
+		checkLengths(query, v)
+		out[i] = dotImpl(query, v)
+	}
+}
+
+// L2SquaredBatch writes the squared Euclidean distance between query and
+// every vector of vectors into out, which must be at least as long as vectors.
+func L2SquaredBatch(query []float32, vectors [][]float32, out []float32) {
+	out = out[:len(vectors)]
+	for i, v := range vectors {
+		checkLengths(query, v)
+		out[i] = l2SquaredImpl(query, v)
+	}
+}
+
+// CosineBatch writes the cosine similarity between query and every vector of
+// vectors into out, which must be at least as long as vectors, as Cosine
+// does.
+func CosineBatch(query []float32, vectors [][]float32, out []float32) {
+	out = out[:len(vectors)]
+	for i, v := range vectors {
+		checkLengths(query, v)
+		dot, normQuery, normV := cosineImpl(query, v)
+		if normQuery == 0 || normV == 0 {
+			out[i] = 0
+			continue
+		}
+		out[i] = float32(float64(dot) / math.Sqrt(float64(normQuery)*float64(normV)))
+	}
+}
+
+func checkLengths(a, b []float32) {
+	if len(a) != len(b) {
+		panic("vecmath: vectors have different lengths")
+	}
+}
+
+// The generic kernels accumulate into four independent sums so that the
+// compiler can pipeline the multiplications, and reslice b to let it drop the
+// bounds checks.
+
+func dotGeneric(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return (s0 + s1) + (s2 + s3)
+}
+
+func l2SquaredGeneric(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		d0 := a[i] - b[i]
+		d1 := a[i+1] - b[i+1]
+		d2 := a[i+2] - b[i+2]
+		d3 := a[i+3] - b[i+3]
+		s0 += d0 * d0
+		s1 += d1 * d1
+		s2 += d2 * d2
+		s3 += d3 * d3
+	}
+	for ; i < len(a); i++ {
+		d := a[i] - b[i]
+		s0 += d * d
+	}
+	return (s0 + s1) + (s2 + s3)
+}
+
+func cosineGeneric(a, b []float32) (dot, normA, normB float32) {
+	b = b[:len(a)]
+	var d0, d1, a0, a1, b0, b1 float32
+	i := 0
+	for ; i+2 <= len(a); i += 2 {
+		x0, x1 := a[i], a[i+1]
+		y0, y1 := b[i], b[i+1]
+		d0 += x0 * y0
+		d1 += x1 * y1
+		a0 += x0 * x0
+		a1 += x1 * x1
+		b0 += y0 * y0
+		b1 += y1 * y1
+	}
+	for ; i < len(a); i++ {
+		d0 += a[i] * b[i]
+		a0 += a[i] * a[i]
+		b0 += b[i] * b[i]
+	}
+	return d0 + d1, a0 + a1, b0 + b1
+}
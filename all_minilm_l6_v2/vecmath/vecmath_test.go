@@ -0,0 +1,206 @@
+package vecmath
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// The kernels are compared against these float64 scalar references.
+
+func dotReference(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func l2SquaredReference(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return sum
+}
+
+func cosineReference(a, b []float32) float64 {
+	normA := math.Sqrt(dotReference(a, a))
+	normB := math.Sqrt(dotReference(b, b))
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dotReference(a, b) / (normA * normB)
+}
+
+// closeEnough tolerates the float32 rounding error of a sum of n products
+// whose absolute values add up to magnitude
+func closeEnough(got float32, expected, magnitude float64, n int) bool {
+	tolerance := 1e-6 * float64(n+1) * (magnitude + 1)
+	return math.Abs(float64(got)-expected) <= tolerance
+}
+
+func randomVector(rng *rand.Rand, dim int) []float32 {
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = float32(rng.NormFloat64())
+	}
+	return v
+}
+
+// vectorsFromBytes splits the fuzzer input into two vectors of equal length
+// with finite values
+func vectorsFromBytes(data []byte) ([]float32, []float32) {
+	n := len(data) / 8
+	a := make([]float32, n)
+	b := make([]float32, n)
+	for i := range n {
+		a[i] = toFinite(binary.LittleEndian.Uint32(data[i*8:]))
+		b[i] = toFinite(binary.LittleEndian.Uint32(data[i*8+4:]))
+	}
+	return a, b
+}
+
+func toFinite(bits uint32) float32 {
+	// Map any bit pattern to [-8, 8)
+	return float32(bits)/float32(math.MaxUint32)*16 - 8
+}
+
+type kernelSet struct {
+	name      string
+	dot       func(a, b []float32) float32
+	l2Squared func(a, b []float32) float32
+	cosine    func(a, b []float32) (float32, float32, float32)
+}
+
+func kernels() []kernelSet {
+	// The dispatched kernels are the generic ones when no faster
+	// implementation is available on this CPU
+	return []kernelSet{
+		{"generic", dotGeneric, l2SquaredGeneric, cosineGeneric},
+		{"dispatched", dotImpl, l2SquaredImpl, cosineImpl},
+	}
+}
+
+func checkKernels(t *testing.T, a, b []float32) {
+	t.Helper()
+
+	var magnitude, magnitudeA, magnitudeB float64
+	for i := range a {
+		magnitude += math.Abs(float64(a[i]) * float64(b[i]))
+		magnitudeA += float64(a[i]) * float64(a[i])
+		magnitudeB += float64(b[i]) * float64(b[i])
+	}
+
+	for _, k := range kernels() {
+		if got, expected := k.dot(a, b), dotReference(a, b); !closeEnough(got, expected, magnitude, len(a)) {
+			t.Errorf("%s dot (n=%d): got %v, expected %v", k.name, len(a), got, expected)
+		}
+		if got, expected := k.l2Squared(a, b), l2SquaredReference(a, b); !closeEnough(got, expected, expected, len(a)) {
+			t.Errorf("%s l2 squared (n=%d): got %v, expected %v", k.name, len(a), got, expected)
+		}
+
+		dot, normA, normB := k.cosine(a, b)
+		if !closeEnough(dot, dotReference(a, b), magnitude, len(a)) ||
+			!closeEnough(normA, magnitudeA, magnitudeA, len(a)) ||
+			!closeEnough(normB, magnitudeB, magnitudeB, len(a)) {
+			t.Errorf("%s cosine (n=%d): got (%v, %v, %v), expected (%v, %v, %v)",
+				k.name, len(a), dot, normA, normB, dotReference(a, b), magnitudeA, magnitudeB)
+		}
+	}
+}
+
+func TestKernelsAllLengths(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// Cover every combination of unrolled blocks and remainders
+	for n := 0; n <= 100; n++ {
+		checkKernels(t, randomVector(rng, n), randomVector(rng, n))
+	}
+	checkKernels(t, randomVector(rng, 384), randomVector(rng, 384))
+}
+
+func TestCosine(t *testing.T) {
+	a := []float32{1, 2, 3}
+
+	if got := Cosine(a, a); math.Abs(float64(got)-1) > 1e-6 {
+		t.Errorf("Expected cosine of 1 with itself, got %v", got)
+	}
+	if got := Cosine(a, []float32{-1, -2, -3}); math.Abs(float64(got)+1) > 1e-6 {
+		t.Errorf("Expected cosine of -1 with opposite, got %v", got)
+	}
+	if got := Cosine(a, []float32{0, 0, 0}); got != 0 {
+		t.Errorf("Expected cosine of 0 with the zero vector, got %v", got)
+	}
+}
+
+func TestNorm(t *testing.T) {
+	if got := Norm([]float32{3, 4}); got != 5 {
+		t.Errorf("Expected norm 5, got %v", got)
+	}
+}
+
+func TestNormalized(t *testing.T) {
+	a := []float32{3, 4}
+	if got := Normalized(a); got[0] != 0.6 || got[1] != 0.8 || a[0] != 3 {
+		t.Errorf("Expected a unit copy, got %v and %v", got, a)
+	}
+	if got := Normalized([]float32{0, 0}); got[0] != 0 || got[1] != 0 {
+		t.Errorf("Expected the zero vector to stay zero, got %v", got)
+	}
+}
+
+func TestBatchMatchesSingle(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	query := randomVector(rng, 384)
+	vectors := make([][]float32, 10)
+	for i := range vectors {
+		vectors[i] = randomVector(rng, 384)
+	}
+	vectors[3] = make([]float32, 384)
+
+	dots := make([]float32, len(vectors))
+	distances := make([]float32, len(vectors))
+	cosines := make([]float32, len(vectors))
+	DotBatch(query, vectors, dots)
+	L2SquaredBatch(query, vectors, distances)
+	CosineBatch(query, vectors, cosines)
+
+	for i, v := range vectors {
+		if dots[i] != Dot(query, v) {
+			t.Errorf("Vector %d: batch dot %v differs from %v", i, dots[i], Dot(query, v))
+		}
+		if distances[i] != L2Squared(query, v) {
+			t.Errorf("Vector %d: batch distance %v differs from %v", i, distances[i], L2Squared(query, v))
+		}
+		if math.Abs(float64(cosines[i]-Cosine(query, v))) > 1e-6 {
+			t.Errorf("Vector %d: batch cosine %v differs from %v", i, cosines[i], Cosine(query, v))
+		}
+	}
+}
+
+func TestLengthMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic on length mismatch")
+		}
+	}()
+	Dot([]float32{1, 2}, []float32{1})
+}
+
+func FuzzKernels(f *testing.F) {
+	f.Add([]byte{})
+	f.Add(make([]byte, 8*7))
+	f.Add(make([]byte, 8*384))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		a, b := vectorsFromBytes(data)
+		checkKernels(t, a, b)
+
+		if got, expected := Cosine(a, b), cosineReference(a, b); math.Abs(float64(got)-expected) > 1e-4 {
+			t.Errorf("cosine (n=%d): got %v, expected %v", len(a), got, expected)
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package all_minilm_l6_v2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+// DefaultWhiteningEpsilon is the default value added to the variances before
+// dividing by their square root.
+const DefaultWhiteningEpsilon = 1e-8
+
+// WhiteningMethod is the rotation applied by a Whitening after scaling the
+// principal components to unit variance.
+type WhiteningMethod uint32
+
+const (
+	// PCAWhitening projects vectors on the principal components, which
+	// allows keeping only the components of highest variance.
+	PCAWhitening WhiteningMethod = iota
+	// ZCAWhitening rotates the whitened components back to the original
+	// axes, keeping the vectors as close as possible to the original ones.
+	// It keeps every dimension.
+	ZCAWhitening
+)
+
+// Whitening centers vectors on the mean of a corpus and decorrelates their
+// dimensions, scaling them to unit variance. This corrects the anisotropy of
+// sentence embeddings, which otherwise occupy a narrow cone where all
+// similarities are high.
+//
+// Whitened vectors are not normalized; compare them with cosine similarity.
+type Whitening struct {
+	method WhiteningMethod
+	mean   []float32
+	// matrix holds one row of len(mean) coefficients per output dimension.
+	matrix    []float32
+	variances []float64
+}
+
+type whiteningOptions struct {
+	method  WhiteningMethod
+	epsilon float64
+}
+
+type WhiteningOption = func(*whiteningOptions)
+
+// WithWhiteningMethod sets the whitening rotation. It defaults to
+// PCAWhitening.
+func WithWhiteningMethod(method WhiteningMethod) WhiteningOption {
+	return func(o *whiteningOptions) {
+		o.method = method
+	}
+}
+
+// WithWhiteningEpsilon sets the value added to the variances before dividing
+// by their square root, which damps the components of near-zero variance. It
+// defaults to DefaultWhiteningEpsilon.
+func WithWhiteningEpsilon(epsilon float64) WhiteningOption {
+	return func(o *whiteningOptions) {
+		o.epsilon = epsilon
+	}
+}
+
+// FitWhitening fits a whitening transform on embeddings, keeping the
+// targetDim principal components of highest variance. A targetDim of zero
+// keeps every dimension; ZCAWhitening requires it.
+//
+// The covariance is the population covariance of embeddings, and its
+// eigendecomposition takes O(dim³) time.
+func FitWhitening(embeddings [][]float32, targetDim int, opts ...WhiteningOption) (*Whitening, error) {
+	o := whiteningOptions{method: PCAWhitening, epsilon: DefaultWhiteningEpsilon}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(embeddings) == 0 {
+		return nil, errors.New("no embeddings to fit")
+	}
+	if err := checkBatchDimensions(embeddings, nil); err != nil {
+		return nil, err
+	}
+	dim := len(embeddings[0])
+	if targetDim == 0 {
+		targetDim = dim
+	}
+	if targetDim < 0 || targetDim > dim {
+		return nil, fmt.Errorf("invalid target dimension %d for embeddings of dimension %d", targetDim, dim)
+	}
+	if o.method == ZCAWhitening && targetDim != dim {
+		return nil, errors.New("ZCA whitening keeps every dimension")
+	}
+	if o.method != PCAWhitening && o.method != ZCAWhitening {
+		return nil, fmt.Errorf("unknown whitening method %d", o.method)
+	}
+
+	mean, covariance := meanAndCovariance(embeddings)
+	values, vectors := symmetricEigen(covariance)
+
+	w := &Whitening{method: o.method, mean: make([]float32, dim), variances: values[:targetDim]}
+	for d, m := range mean {
+		w.mean[d] = float32(m)
+	}
+	// PCA rows are the components scaled by the inverse standard deviation;
+	// ZCA rotates them back with the transposed components.
+	scaled := make([][]float64, targetDim)
+	for k := range scaled {
+		scale := 1 / math.Sqrt(max(values[k], 0)+o.epsilon)
+		scaled[k] = make([]float64, dim)
+		for d, x := range vectors[k] {
+			scaled[k][d] = x * scale
+		}
+	}
+	w.matrix = make([]float32, targetDim*dim)
+	for i := range targetDim {
+		for j := range dim {
+			if o.method == PCAWhitening {
+				w.matrix[i*dim+j] = float32(scaled[i][j])
+				continue
+			}
+			var sum float64
+			for k := range targetDim {
+				sum += vectors[k][i] * scaled[k][j]
+			}
+			w.matrix[i*dim+j] = float32(sum)
+		}
+	}
+	return w, nil
+}
+
+// meanAndCovariance returns the mean and the population covariance matrix of
+// vectors.
+func meanAndCovariance(vectors [][]float32) ([]float64, [][]float64) {
+	dim := len(vectors[0])
+	mean := columnMeans(vectors)
+
+	covariance := make([][]float64, dim)
+	for i := range covariance {
+		covariance[i] = make([]float64, dim)
+	}
+	centered := make([]float64, dim)
+	for _, v := range vectors {
+		for d, x := range v {
+			centered[d] = float64(x) - mean[d]
+		}
+		// Only the lower triangle is accumulated, the matrix being
+		// symmetric.
+		for i := range dim {
+			row := covariance[i]
+			for j := 0; j <= i; j++ {
+				row[j] += centered[i] * centered[j]
+			}
+		}
+	}
+	for i := range dim {
+		for j := 0; j <= i; j++ {
+			covariance[i][j] /= float64(len(vectors))
+			covariance[j][i] = covariance[i][j]
+		}
+	}
+	return mean, covariance
+}
+
+// InputDim returns the dimension of the vectors the transform applies to.
+func (w *Whitening) InputDim() int { return len(w.mean) }
+
+// OutputDim returns the dimension of the whitened vectors.
+func (w *Whitening) OutputDim() int { return len(w.variances) }
+
+// Variances returns the variance of the corpus along each kept principal
+// component, by decreasing variance.
+func (w *Whitening) Variances() []float64 {
+	return append([]float64(nil), w.variances...)
+}
+
+// Transform returns the whitened v.
+func (w *Whitening) Transform(v []float32) ([]float32, error) {
+	dim := len(w.mean)
+	if err := checkDimensions(dim, len(v)); err != nil {
+		return nil, err
+	}
+	centered := make([]float32, dim)
+	for d, x := range v {
+		centered[d] = x - w.mean[d]
+	}
+	out := make([]float32, w.OutputDim())
+	for i := range out {
+		row := w.matrix[i*dim : (i+1)*dim]
+		var sum float64
+		for d, x := range centered {
+			sum += float64(row[d]) * float64(x)
+		}
+		out[i] = float32(sum)
+	}
+	return out, nil
+}
+
+// TransformBatch whitens every vector of vs, such as the output of
+// Model.ComputeBatch.
+func (w *Whitening) TransformBatch(vs [][]float32) ([][]float32, error) {
+	out := make([][]float32, len(vs))
+	for i, v := range vs {
+		var err error
+		if out[i], err = w.Transform(v); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// A serialized whitening is the magic "MINILMWH", the format version, the
+// method, the input and output dimensions as little-endian uint32, the mean
+// as float32, the variances as float64, the matrix as float32 row by row, and
+// the CRC-32C of all the preceding bytes.
+const (
+	whiteningMagic   = "MINILMWH"
+	whiteningVersion = 1
+)
+
+// MarshalBinary encodes the transform in a versioned binary format.
+func (w *Whitening) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 24+len(w.mean)*4+len(w.variances)*8+len(w.matrix)*4+4)
+	buf = append(buf, whiteningMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, whiteningVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(w.method))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(w.mean)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(w.variances)))
+	for _, m := range w.mean {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(m))
+	}
+	for _, v := range w.variances {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+	}
+	for _, x := range w.matrix {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(x))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a transform encoded with MarshalBinary.
+func (w *Whitening) UnmarshalBinary(data []byte) error {
+	if len(data) < 28 || string(data[:8]) != whiteningMagic {
+		return errors.New("not a whitening transform")
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, castagnoli) != sum {
+		return errors.New("whitening checksum mismatch")
+	}
+	if v := binary.LittleEndian.Uint32(body[8:]); v != whiteningVersion {
+		return fmt.Errorf("unsupported whitening version %d", v)
+	}
+	method := WhiteningMethod(binary.LittleEndian.Uint32(body[12:]))
+	in := uint64(binary.LittleEndian.Uint32(body[16:]))
+	out := uint64(binary.LittleEndian.Uint32(body[20:]))
+	if method > ZCAWhitening || in == 0 || out == 0 || out > in ||
+		uint64(len(body)-24) != in*4+out*8+in*out*4 {
+		return errors.New("invalid whitening dimensions")
+	}
+
+	*w = Whitening{
+		method:    method,
+		mean:      make([]float32, in),
+		variances: make([]float64, out),
+		matrix:    make([]float32, in*out),
+	}
+	offset := 24
+	for i := range w.mean {
+		w.mean[i] = math.Float32frombits(binary.LittleEndian.Uint32(body[offset:]))
+		offset += 4
+	}
+	for i := range w.variances {
+		w.variances[i] = math.Float64frombits(binary.LittleEndian.Uint64(body[offset:]))
+		offset += 8
+	}
+	for i := range w.matrix {
+		w.matrix[i] = math.Float32frombits(binary.LittleEndian.Uint32(body[offset:]))
+		offset += 4
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package all_minilm_l6_v2_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+)
+
+// randomRotation returns an orthonormal basis of dimension dim.
+func randomRotation(seed int64, dim int) [][]float64 {
+	rng := rand.New(rand.NewSource(seed))
+	basis := make([][]float64, dim)
+	for i := range basis {
+		v := make([]float64, dim)
+		for d := range v {
+			v[d] = rng.NormFloat64()
+		}
+		for _, b := range basis[:i] {
+			var dot float64
+			for d := range v {
+				dot += v[d] * b[d]
+			}
+			for d := range v {
+				v[d] -= dot * b[d]
+			}
+		}
+		var norm float64
+		for _, x := range v {
+			norm += x * x
+		}
+		for d := range v {
+			v[d] /= math.Sqrt(norm)
+		}
+		basis[i] = v
+	}
+	return basis
+}
+
+// covariance returns the population covariance matrix of vectors.
+func covariance(vectors [][]float32) [][]float64 {
+	dim := len(vectors[0])
+	mean := make([]float64, dim)
+	for _, v := range vectors {
+		for d, x := range v {
+			mean[d] += float64(x) / float64(len(vectors))
+		}
+	}
+	c := make([][]float64, dim)
+	for i := range c {
+		c[i] = make([]float64, dim)
+		for j := range c[i] {
+			for _, v := range vectors {
+				c[i][j] += (float64(v[i]) - mean[i]) * (float64(v[j]) - mean[j]) / float64(len(vectors))
+			}
+		}
+	}
+	return c
+}
+
+func checkIdentity(t *testing.T, m [][]float64, tolerance float64) {
+	t.Helper()
+	for i := range m {
+		for j := range m[i] {
+			expected := 0.0
+			if i == j {
+				expected = 1
+			}
+			if math.Abs(m[i][j]-expected) > tolerance {
+				t.Fatalf("Expected the identity, got %f at (%d, %d)", m[i][j], i, j)
+			}
+		}
+	}
+}
+
+// knownCovarianceData returns vectors whose population covariance is exactly
+// R diag(variances) Rᵀ, R being the rows of rotation: the pairs mean ±
+// sqrt(dim × variance) × axis.
+func knownCovarianceData(mean []float64, rotation [][]float64, variances []float64) [][]float32 {
+	dim := len(mean)
+	var vectors [][]float32
+	for i, axis := range rotation {
+		for _, sign := range []float64{1, -1} {
+			v := make([]float32, dim)
+			for d := range v {
+				v[d] = float32(mean[d] + sign*math.Sqrt(float64(dim)*variances[i])*axis[d])
+			}
+			vectors = append(vectors, v)
+		}
+	}
+	return vectors
+}
+
+func TestFitWhiteningKnownCovariance(t *testing.T) {
+	variances := []float64{9, 4, 2, 1, 0.5, 0.25}
+	rotation := randomRotation(1, len(variances))
+	mean := []float64{1, -2, 0.5, 3, 0, -1}
+	vectors := knownCovarianceData(mean, rotation, variances)
+
+	whitening, err := all_minilm_l6_v2.FitWhitening(vectors, 0)
+	if err != nil {
+		t.Fatalf("Failed to fit whitening: %v", err)
+	}
+	for i, v := range whitening.Variances() {
+		if math.Abs(v-variances[i]) > 1e-4 {
+			t.Errorf("Expected variance %f for component %d, got %f", variances[i], i, v)
+		}
+	}
+
+	whitened, err := whitening.TransformBatch(vectors)
+	if err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+	checkIdentity(t, covariance(whitened), 1e-4)
+
+	// The extremes along the first axis only move along the first
+	// component, by sqrt(dim) standard deviations
+	first := whitened[0]
+	if math.Abs(math.Abs(float64(first[0]))-math.Sqrt(6)) > 1e-3 {
+		t.Errorf("Expected the first component to be ±sqrt(6), got %f", first[0])
+	}
+	for _, x := range first[1:] {
+		if math.Abs(float64(x)) > 1e-3 {
+			t.Errorf("Expected the other components to be zero, got %v", first)
+			break
+		}
+	}
+}
+
+func TestFitWhiteningReducesDimension(t *testing.T) {
+	variances := []float64{9, 4, 2, 1, 0.5, 0.25}
+	vectors := knownCovarianceData(make([]float64, 6), randomRotation(2, 6), variances)
+
+	whitening, err := all_minilm_l6_v2.FitWhitening(vectors, 3)
+	if err != nil {
+		t.Fatalf("Failed to fit whitening: %v", err)
+	}
+	if whitening.InputDim() != 6 || whitening.OutputDim() != 3 {
+		t.Fatalf("Expected a 6 to 3 transform, got %d to %d", whitening.InputDim(), whitening.OutputDim())
+	}
+	whitened, _ := whitening.TransformBatch(vectors)
+	if len(whitened[0]) != 3 {
+		t.Fatalf("Expected 3 dimensions, got %d", len(whitened[0]))
+	}
+	checkIdentity(t, covariance(whitened), 1e-4)
+
+	if _, err := all_minilm_l6_v2.FitWhitening(vectors, 7); err == nil {
+		t.Errorf("Expected an error for a target dimension above the input dimension")
+	}
+	if _, err := all_minilm_l6_v2.FitWhitening(vectors, 3,
+		all_minilm_l6_v2.WithWhiteningMethod(all_minilm_l6_v2.ZCAWhitening)); err == nil {
+		t.Errorf("Expected an error for a reduced ZCA whitening")
+	}
+}
+
+func TestFitWhiteningZCA(t *testing.T) {
+	// Correlated features: random vectors mixed by a random matrix
+	rng := rand.New(rand.NewSource(3))
+	const dim = 48
+	mixing := make([][]float64, dim)
+	for i := range mixing {
+		mixing[i] = make([]float64, dim)
+		for j := range mixing[i] {
+			mixing[i][j] = rng.NormFloat64()
+		}
+	}
+	var vectors [][]float32
+	for range 600 {
+		z := make([]float64, dim)
+		for d := range z {
+			z[d] = rng.NormFloat64()
+		}
+		v := make([]float32, dim)
+		for i := range v {
+			for j := range z {
+				v[i] += float32(mixing[i][j] * z[j])
+			}
+		}
+		vectors = append(vectors, v)
+	}
+
+	for _, method := range []all_minilm_l6_v2.WhiteningMethod{all_minilm_l6_v2.PCAWhitening, all_minilm_l6_v2.ZCAWhitening} {
+		whitening, err := all_minilm_l6_v2.FitWhitening(vectors, 0, all_minilm_l6_v2.WithWhiteningMethod(method))
+		if err != nil {
+			t.Fatalf("Failed to fit whitening: %v", err)
+		}
+		whitened, _ := whitening.TransformBatch(vectors)
+		checkIdentity(t, covariance(whitened), 1e-3)
+
+		variances := whitening.Variances()
+		for i := 1; i < len(variances); i++ {
+			if variances[i] > variances[i-1] {
+				t.Fatalf("Variances are not sorted: %v", variances)
+			}
+		}
+	}
+}
+
+func TestWhiteningMarshalBinary(t *testing.T) {
+	vectors := randomVectors(4, 50, 8)
+	whitening, _ := all_minilm_l6_v2.FitWhitening(vectors, 4)
+	data, err := whitening.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	var loaded all_minilm_l6_v2.Whitening
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	for _, v := range vectors {
+		a, _ := whitening.Transform(v)
+		b, err := loaded.Transform(v)
+		if err != nil {
+			t.Fatalf("Failed to transform: %v", err)
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				t.Fatalf("Expected %v, got %v", a, b)
+			}
+		}
+	}
+
+	for i := range data {
+		corrupted := append([]byte(nil), data...)
+		corrupted[i] ^= 1
+		if err := loaded.UnmarshalBinary(corrupted); err == nil {
+			t.Fatalf("Expected an error with byte %d flipped", i)
+		}
+	}
+	if _, err := whitening.Transform(make([]float32, 3)); err == nil {
+		t.Errorf("Expected a dimension mismatch error")
+	}
+}
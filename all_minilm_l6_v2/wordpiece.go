@@ -0,0 +1,797 @@
+package all_minilm_l6_v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sugarme/tokenizer"
+)
+
+// wordPieceTokenizer is a pure Go implementation of the tokenizer.json
+// pipeline of BERT models: a BertNormalizer, a BertPreTokenizer, a WordPiece
+// model and a template post-processor, followed by truncation and padding.
+//
+// It produces the same ids, type ids, tokens, offsets and masks as the sugarme
+// tokenizer for valid UTF-8 input, with a handful of allocations per encoding.
+// Words, Overflowing and SequenceRanges are left empty. Offsets differ only
+// where the sugarme alignments are corrupted: for the few characters whose
+// lowercase form has another UTF-8 length, such as "İ", and for control
+// characters removed at the start of the text or after a special token.
+type wordPieceTokenizer struct {
+	vocab  map[string]int
+	tokens []string
+	unkID  int
+	prefix string
+	// maxInputCharsPerWord is the length in runes above which a word is
+	// unknown.
+	maxInputCharsPerWord int
+	// maxTokenLen is the length in bytes of the longest vocabulary entry.
+	// Longer candidates are not looked up.
+	maxTokenLen int
+
+	cleanText          bool
+	handleChineseChars bool
+	lowercase          bool
+
+	// added are the tokens matched in the raw text before normalization.
+	added   []wordPieceAddedToken
+	special map[int]bool
+
+	single, pair           []templatePiece
+	singleAdded, pairAdded int
+	specialTokens          map[string]templateSpecialToken
+	maxLength              int
+	padLength              int
+	padBatchLongest        bool
+	padID, padTypeID       int
+	padToken               string
+	decodePrefix           string
+	cleanup                bool
+
+	scratch sync.Pool
+}
+
+type wordPieceAddedToken struct {
+	content string
+	id      int
+}
+
+// templatePiece is a special token or one of the sequences of a template
+// post-processor.
+type templatePiece struct {
+	special  string
+	sequence int
+	typeID   int
+}
+
+type templateSpecialToken struct {
+	ids    []int
+	tokens []string
+}
+
+// wordPieceSequence is a tokenized sequence before post-processing.
+type wordPieceSequence struct {
+	ids     []int
+	tokens  []string
+	offsets [][2]int
+}
+
+func (s *wordPieceSequence) reset() {
+	s.ids = s.ids[:0]
+	s.tokens = s.tokens[:0]
+	s.offsets = s.offsets[:0]
+}
+
+func (s *wordPieceSequence) append(id int, token string, start, end int) {
+	s.ids = append(s.ids, id)
+	s.tokens = append(s.tokens, token)
+	s.offsets = append(s.offsets, [2]int{start, end})
+}
+
+func (s *wordPieceSequence) truncate(n int) {
+	s.ids = s.ids[:n]
+	s.tokens = s.tokens[:n]
+	s.offsets = s.offsets[:n]
+}
+
+// wordPieceScratch holds the buffers reused across encodings.
+type wordPieceScratch struct {
+	// word is the normalized word being built, and starts and ends the
+	// original byte range of each of its bytes.
+	word       []byte
+	starts     []int
+	ends       []int
+	runeStarts []int
+	candidate  []byte
+	matches    []addedTokenMatch
+	selected   []addedTokenMatch
+	sequences  [2]wordPieceSequence
+}
+
+// wordPieceConfig is the subset of tokenizer.json read by
+// newWordPieceTokenizer.
+type wordPieceConfig struct {
+	Truncation *struct {
+		Direction string `json:"direction"`
+		MaxLength int    `json:"max_length"`
+		Strategy  string `json:"strategy"`
+		Stride    int    `json:"stride"`
+	} `json:"truncation"`
+	Padding *struct {
+		Strategy  json.RawMessage `json:"strategy"`
+		Direction string          `json:"direction"`
+		PadID     int             `json:"pad_id"`
+		PadTypeID int             `json:"pad_type_id"`
+		PadToken  string          `json:"pad_token"`
+	} `json:"padding"`
+	AddedTokens []struct {
+		ID         int    `json:"id"`
+		Content    string `json:"content"`
+		SingleWord bool   `json:"single_word"`
+		LStrip     bool   `json:"lstrip"`
+		RStrip     bool   `json:"rstrip"`
+		Normalized bool   `json:"normalized"`
+		Special    bool   `json:"special"`
+	} `json:"added_tokens"`
+	Normalizer *struct {
+		Type               string `json:"type"`
+		CleanText          bool   `json:"clean_text"`
+		HandleChineseChars bool   `json:"handle_chinese_chars"`
+		StripAccents       *bool  `json:"strip_accents"`
+		Lowercase          bool   `json:"lowercase"`
+	} `json:"normalizer"`
+	PreTokenizer *struct {
+		Type string `json:"type"`
+	} `json:"pre_tokenizer"`
+	PostProcessor *struct {
+		Type          string                `json:"type"`
+		Single        []templatePieceConfig `json:"single"`
+		Pair          []templatePieceConfig `json:"pair"`
+		SpecialTokens map[string]struct {
+			IDs    []int    `json:"ids"`
+			Tokens []string `json:"tokens"`
+		} `json:"special_tokens"`
+		Sep []any `json:"sep"`
+		Cls []any `json:"cls"`
+	} `json:"post_processor"`
+	Decoder *struct {
+		Type    string `json:"type"`
+		Prefix  string `json:"prefix"`
+		Cleanup bool   `json:"cleanup"`
+	} `json:"decoder"`
+	Model struct {
+		Type                    string         `json:"type"`
+		UnkToken                string         `json:"unk_token"`
+		ContinuingSubwordPrefix string         `json:"continuing_subword_prefix"`
+		MaxInputCharsPerWord    int            `json:"max_input_chars_per_word"`
+		Vocab                   map[string]int `json:"vocab"`
+	} `json:"model"`
+}
+
+type templatePieceConfig struct {
+	SpecialToken *struct {
+		ID     string `json:"id"`
+		TypeID int    `json:"type_id"`
+	} `json:"SpecialToken"`
+	Sequence *struct {
+		ID     string `json:"id"`
+		TypeID int    `json:"type_id"`
+	} `json:"Sequence"`
+}
+
+// newWordPieceTokenizer loads a tokenizer.json describing a BERT tokenizer.
+// Other normalizers, pre-tokenizers and models are rejected.
+func newWordPieceTokenizer(data []byte) (*wordPieceTokenizer, error) {
+	var config wordPieceConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse tokenizer config: %w", err)
+	}
+
+	if config.Model.Type != "WordPiece" {
+		return nil, fmt.Errorf("unsupported tokenizer model %q", config.Model.Type)
+	}
+	t := &wordPieceTokenizer{
+		vocab:                config.Model.Vocab,
+		prefix:               config.Model.ContinuingSubwordPrefix,
+		maxInputCharsPerWord: config.Model.MaxInputCharsPerWord,
+		special:              make(map[int]bool),
+		decodePrefix:         "##",
+	}
+	unkID, ok := t.vocab[config.Model.UnkToken]
+	if !ok {
+		return nil, fmt.Errorf("unknown token %q is not in the vocabulary", config.Model.UnkToken)
+	}
+	t.unkID = unkID
+	t.tokens = make([]string, len(t.vocab))
+	for token, id := range t.vocab {
+		if id < 0 || id >= len(t.tokens) || t.tokens[id] != "" {
+			return nil, fmt.Errorf("invalid vocabulary id %d for %q", id, token)
+		}
+		t.tokens[id] = token
+		t.maxTokenLen = max(t.maxTokenLen, len(token))
+	}
+
+	if n := config.Normalizer; n != nil {
+		if n.Type != "BertNormalizer" {
+			return nil, fmt.Errorf("unsupported normalizer %q", n.Type)
+		}
+		if n.StripAccents != nil && *n.StripAccents {
+			return nil, fmt.Errorf("unsupported normalizer option strip_accents")
+		}
+		t.cleanText = n.CleanText
+		t.handleChineseChars = n.HandleChineseChars
+		t.lowercase = n.Lowercase
+	}
+	if p := config.PreTokenizer; p == nil || p.Type != "BertPreTokenizer" {
+		return nil, fmt.Errorf("unsupported pre-tokenizer, expected BertPreTokenizer")
+	}
+
+	var special, others []wordPieceAddedToken
+	for _, added := range config.AddedTokens {
+		if added.Normalized || added.SingleWord || added.LStrip || added.RStrip {
+			return nil, fmt.Errorf("unsupported options for added token %q", added.Content)
+		}
+		if added.Content == "" {
+			continue
+		}
+		id, ok := t.vocab[added.Content]
+		if !ok {
+			return nil, fmt.Errorf("added token %q is not in the vocabulary", added.Content)
+		}
+		token := wordPieceAddedToken{content: added.Content, id: id}
+		if added.Special {
+			special = append(special, token)
+			t.special[id] = true
+		} else {
+			others = append(others, token)
+		}
+	}
+	// Special tokens are matched first
+	t.added = append(special, others...)
+
+	if err := t.loadPostProcessor(&config); err != nil {
+		return nil, err
+	}
+
+	if tr := config.Truncation; tr != nil {
+		if tr.Strategy != "LongestFirst" || tr.Stride != 0 || (tr.Direction != "" && tr.Direction != "Right") {
+			return nil, fmt.Errorf("unsupported truncation %s with stride %d", tr.Strategy, tr.Stride)
+		}
+		t.maxLength = tr.MaxLength
+	}
+	if p := config.Padding; p != nil {
+		if p.Direction != "" && p.Direction != "Right" {
+			return nil, fmt.Errorf("unsupported padding direction %q", p.Direction)
+		}
+		var fixed struct {
+			Fixed int `json:"Fixed"`
+		}
+		var strategy string
+		switch {
+		case json.Unmarshal(p.Strategy, &strategy) == nil && strategy == "BatchLongest":
+			t.padBatchLongest = true
+		case json.Unmarshal(p.Strategy, &fixed) == nil && fixed.Fixed > 0:
+			t.padLength = fixed.Fixed
+		default:
+			return nil, fmt.Errorf("unsupported padding strategy %s", p.Strategy)
+		}
+		t.padID = p.PadID
+		t.padTypeID = p.PadTypeID
+		t.padToken = p.PadToken
+	}
+
+	if d := config.Decoder; d != nil {
+		if d.Type != "WordPiece" {
+			return nil, fmt.Errorf("unsupported decoder %q", d.Type)
+		}
+		t.decodePrefix = d.Prefix
+		t.cleanup = d.Cleanup
+	}
+
+	t.scratch.New = func() any {
+		return &wordPieceScratch{}
+	}
+	return t, nil
+}
+
+func (t *wordPieceTokenizer) loadPostProcessor(config *wordPieceConfig) error {
+	p := config.PostProcessor
+	if p == nil {
+		t.single = []templatePiece{{sequence: 0}}
+		t.pair = []templatePiece{{sequence: 0}, {sequence: 1, typeID: 1}}
+		return nil
+	}
+
+	t.specialTokens = make(map[string]templateSpecialToken)
+	switch p.Type {
+	case "TemplateProcessing":
+		for name, special := range p.SpecialTokens {
+			if len(special.IDs) != len(special.Tokens) {
+				return fmt.Errorf("special token %q has %d ids for %d tokens", name, len(special.IDs), len(special.Tokens))
+			}
+			t.specialTokens[name] = templateSpecialToken{ids: special.IDs, tokens: special.Tokens}
+		}
+		var err error
+		if t.single, err = t.template(p.Single); err != nil {
+			return err
+		}
+		if t.pair, err = t.template(p.Pair); err != nil {
+			return err
+		}
+	case "BertProcessing":
+		for _, special := range [][]any{p.Cls, p.Sep} {
+			if len(special) != 2 {
+				return fmt.Errorf("invalid BertProcessing special token %v", special)
+			}
+			token, ok := special[0].(string)
+			id, isNumber := special[1].(float64)
+			if !ok || !isNumber {
+				return fmt.Errorf("invalid BertProcessing special token %v", special)
+			}
+			t.specialTokens[token] = templateSpecialToken{ids: []int{int(id)}, tokens: []string{token}}
+		}
+		cls, sep := p.Cls[0].(string), p.Sep[0].(string)
+		t.single = []templatePiece{{special: cls}, {sequence: 0}, {special: sep}}
+		t.pair = []templatePiece{{special: cls}, {sequence: 0}, {special: sep}, {sequence: 1, typeID: 1}, {special: sep, typeID: 1}}
+	default:
+		return fmt.Errorf("unsupported post-processor %q", p.Type)
+	}
+
+	for _, piece := range t.single {
+		t.singleAdded += len(t.specialTokens[piece.special].ids)
+	}
+	for _, piece := range t.pair {
+		t.pairAdded += len(t.specialTokens[piece.special].ids)
+	}
+	return nil
+}
+
+func (t *wordPieceTokenizer) template(pieces []templatePieceConfig) ([]templatePiece, error) {
+	template := make([]templatePiece, 0, len(pieces))
+	for _, piece := range pieces {
+		switch {
+		case piece.SpecialToken != nil:
+			if _, ok := t.specialTokens[piece.SpecialToken.ID]; !ok {
+				return nil, fmt.Errorf("unknown special token %q in template", piece.SpecialToken.ID)
+			}
+			template = append(template, templatePiece{special: piece.SpecialToken.ID, typeID: piece.SpecialToken.TypeID})
+		case piece.Sequence != nil && (piece.Sequence.ID == "A" || piece.Sequence.ID == "B"):
+			sequence := 0
+			if piece.Sequence.ID == "B" {
+				sequence = 1
+			}
+			template = append(template, templatePiece{sequence: sequence, typeID: piece.Sequence.TypeID})
+		default:
+			return nil, fmt.Errorf("invalid template piece")
+		}
+	}
+	return template, nil
+}
+
+func (t *wordPieceTokenizer) encode(text string, addSpecialTokens bool) (*tokenizer.Encoding, error) {
+	encoding := t.encodeSequences(text, "", false, addSpecialTokens)
+	return &encoding, nil
+}
+
+func (t *wordPieceTokenizer) encodeBatch(texts []string, addSpecialTokens bool) ([]tokenizer.Encoding, error) {
+	encodings := make([]tokenizer.Encoding, len(texts))
+	for i, text := range texts {
+		encodings[i] = t.encodeSequences(text, "", false, addSpecialTokens)
+	}
+	t.padBatch(encodings)
+	return encodings, nil
+}
+
+func (t *wordPieceTokenizer) encodePairs(pairs [][2]string, addSpecialTokens bool) ([]tokenizer.Encoding, error) {
+	encodings := make([]tokenizer.Encoding, len(pairs))
+	for i, p := range pairs {
+		encodings[i] = t.encodeSequences(p[0], p[1], true, addSpecialTokens)
+	}
+	t.padBatch(encodings)
+	return encodings, nil
+}
+
+func (t *wordPieceTokenizer) countTokens(text string, addSpecialTokens bool) (int, error) {
+	s := t.scratch.Get().(*wordPieceScratch)
+	defer t.scratch.Put(s)
+
+	t.tokenize(text, &s.sequences[0], s)
+	n := len(s.sequences[0].ids)
+	if addSpecialTokens {
+		n += t.singleAdded
+	}
+	return n, nil
+}
+
+func (t *wordPieceTokenizer) decode(ids []int, skipSpecialTokens bool) string {
+	var b strings.Builder
+	first := true
+	for _, id := range ids {
+		if id < 0 || id >= len(t.tokens) || (skipSpecialTokens && t.special[id]) {
+			continue
+		}
+		token := t.tokens[id]
+		if !first {
+			if rest, ok := strings.CutPrefix(token, t.decodePrefix); ok {
+				token = rest
+			} else {
+				token = " " + token
+			}
+		}
+		first = false
+		if t.cleanup {
+			token = cleanupDecoded(token)
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+var decodeCleanup = strings.NewReplacer(
+	" .", ".", " ?", "?", " !", "!", " ,", ",", " ' ", "'", " n't", "n't",
+	" 'm", "'m", " do not", " don't", " 's", "'s", " 've", "'ve", " 're", "'re")
+
+func cleanupDecoded(token string) string {
+	if !strings.HasPrefix(token, " ") {
+		return token
+	}
+	return decodeCleanup.Replace(token)
+}
+
+// encodeSequences tokenizes a and, for pairs, b, then truncates, applies the
+// template and pads the result.
+func (t *wordPieceTokenizer) encodeSequences(a, b string, pair bool, addSpecialTokens bool) tokenizer.Encoding {
+	s := t.scratch.Get().(*wordPieceScratch)
+	defer t.scratch.Put(s)
+
+	first, second := &s.sequences[0], &s.sequences[1]
+	t.tokenize(a, first, s)
+	second.reset()
+	if pair {
+		t.tokenize(b, second, s)
+	}
+
+	template, added := t.single, t.singleAdded
+	if pair {
+		template, added = t.pair, t.pairAdded
+	}
+	if t.maxLength > 0 {
+		maxLength := t.maxLength
+		if addSpecialTokens {
+			maxLength -= added
+		}
+		t.truncate(first, second, maxLength)
+	}
+
+	n := 0
+	for _, piece := range template {
+		switch {
+		case piece.special == "":
+			n += len(s.sequences[piece.sequence].ids)
+		case addSpecialTokens:
+			n += len(t.specialTokens[piece.special].ids)
+		}
+	}
+	length := max(n, t.padLength)
+
+	ints := make([]int, 4*length)
+	encoding := tokenizer.Encoding{
+		Ids:              ints[0:length:length],
+		TypeIds:          ints[length : 2*length : 2*length],
+		SpecialTokenMask: ints[2*length : 3*length : 3*length],
+		AttentionMask:    ints[3*length : 4*length],
+		Tokens:           make([]string, length),
+		Offsets:          make([][]int, length),
+	}
+	offsets := make([]int, 2*length)
+	for i := range encoding.Offsets {
+		encoding.Offsets[i] = offsets[2*i : 2*i+2 : 2*i+2]
+	}
+
+	i := 0
+	for _, piece := range template {
+		if piece.special != "" {
+			if !addSpecialTokens {
+				continue
+			}
+			special := t.specialTokens[piece.special]
+			for j, id := range special.ids {
+				encoding.Ids[i] = id
+				encoding.Tokens[i] = special.tokens[j]
+				encoding.TypeIds[i] = piece.typeID
+				encoding.SpecialTokenMask[i] = 1
+				encoding.AttentionMask[i] = 1
+				i++
+			}
+			continue
+		}
+		sequence := &s.sequences[piece.sequence]
+		for j, id := range sequence.ids {
+			encoding.Ids[i] = id
+			encoding.Tokens[i] = sequence.tokens[j]
+			encoding.TypeIds[i] = piece.typeID
+			encoding.Offsets[i][0] = sequence.offsets[j][0]
+			encoding.Offsets[i][1] = sequence.offsets[j][1]
+			encoding.AttentionMask[i] = 1
+			i++
+		}
+	}
+	t.pad(&encoding, i)
+	return encoding
+}
+
+// truncate shortens the sequences to at most maxLength tokens with the
+// LongestFirst strategy of the sugarme tokenizer: a token is removed from
+// the second sequence at every step, and from the first one while it is the
+// longest. A sequence whose target length is not positive is left whole.
+func (t *wordPieceTokenizer) truncate(first, second *wordPieceSequence, maxLength int) {
+	total := len(first.ids) + len(second.ids)
+	if maxLength == 0 || total < maxLength {
+		return
+	}
+	nFirst, nSecond := len(first.ids), len(second.ids)
+	for range total - maxLength {
+		if nFirst > nSecond {
+			nFirst--
+		}
+		nSecond--
+	}
+	if nFirst > 0 && nFirst < len(first.ids) {
+		first.truncate(nFirst)
+	}
+	if nSecond > 0 && nSecond < len(second.ids) {
+		second.truncate(nSecond)
+	}
+}
+
+// pad fills the encoding with padding tokens from position n.
+func (t *wordPieceTokenizer) pad(encoding *tokenizer.Encoding, n int) {
+	for i := n; i < len(encoding.Ids); i++ {
+		encoding.Ids[i] = t.padID
+		encoding.Tokens[i] = t.padToken
+		encoding.TypeIds[i] = t.padTypeID
+		encoding.SpecialTokenMask[i] = 1
+	}
+}
+
+// padBatch pads the encodings to the longest one with the BatchLongest
+// strategy.
+func (t *wordPieceTokenizer) padBatch(encodings []tokenizer.Encoding) {
+	if !t.padBatchLongest {
+		return
+	}
+	longest := 0
+	for _, encoding := range encodings {
+		longest = max(longest, len(encoding.Ids))
+	}
+	for i := range encodings {
+		n := len(encodings[i].Ids)
+		if n == longest {
+			continue
+		}
+		e := &encodings[i]
+		e.Ids = append(e.Ids, make([]int, longest-n)...)
+		e.TypeIds = append(e.TypeIds, make([]int, longest-n)...)
+		e.SpecialTokenMask = append(e.SpecialTokenMask, make([]int, longest-n)...)
+		e.AttentionMask = append(e.AttentionMask, make([]int, longest-n)...)
+		e.Tokens = append(e.Tokens, make([]string, longest-n)...)
+		for range longest - n {
+			e.Offsets = append(e.Offsets, []int{0, 0})
+		}
+		t.pad(e, n)
+	}
+}
+
+// tokenize splits text on the added tokens and tokenizes the segments in
+// between.
+func (t *wordPieceTokenizer) tokenize(text string, sequence *wordPieceSequence, s *wordPieceScratch) {
+	sequence.reset()
+	start := 0
+	for _, match := range t.addedTokenMatches(text, s) {
+		if start < match.start {
+			t.tokenizeSegment(text, start, match.start, sequence, s)
+		}
+		added := t.added[match.token]
+		sequence.append(added.id, added.content, match.start, match.end)
+		start = match.end
+	}
+	if start < len(text) {
+		t.tokenizeSegment(text, start, len(text), sequence, s)
+	}
+}
+
+// addedTokenMatch is an occurrence of t.added[token] in a text.
+type addedTokenMatch struct {
+	token      int
+	start, end int
+}
+
+type addedTokenMatchesByStart []addedTokenMatch
+
+func (m addedTokenMatchesByStart) Len() int           { return len(m) }
+func (m addedTokenMatchesByStart) Less(i, j int) bool { return m[i].start < m[j].start }
+func (m addedTokenMatchesByStart) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+type addedTokenMatchesByToken []addedTokenMatch
+
+func (m addedTokenMatchesByToken) Len() int           { return len(m) }
+func (m addedTokenMatchesByToken) Less(i, j int) bool { return m[i].token < m[j].token }
+func (m addedTokenMatchesByToken) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+// addedTokenMatches returns the added tokens to extract from text.
+//
+// It selects them as the sugarme tokenizer does: matches are visited by
+// added token rather than by position, and those starting before the end of
+// the previous selected match are dropped. "[MASK][PAD]" thus only yields
+// [PAD], which comes first in added_tokens.
+func (t *wordPieceTokenizer) addedTokenMatches(text string, s *wordPieceScratch) []addedTokenMatch {
+	matches := s.matches[:0]
+	for i, added := range t.added {
+		for start := 0; ; {
+			j := strings.Index(text[start:], added.content)
+			if j < 0 {
+				break
+			}
+			start += j + len(added.content)
+			matches = append(matches, addedTokenMatch{token: i, start: start - len(added.content), end: start})
+		}
+	}
+	s.matches = matches
+	if len(matches) == 0 {
+		return nil
+	}
+
+	sort.Sort(addedTokenMatchesByStart(matches))
+	sort.Sort(addedTokenMatchesByToken(matches))
+	selected := s.selected[:0]
+	end := 0
+	for i, match := range matches {
+		if match.start < end {
+			continue
+		}
+		if i+1 < len(matches) {
+			sort.Sort(addedTokenMatchesByToken(matches[i:]))
+		}
+		selected = append(selected, matches[i])
+		end = match.end
+	}
+	s.selected = selected
+	return selected
+}
+
+// tokenizeSegment normalizes text[from:to] and splits it into words on
+// whitespace and punctuation, as the BertNormalizer and BertPreTokenizer do,
+// then tokenizes every word.
+func (t *wordPieceTokenizer) tokenizeSegment(text string, from, to int, sequence *wordPieceSequence, s *wordPieceScratch) {
+	s.word, s.starts, s.ends = s.word[:0], s.starts[:0], s.ends[:0]
+	for i := from; i < to; {
+		r, size := utf8.DecodeRuneInString(text[i:to])
+		start, end := i, i+size
+		i = end
+
+		if t.cleanText && (r == 0 || r == utf8.RuneError || isBertControl(r)) {
+			continue
+		}
+		if isBertWhitespace(r) {
+			t.tokenizeWord(sequence, s)
+			continue
+		}
+		if t.lowercase {
+			r = unicode.ToLower(r)
+		}
+		if isBertPunctuation(r) || (t.handleChineseChars && isChineseChar(r)) {
+			t.tokenizeWord(sequence, s)
+			s.appendRune(r, start, end)
+			t.tokenizeWord(sequence, s)
+			continue
+		}
+		s.appendRune(r, start, end)
+	}
+	t.tokenizeWord(sequence, s)
+}
+
+func (s *wordPieceScratch) appendRune(r rune, start, end int) {
+	n := len(s.word)
+	s.word = utf8.AppendRune(s.word, r)
+	for range len(s.word) - n {
+		s.starts = append(s.starts, start)
+		s.ends = append(s.ends, end)
+	}
+}
+
+// tokenizeWord splits the pending word into the longest vocabulary entries,
+// or a single unknown token, and clears it.
+//
+// The offsets of a token spanning the runes [start, end) of the word are
+// those of its bytes [start, end), which is what the sugarme tokenizer
+// reports for words with multi-byte characters.
+func (t *wordPieceTokenizer) tokenizeWord(sequence *wordPieceSequence, s *wordPieceScratch) {
+	if len(s.word) == 0 {
+		return
+	}
+	defer func() {
+		s.word, s.starts, s.ends = s.word[:0], s.starts[:0], s.ends[:0]
+	}()
+
+	s.runeStarts = s.runeStarts[:0]
+	for i := range string(s.word) {
+		s.runeStarts = append(s.runeStarts, i)
+	}
+	chars := len(s.runeStarts)
+	s.runeStarts = append(s.runeStarts, len(s.word))
+
+	if chars <= t.maxInputCharsPerWord {
+		first := len(sequence.ids)
+		start := 0
+		for start < chars {
+			end := chars
+			for ; end > start; end-- {
+				candidate := s.word[s.runeStarts[start]:s.runeStarts[end]]
+				if start > 0 {
+					if len(t.prefix)+len(candidate) > t.maxTokenLen {
+						continue
+					}
+					s.candidate = append(append(s.candidate[:0], t.prefix...), candidate...)
+					candidate = s.candidate
+				} else if len(candidate) > t.maxTokenLen {
+					continue
+				}
+				if id, ok := t.vocab[string(candidate)]; ok {
+					sequence.append(id, t.tokens[id], s.starts[start], s.ends[end-1])
+					break
+				}
+			}
+			if end == start {
+				sequence.truncate(first)
+				break
+			}
+			start = end
+		}
+		if start == chars {
+			return
+		}
+	}
+	sequence.append(t.unkID, t.tokens[t.unkID], s.starts[0], s.ends[chars-1])
+}
+
+// isBertWhitespace reports whether the BertPreTokenizer splits on r.
+func isBertWhitespace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+// isBertControl reports whether r is removed by the BertNormalizer.
+func isBertControl(r rune) bool {
+	switch r {
+	case '\t', '\n', '\r':
+		return false
+	}
+	return unicode.In(r, unicode.Cc, unicode.Cf)
+}
+
+// isBertPunctuation reports whether r is a word of its own: an ASCII symbol
+// or a Unicode punctuation.
+func isBertPunctuation(r rune) bool {
+	if r < utf8.RuneSelf {
+		return r >= '!' && r <= '/' || r >= ':' && r <= '@' || r >= '[' && r <= '`' || r >= '{' && r <= '~'
+	}
+	return unicode.IsPunct(r)
+}
+
+// isChineseChar reports whether r is in a CJK Unified Ideographs block.
+func isChineseChar(r rune) bool {
+	return r >= 0x4e00 && r <= 0x9fff ||
+		r >= 0x3400 && r <= 0x4dbf ||
+		r >= 0xf900 && r <= 0xfaff ||
+		r >= 0x20000 && r <= 0x2a6df ||
+		r >= 0x2a700 && r <= 0x2ceaf ||
+		r >= 0x2f800 && r <= 0x2fa1f
+}
@@ -0,0 +1,249 @@
+package all_minilm_l6_v2_test
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+	"github.com/sugarme/tokenizer"
+)
+
+var wordPieceCorpus = []string{
+	"",
+	"   ",
+	"Hello, World!",
+	"The quick brown fox jumps over the lazy dog.",
+	"Tokenization of unaffable embeddings isn't trivial; e.g. U.S.A. & co.",
+	"  héllo wörld  ",
+	"naïveté über café Ångström",
+	"中文abc 日本語のテキスト 한국어",
+	"a[SEP]b [CLS][MASK][UNK][PAD] [sep] [SEP",
+	"tab\there\x01x\x00y\u200bz\ufeff",
+	"a\u00a0b\u3000c\vd\fe\r\nf",
+	"emoji 😀👍🏽 and symbols €$%^&*()_+={}|<>~`",
+	"combining e\u0301 and a\u0308",
+	"ERR-4042: connection refused (timeout=30s) at 2024-01-01T00:00:00Z",
+	"http://example.com/path?query=1&other=two#fragment",
+	"Ελληνικά Русский текст العربية עברית हिन्दी",
+	"«quoted» “smart” ‘quotes’ — dash … ellipsis ¿qué? ¡sí!",
+	strings.Repeat("supercalifragilisticexpialidocious", 4),
+	strings.Repeat("word ", 200),
+	strings.Repeat("中", 300),
+	"replacement \ufffd character",
+	"\ufffd\x00leading removed characters",
+	"after [SEP]\u200b\x01a special token",
+	"ɐ ⱥ ᵹ lowercased Ɐ Ⱥ Ᵹ",
+}
+
+// randomText generates texts mixing scripts, punctuation, whitespace,
+// control characters, special tokens and vocabulary entries.
+func randomText(rng *rand.Rand, vocabulary []string) string {
+	pools := []string{
+		"abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+		"!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+		"     \t\n\r\f\v",
+		"\x00\x01\x1f\u007f\u200b\u200d\ufeff\u00ad\ufffd",
+		"éèêëàâäîïôöùûüçñÉÀÇÖÜßøåæœ",
+		"αβγδεζηθΑΒΓΔабвгдАБВГДжЖ",
+		"中文日本語漢字한국어ひらがなカタカナ",
+		"😀👍🏽🎉❤️",
+		"\u0301\u0308\u0327",
+		"。，、！？…—«»“”‘’¿¡§¶•",
+		"\u00a0 \u3000 ",
+	}
+	var b strings.Builder
+	for range rng.Intn(60) {
+		switch rng.Intn(6) {
+		case 0, 1:
+			word := vocabulary[rng.Intn(len(vocabulary))]
+			if rng.Intn(3) == 0 {
+				word = strings.ToUpper(word)
+			}
+			b.WriteString(strings.TrimPrefix(word, "##"))
+		case 2:
+			b.WriteByte(' ')
+		case 3:
+			b.WriteString([]string{"[CLS]", "[SEP]", "[PAD]", "[MASK]", "[UNK]", "[sep]", "["}[rng.Intn(7)])
+		default:
+			pool := []rune(pools[rng.Intn(len(pools))])
+			for range 1 + rng.Intn(4) {
+				b.WriteRune(pool[rng.Intn(len(pool))])
+			}
+		}
+	}
+	return b.String()
+}
+
+// referenceInput returns text without the characters removed by cleaning,
+// which the sugarme tokenizer mangles the alignments of, and even the tokens
+// when they are at the start of the text or after a special token. It also
+// reports whether the offsets of the reference are sound for text: they rely
+// on lowercasing keeping the byte length of every character.
+func referenceInput(text string) (string, bool) {
+	var b strings.Builder
+	sound := true
+	for _, r := range text {
+		if utf8.RuneLen(unicode.ToLower(r)) != utf8.RuneLen(r) {
+			sound = false
+		}
+		if r == 0 || r == utf8.RuneError || (unicode.In(r, unicode.Cc, unicode.Cf) && r != '\t' && r != '\n' && r != '\r') {
+			sound = false
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), sound
+}
+
+// encodeReference returns the encoding of the sugarme tokenizer, or false if
+// it panics, as it does on some characters growing when lowercased.
+func encodeReference(t *testing.T, encode func() (*tokenizer.Encoding, error)) (encoding *tokenizer.Encoding, ok bool) {
+	t.Helper()
+
+	defer func() {
+		if recover() != nil {
+			encoding, ok = nil, false
+		}
+	}()
+	encoding, err := encode()
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	return encoding, true
+}
+
+func compareEncodings(t *testing.T, label string, expected, actual *tokenizer.Encoding, checkOffsets bool) {
+	t.Helper()
+
+	if !slices.Equal(expected.Ids, actual.Ids) {
+		t.Fatalf("Expected ids %v for %s, got %v", expected.Ids, label, actual.Ids)
+	}
+	if !slices.Equal(expected.Tokens, actual.Tokens) {
+		t.Fatalf("Expected tokens %q for %s, got %q", expected.Tokens, label, actual.Tokens)
+	}
+	if !slices.Equal(expected.TypeIds, actual.TypeIds) {
+		t.Fatalf("Expected type ids %v for %s, got %v", expected.TypeIds, label, actual.TypeIds)
+	}
+	if !slices.Equal(expected.AttentionMask, actual.AttentionMask) {
+		t.Fatalf("Expected attention mask %v for %s, got %v", expected.AttentionMask, label, actual.AttentionMask)
+	}
+	if !slices.Equal(expected.SpecialTokenMask, actual.SpecialTokenMask) {
+		t.Fatalf("Expected special token mask %v for %s, got %v", expected.SpecialTokenMask, label, actual.SpecialTokenMask)
+	}
+	if checkOffsets && !slices.EqualFunc(expected.Offsets, actual.Offsets, slices.Equal) {
+		t.Fatalf("Expected offsets %v for %s, got %v", expected.Offsets, label, actual.Offsets)
+	}
+}
+
+func newTokenizers(t *testing.T) (*all_minilm_l6_v2.Tokenizer, *all_minilm_l6_v2.Tokenizer) {
+	t.Helper()
+
+	reference, err := all_minilm_l6_v2.NewTokenizer()
+	if err != nil {
+		t.Fatalf("Failed to create tokenizer: %v", err)
+	}
+	wordPiece, err := all_minilm_l6_v2.NewWordPieceTokenizer()
+	if err != nil {
+		t.Fatalf("Failed to create WordPiece tokenizer: %v", err)
+	}
+	return reference, wordPiece
+}
+
+func TestWordPieceMatchesReference(t *testing.T) {
+	reference, wordPiece := newTokenizers(t)
+
+	// Draw vocabulary entries from the reference so that texts are made of
+	// real word pieces
+	var vocabulary []string
+	for id := 1000; id < 30522; id += 7 {
+		vocabulary = append(vocabulary, reference.Decode([]int{id}, true))
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	corpus := slices.Clone(wordPieceCorpus)
+	for len(corpus) < 3000 {
+		corpus = append(corpus, randomText(rng, vocabulary))
+	}
+
+	// The WordPiece tokenizer intentionally differs from the reference where
+	// the reference is wrong, see NewWordPieceTokenizer. It is checked to
+	// encode every text as the reference encodes the text without the
+	// characters removed by cleaning, see referenceInput, which is what the
+	// reference would produce if it handled them. The texts on which the
+	// reference panics are still encoded, but only checked not to make the
+	// WordPiece tokenizer panic
+	compared := 0
+	for i, text := range corpus {
+		input, sound := referenceInput(text)
+		other := corpus[(i*31+7)%len(corpus)]
+		otherInput, otherSound := referenceInput(other)
+		for _, addSpecialTokens := range []bool{false, true} {
+			actual, err := wordPiece.Encode(text, addSpecialTokens)
+			if err != nil {
+				t.Fatalf("Failed to encode %q: %v", text, err)
+			}
+			expected, ok := encodeReference(t, func() (*tokenizer.Encoding, error) { return reference.Encode(input, addSpecialTokens) })
+			if ok {
+				compareEncodings(t, strconvQuote(text), expected, actual, sound)
+				compared++
+			}
+
+			actual, err = wordPiece.EncodePair(text, other, addSpecialTokens)
+			if err != nil {
+				t.Fatalf("Failed to encode pair: %v", err)
+			}
+			expected, ok = encodeReference(t, func() (*tokenizer.Encoding, error) { return reference.EncodePair(input, otherInput, addSpecialTokens) })
+			if !ok {
+				continue
+			}
+			compareEncodings(t, strconvQuote(text)+" and "+strconvQuote(other), expected, actual, sound && otherSound)
+
+			for _, skipSpecialTokens := range []bool{false, true} {
+				if e, a := reference.Decode(expected.Ids, skipSpecialTokens), wordPiece.Decode(expected.Ids, skipSpecialTokens); e != a {
+					t.Fatalf("Expected %q decoding %v, got %q", e, expected.Ids, a)
+				}
+			}
+		}
+	}
+	if compared < len(corpus)*2*9/10 {
+		t.Errorf("Expected the reference to encode most texts, got %d encodings for %d texts", compared, len(corpus))
+	}
+}
+
+func strconvQuote(text string) string {
+	if len(text) > 80 {
+		text = text[:80] + "..."
+	}
+	return "\"" + strings.ToValidUTF8(text, "?") + "\""
+}
+
+func TestWordPieceLowercaseLength(t *testing.T) {
+	reference, wordPiece := newTokenizers(t)
+
+	// The ids match, and the offsets point at the original characters
+	text := "İstanbul is big"
+	expected, _ := reference.Encode(text, true)
+	actual, err := wordPiece.Encode(text, true)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if !slices.Equal(expected.Ids, actual.Ids) {
+		t.Errorf("Expected ids %v, got %v", expected.Ids, actual.Ids)
+	}
+	if !slices.Equal(actual.Offsets[1], []int{0, 9}) || !slices.Equal(actual.Offsets[2], []int{10, 12}) {
+		t.Errorf("Expected offsets [0 9] and [10 12], got %v", actual.Offsets[:4])
+	}
+
+	// The reference tokenizer panics on characters growing when lowercased
+	actual, err = wordPiece.Encode("Ⱥ c", false)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if actual.Tokens[0] != "[UNK]" || !slices.Equal(actual.Offsets[0], []int{0, 2}) || !slices.Equal(actual.Offsets[1], []int{3, 4}) {
+		t.Errorf("Expected [UNK] at [0 2] then c at [3 4], got %q at %v", actual.Tokens[:2], actual.Offsets[:2])
+	}
+}
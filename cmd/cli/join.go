@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	joinLeftColumn  string
+	joinRightColumn string
+	joinThreshold   float64
+	joinK           int
+	joinAssign      string
+	joinBatchSize   int
+	joinOutput      string
+)
+
+var assignments = map[string]all_minilm_l6_v2.Assignment{
+	"none":      all_minilm_l6_v2.NoAssignment,
+	"greedy":    all_minilm_l6_v2.GreedyAssignment,
+	"hungarian": all_minilm_l6_v2.HungarianAssignment,
+}
+
+func newJoinCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "join LEFT.csv RIGHT.csv",
+		Short: "Match the records of two CSV files by semantic similarity",
+		Long: `Embed a column of two CSV files having a header row and match each left record with the most similar right records.
+
+Matched pairs are printed with their cosine similarity, followed by the unmatched records of each side.`,
+		Args: cobra.ExactArgs(2),
+		Run:  runJoin,
+	}
+
+	cmd.Flags().StringVar(&joinLeftColumn, "left-column", "", "Column of the left file to match on (default: first column)")
+	cmd.Flags().StringVar(&joinRightColumn, "right-column", "", "Column of the right file to match on (default: first column)")
+	cmd.Flags().Float64Var(&joinThreshold, "threshold", 0.8, "Minimum cosine similarity of a match")
+	cmd.Flags().IntVarP(&joinK, "top-k", "k", 5, "Maximum number of matches per left record")
+	cmd.Flags().StringVar(&joinAssign, "assign", "none", "One-to-one assignment: 'none', 'greedy', or 'hungarian'")
+	cmd.Flags().IntVar(&joinBatchSize, "batch-size", all_minilm_l6_v2.DefaultCorpusBatchSize, "Number of records embedded at once")
+	cmd.Flags().StringVarP(&joinOutput, "output", "o", "csv", "Output format: 'csv' or 'json'")
+	return cmd
+}
+
+func runJoin(cmd *cobra.Command, args []string) {
+	assignment, ok := assignments[joinAssign]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown assignment '%s'\n", joinAssign)
+		os.Exit(1)
+	}
+	if joinOutput != "csv" && joinOutput != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown output format '%s'\n", joinOutput)
+		os.Exit(1)
+	}
+	if joinK <= 0 {
+		fmt.Fprintf(os.Stderr, "Top k must be positive\n")
+		os.Exit(1)
+	}
+
+	left, err := readColumn(args[0], joinLeftColumn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read left records: %v\n", err)
+		os.Exit(1)
+	}
+	right, err := readColumn(args[1], joinRightColumn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read right records: %v\n", err)
+		os.Exit(1)
+	}
+
+	var opts []all_minilm_l6_v2.ModelOption
+	if runtimePath != "" {
+		opts = append(opts, all_minilm_l6_v2.WithRuntimePath(runtimePath))
+	}
+
+	model, err := all_minilm_l6_v2.NewModel(opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize model: %v\n", err)
+		os.Exit(1)
+	}
+	defer model.Close()
+
+	result, err := all_minilm_l6_v2.Join(context.Background(), model, left, right, joinThreshold, joinK,
+		all_minilm_l6_v2.WithAssignment(assignment),
+		all_minilm_l6_v2.WithJoinBatchSize(joinBatchSize))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to join records: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := outputJoin(left, right, result); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// readColumn returns the values of a column of a CSV file having a header row.
+func readColumn(path, column string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s has no header row", path)
+	}
+
+	index := 0
+	if column != "" {
+		index = slices.Index(records[0], column)
+		if index == -1 {
+			return nil, fmt.Errorf("%s has no column '%s'", path, column)
+		}
+	}
+	values := make([]string, 0, len(records)-1)
+	for i, record := range records[1:] {
+		if index >= len(record) {
+			return nil, fmt.Errorf("row %d of %s has no column %d", i+1, path, index)
+		}
+		values = append(values, record[index])
+	}
+	return values, nil
+}
+
+// joinRow is a line of the join output. Rows are numbered from 1, the header
+// excluded, and a zero row means the record is missing on that side.
+type joinRow struct {
+	LeftRow  int      `json:"left_row,omitempty"`
+	Left     string   `json:"left,omitempty"`
+	RightRow int      `json:"right_row,omitempty"`
+	Right    string   `json:"right,omitempty"`
+	Score    *float64 `json:"score,omitempty"`
+}
+
+func outputJoin(left, right []string, result *all_minilm_l6_v2.JoinResult) error {
+	var rows []joinRow
+	for _, m := range result.Matches {
+		score := m.Score
+		rows = append(rows, joinRow{
+			LeftRow: m.Left + 1, Left: left[m.Left],
+			RightRow: m.Right + 1, Right: right[m.Right],
+			Score: &score,
+		})
+	}
+	for _, i := range result.UnmatchedLeft {
+		rows = append(rows, joinRow{LeftRow: i + 1, Left: left[i]})
+	}
+	for _, i := range result.UnmatchedRight {
+		rows = append(rows, joinRow{RightRow: i + 1, Right: right[i]})
+	}
+
+	if joinOutput == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"left_row", "left", "right_row", "right", "score"})
+	for _, row := range rows {
+		record := []string{"", row.Left, "", row.Right, ""}
+		if row.LeftRow != 0 {
+			record[0] = strconv.Itoa(row.LeftRow)
+		}
+		if row.RightRow != 0 {
+			record[2] = strconv.Itoa(row.RightRow)
+		}
+		if row.Score != nil {
+			record[4] = strconv.FormatFloat(*row.Score, 'f', 6, 64)
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -23,13 +23,19 @@ func main() {
 		Use:   "all-minilm-l6-v2-go",
 		Short: "Generate sentence embeddings using all-MiniLM-L6-v2 model",
 		Long:  `A CLI tool to generate 384-dimensional sentence embeddings from text input using the all-MiniLM-L6-v2 model.`,
-		Run:   runEmbedding,
+		// Positional arguments are ignored but accepted despite the
+		// subcommands.
+		Args: cobra.ArbitraryArgs,
+		Run:  runEmbedding,
 	}
 
-	rootCmd.Flags().StringVar(&runtimePath, "runtime-path", "", "Path to ONNX Runtime shared library (default: use ONNXRUNTIME_LIB_PATH env var)")
+	rootCmd.PersistentFlags().StringVar(&runtimePath, "runtime-path", "", "Path to ONNX Runtime shared library (default: use ONNXRUNTIME_LIB_PATH env var)")
 	rootCmd.Flags().StringVarP(&outputFormat, "output", "o", "values", "Output format: 'values' (space-separated), 'json', or 'json-pretty'")
 	rootCmd.Flags().BoolVarP(&batchMode, "batch", "b", false, "Process multiple lines as a batch (more efficient for multiple sentences)")
 
+	rootCmd.AddCommand(newJoinCommand())
+	rootCmd.AddCommand(newProjectCommand())
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/clems4ever/all-minilm-l6-v2-go/all_minilm_l6_v2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	projectMethod     string
+	projectDims       int
+	projectPerplexity float64
+	projectIterations int
+	projectSeed       int64
+	projectBatchSize  int
+	projectOutput     string
+)
+
+func newProjectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "project",
+		Short: "Project the embeddings of sentences to a few dimensions",
+		Long: `Embed the sentences read from stdin, one per line, and project the embeddings with PCA or t-SNE.
+
+PCA keeps --dims principal components, to shrink the embeddings or plot them. t-SNE places the sentences in 2D so that similar sentences end up close, to eyeball clusters. The output only depends on the input and the seed.`,
+		Args: cobra.NoArgs,
+		Run:  runProject,
+	}
+
+	cmd.Flags().StringVar(&projectMethod, "method", "pca", "Projection: 'pca' or 'tsne'")
+	cmd.Flags().IntVar(&projectDims, "dims", 2, "Number of principal components kept by PCA")
+	cmd.Flags().Float64Var(&projectPerplexity, "perplexity", all_minilm_l6_v2.DefaultPerplexity, "t-SNE perplexity, roughly the number of neighbors of each sentence")
+	cmd.Flags().IntVar(&projectIterations, "iterations", all_minilm_l6_v2.DefaultTSNEIterations, "Number of t-SNE iterations")
+	cmd.Flags().Int64Var(&projectSeed, "seed", 1, "Seed of the randomized PCA and of the t-SNE initialization")
+	cmd.Flags().IntVar(&projectBatchSize, "batch-size", all_minilm_l6_v2.DefaultCorpusBatchSize, "Number of sentences embedded at once")
+	cmd.Flags().StringVarP(&projectOutput, "output", "o", "csv", "Output format: 'csv' or 'json'")
+	return cmd
+}
+
+func runProject(cmd *cobra.Command, args []string) {
+	if projectMethod != "pca" && projectMethod != "tsne" {
+		fmt.Fprintf(os.Stderr, "Unknown projection '%s'\n", projectMethod)
+		os.Exit(1)
+	}
+	if projectBatchSize <= 0 {
+		fmt.Fprintf(os.Stderr, "Batch size must be positive\n")
+		os.Exit(1)
+	}
+
+	var sentences []string
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if trimmed := strings.TrimSpace(scanner.Text()); trimmed != "" {
+			sentences = append(sentences, trimmed)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(1)
+	}
+	if len(sentences) == 0 {
+		fmt.Fprintf(os.Stderr, "No input provided\n")
+		os.Exit(1)
+	}
+
+	var opts []all_minilm_l6_v2.ModelOption
+	if runtimePath != "" {
+		opts = append(opts, all_minilm_l6_v2.WithRuntimePath(runtimePath))
+	}
+
+	model, err := all_minilm_l6_v2.NewModel(opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize model: %v\n", err)
+		os.Exit(1)
+	}
+	defer model.Close()
+
+	embeddings := make([][]float32, 0, len(sentences))
+	for start := 0; start < len(sentences); start += projectBatchSize {
+		batch, err := model.ComputeBatch(sentences[start:min(start+projectBatchSize, len(sentences))], true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to compute batch embeddings: %v\n", err)
+			os.Exit(1)
+		}
+		embeddings = append(embeddings, batch...)
+	}
+
+	var coordinates [][]float32
+	if projectMethod == "pca" {
+		var pca *all_minilm_l6_v2.PCA
+		pca, err = all_minilm_l6_v2.FitPCA(embeddings, projectDims, all_minilm_l6_v2.WithPCASeed(projectSeed))
+		if err == nil {
+			coordinates, err = pca.TransformBatch(embeddings)
+		}
+	} else {
+		coordinates, err = all_minilm_l6_v2.TSNE(embeddings,
+			all_minilm_l6_v2.WithPerplexity(projectPerplexity),
+			all_minilm_l6_v2.WithTSNEIterations(projectIterations),
+			all_minilm_l6_v2.WithTSNESeed(projectSeed))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to project embeddings: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := outputProjection(sentences, coordinates); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func outputProjection(sentences []string, coordinates [][]float32) error {
+	if projectOutput == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		for i, sentence := range sentences {
+			row := map[string]any{"sentence": sentence, "coordinates": coordinates[i]}
+			if err := encoder.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	header := []string{"sentence"}
+	for d := range coordinates[0] {
+		header = append(header, "x"+strconv.Itoa(d+1))
+	}
+	writer.Write(header)
+	for i, sentence := range sentences {
+		record := []string{sentence}
+		for _, x := range coordinates[i] {
+			record = append(record, strconv.FormatFloat(float64(x), 'f', 6, 32))
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}